@@ -36,11 +36,23 @@ func Run() {
 	lib.Auth = auth
 	log.Debug().Msg("connected to auth server")
 
-	// Set up authentication
+	// Set up sign-up rules
+	lib.SignUpPolicy = lib.CreateNewSignUpPolicy()
+	log.Debug().Msg("loaded sign-up policy")
+
+	// Set up cloud storage
 	cloudStorage := lib.CreateNewStorage()
 	lib.CloudStorage = cloudStorage
 	log.Debug().Msg("connected to cloud storage")
 
+	// Set up ticket QR code signing
+	lib.TicketSigner = lib.CreateNewTicketSigner()
+	log.Debug().Str("activeKeyID", lib.TicketSigner.ActiveKeyID()).Msg("loaded ticket signing keys")
+
+	// Set up payments
+	lib.Payments = lib.CreateNewPaymentProvider()
+	log.Debug().Str("provider", lib.Payments.Name()).Msg("set up payment provider")
+
 	// Initialize all indices on the database
 	err := models.CreateTicketIndices(context.Background())
 	if err != nil {
@@ -60,6 +72,89 @@ func Run() {
 	}
 	log.Debug().Msg("created queued ticket indices")
 
+	err = models.CreateTicketScanIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up ticket scan indices")
+	}
+	log.Debug().Msg("created ticket scan indices")
+
+	err = models.CreateScanStationIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up scan station indices")
+	}
+	log.Debug().Msg("created scan station indices")
+
+	err = models.CreateTicketTransferIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up ticket transfer indices")
+	}
+	log.Debug().Msg("created ticket transfer indices")
+
+	err = models.CreateWaitlistIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up waitlist indices")
+	}
+	log.Debug().Msg("created waitlist indices")
+
+	err = models.CreateOrderIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up order indices")
+	}
+	log.Debug().Msg("created order indices")
+
+	err = models.CreatePaymentIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up payment indices")
+	}
+	log.Debug().Msg("created payment indices")
+
+	err = models.CreateRefundIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up refund indices")
+	}
+	log.Debug().Msg("created refund indices")
+
+	err = models.CreatePromoCodeIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up promo code indices")
+	}
+	log.Debug().Msg("created promo code indices")
+
+	err = models.CreatePromoRedemptionIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up promo redemption indices")
+	}
+	log.Debug().Msg("created promo redemption indices")
+
+	err = models.CreateSeatingGroupIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up seating group indices")
+	}
+	log.Debug().Msg("created seating group indices")
+
+	err = models.CreateRoleChangeIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up role change indices")
+	}
+	log.Debug().Msg("created role change indices")
+
+	err = models.CreateEventStaffIndices(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not set up event staff indices")
+	}
+	log.Debug().Msg("created event staff indices")
+
+	// Start background jobs
+	go runOrderExpiryJob(context.Background())
+	if interval := getRoleReconcileInterval(); interval > 0 {
+		source := os.Getenv("ROLE_RECONCILE_REPAIR")
+		if source != "" && source != models.RoleSourceClaims && source != models.RoleSourceDatabase {
+			log.Fatal().Str("source", source).Msg("ROLE_RECONCILE_REPAIR must be 'claims', 'database', or empty")
+		}
+		go runRoleReconcileJob(context.Background(), interval, source)
+		log.Debug().Dur("interval", interval).Str("source", source).Msg("started role reconcile job")
+	}
+
 	// Set up server
 	s := config.CreateNewServer()
 	s.MountHandlers()
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/controllers"
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// How often unpaid orders are checked for expiry
+const orderExpiryInterval = time.Minute
+
+// runOrderExpiryJob periodically expires orders that weren't paid in time, closing their
+// checkouts and giving their spots to anyone on the waitlist. Meant to be run in a goroutine.
+func runOrderExpiryJob(ctx context.Context) {
+	ticker := time.NewTicker(orderExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expireStaleOrders(ctx)
+		}
+	}
+}
+
+func expireStaleOrders(ctx context.Context) {
+	expired, err := models.ExpireStaleOrders(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("could not expire stale orders")
+	}
+
+	for _, order := range expired {
+		// Stop the checkout from being paid, not much we can do if it fails
+		if order.CheckoutSessionID != "" {
+			if err := lib.Payments.ExpireCheckout(ctx, order.CheckoutSessionID); err != nil {
+				log.Warn().Err(err).Str("order_id", order.ID.Hex()).Msg("could not expire checkout session")
+			}
+		}
+
+		log.Info().
+			Str("type", "audit").
+			Str("controller", "order").
+			Str("requester_uid", "").
+			Str("order_id", order.ID.Hex()).
+			Str("action", "expireOrder").
+			Bool("privileged", true).
+			Msg("expired unpaid order")
+
+		// Spot is free again
+		event, err := models.GetEvent(ctx, bson.M{"_id": order.EventID})
+		if err != nil {
+			log.Error().Err(err).Str("eventId", order.EventID.Hex()).Msg("could not fetch event of expired order")
+			continue
+		}
+		tier, ok := event.GetTicketTier(order.TierID)
+		if !ok {
+			log.Error().Str("eventId", order.EventID.Hex()).Str("tierId", order.TierID.Hex()).Msg("could not find tier of expired order")
+			continue
+		}
+		controllers.PromoteFromWaitlist(ctx, order.EventID, order.TierID, tier.MaxScanCount, "")
+	}
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/rs/zerolog/log"
+)
+
+// getRoleReconcileInterval gets how often roles are compared from ROLE_RECONCILE_INTERVAL_MINUTES.
+// The job is turned off if it isn't set.
+func getRoleReconcileInterval() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("ROLE_RECONCILE_INTERVAL_MINUTES"))
+	if err != nil || minutes <= 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// runRoleReconcileJob periodically compares everyone's role in their auth claims against their
+// user document. Mismatches are logged, and fixed if ROLE_RECONCILE_REPAIR says which store to
+// trust. Meant to be run in a goroutine.
+func runRoleReconcileJob(ctx context.Context, interval time.Duration, source string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reconcileRoles(ctx, source)
+		}
+	}
+}
+
+func reconcileRoles(ctx context.Context, source string) {
+	drifts, err := models.FindRoleDrift(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("could not compare roles")
+		return
+	}
+
+	for _, drift := range drifts {
+		log.Warn().Any("drift", drift).Msg("role in auth claims does not match user data")
+		if source == "" || !drift.Repairable() {
+			continue
+		}
+
+		change, err := models.RepairRoleDrift(ctx, drift, source, "job:reconcile_roles")
+		if err != nil && change.UserID == "" {
+			log.Error().Err(err).Str("uid", drift.UserID).Msg("could not fix mismatched role")
+			continue
+		} else if err != nil {
+			log.Error().Err(err).Any("change", change).Msg("fixed mismatched role but could not record it")
+		}
+
+		log.Info().
+			Str("type", "audit").
+			Str("controller", "admin").
+			Str("requester_uid", "").
+			Str("given_uid", drift.UserID).
+			Str("previous_role", string(change.PreviousRole)).
+			Str("new_role", string(change.NewRole)).
+			Str("source", source).
+			Str("action", "reconcileUserRole").
+			Bool("privileged", true).
+			Msg("fixed mismatched role")
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	fullNameFormatFirstLast = "first_last" // Ex. "John Smith", used as is
+	fullNameFormatLastFirst = "last_first" // Ex. "Smith, John", flipped to "John Smith"
+)
+
+// importConfig maps the columns of a CSV onto tickets for an event. Columns are referred
+// to by their header name.
+type importConfig struct {
+	EventID             string `json:"eventID"             yaml:"eventID"`
+	TierID              string `json:"tierID"              yaml:"tierID"`              // Tier to use when there's no tier column, leave empty if event doesn't use tiers
+	DefaultMaxScanCount int    `json:"defaultMaxScanCount" yaml:"defaultMaxScanCount"` // Used when there's no max scan count column or it's empty
+	UpdateFullNames     bool   `json:"updateFullNames"     yaml:"updateFullNames"`     // Also apply names to students who already have an account
+	Columns             struct {
+		StudentNumber  string `json:"studentNumber"  yaml:"studentNumber"`
+		FullName       string `json:"fullName"       yaml:"fullName"`
+		FullNameFormat string `json:"fullNameFormat" yaml:"fullNameFormat"` // Either "first_last" or "last_first", defaults to "first_last"
+		TierID         string `json:"tierID"         yaml:"tierID"`
+		MaxScanCount   string `json:"maxScanCount"   yaml:"maxScanCount"`
+	} `json:"columns" yaml:"columns"`
+	CustomFields map[string]string `json:"customFields" yaml:"customFields"` // Custom field name -> column
+}
+
+// importReportRow is what happened to one row of the CSV.
+type importReportRow struct {
+	Line           int    `json:"line"` // Line in the CSV, the header is line 1
+	StudentNumber  string `json:"studentNumber"`
+	Status         string `json:"status"`
+	TicketID       string `json:"ticketID,omitempty"`
+	QueuedTicketID string `json:"queuedTicketID,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// importReport is written after every batch so that an interrupted import can be resumed.
+type importReport struct {
+	EventID    string            `json:"eventID"`
+	CSVFile    string            `json:"csvFile"`
+	DryRun     bool              `json:"dryRun"`
+	StartTime  time.Time         `json:"startTime"`
+	EndTime    time.Time         `json:"endTime"`
+	Finished   bool              `json:"finished"`
+	Created    int               `json:"created"`
+	Queued     int               `json:"queued"`
+	Failed     int               `json:"failed"`
+	Skipped    int               `json:"skipped"` // Already done in the report being resumed from
+	Rows       []importReportRow `json:"rows"`
+	reportPath string
+}
+
+// pendingRow is a CSV row waiting to be sent off with the rest of its batch.
+type pendingRow struct {
+	line int
+	row  models.BulkTicketRow
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s -config [MAPPING FILE] [CSV FILENAME]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func loadConfig(filename string) (importConfig, error) {
+	var config importConfig
+
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &config)
+	case ".json":
+		err = json.Unmarshal(raw, &config)
+	default:
+		err = fmt.Errorf("config file must be .yaml, .yml, or .json")
+	}
+
+	return config, err
+}
+
+func loadReport(filename string) (importReport, error) {
+	var report importReport
+
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return report, err
+	}
+	err = json.Unmarshal(raw, &report)
+	return report, err
+}
+
+func (report *importReport) save() {
+	report.EndTime = time.Now()
+
+	raw, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not encode report")
+	}
+	if err := os.WriteFile(report.reportPath, raw, 0644); err != nil {
+		log.Fatal().Err(err).Str("path", report.reportPath).Msg("could not write report")
+	}
+}
+
+func (report *importReport) addRow(row importReportRow) {
+	switch row.Status {
+	case models.BulkTicketRowCreated:
+		report.Created++
+	case models.BulkTicketRowQueued:
+		report.Queued++
+	default:
+		report.Failed++
+	}
+	report.Rows = append(report.Rows, row)
+}
+
+// getColumnIndex finds a column by its header name, returning -1 if the column isn't mapped.
+func getColumnIndex(header []string, col string) int {
+	if col == "" {
+		return -1
+	}
+	for i, headerCol := range header {
+		if headerCol == col {
+			return i
+		}
+	}
+	log.Fatal().Str("column", col).Msg("column in config does not exist in csv")
+	return -1
+}
+
+// parseFullName puts a name from the CSV into "First Last" order.
+func parseFullName(rawFullName string, format string) (string, error) {
+	// Remove any quotation marks
+	rawFullName = strings.TrimSpace(strings.ReplaceAll(rawFullName, "\"", ""))
+	if rawFullName == "" || format != fullNameFormatLastFirst {
+		return rawFullName, nil
+	}
+
+	// Switch order of first and last name
+	nameSplit := strings.Split(rawFullName, ", ")
+	if len(nameSplit) != 2 {
+		return "", fmt.Errorf("expected exactly one comma in name: %s", rawFullName)
+	}
+	return fmt.Sprintf("%s %s", nameSplit[1], nameSplit[0]), nil
+}
+
+func main() {
+	// Just assume we're running in dev
+	godotenv.Load(".env.development")
+
+	configFilename := flag.String("config", "", "YAML or JSON file mapping CSV columns onto tickets (required)")
+	reportFilename := flag.String("report", "import_report.json", "where to write the result report")
+	resumeFilename := flag.String("resume", "", "report from an earlier import to resume, rows that already succeeded are skipped")
+	dryRun := flag.Bool("dry-run", false, "check every row without creating anything")
+	batchSize := flag.Int("batch-size", 100, "rows to create between report saves, dry runs check every row at once")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 || *configFilename == "" {
+		usage()
+	}
+	csvFilename := args[0]
+	if *batchSize < 1 {
+		log.Fatal().Msg("batch size must be at least 1")
+	}
+
+	config, err := loadConfig(*configFilename)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not load config")
+	}
+	if config.Columns.StudentNumber == "" {
+		log.Fatal().Msg("config needs a student number column")
+	}
+	if config.Columns.FullNameFormat == "" {
+		config.Columns.FullNameFormat = fullNameFormatFirstLast
+	}
+	if config.Columns.FullNameFormat != fullNameFormatFirstLast && config.Columns.FullNameFormat != fullNameFormatLastFirst {
+		log.Fatal().Str("format", config.Columns.FullNameFormat).Msg("full name format must be 'first_last' or 'last_first'")
+	}
+	if config.DefaultMaxScanCount < 0 {
+		log.Fatal().Msg("default max scan count below 0")
+	}
+
+	// Create new auth & DB refs
+	lib.Auth = lib.CreateNewAuth()
+	lib.Datastore = lib.CreateNewDB()
+	lib.Datastore.Connect()
+	defer lib.Datastore.Disconnect()
+
+	ctx := context.Background()
+
+	// Start logging
+	util.ConfigureZeroLog()
+
+	// Start working with config
+	eventID, err := primitive.ObjectIDFromHex(config.EventID)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not parse event id")
+	}
+	event, err := models.GetEvent(ctx, bson.M{"_id": eventID})
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not fetch event")
+	}
+
+	defaultTierID := primitive.NilObjectID
+	if config.TierID != "" {
+		defaultTierID, err = primitive.ObjectIDFromHex(config.TierID)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not parse tier id")
+		}
+		if _, ok := event.GetTicketTier(defaultTierID); !ok {
+			log.Fatal().Str("tierID", config.TierID).Msg("tier does not exist for event")
+		}
+	}
+
+	// Custom fields have to be in the event's schema, otherwise they'd be silently dropped or rejected
+	schemaProperties, _ := event.RawCustomFieldsSchema["properties"].(map[string]interface{})
+	for field := range config.CustomFields {
+		if _, ok := schemaProperties[field]; !ok {
+			log.Fatal().Str("field", field).Msg("custom field in config is not in event's schema")
+		}
+	}
+
+	// Rows that were already done in an earlier run don't need to be done again
+	report := importReport{
+		EventID:    config.EventID,
+		CSVFile:    csvFilename,
+		DryRun:     *dryRun,
+		StartTime:  time.Now(),
+		Rows:       []importReportRow{},
+		reportPath: *reportFilename,
+	}
+	doneStudentNumbers := map[string]bool{}
+	if *resumeFilename != "" {
+		prevReport, err := loadReport(*resumeFilename)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not load report to resume")
+		}
+		if prevReport.DryRun {
+			log.Fatal().Msg("can't resume from a dry run")
+		}
+		if prevReport.EventID != config.EventID {
+			log.Fatal().Str("reportEventID", prevReport.EventID).Msg("report to resume is for a different event")
+		}
+
+		for _, row := range prevReport.Rows {
+			if row.Status == models.BulkTicketRowCreated || row.Status == models.BulkTicketRowQueued {
+				doneStudentNumbers[row.StudentNumber] = true
+				report.addRow(row)
+			}
+		}
+	}
+
+	f, err := os.Open(csvFilename)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not open csv")
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+
+	// Read first line to find the mapped columns
+	header, err := csvReader.Read()
+	if err != nil {
+		if err == io.EOF {
+			log.Fatal().Msg("csv is empty")
+		} else {
+			log.Fatal().Err(err).Msg("could not parse csv")
+		}
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	studentNumberColNum := getColumnIndex(header, config.Columns.StudentNumber)
+	fullNameColNum := getColumnIndex(header, config.Columns.FullName)
+	tierIDColNum := getColumnIndex(header, config.Columns.TierID)
+	maxScanCountColNum := getColumnIndex(header, config.Columns.MaxScanCount)
+	customFieldColNums := map[string]int{}
+	for field, col := range config.CustomFields {
+		customFieldColNums[field] = getColumnIndex(header, col)
+	}
+
+	opts := models.BulkTicketOptions{
+		DryRun:          *dryRun,
+		UpdateFullNames: config.UpdateFullNames,
+	}
+
+	// Send off rows in batches, saving the report after each so progress isn't lost
+	batch := []pendingRow{}
+	flushBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		rows := make([]models.BulkTicketRow, len(batch))
+		for i, pending := range batch {
+			rows[i] = pending.row
+		}
+
+		result, err := models.CreateBulkTickets(ctx, eventID, rows, opts)
+		if err != nil {
+			report.save()
+			log.Fatal().Err(err).Msg("could not create tickets")
+		}
+
+		for _, rowResult := range result.Rows {
+			report.addRow(importReportRow{
+				Line:           batch[rowResult.Row-1].line,
+				StudentNumber:  rowResult.StudentNumber,
+				Status:         rowResult.Status,
+				TicketID:       rowResult.TicketID,
+				QueuedTicketID: rowResult.QueuedTicketID,
+				Error:          rowResult.Error,
+			})
+		}
+		report.save()
+		log.Info().Int("created", report.Created).Int("queued", report.Queued).Int("failed", report.Failed).Msg("finished batch")
+
+		batch = []pendingRow{}
+	}
+
+	seenStudentNumbers := map[string]int{}
+	for line := 2; ; line++ {
+		rec, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			report.save()
+			log.Fatal().Err(err).Int("line", line).Msg("could not parse csv")
+		}
+
+		studentNumber := strings.TrimSpace(rec[studentNumberColNum])
+		if doneStudentNumbers[studentNumber] {
+			report.Skipped++
+			continue
+		}
+
+		// Batches only catch repeats within themselves, so catch the rest here
+		if firstLine, ok := seenStudentNumbers[studentNumber]; ok && studentNumber != "" {
+			report.addRow(importReportRow{
+				Line:          line,
+				StudentNumber: studentNumber,
+				Status:        models.BulkTicketRowFailed,
+				Error:         fmt.Sprintf("same student number as line %d", firstLine),
+			})
+			continue
+		}
+		seenStudentNumbers[studentNumber] = line
+
+		// Anything that can't be parsed fails the row without stopping the import
+		row, err := func() (models.BulkTicketRow, error) {
+			row := models.BulkTicketRow{
+				StudentNumber: studentNumber,
+				TierID:        defaultTierID,
+				MaxScanCount:  config.DefaultMaxScanCount,
+			}
+
+			if fullNameColNum != -1 {
+				fullName, err := parseFullName(rec[fullNameColNum], config.Columns.FullNameFormat)
+				if err != nil {
+					return row, err
+				}
+				row.FullName = fullName
+			}
+
+			if tierIDColNum != -1 && strings.TrimSpace(rec[tierIDColNum]) != "" {
+				tierID, err := primitive.ObjectIDFromHex(strings.TrimSpace(rec[tierIDColNum]))
+				if err != nil {
+					return row, fmt.Errorf("could not parse tier id: %s", rec[tierIDColNum])
+				}
+				row.TierID = tierID
+			}
+
+			if maxScanCountColNum != -1 && strings.TrimSpace(rec[maxScanCountColNum]) != "" {
+				maxScanCount, err := strconv.Atoi(strings.TrimSpace(rec[maxScanCountColNum]))
+				if err != nil {
+					return row, fmt.Errorf("could not parse max scan count: %s", rec[maxScanCountColNum])
+				}
+				row.MaxScanCount = maxScanCount
+			}
+
+			// Values are converted to the types in the event's schema
+			rawCustomFields := map[string]string{}
+			for field, colNum := range customFieldColNums {
+				rawCustomFields[field] = strings.ReplaceAll(rec[colNum], "\"", "")
+			}
+			row.CustomFields = models.ParseCustomEventFields(event, rawCustomFields)
+
+			return row, nil
+		}()
+		if err != nil {
+			log.Error().Err(err).Int("line", line).Msg("could not parse row")
+			report.addRow(importReportRow{
+				Line:          line,
+				StudentNumber: studentNumber,
+				Status:        models.BulkTicketRowFailed,
+				Error:         err.Error(),
+			})
+			continue
+		}
+
+		// Dry runs count free spots from the database each time they're called without saving
+		// anything, so the whole file has to be checked at once to count earlier rows too
+		batch = append(batch, pendingRow{line: line, row: row})
+		if !*dryRun && len(batch) >= *batchSize {
+			flushBatch()
+		}
+	}
+	flushBatch()
+
+	report.Finished = true
+	report.save()
+
+	if report.DryRun {
+		fmt.Println("dry run, nothing was created")
+	}
+	fmt.Printf("finished import in %d ms\n", report.EndTime.Sub(report.StartTime).Milliseconds())
+	fmt.Printf("tickets created: %d\n", report.Created)
+	fmt.Printf("queued tickets created (will be added once user signs up): %d\n", report.Queued)
+	fmt.Printf("failed rows: %d\n", report.Failed)
+	fmt.Printf("skipped rows (already done in resumed report): %d\n", report.Skipped)
+	fmt.Printf("report written to %s\n", report.reportPath)
+}
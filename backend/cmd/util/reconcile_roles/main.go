@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/joho/godotenv"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [--repair=claims/database] [--dry-run=true/false]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// roleName makes empty roles readable in the report
+func roleName(role string) string {
+	if role == "" {
+		return "none"
+	}
+	return role
+}
+
+func main() {
+	// Just assume we're running in dev
+	godotenv.Load(".env.development")
+
+	flag.Usage = usage
+	repairPtr := flag.String("repair", "", "store to trust when fixing mismatches, either 'claims' or 'database'. Leave empty to only report them")
+	dryRunPtr := flag.Bool("dry-run", true, "whether to only show what would be fixed without changing anything")
+	flag.Parse()
+
+	if *repairPtr != "" && *repairPtr != models.RoleSourceClaims && *repairPtr != models.RoleSourceDatabase {
+		fmt.Fprintf(os.Stderr, "repair must be either '%s' or '%s'\n", models.RoleSourceClaims, models.RoleSourceDatabase)
+		os.Exit(1)
+	}
+
+	// Create new auth & DB refs
+	lib.Auth = lib.CreateNewAuth()
+	lib.Datastore = lib.CreateNewDB()
+	lib.Datastore.Connect()
+	defer lib.Datastore.Disconnect()
+
+	// Find everyone whose role doesn't match
+	fmt.Println("comparing auth claims against user data in mongodb")
+	drifts, err := models.FindRoleDrift(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "err while finding mismatched roles: %v\n", err)
+		os.Exit(3)
+	}
+	if len(drifts) == 0 {
+		fmt.Println("all roles match")
+		return
+	}
+
+	// Report mismatches
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "UID\tNAME\tSTUDENT #\tCLAIMS ROLE\tDATABASE ROLE\tNOTE")
+	for _, drift := range drifts {
+		note := ""
+		if drift.MissingAuth {
+			note = "no auth account"
+		} else if drift.MissingUserDoc {
+			note = "no user document"
+		}
+		fmt.Fprintf(
+			table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			drift.UserID, drift.FullName, drift.StudentNumber,
+			roleName(string(drift.ClaimsRole)), roleName(string(drift.DatabaseRole)), note,
+		)
+	}
+	table.Flush()
+	fmt.Printf("found %d mismatched roles\n", len(drifts))
+
+	if *repairPtr == "" {
+		return
+	}
+	if *dryRunPtr {
+		fmt.Printf("dry run, not copying roles from %s. re-run with --dry-run=false to fix them\n", *repairPtr)
+		return
+	}
+
+	// Copy roles over from the trusted store
+	target := "database"
+	if *repairPtr == models.RoleSourceDatabase {
+		target = "claims"
+	}
+	failed := 0
+	for _, drift := range drifts {
+		if !drift.Repairable() {
+			fmt.Printf("skipping %s since it can't be fixed automatically\n", drift.UserID)
+			continue
+		}
+
+		change, err := models.RepairRoleDrift(context.Background(), drift, *repairPtr, "cli:reconcile_roles")
+		if err != nil && change.UserID == "" {
+			fmt.Fprintf(os.Stderr, "err while fixing role of %s: %v\n", drift.UserID, err)
+			failed++
+			continue
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "fixed role of %s, but err while recording change: %v\n", drift.UserID, err)
+		}
+		fmt.Printf("set role of %s to '%s' in %s\n", drift.UserID, roleName(string(change.NewRole)), target)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "could not fix %d roles\n", failed)
+		os.Exit(3)
+	}
+}
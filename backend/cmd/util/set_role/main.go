@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/joho/godotenv"
+)
+
+// Roles should normally be changed through the /admins endpoints. This is for giving out the
+// first superadmin role, or fixing things when no superadmin can sign in.
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [--role=superadmin/admin/scanner/none] [--uid] [--reason] [student # or uid]\n", os.Args[0])
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	// Just assume we're running in dev
+	godotenv.Load(".env.development")
+
+	flag.Usage = usage
+	rolePtr := flag.String("role", string(util.RoleAdmin), "role to give the user, or 'none' to take their role away")
+	uidPtr := flag.Bool("uid", false, "whether the user is given by uid instead of student number")
+	reasonPtr := flag.String("reason", "", "why the role is being changed, kept in the role change history")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "student number or uid of user is missing\n")
+		os.Exit(1)
+	}
+
+	role := util.Role(*rolePtr)
+	if *rolePtr == "none" {
+		role = util.RoleNone
+	}
+	if !role.IsValid() {
+		fmt.Fprintf(os.Stderr, "unknown role: %s\n", *rolePtr)
+		os.Exit(1)
+	}
+
+	// Create new auth & DB refs
+	lib.Auth = lib.CreateNewAuth()
+	lib.Datastore = lib.CreateNewDB()
+	lib.Datastore.Connect()
+	defer lib.Datastore.Disconnect()
+
+	// Get user from student number or uid
+	key := "student_number"
+	if *uidPtr {
+		key = "_id"
+	}
+	user, err := models.GetUserByKey(context.Background(), key, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "err while finding user: %v\n", err)
+		os.Exit(3)
+	}
+
+	userSummary := fmt.Sprintf("user %s (student # %s, uid %s)", user.FullName, user.StudentNumber, user.ID)
+
+	// Update claims & user data together
+	fmt.Printf("changing role of %s\n", userSummary)
+	change, err := models.SetUserRole(context.Background(), user.ID, role, "cli:set_role", *reasonPtr)
+	if err != nil && change.UserID == "" {
+		fmt.Fprintf(os.Stderr, "err while changing role: %v\n", err)
+		os.Exit(3)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "role was changed, but err while recording change: %v\n", err)
+	}
+	if !change.TokensRevoked {
+		fmt.Fprintf(os.Stderr, "could not revoke sign-in, old role lasts until their token expires\n")
+	}
+
+	fmt.Printf("%s successfully changed from role '%s' to '%s'\n", userSummary, change.PreviousRole, change.NewRole)
+}
@@ -49,6 +49,7 @@ func (s *Server) MountHandlers() {
 		AllowedOrigins: []string{"https://*", "http://*"}, // !! CHANGE THIS LATER
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
 		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "sentry-trace", "baggage"},
+		ExposedHeaders: []string{"X-Total-Count"},
 	}))
 	s.Router.Use(httprate.LimitByRealIP(100, 1*time.Second))
 	s.Router.Use(render.SetContentType(render.ContentTypeJSON))
@@ -66,4 +67,10 @@ func (s *Server) MountHandlers() {
 	s.Router.Mount("/events", controllers.EventController{}.Routes())
 	s.Router.Mount("/tickets", controllers.TicketController{}.Routes())
 	s.Router.Mount("/queuedtickets", controllers.QueuedTicketController{}.Routes())
+	s.Router.Mount("/scanstations", controllers.ScanStationController{}.Routes())
+	s.Router.Mount("/transfers", controllers.TicketTransferController{}.Routes())
+	s.Router.Mount("/waitlist", controllers.WaitlistController{}.Routes())
+	s.Router.Mount("/orders", controllers.OrderController{}.Routes())
+	s.Router.Mount("/promocodes", controllers.PromoCodeController{}.Routes())
+	s.Router.Mount("/admins", controllers.AdminController{}.Routes())
 }
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aritrosaha10/frasertickets/middleware"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type adminControllerSetRoleRequestBody struct {
+	Role   string `json:"role"   validate:"required"`
+	Reason string `json:"reason"`
+}
+
+type AdminController struct{}
+
+func (ctrl AdminController) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthenticatorMiddleware) // User must be authenticated before using any of these endpoints
+
+	// Superadmin-only routes
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(util.PermissionAdminsManage))
+		r.Get("/", ctrl.List)               // GET /admins - returns every user with a role, requires admins:manage
+		r.Get("/changes", ctrl.ListChanges) // GET /admins/changes - returns the history of role changes, requires admins:manage
+		r.Put("/{uid}", ctrl.SetRole)       // PUT /admins/{uid} - gives a user a role, requires admins:manage
+		r.Delete("/{uid}", ctrl.RemoveRole) // DELETE /admins/{uid} - takes away a user's role, requires admins:manage
+	})
+
+	return r
+}
+
+// changeUserRole runs a role change for the user in the URL, rendering the result or an error.
+func changeUserRole(w http.ResponseWriter, r *http.Request, role util.Role, reason string) {
+	uid := chi.URLParam(r, "uid")
+
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Stops the last superadmin from locking everyone out by accident
+	if uid == token.UID {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("you can't change your own role")))
+		return
+	}
+
+	// Try to change their role
+	change, err := models.SetUserRole(r.Context(), uid, role, token.UID, reason)
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err == models.ErrRoleUnchanged {
+		render.Render(w, r, util.ErrConflict(err))
+		return
+	} else if err != nil && change.UserID == "" {
+		log.Error().Err(err).Str("uid", uid).Str("role", string(role)).Msg("could not change user's role")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	} else if err != nil {
+		// The change went through, it just couldn't be saved to the history
+		log.Error().Err(err).Any("change", change).Msg("changed user's role but could not record it")
+	}
+	if !change.TokensRevoked {
+		log.Warn().Str("uid", uid).Msg("could not revoke refresh tokens after role change, old role lasts until token expiry")
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &change); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "admin").
+		Str("requester_uid", token.UID).
+		Str("given_uid", uid).
+		Str("previous_role", string(change.PreviousRole)).
+		Str("new_role", string(change.NewRole)).
+		Str("reason", reason).
+		Str("action", "setUserRole").
+		Bool("privileged", true).
+		Msg("changed a user's role")
+}
+
+// List fetches every user with a role.
+//
+//	@Summary		List admins
+//	@Description	List every user that has a role, including users who were made admins before roles existed. Only available to superadmins.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	[]models.User
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/admins [get]
+func (ctrl AdminController) List(w http.ResponseWriter, r *http.Request) {
+	users, err := models.GetStaffUsers(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch staff users")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	list := []render.Renderer{}
+	for _, user := range users {
+		u := user // Duplicate it before passing by reference to avoid only passing the last user obj
+		list = append(list, &u)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, list); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "admin").
+		Str("requester_uid", requesterUID).
+		Str("action", "listAdmins").
+		Bool("privileged", true).
+		Msg("fetched all admins")
+}
+
+// ListChanges fetches the history of role changes.
+//
+//	@Summary		List role changes
+//	@Description	List every change made to users' roles, newest first. The total number of changes is given in the X-Total-Count header. Only available to superadmins.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			uid			query		string	false	"Only list changes made to this user"
+//	@Param			page		query		int		false	"Page number, starting from 1"
+//	@Param			pageSize	query		int		false	"Number of changes per page"
+//	@Success		200			{object}	[]models.RoleChange
+//	@Failure		400
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/admins/changes [get]
+func (ctrl AdminController) ListChanges(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := util.GetPaginationFromQuery(r)
+	if err != nil {
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	filter := bson.M{}
+	uid := r.URL.Query().Get("uid")
+	if uid != "" {
+		filter["user"] = uid
+	}
+
+	// Fetch page of changes
+	changes, total, err := models.GetRoleChanges(r.Context(), filter, page, pageSize)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch role changes")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, change := range changes {
+		c := change // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &c)
+	}
+
+	// Return as JSON array, fallback if it fails
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "admin").
+		Str("requester_uid", requesterUID).
+		Str("given_uid", uid).
+		Int64("page", page).
+		Str("action", "listRoleChanges").
+		Bool("privileged", true).
+		Msg("listed role changes")
+}
+
+// SetRole gives a user a role.
+//
+//	@Summary		Give user a role
+//	@Description	Give a user a role, such as "admin", "scanner", or "superadmin". Their sign-in is revoked so the new role takes effect right away, and the change is added to the role change history. You can't change your own role. Only available to superadmins.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			uid		path		string								true	"User ID"
+//	@Param			role	body		adminControllerSetRoleRequestBody	true	"Role to give and why"
+//	@Success		200		{object}	models.RoleChange
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/admins/{uid} [put]
+func (ctrl AdminController) SetRole(w http.ResponseWriter, r *http.Request) {
+	var body adminControllerSetRoleRequestBody
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&body)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(body)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Taking away roles goes through DELETE instead
+	role := util.Role(body.Role)
+	if role == util.RoleNone || !role.IsValid() {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("unknown role: %s", body.Role)))
+		return
+	}
+
+	changeUserRole(w, r, role, body.Reason)
+}
+
+// RemoveRole takes away a user's role.
+//
+//	@Summary		Take away user's role
+//	@Description	Take away a user's role, making them a regular user again. Their sign-in is revoked so the change takes effect right away, and the change is added to the role change history. You can't change your own role. Only available to superadmins.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			uid		path		string	true	"User ID"
+//	@Param			reason	query		string	false	"Why their role is being taken away"
+//	@Success		200		{object}	models.RoleChange
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/admins/{uid} [delete]
+func (ctrl AdminController) RemoveRole(w http.ResponseWriter, r *http.Request) {
+	changeUserRole(w, r, util.RoleNone, r.URL.Query().Get("reason"))
+}
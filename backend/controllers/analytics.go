@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Defaults for attendance analytics when they aren't given in the query
+const (
+	defaultAnalyticsBucketMinutes       = 15
+	defaultAnalyticsStudentNumberPrefix = 2
+)
+
+// getIntFromQuery parses an integer query param, using the fallback if it isn't given.
+func getIntFromQuery(r *http.Request, key string, fallback int, min int, max int) (int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("%s must be a whole number from %d to %d", key, min, max)
+	}
+	return value, nil
+}
+
+// GetAnalytics fetches attendance analytics for an event.
+//
+//	@Summary		Get attendance analytics for event
+//	@Description	Get an event's arrival curve, no-show and re-entry counts, and attendance broken down by grade and by custom field. Grades come from a custom field if gradeField is given, otherwise from the first digits of each student number. Custom fields with a fixed set of answers are broken down unless fields is given. Voided tickets aren't counted. Only available to admins, and the event's viewers and managers.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id					path		string	true	"Event ID"
+//	@Param			bucketMinutes		query		int		false	"Length of each slice of the arrival curve in minutes, defaults to 15"
+//	@Param			gradeField			query		string	false	"Custom field holding each student's grade"
+//	@Param			studentNumberPrefix	query		int		false	"How many leading digits of a student number decide their grade, defaults to 2"
+//	@Param			fields				query		string	false	"Comma-separated custom fields to break down"
+//	@Success		200					{object}	models.EventAttendanceAnalytics
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/analytics [get]
+func (ctrl EventController) GetAnalytics(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to fetch from DB
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not find event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Parse options from query
+	opts := models.AttendanceAnalyticsOptions{
+		GradeField:   r.URL.Query().Get("gradeField"),
+		CustomFields: models.GetBreakdownCustomFields(event),
+	}
+	opts.BucketMinutes, err = getIntFromQuery(r, "bucketMinutes", defaultAnalyticsBucketMinutes, 1, 24*60)
+	if err != nil {
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+	opts.StudentNumberPrefixLength, err = getIntFromQuery(r, "studentNumberPrefix", defaultAnalyticsStudentNumberPrefix, 1, 20)
+	if err != nil {
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+	if rawFields := r.URL.Query().Get("fields"); rawFields != "" {
+		opts.CustomFields = []string{}
+		for _, field := range strings.Split(rawFields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				opts.CustomFields = append(opts.CustomFields, field)
+			}
+		}
+	}
+
+	// Only fields from the schema can be used, since they're put straight into the pipeline
+	properties, _ := event.RawCustomFieldsSchema["properties"].(map[string]interface{})
+	for _, field := range append([]string{opts.GradeField}, opts.CustomFields...) {
+		if _, ok := properties[field]; field != "" && !ok {
+			render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("custom field does not exist for event: %s", field)))
+			return
+		}
+	}
+
+	// Try to work out analytics
+	analytics, err := models.GetEventAttendanceAnalytics(r.Context(), event, opts)
+	if err != nil {
+		log.Error().Err(err).Str("eventId", eventID.Hex()).Msg("could not get attendance analytics")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &analytics); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "getEventAnalytics").
+		Str("eventId", eventID.Hex()).
+		Bool("privileged", true).
+		Msg("fetched attendance analytics for event")
+}
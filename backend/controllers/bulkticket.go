@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxBulkTicketRows is the most tickets that can be made in one bulk request.
+const maxBulkTicketRows = 2000
+
+type eventControllerBulkTicketRow struct {
+	StudentNumber string                 `json:"studentNumber"`
+	FullName      string                 `json:"fullName"`
+	TierID        string                 `json:"tierID"       validate:"omitempty,mongodb"` // Leave empty if event doesn't use tiers
+	MaxScanCount  int                    `json:"maxScanCount"`                              // Defaults to tier's max scan count if 0 and a tier is given
+	CustomFields  map[string]interface{} `json:"customFields"`
+}
+
+type eventControllerBulkCreateTicketsRequestBody struct {
+	Rows   []eventControllerBulkTicketRow `json:"rows"   validate:"required,dive"`
+	DryRun bool                           `json:"dryRun"`
+}
+
+// Columns in a bulk CSV that aren't custom fields
+const (
+	bulkTicketCSVStudentNumberCol = "studentNumber"
+	bulkTicketCSVFullNameCol      = "fullName"
+	bulkTicketCSVTierIDCol        = "tierID"
+	bulkTicketCSVMaxScanCountCol  = "maxScanCount"
+)
+
+// parseBulkTicketCSV reads bulk ticket rows from a CSV with a header row. The studentNumber
+// column is required, fullName, tierID and maxScanCount are optional, and every other column
+// is treated as a custom field.
+func parseBulkTicketCSV(r io.Reader, event models.Event) ([]models.BulkTicketRow, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv is empty")
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	studentNumberColNum := -1
+	for i, col := range header {
+		if col == bulkTicketCSVStudentNumberCol {
+			studentNumberColNum = i
+		}
+	}
+	if studentNumberColNum == -1 {
+		return nil, fmt.Errorf("csv has no %s column", bulkTicketCSVStudentNumberCol)
+	}
+
+	rows := []models.BulkTicketRow{}
+	for rowNum := 1; ; rowNum++ {
+		rec, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if rowNum > maxBulkTicketRows {
+			return nil, fmt.Errorf("can't create more than %d tickets at once", maxBulkTicketRows)
+		}
+
+		row := models.BulkTicketRow{}
+		rawCustomFields := map[string]string{}
+		for i, col := range header {
+			value := strings.TrimSpace(rec[i])
+			switch col {
+			case bulkTicketCSVStudentNumberCol:
+				row.StudentNumber = value
+			case bulkTicketCSVFullNameCol:
+				row.FullName = value
+			case bulkTicketCSVTierIDCol:
+				if value == "" {
+					continue
+				}
+				row.TierID, err = primitive.ObjectIDFromHex(value)
+				if err != nil {
+					return nil, fmt.Errorf("row %d: invalid tier id %q", rowNum, value)
+				}
+			case bulkTicketCSVMaxScanCountCol:
+				if value == "" {
+					continue
+				}
+				row.MaxScanCount, err = strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("row %d: invalid max scan count %q", rowNum, value)
+				}
+			default:
+				rawCustomFields[col] = value
+			}
+		}
+		row.CustomFields = models.ParseCustomEventFields(event, rawCustomFields)
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// BulkCreateTickets creates tickets for many students at once.
+//
+//	@Summary		Create tickets in bulk
+//	@Description	Create tickets for a list of students, given either as JSON or as a CSV (Content-Type text/csv) with a header row. CSVs need a studentNumber column, can have fullName, tierID and maxScanCount columns, and every other column is used as a custom field. Students who haven't signed up yet get a queued ticket. Every row is checked against the event's custom field schema, and a failed row doesn't stop the others. Set dryRun (in the JSON body or query) to check the rows without creating anything. Only available to admins.
+//	@Tags			event
+//	@Accept			json
+//	@Accept			text/csv
+//	@Produce		json
+//	@Param			id		path		string										true	"Event ID"
+//	@Param			dryRun	query		bool										false	"Only check the rows without creating anything"
+//	@Param			tickets	body		eventControllerBulkCreateTicketsRequestBody	true	"Tickets to create"
+//	@Success		200		{object}	models.BulkTicketResult
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/tickets/bulk [post]
+func (ctrl EventController) BulkCreateTickets(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Check if event exists, needed for custom field types when reading CSVs
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Str("id", eventID.Hex()).Msg("could not fetch event data")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+	var rows []models.BulkTicketRow
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		rows, err = parseBulkTicketCSV(r.Body, event)
+		if err != nil {
+			log.Error().Err(err).Msg("could not parse csv")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+	} else {
+		var bulkRaw eventControllerBulkCreateTicketsRequestBody
+
+		// Parse JSON body
+		bodyDecoder := json.NewDecoder(r.Body)
+		bodyDecoder.DisallowUnknownFields()
+		err := bodyDecoder.Decode(&bulkRaw)
+		if err != nil {
+			log.Error().Err(err).Msg("could not parse body")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+
+		// Validate JSON body
+		validate := validator.New()
+		err = validate.Struct(bulkRaw)
+		if err != nil {
+			log.Error().Err(err).Msg("could not validate body")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+		if len(bulkRaw.Rows) > maxBulkTicketRows {
+			render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("can't create more than %d tickets at once", maxBulkTicketRows)))
+			return
+		}
+
+		// Convert to ObjectID from string, already validated so no need to check errors
+		rows = make([]models.BulkTicketRow, len(bulkRaw.Rows))
+		for i, rowRaw := range bulkRaw.Rows {
+			tierID := primitive.NilObjectID
+			if rowRaw.TierID != "" {
+				tierID, _ = primitive.ObjectIDFromHex(rowRaw.TierID)
+			}
+			rows[i] = models.BulkTicketRow{
+				StudentNumber: rowRaw.StudentNumber,
+				FullName:      rowRaw.FullName,
+				TierID:        tierID,
+				MaxScanCount:  rowRaw.MaxScanCount,
+				CustomFields:  rowRaw.CustomFields,
+			}
+		}
+		dryRun = dryRun || bulkRaw.DryRun
+	}
+
+	// Admins can't make tickets for themselves unless they're a superadmin
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	excludedOwner := token.UID
+	if util.GetRoleFromClaims(token.Claims) == util.RoleSuperAdmin {
+		excludedOwner = ""
+	}
+
+	// Try to create all tickets
+	result, err := models.CreateBulkTickets(r.Context(), eventID, rows, models.BulkTicketOptions{
+		DryRun:        dryRun,
+		ExcludedOwner: excludedOwner,
+	})
+	if err == models.ErrNotFound {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Str("id", eventID.Hex()).Msg("could not create tickets in bulk")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &result); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", token.UID).
+		Str("action", "bulkCreateTickets").
+		Str("eventId", eventID.Hex()).
+		Bool("dry_run", result.DryRun).
+		Int("created", result.Created).
+		Int("queued", result.Queued).
+		Int("failed", result.Failed).
+		Bool("privileged", true).
+		Msg("created tickets in bulk for event")
+}
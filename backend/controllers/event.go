@@ -30,13 +30,31 @@ import (
 )
 
 type eventControllerCreateRequestBody struct {
-	Name                  string                 `json:"name"            validate:"required"`
-	Description           string                 `json:"description"     validate:"required"`
-	Location              string                 `json:"location"        validate:"required"`
-	Address               string                 `json:"address"         validate:"required"`
-	StartTimestamp        string                 `json:"start_timestamp" validate:"required"`
-	EndTimestamp          string                 `json:"end_timestamp"   validate:"required"`
-	RawCustomFieldsSchema map[string]interface{} `json:"custom_fields_schema" validate:"required"`
+	Name                     string                 `json:"name"            validate:"required"`
+	Description              string                 `json:"description"     validate:"required"`
+	Location                 string                 `json:"location"        validate:"required"`
+	Address                  string                 `json:"address"         validate:"required"`
+	StartTimestamp           string                 `json:"start_timestamp" validate:"required"`
+	EndTimestamp             string                 `json:"end_timestamp"   validate:"required"`
+	DoorsOpenTimestamp       string                 `json:"doors_open_timestamp"`  // Defaults to start timestamp
+	DoorsCloseTimestamp      string                 `json:"doors_close_timestamp"` // Defaults to end timestamp
+	EarlyGraceMinutes        string                 `json:"early_grace_minutes"    validate:"omitempty,number"`
+	LateGraceMinutes         string                 `json:"late_grace_minutes"     validate:"omitempty,number"`
+	TransfersRequireApproval string                 `json:"transfers_require_approval" validate:"omitempty,boolean"`
+	Capacity                 string                 `json:"capacity"                   validate:"omitempty,number"` // Leave empty for unlimited
+	RawCustomFieldsSchema    map[string]interface{} `json:"custom_fields_schema" validate:"required"`
+}
+
+type eventControllerOfflineScan struct {
+	TicketID    string    `json:"ticketID"    validate:"required,mongodb"`
+	Timestamp   time.Time `json:"timestamp"   validate:"required"`
+	DeviceLabel string    `json:"deviceLabel"`
+}
+
+type eventControllerSyncScansRequestBody struct {
+	DeviceLabel string                       `json:"deviceLabel" validate:"required"` // Used for any scans that don't have their own label
+	StationID   string                       `json:"stationID"   validate:"required,mongodb"`
+	Scans       []eventControllerOfflineScan `json:"scans"       validate:"required,dive"`
 }
 
 type EventController struct{}
@@ -45,32 +63,86 @@ func (ctrl EventController) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.AuthenticatorMiddleware) // User must be authenticated before using any of these endpoints
 
-	r.Get("/", ctrl.List) // GET /events - returns list of events, available to all
+	r.Get("/", ctrl.List)                  // GET /events - returns list of events, available to all
+	r.Get("/staffing", ctrl.ListSelfStaff) // GET /events/staffing - returns events the requester is staff for, available to all
 
-	// Admin-only routes
+	// Event management routes
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AdminAuthorizerMiddleware)
-		r.Post("/", ctrl.Create) // POST /events - add new event to database, only available to admins
+		r.Use(middleware.RequirePermission(util.PermissionEventsWrite))
+		r.Post("/", ctrl.Create) // POST /events - add new event to database, requires events:write
 
 		r.Group(func(r chi.Router) {
 			r.Use(httprate.Limit(20, time.Minute, httprate.WithKeyFuncs(
 				httprate.KeyByRealIP,
 				httprate.KeyByEndpoint,
 			)))
-			r.Post("/upload-photo", ctrl.UploadPhoto) // POST /events/upload-photo - uploads new photo for event in GCP, only available to admins
+			r.Post("/upload-photo", ctrl.UploadPhoto) // POST /events/upload-photo - uploads new photo for event in GCP, requires events:write
 		})
 	})
 
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", ctrl.Get) // GET /events/{id} - returns event data, available to all
+		r.Get("/", ctrl.Get)                                   // GET /events/{id} - returns event data, available to all
+		r.Get("/tiers", ctrl.ListTiers)                        // GET /events/{id}/tiers - returns ticket tiers for an event, available to all
+		r.Get("/seating/tables", ctrl.ListTables)              // GET /events/{id}/seating/tables - returns seating tables for an event, available to all
+		r.Get("/seating/group", ctrl.GetSelfSeatingGroup)      // GET /events/{id}/seating/group - returns requester's seating group, available to all
+		r.Post("/seating/group", ctrl.CreateSeatingGroup)      // POST /events/{id}/seating/group - starts a seating group, available to ticket holders
+		r.Post("/seating/group/join", ctrl.JoinSeatingGroup)   // POST /events/{id}/seating/group/join - joins a seating group by its code, available to ticket holders
+		r.Post("/seating/group/leave", ctrl.LeaveSeatingGroup) // POST /events/{id}/seating/group/leave - leaves requester's seating group, available to all
+
+		// Event management routes
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequirePermission(util.PermissionEventsWrite))
+			r.Patch("/", ctrl.Update)                                           // PATCH /events/{id} - updates event data, requires events:write
+			r.Post("/tiers", ctrl.CreateTier)                                   // POST /events/{id}/tiers - adds a ticket tier to an event, requires events:write
+			r.Patch("/tiers/{tierID}", ctrl.UpdateTier)                         // PATCH /events/{id}/tiers/{tierID} - updates a ticket tier, requires events:write
+			r.Delete("/tiers/{tierID}", ctrl.DeleteTier)                        // DELETE /events/{id}/tiers/{tierID} - deletes a ticket tier, requires events:write
+			r.Post("/seating/tables", ctrl.CreateTable)                         // POST /events/{id}/seating/tables - adds a seating table to an event, requires events:write
+			r.Patch("/seating/tables/{tableID}", ctrl.UpdateTable)              // PATCH /events/{id}/seating/tables/{tableID} - updates a seating table, requires events:write
+			r.Delete("/seating/tables/{tableID}", ctrl.DeleteTable)             // DELETE /events/{id}/seating/tables/{tableID} - deletes a seating table, requires events:write
+			r.Get("/seating/groups", ctrl.ListSeatingGroups)                    // GET /events/{id}/seating/groups - returns all seating groups for an event, requires events:write
+			r.Post("/seating/groups/{groupID}/assign", ctrl.AssignSeatingGroup) // POST /events/{id}/seating/groups/{groupID}/assign - seats a group at a table, requires events:write
+			r.Post("/seating/auto-assign", ctrl.AutoAssignSeating)              // POST /events/{id}/seating/auto-assign - seats all unseated groups, requires events:write
+		})
+
+		// Deleting an event takes all of its tickets with it, so it's kept for superadmins
+		r.With(middleware.RequirePermission(util.PermissionEventsDelete)).
+			Delete("/", ctrl.Delete) // DELETE /events/{id} - deletes event, requires events:delete
 
-		// Admin-only routes
+		// Ticket routes, event staff can use these for their own event
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AdminAuthorizerMiddleware)
-			r.Get("/tickets", ctrl.GetTickets)          // GET /events/{id}/tickets - returns all tickets for an event, only for admins
-			r.Get("/ticket-count", ctrl.GetTicketCount) // GET /events/{id}/ticket-count - returns # of tickets for an event, only for admins
-			r.Patch("/", ctrl.Update)                   // PATCH /events/{id} - updates event data, only available to admins
-			r.Delete("/", ctrl.Delete)                  // DELETE /events/{id} - deletes event, only available to admins
+			r.Use(middleware.RequireEventPermission(util.PermissionTicketsRead))
+			r.Get("/tickets", ctrl.GetTickets)                       // GET /events/{id}/tickets - returns all tickets for an event, requires tickets:read
+			r.Get("/tickets/export", ctrl.ExportTickets)             // GET /events/{id}/tickets/export - downloads tickets for an event as a csv or xlsx, requires tickets:read
+			r.Get("/tickets/export/columns", ctrl.ListExportColumns) // GET /events/{id}/tickets/export/columns - returns columns that can be exported, requires tickets:read
+		})
+		r.With(middleware.RequirePermission(util.PermissionTicketsWrite)).
+			Post("/tickets/bulk", ctrl.BulkCreateTickets) // POST /events/{id}/tickets/bulk - creates many tickets at once, requires tickets:write
+
+		// Door routes, event staff can use these for their own event
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireEventPermission(util.PermissionTicketsScan))
+			r.Post("/scans/sync", ctrl.SyncScans)       // POST /events/{id}/scans/sync - uploads scans made offline, requires tickets:scan
+			r.Get("/manifest", ctrl.GetManifest)        // GET /events/{id}/manifest - returns signed list of valid tickets for offline scanning, requires tickets:scan
+			r.Get("/inside-count", ctrl.GetInsideCount) // GET /events/{id}/inside-count - returns # of ticket holders currently inside, requires tickets:scan
+		})
+
+		// Reporting routes, event staff can use these for their own event
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireEventPermission(util.PermissionEventsAnalytics))
+			r.Get("/ticket-count", ctrl.GetTicketCount)     // GET /events/{id}/ticket-count - returns # of tickets for an event, requires events:analytics
+			r.Get("/scans", ctrl.GetScans)                  // GET /events/{id}/scans - returns scan history for an event, requires events:analytics
+			r.Get("/station-counts", ctrl.GetStationCounts) // GET /events/{id}/station-counts - returns # of scans at each scan station, requires events:analytics
+			r.Get("/analytics", ctrl.GetAnalytics)          // GET /events/{id}/analytics - returns arrival curve, no-shows, and attendance breakdowns, requires events:analytics
+		})
+		r.With(middleware.RequirePermission(util.PermissionOrdersRead)).
+			Get("/financials", ctrl.GetFinancials) // GET /events/{id}/financials - returns money taken in & refunded by tier, requires orders:read
+
+		// Staff routes, event managers can use these for their own event
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireEventPermission(util.PermissionEventStaffManage))
+			r.Get("/staff", ctrl.ListStaff)            // GET /events/{id}/staff - returns everyone with a role for an event, requires events:staff
+			r.Put("/staff/{uid}", ctrl.SetStaff)       // PUT /events/{id}/staff/{uid} - gives someone a role for an event, requires events:staff
+			r.Delete("/staff/{uid}", ctrl.RemoveStaff) // DELETE /events/{id}/staff/{uid} - takes away someone's role for an event, requires events:staff
 		})
 	})
 
@@ -95,10 +167,16 @@ func (ctrl EventController) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only admins can see hidden tiers
+	isAdmin, _ := util.CheckPermission(r.Context(), util.PermissionEventsWrite) // error doesn't matter, bool defaults to false anyways
+
 	// Convert into list of renderers to turn into JSON
 	renderers := []render.Renderer{}
 	for _, event := range events {
 		e := event // Duplicate before passing by reference
+		if !isAdmin {
+			e.TicketTiers = e.VisibleTicketTiers()
+		}
 		renderers = append(renderers, &e)
 	}
 
@@ -156,6 +234,12 @@ func (ctrl EventController) Create(w http.ResponseWriter, r *http.Request) {
 	eventRaw.Address = r.PostFormValue("address")
 	eventRaw.StartTimestamp = r.PostFormValue("start_timestamp")
 	eventRaw.EndTimestamp = r.PostFormValue("end_timestamp")
+	eventRaw.DoorsOpenTimestamp = r.PostFormValue("doors_open_timestamp")
+	eventRaw.DoorsCloseTimestamp = r.PostFormValue("doors_close_timestamp")
+	eventRaw.EarlyGraceMinutes = r.PostFormValue("early_grace_minutes")
+	eventRaw.LateGraceMinutes = r.PostFormValue("late_grace_minutes")
+	eventRaw.TransfersRequireApproval = r.PostFormValue("transfers_require_approval")
+	eventRaw.Capacity = r.PostFormValue("capacity")
 	// Can't provide a JSON object into FormData, so we need to parse it beforehand
 	var rawCustomFieldsSchema map[string]interface{}
 	if err = json.Unmarshal([]byte(r.PostFormValue("custom_fields_schema")), &rawCustomFieldsSchema); err != nil {
@@ -355,6 +439,64 @@ func (ctrl EventController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Doors open / close times are optional, scanning uses the start / end timestamps if not given
+	if eventRaw.DoorsOpenTimestamp != "" {
+		doorsOpenTs, err := time.Parse(time.RFC3339, eventRaw.DoorsOpenTimestamp)
+		if err != nil {
+			log.Error().Err(err).Msg("could not parse doors open timestamp")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+		event.DoorsOpenTimestamp = doorsOpenTs
+	}
+	if eventRaw.DoorsCloseTimestamp != "" {
+		doorsCloseTs, err := time.Parse(time.RFC3339, eventRaw.DoorsCloseTimestamp)
+		if err != nil {
+			log.Error().Err(err).Msg("could not parse doors close timestamp")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+		event.DoorsCloseTimestamp = doorsCloseTs
+	}
+	if doorsOpenTs, doorsCloseTs := event.ScanWindow(); doorsOpenTs.Compare(doorsCloseTs) != -1 {
+		log.Error().Time("doorsOpen", doorsOpenTs).Time("doorsClose", doorsCloseTs).Msg("doors open timestamp is not before doors close timestamp")
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("doors open timestamp is not before doors close timestamp")))
+		return
+	}
+
+	// Grace periods are also optional, defaulting to none
+	if eventRaw.EarlyGraceMinutes != "" {
+		event.EarlyGraceMinutes, err = strconv.Atoi(eventRaw.EarlyGraceMinutes)
+		if err != nil || event.EarlyGraceMinutes < 0 {
+			log.Error().Err(err).Str("earlyGraceMinutes", eventRaw.EarlyGraceMinutes).Msg("invalid early grace period")
+			render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("early grace period must be a non-negative whole number of minutes")))
+			return
+		}
+	}
+	if eventRaw.LateGraceMinutes != "" {
+		event.LateGraceMinutes, err = strconv.Atoi(eventRaw.LateGraceMinutes)
+		if err != nil || event.LateGraceMinutes < 0 {
+			log.Error().Err(err).Str("lateGraceMinutes", eventRaw.LateGraceMinutes).Msg("invalid late grace period")
+			render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("late grace period must be a non-negative whole number of minutes")))
+			return
+		}
+	}
+
+	// Capacity is unlimited unless given
+	if eventRaw.Capacity != "" {
+		event.Capacity, err = strconv.Atoi(eventRaw.Capacity)
+		if err != nil || event.Capacity < 0 {
+			log.Error().Err(err).Str("capacity", eventRaw.Capacity).Msg("invalid capacity")
+			render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("capacity must be a non-negative whole number")))
+			return
+		}
+	}
+
+	// Transfers don't need approval unless asked for
+	if eventRaw.TransfersRequireApproval != "" {
+		event.TransfersRequireApproval, _ = strconv.ParseBool(eventRaw.TransfersRequireApproval) // Already validated
+	}
+
 	// Validate custom fields schema
 	schemaLoader := gojsonschema.NewGoLoader(eventRaw.RawCustomFieldsSchema)
 	_, err = gojsonschema.NewSchema(schemaLoader)
@@ -555,6 +697,11 @@ func (ctrl EventController) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only admins can see hidden tiers
+	if isAdmin, _ := util.CheckPermission(r.Context(), util.PermissionEventsWrite); !isAdmin {
+		event.TicketTiers = event.VisibleTicketTiers()
+	}
+
 	// Return as JSON, fallback if it fails
 	if err := render.Render(w, r, &event); err != nil {
 		render.Render(w, r, util.ErrRender(err))
@@ -580,7 +727,7 @@ func (ctrl EventController) Get(w http.ResponseWriter, r *http.Request) {
 // Get event tickets godoc
 //
 //	@Summary		Get tickets for event
-//	@Description	Get every ticket for an event. Only available to admins.
+//	@Description	Get every ticket for an event. Only available to admins, and the event's viewers and managers.
 //	@Tags			event
 //	@Produce		json
 //	@Param			id	path		string	true	"Event ID"
@@ -654,11 +801,13 @@ func (ctrl EventController) GetTickets(w http.ResponseWriter, r *http.Request) {
 // Get event ticket count godoc
 //
 //	@Summary		Get ticket count for event
-//	@Description	Get the ticket count for an event. Only available to admins.
+//	@Description	Get the ticket count for an event, not counting voided tickets. If byTier is set, the counts for each ticket tier are returned instead, including queued tickets. Only available to admins, and the event's viewers and managers.
 //	@Tags			event
 //	@Produce		json
-//	@Param			id	path		string	true	"Event ID"
-//	@Success		200	{object}	int
+//	@Param			id		path		string	true	"Event ID"
+//	@Param			byTier	query		bool	false	"Break down count by ticket tier"
+//	@Success		200		{object}	int
+//	@Success		200		{object}	[]models.TicketTierCount
 //	@Failure		400
 //	@Failure		404
 //	@Failure		500
@@ -676,6 +825,94 @@ func (ctrl EventController) GetTicketCount(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Check if event exists
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Break down by tier if requested
+	if r.URL.Query().Get("byTier") == "true" {
+		counts, err := models.GetTicketTierCounts(r.Context(), event)
+		if err != nil {
+			log.Error().Err(err).Msg("could not fetch tier counts for event")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+
+		// Convert into list of renderers to turn into JSON
+		renderers := []render.Renderer{}
+		for _, count := range counts {
+			c := count // Duplicate it before passing by reference to avoid only passing the last obj
+			renderers = append(renderers, &c)
+		}
+
+		// Return as JSON array, fallback if it fails
+		if err := render.RenderList(w, r, renderers); err != nil {
+			render.Render(w, r, util.ErrRender(err))
+			return
+		}
+	} else {
+		// Fetch number of tickets
+		count, err := models.GetTicketCount(r.Context(), bson.M{"event": eventID, "voided": bson.M{"$ne": true}})
+		if err != nil {
+			log.Error().Err(err).Msg("could not fetch ticket count for event")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+
+		// Return just as number
+		countStr := strconv.FormatInt(count, 10)
+		w.Write([]byte(countStr))
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "getEventTicketCount").
+		Bool("byTier", r.URL.Query().Get("byTier") == "true").
+		Str("eventId", id).
+		Bool("privileged", true).
+		Msg("fetched ticket count for event")
+}
+
+// Get event inside count godoc
+//
+//	@Summary		Get number of people inside event
+//	@Description	Get the number of ticket holders currently inside an event, based on entry and exit scans. Meant for live capacity tracking. Only available to admins, scanners, and the event's scanners and managers.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	int
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/inside-count [get]
+func (ctrl EventController) GetInsideCount(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
 	// Check if event exists
 	exists, err := models.CheckIfEventExists(r.Context(), eventID)
 	if err != nil {
@@ -688,10 +925,10 @@ func (ctrl EventController) GetTicketCount(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Fetch list of tickets
-	count, err := models.GetTicketCount(r.Context(), bson.M{"event": eventID})
+	// Count tickets whose holders are inside
+	count, err := models.GetTicketCount(r.Context(), bson.M{"event": eventID, "inside": true})
 	if err != nil {
-		log.Error().Err(err).Msg("could not fetch ticket count for event")
+		log.Error().Err(err).Msg("could not fetch inside count for event")
 		render.Render(w, r, util.ErrServer(err))
 		return
 	}
@@ -710,10 +947,433 @@ func (ctrl EventController) GetTicketCount(w http.ResponseWriter, r *http.Reques
 		Str("type", "audit").
 		Str("controller", "event").
 		Str("requester_uid", uid).
-		Str("action", "getEventTicketCount").
+		Str("action", "getEventInsideCount").
 		Str("eventId", id).
 		Bool("privileged", true).
-		Msg("fetched ticket count for event")
+		Msg("fetched inside count for event")
+}
+
+// Get event station counts godoc
+//
+//	@Summary		Get scan counts by station for event
+//	@Description	Get the number of successful entry and exit scans made at each scan station of an event, for breaking down attendance by entrance. Scans made before stations were required have an empty station ID. Only available to admins, and the event's viewers and managers.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	[]models.ScanStationCount
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/station-counts [get]
+func (ctrl EventController) GetStationCounts(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Check if event exists
+	exists, err := models.CheckIfEventExists(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if event exists")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !exists {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	}
+
+	// Count scans at each station
+	counts, err := models.GetScanStationCounts(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch station counts for event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, count := range counts {
+		c := count // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &c)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "getEventStationCounts").
+		Str("eventId", id).
+		Bool("privileged", true).
+		Msg("fetched station counts for event")
+}
+
+// Get event financials godoc
+//
+//	@Summary		Get financial summary for event
+//	@Description	Get the gross, refunded, and net amounts taken in for an event through ticket orders, broken down by tier. Only available to admins.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	models.EventFinancialSummary
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/financials [get]
+func (ctrl EventController) GetFinancials(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Check if event exists
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Add up payments & refunds
+	summary, err := models.GetEventFinancialSummary(r.Context(), event)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch financial summary for event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &summary); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "getEventFinancials").
+		Str("eventId", id).
+		Bool("privileged", true).
+		Msg("fetched financial summary for event")
+}
+
+// Get event scans godoc
+//
+//	@Summary		Get scan history for event
+//	@Description	Get every scan attempt made for an event's tickets, newest first. The total number of scans is given in the X-Total-Count header. Only available to admins, and the event's viewers and managers.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id			path	string	true	"Event ID"
+//	@Param			page		query	int		false	"Page number, starting at 1"
+//	@Param			pageSize	query	int		false	"Number of scans per page"
+//	@Success		200	{object}	[]models.TicketScan
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/scans [get]
+func (ctrl EventController) GetScans(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requested page
+	page, pageSize, err := util.GetPaginationFromQuery(r)
+	if err != nil {
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Check if event exists
+	exists, err := models.CheckIfEventExists(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if event exists")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !exists {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	}
+
+	// Fetch page of scans
+	scans, total, err := models.GetTicketScans(r.Context(), bson.M{"event": eventID}, page, pageSize)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch scans of event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, scan := range scans {
+		s := scan // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &s)
+	}
+
+	// Return as JSON array, fallback if it fails
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "getEventScans").
+		Str("eventId", id).
+		Int64("page", page).
+		Bool("privileged", true).
+		Msg("fetched scans for event")
+}
+
+// Get event manifest godoc
+//
+//	@Summary		Get offline scanning manifest for event
+//	@Description	Get a signed, compact list of every valid ticket for an event so that devices can keep scanning without a connection. The response is "base64url(manifest JSON).base64url(signature)", signed with Ed25519 so it can be checked against the keys from /tickets/signing-keys. Only available to admins, scanners, and the event's scanners and managers.
+//	@Tags			event
+//	@Produce		plain
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{string}	string
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/manifest [get]
+func (ctrl EventController) GetManifest(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Check if event exists
+	exists, err := models.CheckIfEventExists(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if event exists")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !exists {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	}
+
+	// Build manifest
+	manifest, err := models.GetEventManifest(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not build manifest for event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	manifest.KeyID = lib.TicketSigner.ActiveKeyID()
+
+	// Sign manifest so it can't be tampered with on the device
+	rawManifest, err := json.Marshal(manifest)
+	if err != nil {
+		log.Error().Err(err).Msg("could not serialize manifest")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	w.Write([]byte(lib.TicketSigner.SignData(rawManifest)))
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "getEventManifest").
+		Str("eventId", id).
+		Int("ticketCount", len(manifest.Tickets)).
+		Bool("privileged", true).
+		Msg("downloaded offline scanning manifest for event")
+}
+
+// Sync event scans godoc
+//
+//	@Summary		Sync offline scans for event
+//	@Description	Uploads a batch of scans made at a scan station while offline. Scans are replayed in the order they happened against each ticket's max scan count, and any scans that couldn't be accepted (ex. double-admits from two devices) are reported as conflicts. Re-sending scans that were already synced is safe. Only available to admins, scanners, and the event's scanners and managers.
+//	@Tags			event
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string								true	"Event ID"
+//	@Param			scans	body		eventControllerSyncScansRequestBody	true	"Offline scans"
+//	@Success		200		{object}	models.OfflineScanSyncResult
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/scans/sync [post]
+func (ctrl EventController) SyncScans(w http.ResponseWriter, r *http.Request) {
+	var syncReq eventControllerSyncScansRequestBody
+
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err = bodyDecoder.Decode(&syncReq)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(syncReq)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Check if event exists
+	exists, err := models.CheckIfEventExists(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if event exists")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !exists {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	}
+
+	// Get requester so we know who uploaded the scans
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+
+	// Get station that the scans were made from
+	station, ok := getScanStationForScanner(w, r, syncReq.StationID, uid)
+	if !ok {
+		return
+	}
+	if station.Event != eventID {
+		log.Error().Str("stationEventID", station.Event.Hex()).Str("eventID", id).Msg("scan station is not for this event")
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("scan station is not for this event")))
+		return
+	}
+
+	// Convert raw scans
+	scans := make([]models.OfflineScan, len(syncReq.Scans))
+	for i, rawScan := range syncReq.Scans {
+		ticketID, err := primitive.ObjectIDFromHex(rawScan.TicketID)
+		if err != nil {
+			log.Error().Err(err).Str("id", rawScan.TicketID).Msg("could not parse ticket id")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+
+		scans[i] = models.OfflineScan{
+			TicketID:    ticketID,
+			Timestamp:   rawScan.Timestamp,
+			DeviceLabel: rawScan.DeviceLabel,
+		}
+		if scans[i].DeviceLabel == "" {
+			scans[i].DeviceLabel = syncReq.DeviceLabel
+		}
+	}
+
+	// Try to reconcile scans with DB
+	result, err := models.SyncOfflineScans(r.Context(), station, uid, scans)
+	if err != nil {
+		log.Error().Err(err).Any("partialResult", result).Msg("could not sync offline scans")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &result); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "syncEventScans").
+		Str("eventId", id).
+		Str("deviceLabel", syncReq.DeviceLabel).
+		Str("stationId", syncReq.StationID).
+		Any("result", result).
+		Bool("privileged", true).
+		Msg("synced offline scans for event")
 }
 
 // Update event godoc
@@ -799,13 +1459,14 @@ func (ctrl EventController) Update(w http.ResponseWriter, r *http.Request) {
 // Delete event godoc
 //
 //	@Summary		Delete event
-//	@Description	Delete event from database. Only available to admins.
+//	@Description	Delete event from database, along with its tickets, orders, transfers, promo codes, and seating. Events with payments or unpaid orders can't be deleted, so that money records are kept. Only available to superadmins, since every ticket for the event goes with it.
 //	@Tags			event
 //	@Produce		json
 //	@Param			id	path		string	true	"Event ID"
 //	@Success		200
 //	@Failure		400
 //	@Failure		404
+//	@Failure		409
 //	@Failure		500
 //	@Security		ApiKeyAuth
 //	@Router			/events/{id} [delete]
@@ -826,6 +1487,9 @@ func (ctrl EventController) Delete(w http.ResponseWriter, r *http.Request) {
 		log.Error().Err(err).Msg("could not find event to delete")
 		render.Render(w, r, util.ErrNotFound)
 		return
+	} else if err == models.ErrEventHasOrders {
+		render.Render(w, r, util.ErrConflict(errors.New("event has payments or unpaid orders, refund or let them expire first")))
+		return
 	} else if err != nil {
 		log.Error().Err(err).Msg("could not delete event")
 		render.Render(w, r, util.ErrServer(err))
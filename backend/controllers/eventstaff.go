@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type eventControllerSetStaffRequestBody struct {
+	Role string `json:"role" validate:"required,oneof=scanner viewer manager"`
+}
+
+// ListSelfStaff fetches the events the requester is staff for.
+//
+//	@Summary		List requester's event staff roles
+//	@Description	List every event the requester has been given a role for, along with that role.
+//	@Tags			event
+//	@Produce		json
+//	@Success		200	{object}	[]models.EventStaff
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/staffing [get]
+func (ctrl EventController) ListSelfStaff(w http.ResponseWriter, r *http.Request) {
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Try to get their roles
+	staff, err := models.GetEventStaffList(r.Context(), bson.M{"user": token.UID})
+	if err != nil {
+		log.Error().Err(err).Str("uid", token.UID).Msg("could not fetch event staff roles")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, s := range staff {
+		st := s // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &st)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", token.UID).
+		Str("action", "listSelfEventStaff").
+		Bool("privileged", false).
+		Msg("fetched own event staff roles")
+}
+
+// ListStaff fetches everyone with a role for an event.
+//
+//	@Summary		List event staff
+//	@Description	List everyone who has been given a role for an event, such as scanning tickets or seeing the attendee list. Only available to admins and the event's managers.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	[]models.EventStaff
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/staff [get]
+func (ctrl EventController) ListStaff(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Check if event exists
+	exists, err := models.CheckIfEventExists(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if event exists")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !exists {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	}
+
+	// Try to get staff
+	staff, err := models.GetEventStaffList(r.Context(), bson.M{"event": eventID})
+	if err != nil {
+		log.Error().Err(err).Str("eventId", eventID.Hex()).Msg("could not fetch event staff")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, s := range staff {
+		st := s // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &st)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "listEventStaff").
+		Str("eventId", eventID.Hex()).
+		Bool("privileged", true).
+		Msg("fetched staff for event")
+}
+
+// SetStaff gives someone a role for an event.
+//
+//	@Summary		Give someone an event staff role
+//	@Description	Give someone a role for just one event, replacing any role they already had for it. Scanners can scan tickets, viewers can see the attendee list and attendance numbers, and managers can do both as well as add and remove staff. Only available to admins and the event's managers.
+//	@Tags			event
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string								true	"Event ID"
+//	@Param			uid		path		string								true	"User ID"
+//	@Param			role	body		eventControllerSetStaffRequestBody	true	"Role to give"
+//	@Success		200		{object}	models.EventStaff
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/staff/{uid} [put]
+func (ctrl EventController) SetStaff(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+	staffUID := chi.URLParam(r, "uid")
+
+	var body eventControllerSetStaffRequestBody
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&body)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(body)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Check if event exists
+	exists, err := models.CheckIfEventExists(r.Context(), eventID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if event exists")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !exists {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	}
+
+	// Staff need an account to sign in with
+	exists, err = models.CheckIfUserExists(r.Context(), staffUID)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if user exists")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !exists {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("user does not exist")))
+		return
+	}
+
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Try to give them the role
+	staff, err := models.SetEventStaff(r.Context(), models.EventStaff{
+		EventID: eventID,
+		UserID:  staffUID,
+		Role:    util.EventStaffRole(body.Role),
+		AddedBy: token.UID,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("eventId", eventID.Hex()).Str("uid", staffUID).Msg("could not set event staff role")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &staff); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", token.UID).
+		Str("action", "setEventStaff").
+		Str("eventId", eventID.Hex()).
+		Str("given_uid", staffUID).
+		Str("role", body.Role).
+		Bool("privileged", true).
+		Msg("gave user a staff role for event")
+}
+
+// RemoveStaff takes away someone's role for an event.
+//
+//	@Summary		Take away someone's event staff role
+//	@Description	Take away someone's role for an event. Only available to admins and the event's managers.
+//	@Tags			event
+//	@Param			id	path	string	true	"Event ID"
+//	@Param			uid	path	string	true	"User ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/staff/{uid} [delete]
+func (ctrl EventController) RemoveStaff(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+	staffUID := chi.URLParam(r, "uid")
+
+	// Try to take away their role
+	err := models.DeleteEventStaff(r.Context(), eventID, staffUID)
+	if err == models.ErrNotFound {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Str("eventId", eventID.Hex()).Str("uid", staffUID).Msg("could not remove event staff role")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "removeEventStaff").
+		Str("eventId", eventID.Hex()).
+		Str("given_uid", staffUID).
+		Bool("privileged", true).
+		Msg("took away user's staff role for event")
+}
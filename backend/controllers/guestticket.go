@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ticketControllerCreateGuestRequestBody struct {
+	Name         string `json:"name"         validate:"required"`
+	Email        string `json:"email"        validate:"omitempty,email"`
+	Phone        string `json:"phone"        validate:"required_without=Email"` // Need at least one way to contact the guest
+	AgeConfirmed bool   `json:"ageConfirmed" validate:"required"`               // Sponsor has to confirm the guest meets the event's age requirement
+}
+
+// getSponsorTicketFromURL fetches the ticket in the URL, making sure the requester either has
+// the permission or is its owner. Renders an error and returns false if anything goes wrong.
+func getSponsorTicketFromURL(w http.ResponseWriter, r *http.Request, permission util.Permission) (models.Ticket, bool, bool) {
+	// Get ID of requested ticket
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return models.Ticket{}, false, false
+	}
+
+	// Try to fetch from DB
+	ticket, err := models.GetTicket(r.Context(), objID)
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return models.Ticket{}, false, false
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not find ticket")
+		render.Render(w, r, util.ErrServer(err))
+		return models.Ticket{}, false, false
+	}
+
+	// Check if they are authorized to use endpoint (has permission or ticket owner)
+	hasPermission, err := util.CheckPermission(r.Context(), permission)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check requester permissions")
+		render.Render(w, r, util.ErrServer(err))
+		return models.Ticket{}, false, false
+	}
+	idToken, _ := util.GetUserTokenFromContext(r.Context()) // Not error-checking because this gets fetched in permission check
+	if !(hasPermission || ticket.Owner == idToken.UID) {
+		log.Warn().Str("uid", idToken.UID).Msg("unauthorized user attempting to access another person's ticket")
+		render.Render(w, r, util.ErrForbidden)
+		return models.Ticket{}, false, false
+	}
+
+	return ticket, hasPermission, true
+}
+
+// ListGuests fetches the guest tickets that a ticket is sponsoring.
+//
+//	@Summary		List a ticket's guests
+//	@Description	List the guest tickets sponsored by a ticket, including voided ones. Only available to admins and the ticket owner.
+//	@Tags			ticket
+//	@Produce		json
+//	@Param			id	path		string	true	"Sponsor's ticket ID"
+//	@Success		200	{object}	[]models.Ticket
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/tickets/{id}/guests [get]
+func (ctrl TicketController) ListGuests(w http.ResponseWriter, r *http.Request) {
+	sponsorTicket, _, ok := getSponsorTicketFromURL(w, r, util.PermissionTicketsRead)
+	if !ok {
+		return
+	}
+
+	// Try to get guest tickets
+	guestTickets, err := models.GetGuestTickets(r.Context(), sponsorTicket.ID)
+	if err != nil {
+		log.Error().Err(err).Str("ticket_id", sponsorTicket.ID.Hex()).Msg("could not fetch guest tickets")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, ticket := range guestTickets {
+		t := ticket // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &t)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "ticket").
+		Str("requester_uid", requesterUID).
+		Str("ticket_id", sponsorTicket.ID.Hex()).
+		Str("action", "listGuestTickets").
+		Bool("privileged", requesterUID != sponsorTicket.Owner).
+		Msg("listed ticket's guests")
+}
+
+// CreateGuest issues a ticket for an outside guest.
+//
+//	@Summary		Add a guest
+//	@Description	Issue a ticket for an outside guest brought by the ticket's owner, as long as the event allows guests and the ticket hasn't reached the event's guest limit. The guest ticket is owned by the sponsoring student, uses the same tier, and takes up a spot at the event. Only available to admins and the ticket owner.
+//	@Tags			ticket
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string									true	"Sponsor's ticket ID"
+//	@Param			guest	body		ticketControllerCreateGuestRequestBody	true	"Guest details"
+//	@Success		200		{object}	models.Ticket
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/tickets/{id}/guests [post]
+func (ctrl TicketController) CreateGuest(w http.ResponseWriter, r *http.Request) {
+	var guestRaw ticketControllerCreateGuestRequestBody
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&guestRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(guestRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	sponsorTicket, isAdmin, ok := getSponsorTicketFromURL(w, r, util.PermissionTicketsWrite)
+	if !ok {
+		return
+	}
+
+	// Try to add to DB
+	ticket, err := models.CreateGuestTicket(r.Context(), sponsorTicket.ID, models.GuestInfo{
+		Name:         guestRaw.Name,
+		Email:        guestRaw.Email,
+		Phone:        guestRaw.Phone,
+		AgeConfirmed: guestRaw.AgeConfirmed,
+	})
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrTicketVoided:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("ticket has been voided")))
+		case models.ErrGuestsNotAllowed:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("guests are not allowed for this ticket")))
+		case models.ErrGuestLimitReached:
+			render.Render(w, r, util.ErrConflict(errors.New("ticket already has as many guests as the event allows")))
+		case models.ErrEventFull:
+			render.Render(w, r, util.ErrConflict(errors.New("event has reached its capacity")))
+		case models.ErrTierFull:
+			render.Render(w, r, util.ErrConflict(errors.New("ticket tier has reached its capacity")))
+		default:
+			log.Error().Err(err).Str("ticket_id", sponsorTicket.ID.Hex()).Msg("could not create guest ticket")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &ticket); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "ticket").
+		Str("requester_uid", requesterUID).
+		Str("sponsor_ticket_id", sponsorTicket.ID.Hex()).
+		Any("ticket_data", ticket).
+		Str("action", "createGuestTicket").
+		Bool("privileged", isAdmin && requesterUID != sponsorTicket.Owner).
+		Msg("created a new guest ticket")
+}
@@ -0,0 +1,786 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/middleware"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type orderControllerCreateRequestBody struct {
+	EventID      string                 `json:"eventID"      validate:"required,mongodb"`
+	TierID       string                 `json:"tierID"       validate:"required,mongodb"`
+	CustomFields map[string]interface{} `json:"customFields"` // Has to match the event's schema
+	PromoCode    string                 `json:"promoCode"`    // Optional
+}
+
+type orderControllerRefundRequestBody struct {
+	Amount int64  `json:"amount" validate:"gte=0"` // In cents, leave empty to refund everything that's left
+	Reason string `json:"reason" validate:"required"`
+}
+
+// OrderLedger is all of the money that has moved for an order.
+type OrderLedger struct {
+	Order    models.Order     `json:"order"`
+	Payments []models.Payment `json:"payments"`
+	Refunds  []models.Refund  `json:"refunds"`
+}
+
+func (ledger *OrderLedger) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type OrderController struct{}
+
+func (ctrl OrderController) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	// Payment provider calls this, so it's verified by the provider instead of a user token
+	r.Post("/webhook", ctrl.Webhook) // POST /orders/webhook - receives payment updates from the payment provider
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.AuthenticatorMiddleware) // User must be authenticated before using any of these endpoints
+
+		r.Get("/", ctrl.ListSelf) // GET /orders - returns the requester's orders, available to any user
+		r.Post("/", ctrl.Create)  // POST /orders - start buying a ticket, available to any user
+
+		// Admin-only routes
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequirePermission(util.PermissionOrdersRead))
+			r.Get("/all", ctrl.ListAll) // GET /orders/all - returns all orders, requires orders:read
+		})
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", ctrl.Get)           // GET /orders/{id} - returns order data, available to buyer & those with orders:read
+			r.Post("/cancel", ctrl.Cancel) // POST /orders/{id}/cancel - give up on an unpaid order, available to buyer
+
+			// Admin-only routes
+			r.With(middleware.RequirePermission(util.PermissionOrdersRead)).
+				Get("/ledger", ctrl.GetLedger) // GET /orders/{id}/ledger - returns payments & refunds for an order, requires orders:read
+			r.With(middleware.RequirePermission(util.PermissionOrdersRefund)).
+				Post("/refund", ctrl.Refund) // POST /orders/{id}/refund - refund part or all of an order, requires orders:refund
+		})
+	})
+
+	return r
+}
+
+// ListSelf fetches all of the requester's orders.
+//
+//	@Summary		List the requesting user's orders
+//	@Description	List the ticket orders the requesting user has made, newest first. Available to all users.
+//	@Tags			order
+//	@Produce		json
+//	@Success		200	{object}	[]models.Order
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/orders [get]
+func (ctrl OrderController) ListSelf(w http.ResponseWriter, r *http.Request) {
+	// Get user UID
+	userToken, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	uid := userToken.UID
+
+	// Try to get orders
+	orders, err := models.GetOrders(r.Context(), bson.M{"user": uid})
+	if err != nil {
+		log.Error().Err(err).Str("uid", uid).Msg("could not fetch user's orders")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, order := range orders {
+		o := order // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &o)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", uid).
+		Str("action", "listSelfOrders").
+		Bool("privileged", false).
+		Msg("listed requester's orders")
+}
+
+// ListAll fetches all orders.
+//
+//	@Summary		List all orders
+//	@Description	List all ticket orders, newest first. Only available to admins.
+//	@Tags			order
+//	@Produce		json
+//	@Param			status	query		string	false	"Only list orders with this status (ex. paid)"
+//	@Param			eventID	query		string	false	"Only list orders for this event"
+//	@Success		200		{object}	[]models.Order
+//	@Failure		400
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/orders/all [get]
+func (ctrl OrderController) ListAll(w http.ResponseWriter, r *http.Request) {
+	// Filter by status / event if search query provided
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+	if rawEventID := r.URL.Query().Get("eventID"); rawEventID != "" {
+		eventID, err := primitive.ObjectIDFromHex(rawEventID)
+		if err != nil {
+			log.Error().Err(err).Str("id", rawEventID).Msg("could not parse event id")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+		filter["event"] = eventID
+	}
+
+	// Try to get orders
+	orders, err := models.GetOrders(r.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch all orders")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, order := range orders {
+		o := order // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &o)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", requesterUID).
+		Any("filter", filter).
+		Str("action", "listAllOrders").
+		Bool("privileged", true).
+		Msg("listed all orders")
+}
+
+// Get fetches an order.
+//
+//	@Summary		Get order
+//	@Description	Get a ticket order, ex. to check whether it's been paid for yet. Only available to admins and the buyer.
+//	@Tags			order
+//	@Produce		json
+//	@Param			id	path		string	true	"Order ID"
+//	@Success		200	{object}	models.Order
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/orders/{id} [get]
+func (ctrl OrderController) Get(w http.ResponseWriter, r *http.Request) {
+	order, ok := getOrderFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Check if they are authorized to use endpoint (admin or buyer)
+	isAdmin, err := util.CheckPermission(r.Context(), util.PermissionOrdersRead)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check requester permissions")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	idToken, _ := util.GetUserTokenFromContext(r.Context()) // Not error-checking because this gets fetched in permission check
+	if !(isAdmin || order.UserID == idToken.UID) {
+		log.Warn().Str("uid", idToken.UID).Msg("unauthorized user attempting to access another person's order")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &order); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", idToken.UID).
+		Str("order_id", order.ID.Hex()).
+		Str("action", "getOrder").
+		Bool("privileged", isAdmin && order.UserID != idToken.UID).
+		Msg("fetched order")
+}
+
+// Create starts a checkout for a ticket.
+//
+//	@Summary		Buy a ticket
+//	@Description	Starts buying a ticket in one of an event's tiers for the requesting user. Their spot is held until the order expires, and the ticket is issued once the payment provider lets us know that the payment went through. Free tiers, and orders made free by a promo code, are issued right away. Available to all users.
+//	@Tags			order
+//	@Accept			json
+//	@Produce		json
+//	@Param			order	body		orderControllerCreateRequestBody	true	"Order details"
+//	@Success		200		{object}	models.Order
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/orders [post]
+func (ctrl OrderController) Create(w http.ResponseWriter, r *http.Request) {
+	var orderRaw orderControllerCreateRequestBody
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&orderRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(orderRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requester UID
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert to ObjectIDs from string, already validated so no need to check errors
+	eventID, _ := primitive.ObjectIDFromHex(orderRaw.EventID)
+	tierID, _ := primitive.ObjectIDFromHex(orderRaw.TierID)
+
+	// Try to add to DB
+	order, err := models.CreateOrder(r.Context(), models.Order{
+		EventID:      eventID,
+		TierID:       tierID,
+		UserID:       token.UID,
+		Currency:     lib.GetPaymentCurrency(),
+		CustomFields: orderRaw.CustomFields,
+	}, orderRaw.PromoCode, lib.GetOrderHoldDuration())
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrTierNotFound:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("tier does not exist for event")))
+		case models.ErrTierNotOnSale:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("tickets in this tier are not on sale right now")))
+		case models.ErrInvalidCustomFields:
+			render.Render(w, r, util.ErrInvalidRequest(err))
+		case models.ErrAlreadyExists:
+			render.Render(w, r, util.ErrConflict(errors.New("already have a ticket or an unpaid order for this event")))
+		case models.ErrEventFull:
+			render.Render(w, r, util.ErrConflict(errors.New("event has reached its capacity")))
+		case models.ErrTierFull:
+			render.Render(w, r, util.ErrConflict(errors.New("ticket tier has reached its capacity")))
+		case models.ErrPromoCodeNotUsable:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("promo code is not valid for this ticket")))
+		case models.ErrPromoCodeUsedUp:
+			render.Render(w, r, util.ErrConflict(errors.New("promo code has reached its usage limit")))
+		default:
+			log.Error().Err(err).Msg("could not create order")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+
+	if order.Amount == 0 {
+		// Nothing to pay, so issue the ticket straight away
+		var ticket models.Ticket
+		order, ticket, err = models.FulfillOrder(r.Context(), order.ID, "", 0)
+		if err != nil {
+			log.Error().Err(err).Any("order", order).Msg("could not issue ticket for free order")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+
+		log.Info().
+			Str("type", "audit").
+			Str("controller", "order").
+			Str("requester_uid", token.UID).
+			Str("order_id", order.ID.Hex()).
+			Any("ticket_data", ticket).
+			Str("action", "issueOrderTicket").
+			Bool("privileged", false).
+			Msg("issued ticket for free order")
+	} else {
+		// Start taking payment
+		session, err := lib.Payments.CreateCheckout(r.Context(), lib.CheckoutRequest{
+			OrderID:     order.ID.Hex(),
+			Amount:      order.Amount,
+			Currency:    order.Currency,
+			Description: "FraserTickets order " + order.ID.Hex(),
+			ExpiresAt:   order.ExpiresTimestamp,
+		})
+		if err == nil {
+			err = models.SetOrderCheckout(r.Context(), &order, lib.Payments.Name(), session)
+		}
+		if err != nil {
+			// Don't hold a spot for an order that can't be paid
+			models.UpdateOrderStatus(r.Context(), order.ID, []string{models.OrderStatusPending}, models.OrderStatusFailed, "could not start checkout")
+			log.Error().Err(err).Str("order_id", order.ID.Hex()).Msg("could not start checkout")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &order); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", token.UID).
+		Any("order", order).
+		Str("action", "createOrder").
+		Bool("privileged", false).
+		Msg("created order")
+}
+
+// Cancel gives up on an unpaid order.
+//
+//	@Summary		Cancel an order
+//	@Description	Gives up on an order that hasn't been paid for yet, freeing up its spot. Only available to the buyer.
+//	@Tags			order
+//	@Produce		json
+//	@Param			id	path		string	true	"Order ID"
+//	@Success		200	{object}	models.Order
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/orders/{id}/cancel [post]
+func (ctrl OrderController) Cancel(w http.ResponseWriter, r *http.Request) {
+	order, ok := getOrderFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Only the buyer can cancel
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if order.UserID != token.UID {
+		log.Warn().Str("uid", token.UID).Msg("user attempting to cancel another person's order")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	// Only works if it hasn't been paid yet
+	err = models.UpdateOrderStatus(r.Context(), order.ID, []string{models.OrderStatusPending}, models.OrderStatusCancelled, "")
+	if err == models.ErrNoDocumentModified {
+		render.Render(w, r, util.ErrConflict(errors.New("order is already "+order.Status)))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not cancel order")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	order.Status = models.OrderStatusCancelled
+
+	// Stop the checkout from being paid, not much we can do if it fails
+	if order.CheckoutSessionID != "" {
+		if err := lib.Payments.ExpireCheckout(r.Context(), order.CheckoutSessionID); err != nil {
+			log.Warn().Err(err).Str("order_id", order.ID.Hex()).Msg("could not expire checkout session")
+		}
+	}
+
+	// Spot is free again
+	if maxScanCount, err := getTierMaxScanCount(r, order); err != nil {
+		log.Error().Err(err).Str("order_id", order.ID.Hex()).Msg("could not fetch tier of order, not promoting from waitlist")
+	} else {
+		PromoteFromWaitlist(r.Context(), order.EventID, order.TierID, maxScanCount, token.UID)
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &order); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", token.UID).
+		Str("order_id", order.ID.Hex()).
+		Str("action", "cancelOrder").
+		Bool("privileged", false).
+		Msg("cancelled order")
+}
+
+// GetLedger fetches the payments and refunds for an order.
+//
+//	@Summary		Get order ledger
+//	@Description	Get an order along with every payment and refund made for it, oldest first. Only available to admins.
+//	@Tags			order
+//	@Produce		json
+//	@Param			id	path		string	true	"Order ID"
+//	@Success		200	{object}	OrderLedger
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/orders/{id}/ledger [get]
+func (ctrl OrderController) GetLedger(w http.ResponseWriter, r *http.Request) {
+	order, ok := getOrderFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to get ledger entries
+	payments, err := models.GetPayments(r.Context(), bson.M{"order": order.ID})
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch payments for order")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	refunds, err := models.GetRefunds(r.Context(), bson.M{"order": order.ID})
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch refunds for order")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	ledger := OrderLedger{Order: order, Payments: payments, Refunds: refunds}
+	if err := render.Render(w, r, &ledger); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", requesterUID).
+		Str("order_id", order.ID.Hex()).
+		Str("action", "getOrderLedger").
+		Bool("privileged", true).
+		Msg("fetched order ledger")
+}
+
+// Refund gives back part or all of an order's payment.
+//
+//	@Summary		Refund an order
+//	@Description	Gives back part or all of what was paid for an order through the payment provider. Any refund voids the order's ticket, which frees its spot for the waitlist. Only available to admins.
+//	@Tags			order
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string								true	"Order ID"
+//	@Param			refund	body		orderControllerRefundRequestBody	true	"Refund details"
+//	@Success		200		{object}	models.Refund
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/orders/{id}/refund [post]
+func (ctrl OrderController) Refund(w http.ResponseWriter, r *http.Request) {
+	var refundRaw orderControllerRefundRequestBody
+
+	order, ok := getOrderFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&refundRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(refundRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requester UID
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Only orders with money behind them can be refunded
+	payment, err := models.GetPayment(r.Context(), bson.M{"order": order.ID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrConflict(errors.New("order has not been paid for")))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch payment for order")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Refund whatever is left if no amount is given
+	amount := refundRaw.Amount
+	if amount == 0 {
+		amount = payment.RefundableAmount()
+	}
+	if amount <= 0 {
+		render.Render(w, r, util.ErrConflict(errors.New("order has already been fully refunded")))
+		return
+	}
+
+	// Try to refund
+	refund, err := models.RefundPayment(r.Context(), payment, amount, refundRaw.Reason, token.UID)
+	if err == models.ErrRefundTooLarge {
+		render.Render(w, r, util.ErrConflict(err))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Any("refund", refund).Msg("could not refund order")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Ticket was voided, so its spot is free again
+	if !payment.TicketID.IsZero() {
+		if maxScanCount, err := getTierMaxScanCount(r, order); err != nil {
+			log.Error().Err(err).Str("order_id", order.ID.Hex()).Msg("could not fetch tier of order, not promoting from waitlist")
+		} else {
+			PromoteFromWaitlist(r.Context(), order.EventID, order.TierID, maxScanCount, token.UID)
+		}
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &refund); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", token.UID).
+		Str("order_id", order.ID.Hex()).
+		Any("refund", refund).
+		Str("action", "refundOrder").
+		Bool("privileged", true).
+		Msg("refunded order")
+}
+
+// Webhook handles payment updates from the payment provider.
+//
+//	@Summary		Payment provider webhook
+//	@Description	Receives updates from the payment provider about checkouts. Issues the order's ticket once payment settles, or refunds the payment if it doesn't match the order's amount. Only meant to be called by the payment provider.
+//	@Tags			order
+//	@Success		200
+//	@Failure		400
+//	@Failure		500
+//	@Router			/orders/webhook [post]
+func (ctrl OrderController) Webhook(w http.ResponseWriter, r *http.Request) {
+	// Make sure it's actually from the provider
+	event, err := lib.Payments.ParseWebhook(r)
+	if err == lib.ErrUnknownSession {
+		// Not something we can do anything with, so don't make the provider retry
+		log.Warn().Err(err).Msg("payment webhook for unknown checkout session")
+		w.WriteHeader(http.StatusOK)
+		return
+	} else if err != nil {
+		log.Warn().Err(err).Msg("could not verify payment webhook")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Find which order it's for
+	order, err := models.GetOrder(r.Context(), bson.M{"checkout_session": event.SessionID, "provider": lib.Payments.Name()})
+	if err == mongo.ErrNoDocuments {
+		log.Warn().Str("session", event.SessionID).Msg("payment webhook for session without an order")
+		w.WriteHeader(http.StatusOK)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch order for payment webhook")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	if event.Status == lib.PaymentStatusFailed {
+		err := models.UpdateOrderStatus(r.Context(), order.ID, []string{models.OrderStatusPending}, models.OrderStatusFailed, "payment failed")
+		if err != nil && err != models.ErrNoDocumentModified {
+			log.Error().Err(err).Msg("could not mark order as failed")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+
+		// Write audit info log
+		log.Info().
+			Str("type", "audit").
+			Str("controller", "order").
+			Str("requester_uid", "").
+			Str("order_id", order.ID.Hex()).
+			Str("action", "failOrderPayment").
+			Bool("privileged", true).
+			Msg("payment failed for order")
+		return
+	}
+
+	if event.Amount != order.Amount {
+		// Don't issue a ticket for the wrong amount, give the money back instead
+		log.Error().Int64("paid", event.Amount).Int64("expected", order.Amount).Str("order_id", order.ID.Hex()).Msg("payment amount does not match order")
+		order, refund, err := models.RejectOrderPayment(r.Context(), order.ID, event.PaymentID, event.Amount, "paid amount did not match order")
+		if err == models.ErrNoDocumentModified {
+			// Webhook was already handled
+			w.WriteHeader(http.StatusOK)
+			return
+		} else if err != nil {
+			// Order has been marked as failed, so the provider shouldn't retry
+			log.Error().Err(err).Any("order", order).Any("refund", refund).Msg("could not refund payment that did not match order")
+		}
+		w.WriteHeader(http.StatusOK)
+
+		// Write audit info log
+		log.Info().
+			Str("type", "audit").
+			Str("controller", "order").
+			Str("requester_uid", "").
+			Str("order_id", order.ID.Hex()).
+			Str("payment_id", event.PaymentID).
+			Any("refund", refund).
+			Str("action", "rejectOrderPayment").
+			Bool("privileged", true).
+			Msg("rejected payment that did not match order")
+		return
+	}
+
+	// Issue the ticket
+	order, ticket, err := models.FulfillOrder(r.Context(), order.ID, event.PaymentID, event.Amount)
+	if err == models.ErrNoDocumentModified {
+		// Webhook was already handled
+		w.WriteHeader(http.StatusOK)
+		return
+	} else if err != nil {
+		// Order has been marked as failed with the reason, so the provider shouldn't retry
+		log.Error().Err(err).Any("order", order).Msg("payment settled but ticket could not be issued")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "order").
+		Str("requester_uid", "").
+		Str("order_id", order.ID.Hex()).
+		Str("payment_id", event.PaymentID).
+		Any("ticket_data", ticket).
+		Str("action", "issueOrderTicket").
+		Bool("privileged", true).
+		Msg("issued ticket for paid order")
+}
+
+// getOrderFromURL fetches the order given in the URL, rendering an error response if it
+// can't be found.
+func getOrderFromURL(w http.ResponseWriter, r *http.Request) (models.Order, bool) {
+	// Get ID of requested order
+	id := chi.URLParam(r, "id")
+
+	// Convert to ObjectID
+	orderID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert id to objectid")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return models.Order{}, false
+	}
+
+	// Try to fetch from DB
+	order, err := models.GetOrder(r.Context(), bson.M{"_id": orderID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return models.Order{}, false
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch order")
+		render.Render(w, r, util.ErrServer(err))
+		return models.Order{}, false
+	}
+
+	return order, true
+}
+
+// getTierMaxScanCount gets the max scan count of an order's tier, for promoting someone
+// from the waitlist into the spot it held.
+func getTierMaxScanCount(r *http.Request, order models.Order) (int, error) {
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": order.EventID})
+	if err != nil {
+		return -1, err
+	}
+	tier, ok := event.GetTicketTier(order.TierID)
+	if !ok {
+		return -1, models.ErrTierNotFound
+	}
+	return tier.MaxScanCount, nil
+}
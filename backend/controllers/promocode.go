@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/middleware"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type promoCodeControllerCreateRequestBody struct {
+	Code              string    `json:"code"              validate:"required"`
+	EventID           string    `json:"eventID"           validate:"required,mongodb"`
+	Type              string    `json:"type"              validate:"required,oneof=percentage fixed free"`
+	Value             int64     `json:"value"             validate:"gte=0"`                  // Percent off for percentage codes, cents off for fixed codes, leave empty for free codes
+	TierIDs           []string  `json:"tierIDs"           validate:"omitempty,dive,mongodb"` // Leave empty to allow any tier
+	MaxUses           int       `json:"maxUses"           validate:"gte=0"`                  // Leave empty for no limit
+	MaxUsesPerStudent int       `json:"maxUsesPerStudent" validate:"gte=0"`                  // Leave empty for no limit
+	ExpiresTime       time.Time `json:"expiresTime"`                                         // Leave empty to never expire
+}
+
+type PromoCodeController struct{}
+
+func (ctrl PromoCodeController) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthenticatorMiddleware) // User must be authenticated before using any of these endpoints
+
+	// Admin-only routes
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(util.PermissionPromoCodesManage))
+		r.Get("/", ctrl.List)                            // GET /promocodes - returns all promo codes, requires promocodes:manage
+		r.Post("/", ctrl.Create)                         // POST /promocodes - create a new promo code, requires promocodes:manage
+		r.Get("/{id}", ctrl.Get)                         // GET /promocodes/{id} - get a specific promo code, requires promocodes:manage
+		r.Patch("/{id}", ctrl.Update)                    // PATCH /promocodes/{id} - update a promo code's limits, requires promocodes:manage
+		r.Delete("/{id}", ctrl.Delete)                   // DELETE /promocodes/{id} - delete an unused promo code, requires promocodes:manage
+		r.Get("/{id}/redemptions", ctrl.ListRedemptions) // GET /promocodes/{id}/redemptions - returns all uses of a promo code, requires promocodes:manage
+	})
+
+	return r
+}
+
+// getPromoCodeIDFromURL reads the promo code ID from the URL, rendering an error if it's invalid.
+func getPromoCodeIDFromURL(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	id := chi.URLParam(r, "id")
+
+	// Convert to ObjectID
+	promoCodeID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert id to objectid")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return primitive.NilObjectID, false
+	}
+
+	return promoCodeID, true
+}
+
+// List fetches all promo codes, optionally only for one event.
+//
+//	@Summary		List promo codes
+//	@Description	List all promo codes, optionally filtered to one event. Only available to admins.
+//	@Tags			promocode
+//	@Produce		json
+//	@Param			eventID	query		string	false	"Only list promo codes for this event"
+//	@Success		200		{object}	[]models.PromoCode
+//	@Failure		400
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/promocodes [get]
+func (ctrl PromoCodeController) List(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+
+	// Filter by event if needed
+	if rawEventID := r.URL.Query().Get("eventID"); rawEventID != "" {
+		eventID, err := primitive.ObjectIDFromHex(rawEventID)
+		if err != nil {
+			log.Error().Err(err).Str("id", rawEventID).Msg("could not parse event id")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+		filter["event"] = eventID
+	}
+
+	// Try to get promo codes
+	promoCodes, err := models.GetPromoCodes(r.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch promo codes")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, promoCode := range promoCodes {
+		p := promoCode // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &p)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "promocode").
+		Str("requester_uid", requesterUID).
+		Any("filter", filter).
+		Str("action", "listPromoCodes").
+		Bool("privileged", true).
+		Msg("listed promo codes")
+}
+
+// Get fetches a specific promo code.
+//
+//	@Summary		Get promo code
+//	@Description	Get a specific promo code, including how many times it has been used. Only available to admins.
+//	@Tags			promocode
+//	@Produce		json
+//	@Param			id	path		string	true	"Promo code ID"
+//	@Success		200	{object}	models.PromoCode
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/promocodes/{id} [get]
+func (ctrl PromoCodeController) Get(w http.ResponseWriter, r *http.Request) {
+	promoCodeID, ok := getPromoCodeIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to fetch from DB
+	promoCode, err := models.GetPromoCode(r.Context(), bson.M{"_id": promoCodeID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch promo code")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &promoCode); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "promocode").
+		Str("requester_uid", requesterUID).
+		Str("promo_code_id", promoCodeID.Hex()).
+		Str("action", "getPromoCode").
+		Bool("privileged", true).
+		Msg("fetched promo code")
+}
+
+// Create creates a new promo code.
+//
+//	@Summary		Create new promo code
+//	@Description	Create a new promo code for an event. Codes are case-insensitive and must be unique within the event. Only available to admins.
+//	@Tags			promocode
+//	@Accept			json
+//	@Produce		json
+//	@Param			promoCode	body		promoCodeControllerCreateRequestBody	true	"Promo code details"
+//	@Success		200			{object}	models.PromoCode
+//	@Failure		400
+//	@Failure		403
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/promocodes [post]
+func (ctrl PromoCodeController) Create(w http.ResponseWriter, r *http.Request) {
+	var promoCodeRaw promoCodeControllerCreateRequestBody
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&promoCodeRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(promoCodeRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requester UID
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert to ObjectIDs from string, already validated so no need to check errors
+	eventID, _ := primitive.ObjectIDFromHex(promoCodeRaw.EventID)
+	tierIDs := []primitive.ObjectID{}
+	for _, rawTierID := range promoCodeRaw.TierIDs {
+		tierID, _ := primitive.ObjectIDFromHex(rawTierID)
+		tierIDs = append(tierIDs, tierID)
+	}
+
+	// Transfer all data from raw to actual promo code
+	promoCode := models.PromoCode{
+		Code:              models.NormalizePromoCode(promoCodeRaw.Code),
+		EventID:           eventID,
+		Type:              promoCodeRaw.Type,
+		Value:             promoCodeRaw.Value,
+		TierIDs:           tierIDs,
+		MaxUses:           promoCodeRaw.MaxUses,
+		MaxUsesPerStudent: promoCodeRaw.MaxUsesPerStudent,
+		ExpiresTimestamp:  promoCodeRaw.ExpiresTime,
+		CreatedBy:         token.UID,
+	}
+
+	// Try to add to DB
+	id, err := models.CreatePromoCode(r.Context(), promoCode)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("event given was not found")))
+		case models.ErrTierNotFound:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("tier does not exist for event")))
+		case models.ErrAlreadyExists:
+			render.Render(w, r, util.ErrConflict(errors.New("promo code already exists for event")))
+		case models.ErrInvalidPromoCodeType, models.ErrInvalidPromoCodeValue:
+			render.Render(w, r, util.ErrInvalidRequest(err))
+		default:
+			log.Error().Err(err).Msg("could not add promo code to db")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+	promoCode, err = models.GetPromoCode(r.Context(), bson.M{"_id": id})
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch newly created promo code")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &promoCode); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "promocode").
+		Str("requester_uid", token.UID).
+		Any("promo_code_data", promoCode).
+		Str("action", "createPromoCode").
+		Bool("privileged", true).
+		Msg("created a new promo code")
+}
+
+// Update updates a promo code.
+//
+//	@Summary		Update promo code
+//	@Description	Update a promo code's limits, expiry, or whether it's disabled. The code and discount can't be changed once created. Lowering a limit below the current uses stops new uses without affecting existing orders. Only available to admins.
+//	@Tags			promocode
+//	@Accept			json
+//	@Param			id		path	string					true	"Promo code ID"
+//	@Param			updates	body	map[string]interface{}	true	"Updates to make"
+//	@Success		200
+//	@Failure		304
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/promocodes/{id} [patch]
+func (ctrl PromoCodeController) Update(w http.ResponseWriter, r *http.Request) {
+	promoCodeID, ok := getPromoCodeIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Get JSON body
+	var requestedUpdates map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&requestedUpdates)
+	if err != nil {
+		log.Error().Stack().Err(err).Send()
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try updating the appropriate document
+	err = models.UpdateExistingPromoCode(r.Context(), promoCodeID, requestedUpdates)
+	if err != nil {
+		if err == models.ErrNotFound {
+			render.Render(w, r, util.ErrNotFound)
+			return
+		} else if err == models.ErrNoDocumentModified {
+			log.Error().Stack().Err(err).Send()
+			render.Render(w, r, util.ErrUnmodified)
+			return
+		}
+
+		// Anything else is from an invalid update
+		log.Error().Stack().Err(err).Send()
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "promocode").
+		Str("requester_uid", requesterUID).
+		Str("promo_code_id", promoCodeID.Hex()).
+		Any("requestedUpdates", requestedUpdates).
+		Str("action", "updatePromoCode").
+		Bool("privileged", true).
+		Msg("updated promo code details")
+}
+
+// Delete deletes a promo code.
+//
+//	@Summary		Delete promo code
+//	@Description	Deletes a promo code that has never been used. Codes that have been used should be disabled instead. Only available to admins.
+//	@Tags			promocode
+//	@Param			id	path	string	true	"Promo code ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/promocodes/{id} [delete]
+func (ctrl PromoCodeController) Delete(w http.ResponseWriter, r *http.Request) {
+	promoCodeID, ok := getPromoCodeIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Fetch promo code data so that we can log it later
+	promoCode, _ := models.GetPromoCode(r.Context(), bson.M{"_id": promoCodeID})
+
+	// Try to delete document
+	err := models.DeletePromoCode(r.Context(), promoCodeID)
+	if err == models.ErrNotFound {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err == models.ErrPromoCodeInUse {
+		render.Render(w, r, util.ErrConflict(errors.New("promo code has already been used, disable it instead")))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not delete promo code")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "promocode").
+		Str("requester_uid", requesterUID).
+		Any("promo_code_data", promoCode).
+		Str("action", "deletePromoCode").
+		Bool("privileged", true).
+		Msg("deleted promo code")
+}
+
+// ListRedemptions fetches every time a promo code was used.
+//
+//	@Summary		List promo code redemptions
+//	@Description	List every order that used a promo code, including ones that are still unpaid or never went through. Only available to admins.
+//	@Tags			promocode
+//	@Produce		json
+//	@Param			id	path		string	true	"Promo code ID"
+//	@Success		200	{object}	[]models.PromoRedemption
+//	@Failure		400
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/promocodes/{id}/redemptions [get]
+func (ctrl PromoCodeController) ListRedemptions(w http.ResponseWriter, r *http.Request) {
+	promoCodeID, ok := getPromoCodeIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to get redemptions
+	redemptions, err := models.GetPromoRedemptions(r.Context(), bson.M{"promo_code": promoCodeID})
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch promo code redemptions")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, redemption := range redemptions {
+		rd := redemption // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &rd)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "promocode").
+		Str("requester_uid", requesterUID).
+		Str("promo_code_id", promoCodeID.Hex()).
+		Str("action", "listPromoRedemptions").
+		Bool("privileged", true).
+		Msg("listed promo code redemptions")
+}
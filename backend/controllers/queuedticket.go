@@ -22,7 +22,8 @@ import (
 type queuedTicketControllerCreateRequestBody struct {
 	StudentNumber string `json:"studentNumber" validate:"required"`
 	EventID       string `json:"eventID" validate:"required,mongodb"`
-	MaxScanCount  int    `json:"maxScanCount" validate:"gte=0"`
+	TierID        string `json:"tierID" validate:"omitempty,mongodb"` // Leave empty if event doesn't use tiers
+	MaxScanCount  int    `json:"maxScanCount" validate:"gte=0"`       // Defaults to tier's max scan count if 0 and a tier is given
 }
 
 type QueuedTicketController struct{}
@@ -33,10 +34,13 @@ func (ctrl QueuedTicketController) Routes() chi.Router {
 
 	// Admin-only routes
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AdminAuthorizerMiddleware)
-		r.Post("/", ctrl.Create)       // POST /queuedtickets - create a new ticket, only available to admins
-		r.Get("/", ctrl.ListAll)       // GET /queuedtickets - returns all tickets, only available to admins
-		r.Delete("/{id}", ctrl.Delete) // DELETE /queuedtickets/{id} - deletes a queued ticket, only available to admins
+		r.Use(middleware.RequirePermission(util.PermissionTicketsWrite))
+		r.Post("/", ctrl.Create)       // POST /queuedtickets - create a new ticket, requires tickets:write
+		r.Delete("/{id}", ctrl.Delete) // DELETE /queuedtickets/{id} - deletes a queued ticket, requires tickets:write
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(util.PermissionTicketsRead))
+		r.Get("/", ctrl.ListAll) // GET /queuedtickets - returns all tickets, requires tickets:read
 	})
 
 	return r
@@ -148,7 +152,7 @@ func (ctrl QueuedTicketController) Create(w http.ResponseWriter, r *http.Request
 	}
 
 	// Check if event exists
-	_, err = models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
 	if err == mongo.ErrNoDocuments {
 		log.Error().Err(err).Str("id", queuedTicketRaw.EventID).Msg("no such event exists")
 		render.Render(w, r, util.ErrInvalidRequest(err))
@@ -159,6 +163,12 @@ func (ctrl QueuedTicketController) Create(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Check if tier exists for event
+	tier, ok := getTicketTierForNewTicket(w, r, event, queuedTicketRaw.TierID)
+	if !ok {
+		return
+	}
+
 	// Try to find the user object associated with student number
 	user, err := models.GetUserByKey(r.Context(), "student_number", queuedTicketRaw.StudentNumber)
 	if err == nil {
@@ -173,7 +183,11 @@ func (ctrl QueuedTicketController) Create(w http.ResponseWriter, r *http.Request
 
 	// Transfer all data from raw to actual ticket
 	queuedTicket.EventID = eventID
+	queuedTicket.Tier = tier.ID
 	queuedTicket.MaxScanCount = queuedTicketRaw.MaxScanCount
+	if queuedTicket.MaxScanCount == 0 {
+		queuedTicket.MaxScanCount = tier.MaxScanCount
+	}
 	queuedTicket.StudentNumber = queuedTicketRaw.StudentNumber
 	queuedTicket.Timestamp = time.Now()
 
@@ -197,6 +211,21 @@ func (ctrl QueuedTicketController) Create(w http.ResponseWriter, r *http.Request
 				errMsg = "event given was not found"
 				renderErr = util.ErrInvalidRequest(errors.New(errMsg))
 			}
+		case models.ErrEventFull:
+			{
+				errMsg = "event has reached its capacity"
+				renderErr = util.ErrConflict(errors.New(errMsg))
+			}
+		case models.ErrTierFull:
+			{
+				errMsg = "ticket tier has reached its capacity"
+				renderErr = util.ErrConflict(errors.New(errMsg))
+			}
+		case models.ErrTierNotFound:
+			{
+				errMsg = "tier does not exist for event"
+				renderErr = util.ErrInvalidRequest(errors.New(errMsg))
+			}
 		default:
 			{
 				errMsg = "could not add ticket to db"
@@ -275,12 +304,17 @@ func (ctrl QueuedTicketController) Delete(w http.ResponseWriter, r *http.Request
 
 	w.WriteHeader(http.StatusOK)
 
-	// Write audit info log
+	// Get requester so promotions are attributed to them
 	token, err := util.GetUserTokenFromContext(r.Context())
 	requesterUID := ""
 	if err == nil {
 		requesterUID = token.UID
 	}
+
+	// Give the spot to whoever is next in line
+	PromoteFromWaitlist(r.Context(), queuedTicket.EventID, queuedTicket.Tier, queuedTicket.MaxScanCount, requesterUID)
+
+	// Write audit info log
 	log.Info().
 		Str("type", "audit").
 		Str("controller", "queuedticket").
@@ -0,0 +1,471 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/middleware"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type scanStationControllerCreateRequestBody struct {
+	Name             string    `json:"name"             validate:"required"`
+	EventID          string    `json:"eventID"          validate:"required,mongodb"`
+	AllowedAdminUIDs []string  `json:"allowedAdminUIDs"` // Leave empty to let any admin use the station
+	Role             string    `json:"role"             validate:"required,oneof=entry exit any"`
+	ActiveFrom       time.Time `json:"activeFrom"`  // Leave empty for no start limit
+	ActiveUntil      time.Time `json:"activeUntil"` // Leave empty for no end limit
+}
+
+type ScanStationController struct{}
+
+func (ctrl ScanStationController) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthenticatorMiddleware) // User must be authenticated before using any of these endpoints
+
+	// Door staff need to be able to pick their station
+	r.With(middleware.RequireStaffPermission(util.PermissionTicketsScan)).
+		Get("/", ctrl.List) // GET /scanstations - returns all scan stations, requires tickets:scan globally or for the given event
+	r.With(middleware.RequirePermission(util.PermissionTicketsScan)).
+		Get("/{id}", ctrl.Get) // GET /scanstations/{id} - get a specific scan station, requires tickets:scan
+
+	// Admin-only routes
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(util.PermissionScanStationManage))
+		r.Post("/", ctrl.Create)       // POST /scanstations - create a new scan station, requires scanstations:manage
+		r.Patch("/{id}", ctrl.Update)  // PATCH /scanstations/{id} - update a scan station, requires scanstations:manage
+		r.Delete("/{id}", ctrl.Delete) // DELETE /scanstations/{id} - delete a scan station, requires scanstations:manage
+	})
+
+	return r
+}
+
+// List fetches all scan stations, optionally only for one event.
+//
+//	@Summary		List scan stations
+//	@Description	List all scan stations, optionally filtered to one event. Only available to admins and scanners, or to an event's scanners if it's given.
+//	@Tags			scanstation
+//	@Produce		json
+//	@Param			eventID	query		string	false	"Only list stations for this event"
+//	@Success		200		{object}	[]models.ScanStation
+//	@Failure		400
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/scanstations [get]
+func (ctrl ScanStationController) List(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+
+	// Filter by event if needed
+	eventID := primitive.NilObjectID
+	if rawEventID := r.URL.Query().Get("eventID"); rawEventID != "" {
+		var err error
+		eventID, err = primitive.ObjectIDFromHex(rawEventID)
+		if err != nil {
+			log.Error().Err(err).Str("id", rawEventID).Msg("could not parse event id")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+		filter["event"] = eventID
+	}
+
+	// Event staff can only see their own event's stations
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	role := util.GetRoleFromClaims(token.Claims)
+	if !role.HasPermission(util.PermissionTicketsScan) {
+		if eventID.IsZero() {
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("eventID must be given by event staff")))
+			return
+		}
+		canScan, err := models.HasEventPermission(r.Context(), eventID, token.UID, role, util.PermissionTicketsScan)
+		if err != nil {
+			log.Error().Err(err).Msg("could not check event staff permissions")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+		if !canScan {
+			log.Warn().Str("uid", token.UID).Str("eventId", eventID.Hex()).Msg("unauthorized user attempting to list another event's scan stations")
+			render.Render(w, r, util.ErrForbidden)
+			return
+		}
+	}
+
+	// Try to get scan stations
+	stations, err := models.GetScanStations(r.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch scan stations")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, station := range stations {
+		s := station // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &s)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "scanstation").
+		Str("requester_uid", token.UID).
+		Any("filter", filter).
+		Str("action", "listScanStations").
+		Bool("privileged", true).
+		Msg("listed scan stations")
+}
+
+// Get fetches a specific scan station.
+//
+//	@Summary		Get scan station
+//	@Description	Get a specific scan station. Only available to admins and scanners.
+//	@Tags			scanstation
+//	@Produce		json
+//	@Param			id	path		string	true	"Scan station ID"
+//	@Success		200	{object}	models.ScanStation
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/scanstations/{id} [get]
+func (ctrl ScanStationController) Get(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested scan station
+	id := chi.URLParam(r, "id")
+
+	// Convert to ObjectID
+	stationID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert id to objectid")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try to fetch from DB
+	station, err := models.GetScanStation(r.Context(), stationID)
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch scan station")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &station); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "scanstation").
+		Str("requester_uid", requesterUID).
+		Str("station_id", id).
+		Str("action", "getScanStation").
+		Bool("privileged", true).
+		Msg("fetched scan station")
+}
+
+// Create creates a new scan station.
+//
+//	@Summary		Create new scan station
+//	@Description	Create a new scan station for an event. Only available to admins.
+//	@Tags			scanstation
+//	@Accept			json
+//	@Produce		json
+//	@Param			station	body		scanStationControllerCreateRequestBody	true	"Scan station details"
+//	@Success		200		{object}	models.ScanStation
+//	@Failure		400
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/scanstations [post]
+func (ctrl ScanStationController) Create(w http.ResponseWriter, r *http.Request) {
+	var stationRaw scanStationControllerCreateRequestBody
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&stationRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(stationRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Active window should make sense if both ends are given
+	if !stationRaw.ActiveFrom.IsZero() && !stationRaw.ActiveUntil.IsZero() && !stationRaw.ActiveUntil.After(stationRaw.ActiveFrom) {
+		err := fmt.Errorf("active until must be after active from")
+		log.Error().Err(err).Msg("invalid active window")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Convert to ObjectID from string
+	eventID, err := primitive.ObjectIDFromHex(stationRaw.EventID)
+	if err != nil {
+		log.Error().Err(err).Str("id", stationRaw.EventID).Msg("could not parse event id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Transfer all data from raw to actual scan station
+	station := models.ScanStation{
+		Name:             stationRaw.Name,
+		Event:            eventID,
+		AllowedAdminUIDs: stationRaw.AllowedAdminUIDs,
+		Role:             stationRaw.Role,
+		ActiveFrom:       stationRaw.ActiveFrom,
+		ActiveUntil:      stationRaw.ActiveUntil,
+	}
+
+	// Try to add to DB
+	id, err := models.CreateNewScanStation(r.Context(), station)
+	if err == models.ErrNotFound {
+		log.Error().Err(err).Str("event", stationRaw.EventID).Msg("event given was not found")
+		render.Render(w, r, util.ErrInvalidRequest(errors.New("event given was not found")))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not add scan station to db")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	station.ID = id
+	if station.AllowedAdminUIDs == nil {
+		station.AllowedAdminUIDs = []string{}
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &station); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "scanstation").
+		Str("requester_uid", requesterUID).
+		Any("station_data", station).
+		Str("action", "createScanStation").
+		Bool("privileged", true).
+		Msg("created a new scan station")
+}
+
+// Update updates a scan station.
+//
+//	@Summary		Update scan station
+//	@Description	Update the details of a scan station. Only available to admins.
+//	@Tags			scanstation
+//	@Accept			json
+//	@Param			id		path	string					true	"Scan station ID"
+//	@Param			updates	body	map[string]interface{}	true	"Updates to make"
+//	@Success		200
+//	@Failure		304
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/scanstations/{id} [patch]
+func (ctrl ScanStationController) Update(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested scan station
+	id := chi.URLParam(r, "id")
+
+	// Convert to ObjectID
+	stationID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert id to objectid")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get JSON body
+	var requestedUpdates map[string]interface{}
+	err = json.NewDecoder(r.Body).Decode(&requestedUpdates)
+	if err != nil {
+		log.Error().Stack().Err(err).Send()
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try updating the appropriate document
+	err = models.UpdateExistingScanStation(r.Context(), stationID, requestedUpdates)
+	if err != nil {
+		if err == models.ErrNotFound {
+			render.Render(w, r, util.ErrNotFound)
+			return
+		} else if err == models.ErrNoDocumentModified {
+			log.Error().Stack().Err(err).Send()
+			render.Render(w, r, util.ErrUnmodified)
+			return
+		} else if err == models.ErrEditNotAllowed || err == models.ErrInvalidStationRole {
+			render.Render(w, r, util.ErrInvalidRequest(err))
+			return
+		}
+
+		log.Error().Stack().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "scanstation").
+		Str("requester_uid", requesterUID).
+		Str("station_id", id).
+		Any("requestedUpdates", requestedUpdates).
+		Str("action", "updateScanStation").
+		Bool("privileged", true).
+		Msg("updated scan station details")
+}
+
+// Delete deletes a scan station.
+//
+//	@Summary		Delete scan station
+//	@Description	Deletes a scan station. Scans that were made at it stay in the scan history. Only available to admins.
+//	@Tags			scanstation
+//	@Param			id	path	string	true	"Scan station ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/scanstations/{id} [delete]
+func (ctrl ScanStationController) Delete(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested scan station
+	id := chi.URLParam(r, "id")
+
+	// Convert to ObjectID
+	stationID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert id to objectid")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Fetch station data so that we can log it later
+	station, _ := models.GetScanStation(r.Context(), stationID)
+
+	// Try to delete document
+	err = models.DeleteScanStation(r.Context(), stationID)
+	if err == models.ErrNoDocumentModified || err == mongo.ErrNoDocuments {
+		log.Error().Err(err).Msg("could not find scan station to delete")
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not delete scan station")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "scanstation").
+		Str("requester_uid", requesterUID).
+		Str("station_id", id).
+		Any("station_data", station).
+		Str("action", "deleteScanStation").
+		Bool("privileged", true).
+		Msg("deleted scan station")
+}
+
+// getScanStationForScanner fetches the station that a scan is being made from and makes
+// sure the scanner has been assigned to it. An error response is rendered if not.
+func getScanStationForScanner(
+	w http.ResponseWriter,
+	r *http.Request,
+	rawStationID string,
+	requesterUID string,
+) (models.ScanStation, bool) {
+	// Convert to ObjectID from string
+	stationID, err := primitive.ObjectIDFromHex(rawStationID)
+	if err != nil {
+		log.Error().Err(err).Str("id", rawStationID).Msg("could not parse scan station id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return models.ScanStation{}, false
+	}
+
+	// Try to fetch from DB
+	station, err := models.GetScanStation(r.Context(), stationID)
+	if err == mongo.ErrNoDocuments {
+		log.Error().Err(err).Str("id", rawStationID).Msg("no such scan station exists")
+		render.Render(w, r, util.ErrInvalidRequest(errors.New("scan station given was not found")))
+		return models.ScanStation{}, false
+	} else if err != nil {
+		log.Error().Err(err).Str("id", rawStationID).Msg("could not fetch scan station")
+		render.Render(w, r, util.ErrServer(err))
+		return models.ScanStation{}, false
+	}
+
+	// Volunteers can only scan at the doors they're assigned to
+	if !station.CanBeUsedBy(requesterUID) {
+		log.Warn().Str("id", rawStationID).Str("requester_uid", requesterUID).Msg("scanner is not assigned to scan station")
+		render.Render(w, r, util.ErrForbidden)
+		return models.ScanStation{}, false
+	}
+
+	return station, true
+}
@@ -0,0 +1,811 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type eventControllerCreateTableRequestBody struct {
+	Name    string `json:"name"    validate:"required"`
+	Section string `json:"section"`
+	Seats   int    `json:"seats"   validate:"gte=1"`
+}
+
+type eventControllerCreateSeatingGroupRequestBody struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type eventControllerJoinSeatingGroupRequestBody struct {
+	JoinCode string `json:"joinCode" validate:"required"`
+}
+
+type eventControllerAssignSeatingGroupRequestBody struct {
+	TableID string `json:"tableID" validate:"omitempty,mongodb"` // Leave empty to unseat the group
+}
+
+// getEventIDFromURL gets the event ID from the URL, rendering an error response if it's invalid.
+func getEventIDFromURL(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	eventID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return primitive.NilObjectID, false
+	}
+
+	return eventID, true
+}
+
+// getEventSubresourceIDFromURL gets the event ID and another ID from the URL, ex. a table or
+// group, rendering an error response if either is invalid.
+func getEventSubresourceIDFromURL(w http.ResponseWriter, r *http.Request, param string) (primitive.ObjectID, primitive.ObjectID, bool) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, param))
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return eventID, id, true
+}
+
+// renderSeatingGroupError renders the response for errors from the seating group models.
+func renderSeatingGroupError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case models.ErrNotFound:
+		render.Render(w, r, util.ErrNotFound)
+	case models.ErrTicketVoided:
+		render.Render(w, r, util.ErrInvalidRequest(errors.New("ticket has been voided")))
+	case models.ErrAlreadyExists:
+		render.Render(w, r, util.ErrConflict(errors.New("already in a seating group for this event")))
+	case models.ErrGroupSeated:
+		render.Render(w, r, util.ErrConflict(errors.New("seating group has already been seated, ask an admin to unseat it first")))
+	case models.ErrTableNotFound:
+		render.Render(w, r, util.ErrInvalidRequest(errors.New("table does not exist for event")))
+	case models.ErrTableFull:
+		render.Render(w, r, util.ErrConflict(errors.New("table does not have enough free seats")))
+	default:
+		log.Error().Err(err).Msg("could not update seating group")
+		render.Render(w, r, util.ErrServer(err))
+	}
+}
+
+// ListTables fetches the seating tables of an event.
+//
+//	@Summary		List seating tables for event
+//	@Description	List the tables that people can be seated at for an event. Available to all users.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	[]models.SeatingTable
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/tables [get]
+func (ctrl EventController) ListTables(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to fetch from DB
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not find event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, table := range event.SeatingTables {
+		t := table // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &t)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "listEventTables").
+		Str("eventId", eventID.Hex()).
+		Bool("privileged", false).
+		Msg("fetched seating tables for event")
+}
+
+// CreateTable adds a new seating table to an event.
+//
+//	@Summary		Create seating table for event
+//	@Description	Add a new table to an event. Table names have to be unique within their section. Only available to admins.
+//	@Tags			event
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string									true	"Event ID"
+//	@Param			table	body		eventControllerCreateTableRequestBody	true	"Table details"
+//	@Success		200		{object}	models.SeatingTable
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/tables [post]
+func (ctrl EventController) CreateTable(w http.ResponseWriter, r *http.Request) {
+	var tableRaw eventControllerCreateTableRequestBody
+
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&tableRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(tableRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Transfer all data from raw to actual table
+	table := models.SeatingTable{
+		Name:    tableRaw.Name,
+		Section: tableRaw.Section,
+		Seats:   tableRaw.Seats,
+	}
+
+	// Try to add to DB
+	table.ID, err = models.CreateSeatingTable(r.Context(), eventID, table)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrAlreadyExists:
+			render.Render(w, r, util.ErrConflict(errors.New("a table with that name already exists in this section")))
+		default:
+			log.Error().Err(err).Msg("could not create seating table")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &table); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "createEventTable").
+		Str("eventId", eventID.Hex()).
+		Any("table_data", table).
+		Bool("privileged", true).
+		Msg("created seating table for event")
+}
+
+// UpdateTable changes the details of one of an event's seating tables.
+//
+//	@Summary		Update seating table for event
+//	@Description	Update the details of a seating table. Tables can't be shrunk so that seats someone is already sitting in are removed. Only available to admins.
+//	@Tags			event
+//	@Accept			json
+//	@Param			id		path	string					true	"Event ID"
+//	@Param			tableID	path	string					true	"Table ID"
+//	@Param			updates	body	map[string]interface{}	true	"Updates to make"
+//	@Success		200
+//	@Failure		304
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/tables/{tableID} [patch]
+func (ctrl EventController) UpdateTable(w http.ResponseWriter, r *http.Request) {
+	eventID, tableID, ok := getEventSubresourceIDFromURL(w, r, "tableID")
+	if !ok {
+		return
+	}
+
+	// Get JSON body
+	var requestedUpdates map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&requestedUpdates)
+	if err != nil {
+		log.Error().Stack().Err(err).Send()
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try updating the table
+	err = models.UpdateSeatingTable(r.Context(), eventID, tableID, requestedUpdates)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrNoDocumentModified:
+			render.Render(w, r, util.ErrUnmodified)
+		case models.ErrTableFull:
+			render.Render(w, r, util.ErrConflict(errors.New("people are already seated in seats that would be removed")))
+		case models.ErrEditNotAllowed:
+			render.Render(w, r, util.ErrInvalidRequest(err))
+		default:
+			// Anything else is from parsing the updates
+			log.Error().Err(err).Msg("could not update seating table")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "updateEventTable").
+		Str("eventId", eventID.Hex()).
+		Str("tableId", tableID.Hex()).
+		Any("requestedUpdates", requestedUpdates).
+		Bool("privileged", true).
+		Msg("updated seating table for event")
+}
+
+// DeleteTable removes a seating table from an event.
+//
+//	@Summary		Delete seating table for event
+//	@Description	Remove a seating table from an event. Tables with groups seated at them can't be deleted. Only available to admins.
+//	@Tags			event
+//	@Param			id		path	string	true	"Event ID"
+//	@Param			tableID	path	string	true	"Table ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/tables/{tableID} [delete]
+func (ctrl EventController) DeleteTable(w http.ResponseWriter, r *http.Request) {
+	eventID, tableID, ok := getEventSubresourceIDFromURL(w, r, "tableID")
+	if !ok {
+		return
+	}
+
+	// Try deleting the table
+	err := models.DeleteSeatingTable(r.Context(), eventID, tableID)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrTableInUse:
+			render.Render(w, r, util.ErrConflict(errors.New("table still has groups seated at it, move them first")))
+		default:
+			log.Error().Err(err).Msg("could not delete seating table")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "deleteEventTable").
+		Str("eventId", eventID.Hex()).
+		Str("tableId", tableID.Hex()).
+		Bool("privileged", true).
+		Msg("deleted seating table for event")
+}
+
+// GetSelfSeatingGroup fetches the requester's seating group for an event.
+//
+//	@Summary		Get own seating group
+//	@Description	Get the seating group that the requesting user is in for an event. Available to all users.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	models.SeatingGroup
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/group [get]
+func (ctrl EventController) GetSelfSeatingGroup(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Get requester UID
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Try to fetch from DB
+	group, err := models.GetSeatingGroupForUser(r.Context(), eventID, token.UID)
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch seating group")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &group); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", token.UID).
+		Str("action", "getSelfSeatingGroup").
+		Str("eventId", eventID.Hex()).
+		Str("groupId", group.ID.Hex()).
+		Bool("privileged", false).
+		Msg("fetched requester's seating group for event")
+}
+
+// CreateSeatingGroup starts a new seating group for an event.
+//
+//	@Summary		Create seating group
+//	@Description	Start a new seating group with the requesting user and any guests they're bringing in it. Others can join using the group's join code. Available to all users with a ticket to the event.
+//	@Tags			event
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string											true	"Event ID"
+//	@Param			group	body		eventControllerCreateSeatingGroupRequestBody	true	"Group details"
+//	@Success		200		{object}	models.SeatingGroup
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/group [post]
+func (ctrl EventController) CreateSeatingGroup(w http.ResponseWriter, r *http.Request) {
+	var groupRaw eventControllerCreateSeatingGroupRequestBody
+
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&groupRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(groupRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requester UID
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Try to add to DB
+	group, err := models.CreateSeatingGroup(r.Context(), eventID, token.UID, groupRaw.Name)
+	if err != nil {
+		renderSeatingGroupError(w, r, err)
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &group); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", token.UID).
+		Str("action", "createSeatingGroup").
+		Str("eventId", eventID.Hex()).
+		Any("group_data", group).
+		Bool("privileged", false).
+		Msg("created seating group for event")
+}
+
+// JoinSeatingGroup adds the requester to a seating group.
+//
+//	@Summary		Join seating group
+//	@Description	Join a seating group using its join code, bringing along any guests the requesting user is bringing. Groups that have already been seated can't be joined. Available to all users with a ticket to the event.
+//	@Tags			event
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string										true	"Event ID"
+//	@Param			join	body		eventControllerJoinSeatingGroupRequestBody	true	"Join code"
+//	@Success		200		{object}	models.SeatingGroup
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/group/join [post]
+func (ctrl EventController) JoinSeatingGroup(w http.ResponseWriter, r *http.Request) {
+	var joinRaw eventControllerJoinSeatingGroupRequestBody
+
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&joinRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(joinRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requester UID
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Try to join group
+	group, err := models.JoinSeatingGroup(r.Context(), eventID, token.UID, joinRaw.JoinCode)
+	if err != nil {
+		renderSeatingGroupError(w, r, err)
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &group); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", token.UID).
+		Str("action", "joinSeatingGroup").
+		Str("eventId", eventID.Hex()).
+		Str("groupId", group.ID.Hex()).
+		Bool("privileged", false).
+		Msg("joined seating group for event")
+}
+
+// LeaveSeatingGroup takes the requester out of their seating group.
+//
+//	@Summary		Leave seating group
+//	@Description	Leave the requesting user's seating group, along with any guests they're bringing. Any seats they were given are freed up. Available to all users.
+//	@Tags			event
+//	@Param			id	path	string	true	"Event ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/group/leave [post]
+func (ctrl EventController) LeaveSeatingGroup(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Get requester UID
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Try to leave group
+	err = models.LeaveSeatingGroup(r.Context(), eventID, token.UID)
+	if err != nil {
+		renderSeatingGroupError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", token.UID).
+		Str("action", "leaveSeatingGroup").
+		Str("eventId", eventID.Hex()).
+		Bool("privileged", false).
+		Msg("left seating group for event")
+}
+
+// ListSeatingGroups fetches every seating group for an event.
+//
+//	@Summary		List seating groups for event
+//	@Description	List every seating group for an event, optionally only the ones that haven't been seated yet. Only available to admins.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id			path		string	true	"Event ID"
+//	@Param			unseated	query		bool	false	"Only list groups that haven't been seated"
+//	@Success		200			{object}	[]models.SeatingGroup
+//	@Failure		400
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/groups [get]
+func (ctrl EventController) ListSeatingGroups(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"event": eventID}
+	if r.URL.Query().Get("unseated") == "true" {
+		filter["table"] = bson.M{"$exists": false}
+	}
+
+	// Try to get groups
+	groups, err := models.GetSeatingGroups(r.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch seating groups")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, group := range groups {
+		g := group // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &g)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "listSeatingGroups").
+		Str("eventId", eventID.Hex()).
+		Any("filter", filter).
+		Bool("privileged", true).
+		Msg("fetched seating groups for event")
+}
+
+// AssignSeatingGroup seats a group at a table.
+//
+//	@Summary		Seat a group
+//	@Description	Seat every ticket in a group at a table, moving them if they were already seated somewhere else. An empty table ID unseats the group. Only available to admins.
+//	@Tags			event
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		string											true	"Event ID"
+//	@Param			groupID		path		string											true	"Group ID"
+//	@Param			assignment	body		eventControllerAssignSeatingGroupRequestBody	true	"Table to seat the group at"
+//	@Success		200			{object}	models.SeatingGroup
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/groups/{groupID}/assign [post]
+func (ctrl EventController) AssignSeatingGroup(w http.ResponseWriter, r *http.Request) {
+	var assignRaw eventControllerAssignSeatingGroupRequestBody
+
+	eventID, groupID, ok := getEventSubresourceIDFromURL(w, r, "groupID")
+	if !ok {
+		return
+	}
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&assignRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(assignRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Convert to ObjectID from string, already validated so no need to check errors
+	tableID := primitive.NilObjectID
+	if assignRaw.TableID != "" {
+		tableID, _ = primitive.ObjectIDFromHex(assignRaw.TableID)
+	}
+
+	// Try to seat group
+	group, err := models.AssignSeatingGroup(r.Context(), eventID, groupID, tableID)
+	if err != nil {
+		renderSeatingGroupError(w, r, err)
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &group); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "assignSeatingGroup").
+		Str("eventId", eventID.Hex()).
+		Str("groupId", groupID.Hex()).
+		Str("tableId", assignRaw.TableID).
+		Bool("privileged", true).
+		Msg("seated group for event")
+}
+
+// AutoAssignSeating seats every group that hasn't been seated yet.
+//
+//	@Summary		Automatically seat groups
+//	@Description	Seat every group that hasn't been seated yet, biggest groups first, each at the table with the most free seats. Groups that don't fit anywhere are left unseated. Only available to admins.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	models.SeatingAutoAssignResult
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/seating/auto-assign [post]
+func (ctrl EventController) AutoAssignSeating(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to seat groups
+	result, err := models.AutoAssignSeating(r.Context(), eventID)
+	if err == models.ErrNotFound {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		// Some groups might have been seated already, so log what happened
+		log.Error().Err(err).Any("result", result).Msg("could not automatically seat groups")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &result); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "autoAssignSeating").
+		Str("eventId", eventID.Hex()).
+		Int("assigned", len(result.Assigned)).
+		Int("unassigned", len(result.Unassigned)).
+		Bool("privileged", true).
+		Msg("automatically seated groups for event")
+}
@@ -1,12 +1,16 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/aritrosaha10/frasertickets/lib"
 	"github.com/aritrosaha10/frasertickets/middleware"
 	"github.com/aritrosaha10/frasertickets/models"
 	"github.com/aritrosaha10/frasertickets/util"
@@ -22,7 +26,8 @@ import (
 type ticketControllerCreateRequestBody struct {
 	StudentNumber string                 `json:"studentNumber" validate:"required"`
 	EventID       string                 `json:"eventID" validate:"required,mongodb"`
-	MaxScanCount  int                    `json:"maxScanCount" validate:"gte=0"`
+	TierID        string                 `json:"tierID" validate:"omitempty,mongodb"` // Leave empty if event doesn't use tiers
+	MaxScanCount  int                    `json:"maxScanCount" validate:"gte=0"`       // Defaults to tier's max scan count if 0 and a tier is given
 	CustomFields  map[string]interface{} `json:"customFields" validate:"required"`
 }
 
@@ -32,7 +37,14 @@ type ticketControllerSearchRequestBody struct {
 }
 
 type ticketControllerScanRequestBody struct {
-	TicketID string `json:"ticketID" validate:"required,mongodb"`
+	Payload     string `json:"payload" validate:"required"` // Signed payload from ticket's QR code
+	DeviceLabel string `json:"deviceLabel"`
+	StationID   string `json:"stationID" validate:"required,mongodb"` // Station the scan is made from, which decides the direction
+	Override    bool   `json:"override"`                              // Let the ticket in even if doors aren't open, requires tickets:write
+}
+
+type ticketControllerVoidRequestBody struct {
+	Reason string `json:"reason"` // Ex. "refunded", "banned"
 }
 
 type ticketControllerUpdateRequestBody struct {
@@ -50,27 +62,37 @@ func (ctrl TicketController) Routes() chi.Router {
 
 	// Admin-only routes
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AdminAuthorizerMiddleware)
-		r.Post("/", ctrl.Create)       // POST /tickets - create a new ticket, only available to admins
-		r.Get("/all", ctrl.ListAll)    // GET /tickets/all - returns all tickets, only available to admins
-		r.Post("/search", ctrl.Search) // POST /tickets/search - search for a ticket given an owner and event, only available to admins
-		r.Post("/scan", ctrl.Scan)     // POST /tickets/scan - scan a ticket, only available to admins
+		r.Use(middleware.RequirePermission(util.PermissionTicketsRead))
+		r.Get("/all", ctrl.ListAll)    // GET /tickets/all - returns all tickets, requires tickets:read
+		r.Post("/search", ctrl.Search) // POST /tickets/search - search for a ticket given an owner and event, requires tickets:read
 	})
+	r.With(middleware.RequirePermission(util.PermissionTicketsWrite)).
+		Post("/", ctrl.Create) // POST /tickets - create a new ticket, requires tickets:write
+	r.With(middleware.RequireStaffPermission(util.PermissionTicketsScan)).
+		Post("/scan", ctrl.Scan) // POST /tickets/scan - scan a ticket, requires tickets:scan globally or for the scan station's event
+	r.With(middleware.RequireStaffPermission(util.PermissionTicketsScan)).
+		Get("/signing-keys", ctrl.ListSigningKeys) // GET /tickets/signing-keys - returns the public keys for verifying QR codes and manifests, requires tickets:scan globally or for an event
 
 	r.Route("/user/{uid}", func(r chi.Router) {
-		r.Use(middleware.AdminAuthorizerMiddleware)
-		r.Get("/", ctrl.ListUser) // GET /tickets/user/{uid} - returns a user's tickets, only available to admins
+		r.Use(middleware.RequirePermission(util.PermissionTicketsRead))
+		r.Get("/", ctrl.ListUser) // GET /tickets/user/{uid} - returns a user's tickets, requires tickets:read
 	})
 
 	r.Route("/{id}", func(r chi.Router) {
-		r.Get("/", ctrl.Get) // GET /tickets/{id} - returns ticket data, available to admins & ticket owner
+		r.Get("/", ctrl.Get)                // GET /tickets/{id} - returns ticket data, available to ticket owner & those with tickets:read
+		r.Get("/qr", ctrl.GetQR)            // GET /tickets/{id}/qr - returns signed QR code payload, available to ticket owner & those with tickets:read
+		r.Get("/guests", ctrl.ListGuests)   // GET /tickets/{id}/guests - returns ticket's guest tickets, available to ticket owner & those with tickets:read
+		r.Post("/guests", ctrl.CreateGuest) // POST /tickets/{id}/guests - add a guest ticket, available to ticket owner & those with tickets:write
 
 		// Admin-only routes
-		r.Group(func(r chi.Router) {
-			r.Use(middleware.AdminAuthorizerMiddleware)
-			r.Patch("/", ctrl.Update)  // PATCH /tickets/{id} - update ticket, only available to admins
-			r.Delete("/", ctrl.Delete) // DELETE /tickets/{id} - delete ticket, only available to admins
-		})
+		r.With(middleware.RequirePermission(util.PermissionTicketsWrite)).
+			Patch("/", ctrl.Update) // PATCH /tickets/{id} - update ticket, requires tickets:write
+		r.With(middleware.RequirePermission(util.PermissionTicketsDelete)).
+			Delete("/", ctrl.Void) // DELETE /tickets/{id} - void ticket, requires tickets:delete
+		r.With(middleware.RequirePermission(util.PermissionEventsAnalytics)).
+			Get("/scans", ctrl.ListScans) // GET /tickets/{id}/scans - returns ticket's scan history, requires events:analytics
+		r.With(middleware.RequirePermission(util.PermissionTicketsRestore)).
+			Post("/restore", ctrl.Restore) // POST /tickets/{id}/restore - restore voided ticket, requires tickets:restore
 	})
 
 	return r
@@ -79,9 +101,10 @@ func (ctrl TicketController) Routes() chi.Router {
 // ListSelf fetches all the requester's tickets using their token in Context.
 //
 //	@Summary		List the requesting user's tickets
-//	@Description	List the tickets owned by the user sending the request. Available to all users.
+//	@Description	List the tickets owned by the user sending the request, including tickets for guests they're sponsoring. Voided tickets are hidden unless includeVoided is set. Available to all users.
 //	@Tags			ticket
 //	@Produce		json
+//	@Param			includeVoided	query	bool	false	"Whether to include voided tickets"
 //	@Success		200	{object}	[]models.Ticket
 //	@Failure		404
 //	@Failure		500
@@ -97,8 +120,14 @@ func (ctrl TicketController) ListSelf(w http.ResponseWriter, r *http.Request) {
 	}
 	uid := userToken.UID
 
+	// Hide voided tickets unless asked for
+	filter := bson.M{"owner": uid}
+	if r.URL.Query().Get("includeVoided") != "true" {
+		filter["voided"] = bson.M{"$ne": true}
+	}
+
 	// Try to get tickets
-	tickets, err := models.GetTickets(r.Context(), bson.M{"owner": uid})
+	tickets, err := models.GetTickets(r.Context(), filter)
 	if err != nil {
 		log.Error().Err(err).Str("uid", uid).Msg("could not fetch user's tickets")
 		render.Render(w, r, util.ErrServer(err))
@@ -119,9 +148,9 @@ func (ctrl TicketController) ListSelf(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Check admin status for next part, if there's an error, just ignore it
+	// Check permissions for next part, if there's an error, just ignore it
 	// as isAdmin will still be false
-	isAdmin, _ := util.CheckIfAdmin(r.Context())
+	isAdmin, _ := util.CheckPermission(r.Context(), util.PermissionTicketsRead)
 
 	// Convert into list of renderers to turn into JSON
 	renderers := []render.Renderer{}
@@ -233,7 +262,7 @@ func (ctrl TicketController) ListUser(w http.ResponseWriter, r *http.Request) {
 // ListAll fetches all tickets that exist.
 //
 //	@Summary		List all tickets
-//	@Description	List all tickets. Only available to admins.
+//	@Description	List all tickets. Only available to admins and scanners.
 //	@Tags			ticket
 //	@Param          eventId	query string false "filter by event ID"
 //	@Produce		json
@@ -359,6 +388,12 @@ func (ctrl TicketController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check if tier exists for event
+	tier, ok := getTicketTierForNewTicket(w, r, event, ticketRaw.TierID)
+	if !ok {
+		return
+	}
+
 	// Try to find the user object associated with student number
 	user, err := models.GetUserByKey(r.Context(), "student_number", ticketRaw.StudentNumber)
 	if err == mongo.ErrNoDocuments {
@@ -374,7 +409,7 @@ func (ctrl TicketController) Create(w http.ResponseWriter, r *http.Request) {
 	// Check whether user is making ticket for themselves
 	token, err := util.GetUserTokenFromContext(r.Context())
 	if token.UID == user.ID {
-		if isSuperAdmin, ok := token.Claims["superadmin"]; !ok || !(isSuperAdmin.(bool)) {
+		if util.GetRoleFromClaims(token.Claims) != util.RoleSuperAdmin {
 			log.Warn().Err(err).Str("uid", token.UID).Msg("admin tried making a ticket for themselves")
 			render.Render(w, r, util.ErrForbidden)
 			return
@@ -385,8 +420,12 @@ func (ctrl TicketController) Create(w http.ResponseWriter, r *http.Request) {
 	ticket.Owner = user.ID
 	ticket.Event = eventID
 	ticket.EventData = event
+	ticket.Tier = tier.ID
 	ticket.Timestamp = time.Now()
 	ticket.MaxScanCount = ticketRaw.MaxScanCount
+	if ticket.MaxScanCount == 0 {
+		ticket.MaxScanCount = tier.MaxScanCount
+	}
 	ticket.CustomFields = ticketRaw.CustomFields
 
 	// Try to add to DB
@@ -409,6 +448,21 @@ func (ctrl TicketController) Create(w http.ResponseWriter, r *http.Request) {
 				errMsg = "event or user given was not found"
 				renderErr = util.ErrInvalidRequest(errors.New(errMsg))
 			}
+		case models.ErrEventFull:
+			{
+				errMsg = "event has reached its capacity"
+				renderErr = util.ErrConflict(errors.New(errMsg))
+			}
+		case models.ErrTierFull:
+			{
+				errMsg = "ticket tier has reached its capacity"
+				renderErr = util.ErrConflict(errors.New(errMsg))
+			}
+		case models.ErrTierNotFound:
+			{
+				errMsg = "tier does not exist for event"
+				renderErr = util.ErrInvalidRequest(errors.New(errMsg))
+			}
 		default:
 			{
 				errMsg = "could not add ticket to db"
@@ -446,7 +500,7 @@ func (ctrl TicketController) Create(w http.ResponseWriter, r *http.Request) {
 // Get fetches a single ticket.
 //
 //	@Summary		Get one ticket
-//	@Description	Get one ticket. Only available to admins and the ticket owner.
+//	@Description	Get one ticket. Only available to admins, scanners, and the ticket owner.
 //	@Tags			ticket
 //	@Produce		json
 //	@Param			id	path		string	true	"Ticket ID"
@@ -483,17 +537,17 @@ func (ctrl TicketController) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if they are authorized to use endpoint (admin or ticket owner)
+	// Check if they are authorized to use endpoint (has tickets:read or ticket owner)
 	// This runs after the data fetch process so we can grab the ticket owner UID
-	isAdmin, err := util.CheckIfAdmin(r.Context())
+	isAdmin, err := util.CheckPermission(r.Context(), util.PermissionTicketsRead)
 	if err != nil {
-		log.Error().Err(err).Msg("could not check if requester is admin")
+		log.Error().Err(err).Msg("could not check requester permissions")
 		render.Render(w, r, util.ErrServer(err))
 		return
 	}
 
 	// Check if they're the owner of the ticket
-	idToken, _ := util.GetUserTokenFromContext(r.Context()) // Not error-checking because this gets fetched in admin check
+	idToken, _ := util.GetUserTokenFromContext(r.Context()) // Not error-checking because this gets fetched in permission check
 	isOwner := ticket.Owner == idToken.UID
 
 	// Do final authorization check
@@ -540,10 +594,138 @@ func (ctrl TicketController) Get(w http.ResponseWriter, r *http.Request) {
 		Msg("fetched ticket")
 }
 
+// GetQR fetches the signed payload to put in a ticket's QR code.
+//
+//	@Summary		Get a ticket's QR code payload
+//	@Description	Get the signed payload that should be encoded in a ticket's QR code. Only available to admins, scanners, and the ticket owner.
+//	@Tags			ticket
+//	@Produce		plain
+//	@Param			id	path		string	true	"Ticket ID"
+//	@Success		200	{string}	string
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/tickets/{id}/qr [get]
+func (ctrl TicketController) GetQR(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested ticket
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try to fetch from DB
+	ticket, err := models.GetTicket(r.Context(), objID)
+
+	// Handle errors
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			render.Render(w, r, util.ErrNotFound)
+			return
+		}
+
+		log.Error().Err(err).Msg("could not find ticket")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Check if they are authorized to use endpoint (has tickets:read or ticket owner)
+	isAdmin, err := util.CheckPermission(r.Context(), util.PermissionTicketsRead)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check requester permissions")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	idToken, _ := util.GetUserTokenFromContext(r.Context()) // Not error-checking because this gets fetched in permission check
+	if !(isAdmin || ticket.Owner == idToken.UID) {
+		log.Warn().Str("uid", idToken.UID).Msg("unauthorized user attempting to access another person's ticket qr code")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	// Voided tickets can't be scanned anyways
+	if ticket.Voided {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("ticket has been voided")))
+		return
+	}
+
+	// Sign a fresh payload for the ticket
+	signedPayload, err := lib.TicketSigner.SignTicketPayload(lib.TicketPayload{
+		TicketID: ticket.ID.Hex(),
+		EventID:  ticket.Event.Hex(),
+		IssuedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("could not sign ticket payload")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return just as string
+	w.Write([]byte(signedPayload))
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "ticket").
+		Str("requester_uid", idToken.UID).
+		Str("ticket_id", ticket.ID.Hex()).
+		Str("key_id", lib.TicketSigner.ActiveKeyID()).
+		Str("action", "getTicketQR").
+		Bool("privileged", idToken.UID != ticket.Owner).
+		Msg("issued signed ticket qr code")
+}
+
+// ListSigningKeys fetches the public keys that ticket QR codes and offline manifests are signed with.
+//
+//	@Summary		List ticket signing public keys
+//	@Description	List the Ed25519 public keys that ticket QR codes and offline scanning manifests are signed with, so scanning devices can verify them without a connection. The signature covers the base64url-encoded data before the ".". Only available to admins, scanners, and event scanners and managers.
+//	@Tags			ticket
+//	@Produce		json
+//	@Success		200	{object}	[]lib.TicketSigningKey
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/tickets/signing-keys [get]
+func (ctrl TicketController) ListSigningKeys(w http.ResponseWriter, r *http.Request) {
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, key := range lib.TicketSigner.PublicKeys() {
+		k := key // Duplicate it before passing by reference to avoid only passing the last key obj
+		renderers = append(renderers, &k)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "ticket").
+		Str("requester_uid", requesterUID).
+		Str("action", "listTicketSigningKeys").
+		Bool("privileged", true).
+		Msg("fetched ticket signing public keys")
+}
+
 // Search gets a ticket based on its owner and an event.
 //
 //	@Summary		Search for ticket using owner and event
-//	@Description	Search for a ticket by using the owner and associated event. Only available to admins.
+//	@Description	Search for a ticket by using the owner and associated event. Only available to admins and scanners.
 //	@Tags			ticket
 //	@Accept			json
 //	@Produce		json
@@ -638,7 +820,7 @@ func (ctrl TicketController) Search(w http.ResponseWriter, r *http.Request) {
 // Scan records a scanning event for a ticket.
 //
 //	@Summary		Scans a ticket
-//	@Description	Scans in a ticket given the ticket ID. Only available to admins.
+//	@Description	Scans in a ticket given the signed payload from its QR code and the station it's being scanned at. Admins can only scan at stations they've been assigned to. Entry scans outside of the event's doors open / close window are rejected unless override is set, which requires tickets:write. Only available to admins, scanners, and the event's scanners and managers.
 //	@Tags			ticket
 //	@Accept			json
 //	@Produce		json
@@ -671,11 +853,34 @@ func (ctrl TicketController) Scan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only admins can let tickets in outside of the doors open / close window
+	if searchQuery.Override {
+		canOverride, err := util.CheckPermission(r.Context(), util.PermissionTicketsWrite)
+		if err != nil {
+			log.Error().Err(err).Msg("could not check requester permissions")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+		if !canOverride {
+			log.Warn().Msg("unauthorized user attempting to override event scan window")
+			render.Render(w, r, util.ErrForbidden)
+			return
+		}
+	}
+
+	// Verify the QR code's signature before trusting anything inside it
+	payload, err := lib.TicketSigner.VerifyTicketPayload(searchQuery.Payload)
+	if err != nil {
+		log.Warn().Err(err).Str("payload", searchQuery.Payload).Msg("could not verify ticket payload")
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("ticket QR code is invalid")))
+		return
+	}
+
 	// Convert to ObjectID from string
-	ticketID, err := primitive.ObjectIDFromHex(searchQuery.TicketID)
+	ticketID, err := primitive.ObjectIDFromHex(payload.TicketID)
 	if err != nil {
-		log.Error().Err(err).Str("id", searchQuery.TicketID).Msg("could not parse ticket id")
-		render.Render(w, r, util.ErrServer(err))
+		log.Error().Err(err).Str("id", payload.TicketID).Msg("could not parse ticket id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
 		return
 	}
 
@@ -694,7 +899,42 @@ func (ctrl TicketController) Scan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user associated with ticket
+	// Payload should be for the event that the ticket is actually for
+	if payload.EventID != ticket.Event.Hex() {
+		log.Warn().Any("payload", payload).Str("eventID", ticket.Event.Hex()).Msg("ticket payload event does not match ticket")
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("ticket QR code is invalid")))
+		return
+	}
+
+	// Get requester so we know who did the scan
+	token, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	requesterUID := token.UID
+
+	// Get station that the scan is being made from
+	station, ok := getScanStationForScanner(w, r, searchQuery.StationID, requesterUID)
+	if !ok {
+		return
+	}
+
+	// Event staff can only scan at their own event's stations
+	canScan, err := models.HasEventPermission(r.Context(), station.Event, requesterUID, util.GetRoleFromClaims(token.Claims), util.PermissionTicketsScan)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check event staff permissions")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	if !canScan {
+		log.Warn().Str("uid", requesterUID).Str("stationEventID", station.Event.Hex()).Msg("unauthorized user attempting to scan ticket")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	// Get user associated with ticket, which is the sponsoring student for guest tickets
 	ticketOwner, err := models.GetUserByKey(r.Context(), "_id", ticket.Owner)
 	// Handle errors
 	if err != nil {
@@ -703,68 +943,246 @@ func (ctrl TicketController) Scan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create scan info obj to return
-	scanData := models.TicketScan{
-		Index:           ticket.ScanCount + 1,
-		Timestamp:       time.Now(),
-		TicketData:      ticket,
-		UserData:        ticketOwner,
-		Processed:       true,
-		NoProcessReason: "",
-	}
-
-	// Check if max scan count has been exceeded
-	// Max scan count of 0 means unlimited
-	if scanData.Index > ticket.MaxScanCount && ticket.MaxScanCount != 0 {
-		log.Warn().Msg("could not scan ticket since max scan count exceeded")
-
-		// Reset scan data to show previous scan
-		scanData.Index = ticket.ScanCount
-		scanData.Timestamp = ticket.LastScanTimestamp
-		scanData.Processed = false
-		scanData.NoProcessReason = "max scan count exceeded"
-
-		// Return as JSON, fallback if it fails
-		if err := render.Render(w, r, &scanData); err != nil {
-			render.Render(w, r, util.ErrRender(err))
+	// Scan record that gets saved to the scan history, whether or not it goes through
+	scanRecord := models.TicketScan{
+		TicketID:    ticket.ID,
+		EventID:     ticket.Event,
+		Timestamp:   time.Now(),
+		ScannerUID:  requesterUID,
+		DeviceLabel: searchQuery.DeviceLabel,
+		Direction:   station.Direction(),
+		StationID:   station.ID,
+	}
+
+	// Voided tickets can never be let in
+	if ticket.Voided {
+		log.Warn().Str("ticketID", ticket.ID.Hex()).Msg("voided ticket was scanned")
+		scanRecord.NoProcessReason = models.TicketScanReasonVoided
+		renderRejectedTicketScan(w, r, scanRecord, ticket, ticketOwner)
+		return
+	}
+
+	// Station has to be for the same event and open right now
+	if station.Event != ticket.Event {
+		log.Warn().Str("stationEventID", station.Event.Hex()).Str("eventID", ticket.Event.Hex()).Msg("ticket is not for the scan station's event")
+		scanRecord.NoProcessReason = models.TicketScanReasonNotForEvent
+		renderRejectedTicketScan(w, r, scanRecord, ticket, ticketOwner)
+		return
+	}
+	if !station.IsActive(scanRecord.Timestamp) {
+		log.Warn().Str("stationID", station.ID.Hex()).Msg("scan station is not active")
+		scanRecord.NoProcessReason = models.TicketScanReasonStationNotActive
+		renderRejectedTicketScan(w, r, scanRecord, ticket, ticketOwner)
+		return
+	}
+
+	// Tickets can only be scanned in while doors are open, unless an admin overrides it.
+	// People can always leave though.
+	if scanRecord.Direction != models.ScanDirectionExit {
+		event, err := models.GetEvent(r.Context(), bson.M{"_id": ticket.Event})
+		if err != nil {
+			log.Error().Err(err).Str("eventID", ticket.Event.Hex()).Msg("could not fetch event data")
+			render.Render(w, r, util.ErrServer(err))
 			return
 		}
 
-		// Write audit info log
-		token, err := util.GetUserTokenFromContext(r.Context())
-		requesterUID := ""
+		if err := event.CheckScanTime(scanRecord.Timestamp); err != nil {
+			reason, _ := models.GetTicketScanReasonForError(err)
+			if !searchQuery.Override {
+				log.Warn().Err(err).Msg("ticket scanned outside of event's scan window")
+				scanRecord.NoProcessReason = reason
+				renderRejectedTicketScan(w, r, scanRecord, ticket, ticketOwner)
+				return
+			}
+
+			// Overrides get their own audit entry so they're easy to find later
+			scanRecord.Overridden = true
+			scanRecord.OverrideReason = reason
+			log.Info().
+				Str("type", "audit").
+				Str("controller", "ticket").
+				Str("requester_uid", requesterUID).
+				Str("ticket_id", ticket.ID.Hex()).
+				Str("reason", reason).
+				Str("action", "overrideTicketScanWindow").
+				Bool("privileged", true).
+				Msg("overrode event scan window to scan ticket")
+		}
+	}
+
+	// Try to record the scan, which only succeeds if the ticket has scans left and the
+	// holder isn't already inside / outside. This is done in one operation on the DB so
+	// simultaneous scans can't both get through.
+	prevTicket, err := models.ScanTicket(r.Context(), ticketID, scanRecord.Timestamp, scanRecord.Direction)
+	if reason, rejected := models.GetTicketScanReasonForError(err); rejected {
+		log.Warn().Err(err).Msg("could not scan ticket")
+
+		// Use latest data in case another scan just got through
+		latestTicket, err := models.GetTicket(r.Context(), ticketID)
 		if err == nil {
-			requesterUID = token.UID
+			ticket = latestTicket
 		}
-		log.Info().
-			Str("type", "audit").
-			Str("controller", "ticket").
-			Str("requester_uid", requesterUID).
-			Str("ticket_id", searchQuery.TicketID).
-			Any("scan_data", scanData).
-			Str("action", "scanTicket").
-			Bool("privileged", true).
-			Msg("attempted ticket scan, but max scans reached")
 
+		scanRecord.NoProcessReason = reason
+		renderRejectedTicketScan(w, r, scanRecord, ticket, ticketOwner)
+		return
+	} else if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not update ticket with new scan info")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Show the ticket as it was right before this scan
+	ticket.ScanCount = prevTicket.ScanCount
+	ticket.LastScanTimestamp = prevTicket.LastScanTimestamp
+	ticket.Inside = prevTicket.Inside
+	ticket.LastExitTimestamp = prevTicket.LastExitTimestamp
+
+	// Save successful scan to history, exits don't count as scans
+	scanRecord.Index = prevTicket.ScanCount
+	if scanRecord.Direction != models.ScanDirectionExit {
+		scanRecord.Index++
+	}
+	scanRecord.Processed = true
+	saveTicketScan(r.Context(), scanRecord)
+
+	// Create scan info obj to return
+	scanData := scanRecord
+	scanData.TicketData = ticket
+	scanData.UserData = ticketOwner
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &scanData); err != nil {
+		render.Render(w, r, util.ErrRender(err))
 		return
 	}
 
-	// Update ticket info with new scan data
-	ticket.ScanCount = scanData.Index
-	ticket.LastScanTimestamp = scanData.Timestamp
-	err = models.UpdateExistingTicketByKeys(r.Context(), ticket.ID, map[string]interface{}{
-		"lastScanTime": scanData.Timestamp,
-		"scanCount":    scanData.Index,
-	})
-	// Handle errors
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "ticket").
+		Str("requester_uid", requesterUID).
+		Str("ticket_id", ticket.ID.Hex()).
+		Any("scan_data", scanData).
+		Str("action", "scanTicket").
+		Bool("privileged", true).
+		Msg("scanned ticket")
+}
+
+// saveTicketScan adds a scan attempt to the scan history. Failing to do so shouldn't
+// stop someone from getting in, so errors are only logged.
+func saveTicketScan(ctx context.Context, scanRecord models.TicketScan) {
+	if _, err := models.CreateTicketScan(ctx, scanRecord); err != nil {
+		log.Error().Err(err).Any("scan_record", scanRecord).Msg("could not save ticket scan to history")
+	}
+}
+
+// renderRejectedTicketScan saves a scan attempt that didn't go through and responds with
+// the ticket's previous scan, so the scanner can see when it was last let in.
+func renderRejectedTicketScan(
+	w http.ResponseWriter,
+	r *http.Request,
+	scanRecord models.TicketScan,
+	ticket models.Ticket,
+	ticketOwner models.User,
+) {
+	// Save rejected scan to history
+	scanRecord.Index = ticket.ScanCount
+	scanRecord.Processed = false
+	saveTicketScan(r.Context(), scanRecord)
+
+	// Reset scan data to show previous scan
+	scanData := scanRecord
+	scanData.Timestamp = ticket.LastScanTimestamp
+	scanData.TicketData = ticket
+	scanData.UserData = ticketOwner
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &scanData); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "ticket").
+		Str("requester_uid", scanRecord.ScannerUID).
+		Str("ticket_id", ticket.ID.Hex()).
+		Any("scan_data", scanData).
+		Str("action", "scanTicket").
+		Bool("privileged", true).
+		Msg("attempted ticket scan, but it was rejected: " + scanRecord.NoProcessReason)
+}
+
+// ListScans fetches the scan history of a ticket.
+//
+//	@Summary		List a ticket's scans
+//	@Description	List every scan attempt made on a ticket, newest first. The total number of scans is given in the X-Total-Count header. Only available to admins.
+//	@Tags			ticket
+//	@Produce		json
+//	@Param			id			path	string	true	"Ticket ID"
+//	@Param			page		query	int		false	"Page number, starting at 1"
+//	@Param			pageSize	query	int		false	"Number of scans per page"
+//	@Success		200	{object}	[]models.TicketScan
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/tickets/{id}/scans [get]
+func (ctrl TicketController) ListScans(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested ticket
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		log.Error().Err(err).Msg("could not update ticket with new info")
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requested page
+	page, pageSize, err := util.GetPaginationFromQuery(r)
+	if err != nil {
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Check if ticket exists
+	exists, err := models.CheckIfTicketExists(r.Context(), bson.M{"_id": objID})
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if ticket exists")
 		render.Render(w, r, util.ErrServer(err))
 		return
 	}
+	if !exists {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	}
 
-	// Return as JSON, fallback if it fails
-	if err := render.Render(w, r, &scanData); err != nil {
+	// Fetch page of scans
+	scans, total, err := models.GetTicketScans(r.Context(), bson.M{"ticket": objID}, page, pageSize)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch scans of ticket")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, scan := range scans {
+		s := scan // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &s)
+	}
+
+	// Return as JSON array, fallback if it fails
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	if err := render.RenderList(w, r, renderers); err != nil {
 		render.Render(w, r, util.ErrRender(err))
 		return
 	}
@@ -779,11 +1197,11 @@ func (ctrl TicketController) Scan(w http.ResponseWriter, r *http.Request) {
 		Str("type", "audit").
 		Str("controller", "ticket").
 		Str("requester_uid", requesterUID).
-		Str("ticket_id", searchQuery.TicketID).
-		Any("scan_data", scanData).
-		Str("action", "scanTicket").
+		Str("ticket_id", id).
+		Int64("page", page).
+		Str("action", "listTicketScans").
 		Bool("privileged", true).
-		Msg("scanned ticket")
+		Msg("listed ticket's scans")
 }
 
 // Update updates a ticket.
@@ -888,20 +1306,24 @@ func (ctrl TicketController) Update(w http.ResponseWriter, r *http.Request) {
 		Msg("updated ticket")
 }
 
-// Delete deletes a ticket.
+// Void voids a ticket.
 //
-//	@Summary		Delete a ticket
-//	@Description	Deletes a ticket. Only available to admins.
+//	@Summary		Void a ticket
+//	@Description	Voids a ticket instead of deleting it, so that it stays in the audit trail but can't be scanned. A reason can be given in the body. The freed up spot goes to the event's waitlist. Only available to admins.
 //	@Tags			ticket
 //	@Accept			json
-//	@Param			id	path		string	true	"Ticket ID"
+//	@Param			id		path	string							true	"Ticket ID"
+//	@Param			reason	body	ticketControllerVoidRequestBody	false	"Reason for voiding"
 //	@Success		200
+//	@Failure		400
 //	@Failure		403
 //	@Failure		404
 //	@Failure		500
 //	@Security		ApiKeyAuth
 //	@Router			/tickets/{id} [delete]
-func (ctrl TicketController) Delete(w http.ResponseWriter, r *http.Request) {
+func (ctrl TicketController) Void(w http.ResponseWriter, r *http.Request) {
+	var voidReq ticketControllerVoidRequestBody
+
 	// Get ID of requested ticket
 	id := chi.URLParam(r, "id")
 
@@ -913,37 +1335,134 @@ func (ctrl TicketController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch ticket data so that we can log it later, since we won't be able
-	// to access the ticket later. Errors should be handled in the delete ticket
+	// Parse JSON body, which is optional
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err = bodyDecoder.Decode(&voidReq)
+	if err != nil && err != io.EOF {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requester so we know who voided it
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+
+	// Fetch ticket data so we know which event a spot opened up at
 	ticket, _ := models.GetTicket(r.Context(), objID)
 
-	// Try to delete document
-	err = models.DeleteTicket(r.Context(), objID)
-	if err == models.ErrNoDocumentModified || err == mongo.ErrNoDocuments {
-		log.Error().Err(err).Msg("could not find ticket to delete")
+	// Try to void ticket
+	err = models.VoidTicket(r.Context(), objID, voidReq.Reason, requesterUID)
+	if err == models.ErrNotFound {
+		log.Error().Err(err).Msg("could not find ticket to void")
 		render.Render(w, r, util.ErrNotFound)
 		return
+	} else if err == models.ErrTicketVoided {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("ticket has already been voided")))
+		return
 	} else if err != nil {
-		log.Error().Err(err).Msg("could not delete ticket")
+		log.Error().Err(err).Msg("could not void ticket")
 		render.Render(w, r, util.ErrServer(err))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 
+	// Give the spot to whoever is next in line
+	PromoteFromWaitlist(r.Context(), ticket.Event, ticket.Tier, ticket.MaxScanCount, requesterUID)
+
 	// Write audit info log
-	token, err := util.GetUserTokenFromContext(r.Context())
-	requesterUID := ""
-	if err == nil {
-		requesterUID = token.UID
-	}
 	log.Info().
 		Str("type", "audit").
 		Str("controller", "ticket").
 		Str("requester_uid", requesterUID).
 		Str("ticket_id", objID.Hex()).
-		Any("ticket", ticket).
-		Str("action", "deleteTicket").
+		Str("reason", voidReq.Reason).
+		Str("action", "voidTicket").
+		Bool("privileged", true).
+		Msg("voided ticket")
+}
+
+// Restore restores a voided ticket.
+//
+//	@Summary		Restore a voided ticket
+//	@Description	Restores a voided ticket so that it can be used again, along with any guest tickets that were voided with it. The ticket needs a free spot at the event, since its old one may have been given to someone else. Guest tickets are restored while there's space left. Only available to superadmins.
+//	@Tags			ticket
+//	@Param			id	path	string	true	"Ticket ID"
+//	@Success		200
+//	@Failure		304
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/tickets/{id}/restore [post]
+func (ctrl TicketController) Restore(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested ticket
+	id := chi.URLParam(r, "id")
+
+	// Convert to ObjectID
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert id to objectid")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Only superadmins can undo a void
+	isSuperAdmin, err := util.CheckIfSuperAdmin(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("could not check if requester is superadmin")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	token, _ := util.GetUserTokenFromContext(r.Context()) // Not error-checking because this gets fetched in superadmin check
+	if !isSuperAdmin {
+		log.Warn().Str("uid", token.UID).Msg("non-superadmin tried restoring a voided ticket")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	// Fetch ticket data so that we can log the void it's undoing
+	ticket, _ := models.GetTicket(r.Context(), objID)
+
+	// Try to restore ticket
+	restoredGuests, err := models.RestoreTicket(r.Context(), objID)
+	if err == models.ErrNotFound {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err == models.ErrNoDocumentModified {
+		render.Render(w, r, util.ErrUnmodified)
+		return
+	} else if err == models.ErrEventFull {
+		render.Render(w, r, util.ErrConflict(errors.New("event has reached its capacity")))
+		return
+	} else if err == models.ErrTierFull {
+		render.Render(w, r, util.ErrConflict(errors.New("ticket tier has reached its capacity")))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not restore ticket")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "ticket").
+		Str("requester_uid", token.UID).
+		Str("ticket_id", objID.Hex()).
+		Str("void_reason", ticket.VoidReason).
+		Str("voided_by", ticket.VoidedBy).
+		Any("restored_guest_ticket_ids", restoredGuests).
+		Str("action", "restoreTicket").
 		Bool("privileged", true).
-		Msg("deleted ticket")
+		Msg("restored voided ticket")
 }
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ticketExportFilename makes a filename for an export that's safe to put in a header.
+func ticketExportFilename(event models.Event, extension string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 32 || r > 126 || strings.ContainsRune(`"\/:*?<>|`, r) {
+			return -1
+		}
+		return r
+	}, event.Name)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = event.ID.Hex()
+	}
+	return fmt.Sprintf("%s attendees.%s", name, extension)
+}
+
+// escapeCSVFormula stops text that starts like a formula from being run as one when a CSV is
+// opened in a spreadsheet app, by putting a ' in front of it. XLSX cells are always written as
+// text, so they don't need this.
+func escapeCSVFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// ListExportColumns fetches the columns that can be included in a ticket export.
+//
+//	@Summary		List ticket export columns
+//	@Description	List the columns that can be picked when exporting an event's tickets, including one for each custom field. Only available to admins, and the event's viewers and managers.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	[]models.TicketExportColumn
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/tickets/export/columns [get]
+func (ctrl EventController) ListExportColumns(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to fetch from DB
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not find event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, column := range models.GetTicketExportColumns(event) {
+		c := column // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &c)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "listTicketExportColumns").
+		Str("eventId", eventID.Hex()).
+		Bool("privileged", true).
+		Msg("fetched ticket export columns for event")
+}
+
+// ExportTickets downloads an event's tickets as a spreadsheet.
+//
+//	@Summary		Export tickets for event
+//	@Description	Download an event's tickets as a CSV or XLSX spreadsheet. Columns can be picked using the keys from the export columns endpoint, otherwise every column is included. The first column is always the ticket's status, which is "queued" for tickets that haven't been claimed yet. Only available to admins, and the event's viewers and managers.
+//	@Tags			event
+//	@Produce		text/csv
+//	@Produce		application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+//	@Param			id				path	string	true	"Event ID"
+//	@Param			format			query	string	false	"Either csv or xlsx, defaults to csv"
+//	@Param			columns			query	string	false	"Comma-separated column keys, defaults to every column"
+//	@Param			includeQueued	query	bool	false	"Whether to include queued tickets"
+//	@Param			includeVoided	query	bool	false	"Whether to include voided tickets"
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/tickets/export [get]
+func (ctrl EventController) ExportTickets(w http.ResponseWriter, r *http.Request) {
+	eventID, ok := getEventIDFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to fetch from DB
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not find event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Get columns to export
+	columnKeys := []string{}
+	if rawColumns := r.URL.Query().Get("columns"); rawColumns != "" {
+		for _, key := range strings.Split(rawColumns, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				columnKeys = append(columnKeys, key)
+			}
+		}
+	}
+	columns, err := models.GetTicketExportColumnsByKey(event, columnKeys)
+	if err != nil {
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Header
+	}
+
+	opts := models.TicketExportOptions{
+		IncludeQueued: r.URL.Query().Get("includeQueued") == "true",
+		IncludeVoided: r.URL.Query().Get("includeVoided") == "true",
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	// Rows are streamed out as they're read, so errors after this point can't be sent back
+	var (
+		writeRow func([]interface{}) error
+		finish   func() error
+	)
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, ticketExportFilename(event, "csv")))
+
+		csvWriter := csv.NewWriter(w)
+		writeRow = func(cells []interface{}) error {
+			rec := make([]string, len(cells))
+			for i, cell := range cells {
+				switch cell.(type) {
+				case int, int32, int64, float32, float64:
+					rec[i] = fmt.Sprint(cell)
+				default:
+					// Student-entered text could otherwise be run as a formula
+					rec[i] = escapeCSVFormula(fmt.Sprint(cell))
+				}
+			}
+			return csvWriter.Write(rec)
+		}
+		finish = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	case "xlsx":
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, ticketExportFilename(event, "xlsx")))
+
+		xlsxWriter, err := util.NewXLSXWriter(w, "Attendees")
+		if err != nil {
+			log.Error().Err(err).Msg("could not start xlsx export")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+		writeRow = xlsxWriter.WriteRow
+		finish = xlsxWriter.Close
+	default:
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("format must be 'csv' or 'xlsx'")))
+		return
+	}
+
+	err = writeRow(header)
+	if err == nil {
+		err = models.ExportEventTickets(r.Context(), event, columns, opts, writeRow)
+	}
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		log.Error().Err(err).Str("eventId", eventID.Hex()).Msg("could not finish ticket export")
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "exportTickets").
+		Str("eventId", eventID.Hex()).
+		Str("format", format).
+		Strs("columns", columnKeys).
+		Bool("include_queued", opts.IncludeQueued).
+		Bool("include_voided", opts.IncludeVoided).
+		Bool("privileged", true).
+		Msg("exported tickets for event")
+}
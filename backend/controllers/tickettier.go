@@ -0,0 +1,381 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type eventControllerCreateTierRequestBody struct {
+	Name               string    `json:"name"                 validate:"required"`
+	Price              int64     `json:"price"                validate:"gte=0"` // In cents
+	Capacity           int       `json:"capacity"             validate:"gte=0"` // Leave empty for unlimited
+	MaxScanCount       int       `json:"max_scan_count"       validate:"gte=0"`
+	Hidden             bool      `json:"hidden"`
+	SaleStartTimestamp time.Time `json:"sale_start_timestamp"` // Leave empty for no start limit
+	SaleEndTimestamp   time.Time `json:"sale_end_timestamp"`   // Leave empty for no end limit
+}
+
+// ListTiers fetches the ticket tiers of an event.
+//
+//	@Summary		List ticket tiers for event
+//	@Description	List the types of tickets available for an event. Hidden tiers are only shown to admins. Available to all users.
+//	@Tags			event
+//	@Produce		json
+//	@Param			id	path		string	true	"Event ID"
+//	@Success		200	{object}	[]models.TicketTier
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/tiers [get]
+func (ctrl EventController) ListTiers(w http.ResponseWriter, r *http.Request) {
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try to fetch from DB
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not find event")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Only admins can see hidden tiers
+	isAdmin, err := util.CheckPermission(r.Context(), util.PermissionEventsWrite)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check requester permissions")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	tiers := event.TicketTiers
+	if !isAdmin {
+		tiers = event.VisibleTicketTiers()
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, tier := range tiers {
+		t := tier // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &t)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "listEventTiers").
+		Str("eventId", id).
+		Bool("privileged", isAdmin).
+		Msg("fetched ticket tiers for event")
+}
+
+// CreateTier adds a new ticket tier to an event.
+//
+//	@Summary		Create ticket tier for event
+//	@Description	Add a new type of ticket to an event. Tier names have to be unique within the event. Only available to admins.
+//	@Tags			event
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string									true	"Event ID"
+//	@Param			tier	body		eventControllerCreateTierRequestBody	true	"Tier details"
+//	@Success		200		{object}	models.TicketTier
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/tiers [post]
+func (ctrl EventController) CreateTier(w http.ResponseWriter, r *http.Request) {
+	var tierRaw eventControllerCreateTierRequestBody
+
+	// Get ID of requested event
+	id := chi.URLParam(r, "id")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err = bodyDecoder.Decode(&tierRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(tierRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Sale window should make sense if both ends are given
+	if !tierRaw.SaleStartTimestamp.IsZero() && !tierRaw.SaleEndTimestamp.IsZero() && !tierRaw.SaleEndTimestamp.After(tierRaw.SaleStartTimestamp) {
+		err := fmt.Errorf("sale end must be after sale start")
+		log.Error().Err(err).Msg("invalid sale window")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Transfer all data from raw to actual tier
+	tier := models.TicketTier{
+		Name:               tierRaw.Name,
+		Price:              tierRaw.Price,
+		Capacity:           tierRaw.Capacity,
+		MaxScanCount:       tierRaw.MaxScanCount,
+		Hidden:             tierRaw.Hidden,
+		SaleStartTimestamp: tierRaw.SaleStartTimestamp,
+		SaleEndTimestamp:   tierRaw.SaleEndTimestamp,
+	}
+
+	// Try to add to DB
+	tier.ID, err = models.CreateTicketTier(r.Context(), eventID, tier)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrAlreadyExists:
+			render.Render(w, r, util.ErrConflict(errors.New("a tier with that name already exists for this event")))
+		default:
+			log.Error().Err(err).Msg("could not create ticket tier")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &tier); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "createEventTier").
+		Str("eventId", id).
+		Any("tier_data", tier).
+		Bool("privileged", true).
+		Msg("created ticket tier for event")
+}
+
+// UpdateTier changes the details of one of an event's ticket tiers.
+//
+//	@Summary		Update ticket tier for event
+//	@Description	Update the details of a ticket tier. Changes don't apply to tickets that were already made. Only available to admins.
+//	@Tags			event
+//	@Accept			json
+//	@Param			id		path	string	true	"Event ID"
+//	@Param			tierID	path	string	true	"Tier ID"
+//	@Success		200
+//	@Failure		304
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/tiers/{tierID} [patch]
+func (ctrl EventController) UpdateTier(w http.ResponseWriter, r *http.Request) {
+	eventID, tierID, ok := getTierIDsFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Get JSON body
+	var requestedUpdates map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&requestedUpdates)
+	if err != nil {
+		log.Error().Stack().Err(err).Send()
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try updating the tier
+	err = models.UpdateTicketTier(r.Context(), eventID, tierID, requestedUpdates)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrNoDocumentModified:
+			render.Render(w, r, util.ErrUnmodified)
+		case models.ErrAlreadyExists:
+			render.Render(w, r, util.ErrConflict(errors.New("a tier with that name already exists for this event")))
+		case models.ErrEditNotAllowed:
+			render.Render(w, r, util.ErrInvalidRequest(err))
+		default:
+			// Anything else is from parsing the updates
+			log.Error().Err(err).Msg("could not update ticket tier")
+			render.Render(w, r, util.ErrInvalidRequest(err))
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "updateEventTier").
+		Str("eventId", eventID.Hex()).
+		Str("tierId", tierID.Hex()).
+		Any("requestedUpdates", requestedUpdates).
+		Bool("privileged", true).
+		Msg("updated ticket tier for event")
+}
+
+// DeleteTier removes a ticket tier from an event.
+//
+//	@Summary		Delete ticket tier for event
+//	@Description	Remove a ticket tier from an event. Tiers with tickets or queued tickets in them can't be deleted. Only available to admins.
+//	@Tags			event
+//	@Param			id		path	string	true	"Event ID"
+//	@Param			tierID	path	string	true	"Tier ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/events/{id}/tiers/{tierID} [delete]
+func (ctrl EventController) DeleteTier(w http.ResponseWriter, r *http.Request) {
+	eventID, tierID, ok := getTierIDsFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Try deleting the tier
+	err := models.DeleteTicketTier(r.Context(), eventID, tierID)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrTierInUse:
+			render.Render(w, r, util.ErrConflict(errors.New("tier still has tickets, void or move them first")))
+		default:
+			log.Error().Err(err).Msg("could not delete ticket tier")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	uid := ""
+	if err == nil {
+		uid = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "event").
+		Str("requester_uid", uid).
+		Str("action", "deleteEventTier").
+		Str("eventId", eventID.Hex()).
+		Str("tierId", tierID.Hex()).
+		Bool("privileged", true).
+		Msg("deleted ticket tier for event")
+}
+
+// getTierIDsFromURL gets the event and tier IDs from the URL, rendering an error response
+// if either is invalid.
+func getTierIDsFromURL(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, primitive.ObjectID, bool) {
+	eventID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	tierID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "tierID"))
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return primitive.NilObjectID, primitive.NilObjectID, false
+	}
+
+	return eventID, tierID, true
+}
+
+// getTicketTierForNewTicket parses the tier ID given when making a ticket and makes sure it
+// belongs to the event, rendering an error response if not. An empty ID means no tier.
+func getTicketTierForNewTicket(w http.ResponseWriter, r *http.Request, event models.Event, rawTierID string) (models.TicketTier, bool) {
+	if rawTierID == "" {
+		return models.TicketTier{}, true
+	}
+
+	tierID, err := primitive.ObjectIDFromHex(rawTierID)
+	if err != nil {
+		log.Error().Err(err).Str("id", rawTierID).Msg("could not parse tier id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return models.TicketTier{}, false
+	}
+
+	tier, ok := event.GetTicketTier(tierID)
+	if !ok {
+		log.Error().Str("id", rawTierID).Msg("tier does not exist for event")
+		render.Render(w, r, util.ErrInvalidRequest(errors.New("tier does not exist for event")))
+		return models.TicketTier{}, false
+	}
+
+	return tier, true
+}
@@ -0,0 +1,725 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/middleware"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ticketTransferControllerCreateRequestBody struct {
+	TicketID      string `json:"ticketID"      validate:"required,mongodb"`
+	StudentNumber string `json:"studentNumber" validate:"required"` // Student number of recipient
+}
+
+type TicketTransferController struct{}
+
+func (ctrl TicketTransferController) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthenticatorMiddleware) // User must be authenticated before using any of these endpoints
+
+	r.Get("/", ctrl.ListSelf) // GET /transfers - returns the requester's incoming & outgoing transfers, available to any user
+	r.Post("/", ctrl.Create)  // POST /transfers - start transferring one of the requester's tickets, available to any user
+
+	// Admin-only routes
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequirePermission(util.PermissionTicketsRead))
+		r.Get("/all", ctrl.ListAll) // GET /transfers/all - returns all transfers, requires tickets:read
+	})
+
+	r.Route("/{id}", func(r chi.Router) {
+		r.Get("/", ctrl.Get)             // GET /transfers/{id} - returns transfer data, available to sender, recipient & those with tickets:read
+		r.Post("/accept", ctrl.Accept)   // POST /transfers/{id}/accept - accept a transfer, available to recipient
+		r.Post("/decline", ctrl.Decline) // POST /transfers/{id}/decline - decline a transfer, available to recipient
+		r.Post("/cancel", ctrl.Cancel)   // POST /transfers/{id}/cancel - cancel a transfer, available to sender
+
+		// Admin-only routes
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequirePermission(util.PermissionTicketsWrite))
+			r.Post("/approve", ctrl.Approve) // POST /transfers/{id}/approve - approve a transfer, requires tickets:write
+			r.Post("/reject", ctrl.Reject)   // POST /transfers/{id}/reject - reject a transfer, requires tickets:write
+		})
+	})
+
+	return r
+}
+
+// ListSelf fetches all transfers the requester is sending or receiving.
+//
+//	@Summary		List the requesting user's transfers
+//	@Description	List the ticket transfers that the requesting user is sending or receiving, newest first. Available to all users.
+//	@Tags			transfer
+//	@Produce		json
+//	@Success		200	{object}	[]models.TicketTransfer
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers [get]
+func (ctrl TicketTransferController) ListSelf(w http.ResponseWriter, r *http.Request) {
+	// Get user UID
+	userToken, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	uid := userToken.UID
+
+	// Try to get transfers
+	transfers, err := models.GetTicketTransfers(r.Context(), bson.M{
+		"$or": bson.A{
+			bson.M{"from_uid": uid},
+			bson.M{"to_uid": uid},
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Str("uid", uid).Msg("could not fetch user's transfers")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, transfer := range transfers {
+		t := transfer // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &t)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", uid).
+		Str("action", "listSelfTransfers").
+		Bool("privileged", false).
+		Msg("listed requester's transfers")
+}
+
+// ListAll fetches all transfers.
+//
+//	@Summary		List all transfers
+//	@Description	List all ticket transfers, newest first. Only available to admins.
+//	@Tags			transfer
+//	@Produce		json
+//	@Param			status	query		string	false	"Only list transfers with this status (ex. awaiting_approval)"
+//	@Success		200		{object}	[]models.TicketTransfer
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers/all [get]
+func (ctrl TicketTransferController) ListAll(w http.ResponseWriter, r *http.Request) {
+	// Filter by status if search query provided
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	// Try to get transfers
+	transfers, err := models.GetTicketTransfers(r.Context(), filter)
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch all transfers")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, transfer := range transfers {
+		t := transfer // Duplicate it before passing by reference to avoid only passing the last obj
+		renderers = append(renderers, &t)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	token, err := util.GetUserTokenFromContext(r.Context())
+	requesterUID := ""
+	if err == nil {
+		requesterUID = token.UID
+	}
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", requesterUID).
+		Any("filter", filter).
+		Str("action", "listAllTransfers").
+		Bool("privileged", true).
+		Msg("listed all transfers")
+}
+
+// Get fetches a transfer.
+//
+//	@Summary		Get transfer
+//	@Description	Get a ticket transfer. Only available to admins, and the sender & recipient of the transfer.
+//	@Tags			transfer
+//	@Produce		json
+//	@Param			id	path		string	true	"Transfer ID"
+//	@Success		200	{object}	models.TicketTransfer
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers/{id} [get]
+func (ctrl TicketTransferController) Get(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := getTicketTransferFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Check if they are authorized to use endpoint (admin, sender, or recipient)
+	isAdmin, err := util.CheckPermission(r.Context(), util.PermissionTicketsRead)
+	if err != nil {
+		log.Error().Err(err).Msg("could not check requester permissions")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	idToken, _ := util.GetUserTokenFromContext(r.Context()) // Not error-checking because this gets fetched in permission check
+	if !(isAdmin || transfer.FromUID == idToken.UID || transfer.ToUID == idToken.UID) {
+		log.Warn().Str("uid", idToken.UID).Msg("unauthorized user attempting to access another person's transfer")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &transfer); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", idToken.UID).
+		Str("transfer_id", transfer.ID.Hex()).
+		Str("action", "getTransfer").
+		Bool("privileged", isAdmin && transfer.FromUID != idToken.UID && transfer.ToUID != idToken.UID).
+		Msg("fetched transfer")
+}
+
+// Create starts transferring a ticket.
+//
+//	@Summary		Start a ticket transfer
+//	@Description	Starts transferring one of the requester's unused tickets to another student. If the recipient has signed up, they have to accept it. If they haven't, they get a queued ticket once it goes through. Events can also require an admin to approve transfers. Available to all users.
+//	@Tags			transfer
+//	@Accept			json
+//	@Produce		json
+//	@Param			transfer	body		ticketTransferControllerCreateRequestBody	true	"Transfer details"
+//	@Success		200			{object}	models.TicketTransfer
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers [post]
+func (ctrl TicketTransferController) Create(w http.ResponseWriter, r *http.Request) {
+	var transferRaw ticketTransferControllerCreateRequestBody
+
+	// Parse JSON body
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	err := bodyDecoder.Decode(&transferRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	err = validate.Struct(transferRaw)
+	if err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Get requester UID
+	userToken, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	uid := userToken.UID
+
+	// Convert to ObjectID from string
+	ticketID, err := primitive.ObjectIDFromHex(transferRaw.TicketID)
+	if err != nil {
+		log.Error().Err(err).Str("id", transferRaw.TicketID).Msg("could not parse ticket id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Try to fetch ticket
+	ticket, err := models.GetTicket(r.Context(), ticketID)
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not find ticket")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Only the owner can give their ticket away
+	if ticket.Owner != uid {
+		log.Warn().Str("uid", uid).Str("ticket_id", ticket.ID.Hex()).Msg("user tried transferring a ticket they don't own")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+	if ticket.Voided {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("ticket has been voided")))
+		return
+	}
+	if ticket.ScanCount > 0 {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("ticket has already been used")))
+		return
+	}
+	if ticket.Guest != nil {
+		render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("guest tickets can't be transferred")))
+		return
+	}
+
+	// Find recipient, who might not have signed up yet
+	transfer := models.TicketTransfer{
+		TicketID:         ticket.ID,
+		EventID:          ticket.Event,
+		FromUID:          uid,
+		ToStudentNumber:  transferRaw.StudentNumber,
+		CreatedTimestamp: time.Now(),
+	}
+	recipient, err := models.GetUserByKey(r.Context(), "student_number", transferRaw.StudentNumber)
+	if err == nil {
+		if recipient.ID == uid {
+			render.Render(w, r, util.ErrInvalidRequest(fmt.Errorf("cannot transfer a ticket to yourself")))
+			return
+		}
+		transfer.ToUID = recipient.ID
+
+		// Recipient can only have one ticket per event
+		if _, err := models.SearchForTicket(r.Context(), ticket.Event, recipient.ID); err == nil {
+			render.Render(w, r, util.ErrConflict(fmt.Errorf("recipient already has a ticket for this event")))
+			return
+		} else if err != mongo.ErrNoDocuments {
+			log.Error().Err(err).Msg("could not check if recipient already has ticket")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+	} else if err != mongo.ErrNoDocuments {
+		log.Error().Err(err).Str("id", transferRaw.StudentNumber).Msg("could not fetch user data")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Recipients who have signed up have to accept first. Otherwise, it only needs
+	// an admin's approval if the event requires it.
+	if transfer.ToUID != "" {
+		transfer.Status = models.TicketTransferStatusPending
+	} else if ticket.EventData.TransfersRequireApproval {
+		transfer.Status = models.TicketTransferStatusAwaitingApproval
+	} else {
+		transfer.Status = models.TicketTransferStatusCompleted
+	}
+
+	// Try to add to DB
+	id, err := models.CreateTicketTransfer(r.Context(), transfer)
+	if err == models.ErrAlreadyExists {
+		render.Render(w, r, util.ErrConflict(errors.New("ticket already has a transfer in progress")))
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not add transfer to db")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	transfer.ID = id
+
+	// Nothing left to wait for, so move the ticket right away
+	if transfer.Status == models.TicketTransferStatusCompleted {
+		var ok bool
+		transfer, ok = completeTicketTransfer(w, r, transfer, uid)
+		if !ok {
+			return
+		}
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &transfer); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", uid).
+		Any("transfer", transfer).
+		Str("action", "createTransfer").
+		Bool("privileged", false).
+		Msg("started ticket transfer")
+}
+
+// Accept accepts a transfer.
+//
+//	@Summary		Accept a transfer
+//	@Description	Accepts a ticket transfer, moving the ticket to the recipient unless the event needs an admin to approve it first. Only available to the recipient.
+//	@Tags			transfer
+//	@Produce		json
+//	@Param			id	path		string	true	"Transfer ID"
+//	@Success		200	{object}	models.TicketTransfer
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers/{id}/accept [post]
+func (ctrl TicketTransferController) Accept(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := getTicketTransferFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Only recipient can accept
+	idToken, _ := util.GetUserTokenFromContext(r.Context())
+	if transfer.ToUID == "" || transfer.ToUID != idToken.UID {
+		log.Warn().Str("uid", idToken.UID).Str("transfer_id", transfer.ID.Hex()).Msg("non-recipient tried accepting transfer")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	// Check whether an admin needs to approve it
+	event, err := models.GetEvent(r.Context(), bson.M{"_id": transfer.EventID})
+	if err != nil {
+		log.Error().Err(err).Str("eventID", transfer.EventID.Hex()).Msg("could not fetch event data")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	newStatus := models.TicketTransferStatusCompleted
+	if event.TransfersRequireApproval {
+		newStatus = models.TicketTransferStatusAwaitingApproval
+	}
+
+	// Claim the transfer so it can't be cancelled or accepted twice at the same time
+	if !claimTicketTransfer(w, r, transfer, []string{models.TicketTransferStatusPending}, newStatus, idToken.UID) {
+		return
+	}
+	transfer.Status = newStatus
+
+	if newStatus == models.TicketTransferStatusCompleted {
+		transfer, ok = completeTicketTransfer(w, r, transfer, idToken.UID)
+		if !ok {
+			return
+		}
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &transfer); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", idToken.UID).
+		Any("transfer", transfer).
+		Str("action", "acceptTransfer").
+		Bool("privileged", false).
+		Msg("accepted ticket transfer")
+}
+
+// Decline declines a transfer.
+//
+//	@Summary		Decline a transfer
+//	@Description	Declines a ticket transfer, leaving the ticket with its owner. Only available to the recipient.
+//	@Tags			transfer
+//	@Param			id	path	string	true	"Transfer ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers/{id}/decline [post]
+func (ctrl TicketTransferController) Decline(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := getTicketTransferFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Only recipient can decline
+	idToken, _ := util.GetUserTokenFromContext(r.Context())
+	if transfer.ToUID == "" || transfer.ToUID != idToken.UID {
+		log.Warn().Str("uid", idToken.UID).Str("transfer_id", transfer.ID.Hex()).Msg("non-recipient tried declining transfer")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	if !claimTicketTransfer(
+		w, r, transfer,
+		[]string{models.TicketTransferStatusPending},
+		models.TicketTransferStatusDeclined,
+		idToken.UID,
+	) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", idToken.UID).
+		Str("transfer_id", transfer.ID.Hex()).
+		Str("action", "declineTransfer").
+		Bool("privileged", false).
+		Msg("declined ticket transfer")
+}
+
+// Cancel cancels a transfer.
+//
+//	@Summary		Cancel a transfer
+//	@Description	Cancels a ticket transfer that hasn't gone through yet. Only available to the sender.
+//	@Tags			transfer
+//	@Param			id	path	string	true	"Transfer ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers/{id}/cancel [post]
+func (ctrl TicketTransferController) Cancel(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := getTicketTransferFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// Only sender can cancel
+	idToken, _ := util.GetUserTokenFromContext(r.Context())
+	if transfer.FromUID != idToken.UID {
+		log.Warn().Str("uid", idToken.UID).Str("transfer_id", transfer.ID.Hex()).Msg("non-sender tried cancelling transfer")
+		render.Render(w, r, util.ErrForbidden)
+		return
+	}
+
+	if !claimTicketTransfer(
+		w, r, transfer,
+		[]string{models.TicketTransferStatusPending, models.TicketTransferStatusAwaitingApproval},
+		models.TicketTransferStatusCancelled,
+		idToken.UID,
+	) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", idToken.UID).
+		Str("transfer_id", transfer.ID.Hex()).
+		Str("action", "cancelTransfer").
+		Bool("privileged", false).
+		Msg("cancelled ticket transfer")
+}
+
+// Approve approves a transfer.
+//
+//	@Summary		Approve a transfer
+//	@Description	Approves a ticket transfer that's waiting on an admin, moving the ticket to the recipient. Only available to admins.
+//	@Tags			transfer
+//	@Produce		json
+//	@Param			id	path		string	true	"Transfer ID"
+//	@Success		200	{object}	models.TicketTransfer
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers/{id}/approve [post]
+func (ctrl TicketTransferController) Approve(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := getTicketTransferFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	idToken, _ := util.GetUserTokenFromContext(r.Context())
+	if !claimTicketTransfer(
+		w, r, transfer,
+		[]string{models.TicketTransferStatusAwaitingApproval},
+		models.TicketTransferStatusCompleted,
+		idToken.UID,
+	) {
+		return
+	}
+	transfer.Status = models.TicketTransferStatusCompleted
+
+	transfer, ok = completeTicketTransfer(w, r, transfer, idToken.UID)
+	if !ok {
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &transfer); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", idToken.UID).
+		Any("transfer", transfer).
+		Str("action", "approveTransfer").
+		Bool("privileged", true).
+		Msg("approved ticket transfer")
+}
+
+// Reject rejects a transfer.
+//
+//	@Summary		Reject a transfer
+//	@Description	Rejects a ticket transfer that hasn't gone through yet, leaving the ticket with its owner. Only available to admins.
+//	@Tags			transfer
+//	@Param			id	path	string	true	"Transfer ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		403
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/transfers/{id}/reject [post]
+func (ctrl TicketTransferController) Reject(w http.ResponseWriter, r *http.Request) {
+	transfer, ok := getTicketTransferFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	idToken, _ := util.GetUserTokenFromContext(r.Context())
+	if !claimTicketTransfer(
+		w, r, transfer,
+		[]string{models.TicketTransferStatusPending, models.TicketTransferStatusAwaitingApproval},
+		models.TicketTransferStatusRejected,
+		idToken.UID,
+	) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "transfer").
+		Str("requester_uid", idToken.UID).
+		Str("transfer_id", transfer.ID.Hex()).
+		Str("action", "rejectTransfer").
+		Bool("privileged", true).
+		Msg("rejected ticket transfer")
+}
+
+// getTicketTransferFromURL fetches the transfer given in the URL, rendering an error response if it can't.
+func getTicketTransferFromURL(w http.ResponseWriter, r *http.Request) (models.TicketTransfer, bool) {
+	// Get ID of requested transfer
+	id := chi.URLParam(r, "id")
+
+	// Convert to ObjectID
+	transferID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert id to objectid")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return models.TicketTransfer{}, false
+	}
+
+	// Try to fetch from DB
+	transfer, err := models.GetTicketTransfer(r.Context(), transferID)
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return models.TicketTransfer{}, false
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch transfer")
+		render.Render(w, r, util.ErrServer(err))
+		return models.TicketTransfer{}, false
+	}
+
+	return transfer, true
+}
+
+// claimTicketTransfer moves a transfer to a new status if it's still in one of the expected
+// statuses, rendering a conflict if someone else got to it first.
+func claimTicketTransfer(
+	w http.ResponseWriter,
+	r *http.Request,
+	transfer models.TicketTransfer,
+	fromStatuses []string,
+	toStatus string,
+	requesterUID string,
+) bool {
+	err := models.UpdateTicketTransferStatus(r.Context(), transfer.ID, fromStatuses, toStatus, requesterUID)
+	if err == models.ErrNoDocumentModified {
+		log.Warn().Str("transfer_id", transfer.ID.Hex()).Str("status", transfer.Status).Str("newStatus", toStatus).Msg("transfer is not in the right status")
+		render.Render(w, r, util.ErrConflict(fmt.Errorf("transfer is already %s", transfer.Status)))
+		return false
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not update transfer status")
+		render.Render(w, r, util.ErrServer(err))
+		return false
+	}
+
+	return true
+}
+
+// completeTicketTransfer moves the ticket over to the recipient, rendering an error response
+// if the transfer couldn't go through.
+func completeTicketTransfer(
+	w http.ResponseWriter,
+	r *http.Request,
+	transfer models.TicketTransfer,
+	requesterUID string,
+) (models.TicketTransfer, bool) {
+	transfer, err := models.CompleteTicketTransfer(r.Context(), transfer, requesterUID)
+	if err == models.ErrTransferNotAllowed || err == models.ErrAlreadyExists {
+		log.Warn().Err(err).Any("transfer", transfer).Msg("transfer failed")
+		render.Render(w, r, util.ErrConflict(errors.New(transfer.FailureReason)))
+		return transfer, false
+	} else if err != nil {
+		log.Error().Err(err).Any("transfer", transfer).Msg("could not complete transfer")
+		render.Render(w, r, util.ErrServer(err))
+		return transfer, false
+	}
+
+	return transfer, true
+}
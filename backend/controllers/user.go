@@ -3,7 +3,6 @@ package controllers
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
 
 	"github.com/aritrosaha10/frasertickets/lib"
 	"github.com/aritrosaha10/frasertickets/middleware"
@@ -25,12 +24,12 @@ func (ctrl UserController) Routes() chi.Router {
 
 	// Admin-only route(s)
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AdminAuthorizerMiddleware)
-		r.Get("/", ctrl.List) // GET /users - returns list of users, only available to admins
+		r.Use(middleware.RequirePermission(util.PermissionUsersRead))
+		r.Get("/", ctrl.List) // GET /users - returns list of users, requires users:read
 	})
 
 	r.Route("/{id}", func(r chi.Router) {
-		// Custom middleware function made specifically to check if requester if admin or accessing self data
+		// Custom middleware function made specifically to check if requester has permission or is accessing self data
 		r.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				// Get ID token to get user's identity / UID
@@ -42,9 +41,13 @@ func (ctrl UserController) Routes() chi.Router {
 				}
 
 				// Get two main criteria for authorization
-				isAdmin, _ := util.CheckIfAdmin(r.Context()) // error doesn't matter, bool defaults to false anyways
+				permission := util.PermissionUsersRead
+				if r.Method != http.MethodGet {
+					permission = util.PermissionUsersManage
+				}
+				hasPermission := util.GetRoleFromClaims(idToken.Claims).HasPermission(permission)
 				isSelf := chi.URLParam(r, "id") == idToken.UID
-				if !(isAdmin || isSelf) {
+				if !(hasPermission || isSelf) {
 					log.Warn().Str("uid", idToken.UID).Msg("unauthorized user attempted to access another person's user profile")
 					render.Render(w, r, util.ErrForbidden)
 					return
@@ -54,13 +57,13 @@ func (ctrl UserController) Routes() chi.Router {
 			})
 		})
 
-		r.Get("/", ctrl.Get)      // GET /users/{id} - returns user data, only available to admins and user
-		r.Patch("/", ctrl.Update) // PATCH /users/{id} - updates user data, only available to admins
+		r.Get("/", ctrl.Get)      // GET /users/{id} - returns user data, available to user & those with users:read
+		r.Patch("/", ctrl.Update) // PATCH /users/{id} - updates user data, available to user & those with users:manage
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.AdminAuthorizerMiddleware)
-		r.Patch("/{id}", ctrl.Update) // PATCH /users/{id} - updates user data, only available to admins
+		r.Use(middleware.RequirePermission(util.PermissionUsersManage))
+		r.Patch("/{id}", ctrl.Update) // PATCH /users/{id} - updates user data, requires users:manage
 	})
 
 	return r
@@ -140,9 +143,10 @@ func (ctrl UserController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if they are using a school account or not
-	if !strings.Contains(userRecord.Email, "@pdsb.net") {
-		log.Warn().Str("uid", userToken.UID).Str("email", userRecord.Email).Msg("user attempting to sign in with personal account")
+	// Check if they're allowed to sign up with this email, ex. using a school account
+	signUpResult, err := lib.SignUpPolicy.Check(userRecord.Email)
+	if err != nil {
+		log.Warn().Err(err).Str("uid", userToken.UID).Str("email", userRecord.Email).Msg("user attempting to sign in with account not allowed by sign-up policy")
 		render.Render(w, r, util.ErrUnauthorized)
 
 		// Also delete the user for good measure
@@ -164,8 +168,8 @@ func (ctrl UserController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract student number from email
-	studentNumber := strings.Replace(userRecord.Email, "@pdsb.net", "", -1)
+	// Student number comes from email, staff accounts won't have one
+	studentNumber := signUpResult.StudentNumber
 
 	tmpUser := models.User{
 		ID:            userRecord.UID,
@@ -189,18 +193,20 @@ func (ctrl UserController) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Look through queued tickets and create any that may belong to them
-	queuedTickets, err := models.GetQueuedTicketsForStudentNumber(r.Context(), studentNumber)
-	if err != nil {
-		log.Error().Err(err).Str("uid", id).Msg("could not get queued tickets")
-	} else {
-		// TODO: Consider using goroutines? Not bothering right now since too complex to just register 1-2 tickets
-		for i, queuedTicket := range queuedTickets {
-			// No point in updating name multiple times
-			ticket, err := models.ConvertQueuedTicketToTicket(r.Context(), queuedTicket, i == 0)
-			log.Info().Any("ticket", ticket).Str("uid", id).Msg("converted queued ticket to ticket")
-			if err != nil {
-				log.Error().Err(err).Any("queuedTicket", queuedTicket).Str("uid", id).Msg("could not convert queued ticket to ticket")
+	// Look through queued tickets and create any that may belong to them, only possible with a student number
+	if studentNumber != "" {
+		queuedTickets, err := models.GetQueuedTicketsForStudentNumber(r.Context(), studentNumber)
+		if err != nil {
+			log.Error().Err(err).Str("uid", id).Msg("could not get queued tickets")
+		} else {
+			// TODO: Consider using goroutines? Not bothering right now since too complex to just register 1-2 tickets
+			for i, queuedTicket := range queuedTickets {
+				// No point in updating name multiple times
+				ticket, err := models.ConvertQueuedTicketToTicket(r.Context(), queuedTicket, i == 0)
+				log.Info().Any("ticket", ticket).Str("uid", id).Msg("converted queued ticket to ticket")
+				if err != nil {
+					log.Error().Err(err).Any("queuedTicket", queuedTicket).Str("uid", id).Msg("could not convert queued ticket to ticket")
+				}
 			}
 		}
 	}
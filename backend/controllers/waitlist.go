@@ -0,0 +1,395 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/aritrosaha10/frasertickets/middleware"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type waitlistControllerJoinRequestBody struct {
+	TierID       string                 `json:"tierID" validate:"omitempty,mongodb"` // Required for events with tiers, spots only come from this tier
+	CustomFields map[string]interface{} `json:"customFields"`                        // Has to match the event's schema, used for the ticket once promoted
+}
+
+type WaitlistController struct{}
+
+func (ctrl WaitlistController) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(middleware.AuthenticatorMiddleware) // User must be authenticated before using any of these endpoints
+
+	r.Get("/", ctrl.ListSelf) // GET /waitlist - returns the waitlists the requester is in, available to any user
+
+	r.Route("/{eventID}", func(r chi.Router) {
+		r.Get("/", ctrl.Get)      // GET /waitlist/{eventID} - returns requester's spot in line, available to any user
+		r.Post("/", ctrl.Join)    // POST /waitlist/{eventID} - join an event's waitlist, available to any user
+		r.Delete("/", ctrl.Leave) // DELETE /waitlist/{eventID} - leave an event's waitlist, available to any user
+
+		// Admin-only routes
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequirePermission(util.PermissionEventsAnalytics))
+			r.Get("/all", ctrl.ListEvent) // GET /waitlist/{eventID}/all - returns everyone waiting for an event, requires events:analytics
+		})
+	})
+
+	return r
+}
+
+// ListSelf fetches every waitlist the requester is waiting in.
+//
+//	@Summary		List the requesting user's waitlist spots
+//	@Description	List the events the requesting user is waiting for, with their position in each line. Available to all users.
+//	@Tags			waitlist
+//	@Produce		json
+//	@Success		200	{object}	[]models.WaitlistEntry
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/waitlist [get]
+func (ctrl WaitlistController) ListSelf(w http.ResponseWriter, r *http.Request) {
+	// Get user UID
+	userToken, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+	uid := userToken.UID
+
+	// Try to get waitlist entries
+	entries, err := models.GetWaitlist(r.Context(), bson.M{"user": uid, "status": models.WaitlistStatusWaiting})
+	if err != nil {
+		log.Error().Err(err).Str("uid", uid).Msg("could not fetch user's waitlist entries")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for _, entry := range entries {
+		e := entry // Duplicate it before passing by reference to avoid only passing the last obj
+
+		e.Position, err = models.GetWaitlistPosition(r.Context(), e)
+		if err != nil {
+			log.Error().Err(err).Str("uid", uid).Msg("could not fetch waitlist position")
+			render.Render(w, r, util.ErrServer(err))
+			return
+		}
+
+		renderers = append(renderers, &e)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "waitlist").
+		Str("requester_uid", uid).
+		Str("action", "listSelfWaitlist").
+		Bool("privileged", false).
+		Msg("listed requester's waitlist entries")
+}
+
+// Get fetches the requester's spot in an event's waitlist.
+//
+//	@Summary		Get the requesting user's waitlist spot
+//	@Description	Get the requesting user's position in an event's waitlist. Available to all users.
+//	@Tags			waitlist
+//	@Produce		json
+//	@Param			eventID	path		string	true	"Event ID"
+//	@Success		200		{object}	models.WaitlistEntry
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/waitlist/{eventID} [get]
+func (ctrl WaitlistController) Get(w http.ResponseWriter, r *http.Request) {
+	eventID, uid, ok := getWaitlistRequestInfo(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to fetch from DB
+	entry, err := models.GetWaitingWaitlistEntry(r.Context(), eventID, uid)
+	if err == mongo.ErrNoDocuments {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not fetch waitlist entry")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &entry); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "waitlist").
+		Str("requester_uid", uid).
+		Str("eventId", eventID.Hex()).
+		Str("action", "getWaitlistEntry").
+		Bool("privileged", false).
+		Msg("fetched requester's waitlist entry")
+}
+
+// Join adds the requester to an event's waitlist.
+//
+//	@Summary		Join an event's waitlist
+//	@Description	Adds the requesting user to the end of the waitlist for a full tier, or a full event if it doesn't have tiers. They're given a spot in that tier automatically once one opens up, using the custom fields given now. Spots in priced tiers come as an order they have to pay for before its checkout deadline. Available to all users.
+//	@Tags			waitlist
+//	@Accept			json
+//	@Produce		json
+//	@Param			eventID	path		string								true	"Event ID"
+//	@Param			body	body		waitlistControllerJoinRequestBody	false	"Tier to wait for & custom fields for the ticket"
+//	@Success		200		{object}	models.WaitlistEntry
+//	@Failure		400
+//	@Failure		404
+//	@Failure		409
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/waitlist/{eventID} [post]
+func (ctrl WaitlistController) Join(w http.ResponseWriter, r *http.Request) {
+	eventID, uid, ok := getWaitlistRequestInfo(w, r)
+	if !ok {
+		return
+	}
+
+	// Parse JSON body, it's optional for events without custom fields
+	var body waitlistControllerJoinRequestBody
+	bodyDecoder := json.NewDecoder(r.Body)
+	bodyDecoder.DisallowUnknownFields()
+	if err := bodyDecoder.Decode(&body); err != nil && err != io.EOF {
+		log.Error().Err(err).Msg("could not parse body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+
+	// Validate JSON body
+	validate := validator.New()
+	if err := validate.Struct(body); err != nil {
+		log.Error().Err(err).Msg("could not validate body")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return
+	}
+	tierID := primitive.NilObjectID
+	if body.TierID != "" {
+		tierID, _ = primitive.ObjectIDFromHex(body.TierID) // Already validated
+	}
+
+	// Try to add to DB
+	entry, err := models.JoinWaitlist(r.Context(), eventID, tierID, uid, body.CustomFields)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			render.Render(w, r, util.ErrNotFound)
+		case models.ErrInvalidCustomFields:
+			render.Render(w, r, util.ErrInvalidRequest(err))
+		case models.ErrTierNotFound:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("tierID has to be one of the event's tiers")))
+		case models.ErrEventNotFull:
+			render.Render(w, r, util.ErrInvalidRequest(errors.New("tier or event still has space, no need to join waitlist")))
+		case models.ErrAlreadyExists:
+			render.Render(w, r, util.ErrConflict(errors.New("already have a ticket or already waiting for this event")))
+		default:
+			log.Error().Err(err).Msg("could not join waitlist")
+			render.Render(w, r, util.ErrServer(err))
+		}
+		return
+	}
+
+	// Return as JSON, fallback if it fails
+	if err := render.Render(w, r, &entry); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "waitlist").
+		Str("requester_uid", uid).
+		Str("eventId", eventID.Hex()).
+		Str("tierId", tierID.Hex()).
+		Int64("position", entry.Position).
+		Str("action", "joinWaitlist").
+		Bool("privileged", false).
+		Msg("joined waitlist")
+}
+
+// Leave removes the requester from an event's waitlist.
+//
+//	@Summary		Leave an event's waitlist
+//	@Description	Removes the requesting user from an event's waitlist. Available to all users.
+//	@Tags			waitlist
+//	@Param			eventID	path	string	true	"Event ID"
+//	@Success		200
+//	@Failure		400
+//	@Failure		404
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/waitlist/{eventID} [delete]
+func (ctrl WaitlistController) Leave(w http.ResponseWriter, r *http.Request) {
+	eventID, uid, ok := getWaitlistRequestInfo(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to update DB
+	err := models.LeaveWaitlist(r.Context(), eventID, uid)
+	if err == models.ErrNotFound {
+		render.Render(w, r, util.ErrNotFound)
+		return
+	} else if err != nil {
+		log.Error().Err(err).Msg("could not leave waitlist")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "waitlist").
+		Str("requester_uid", uid).
+		Str("eventId", eventID.Hex()).
+		Str("action", "leaveWaitlist").
+		Bool("privileged", false).
+		Msg("left waitlist")
+}
+
+// ListEvent fetches everyone waiting for an event.
+//
+//	@Summary		List an event's waitlist
+//	@Description	List everyone waiting for an event, in order. Only available to admins.
+//	@Tags			waitlist
+//	@Produce		json
+//	@Param			eventID	path		string	true	"Event ID"
+//	@Success		200		{object}	[]models.WaitlistEntry
+//	@Failure		400
+//	@Failure		403
+//	@Failure		500
+//	@Security		ApiKeyAuth
+//	@Router			/waitlist/{eventID}/all [get]
+func (ctrl WaitlistController) ListEvent(w http.ResponseWriter, r *http.Request) {
+	eventID, uid, ok := getWaitlistRequestInfo(w, r)
+	if !ok {
+		return
+	}
+
+	// Try to get waitlist entries
+	entries, err := models.GetWaitlist(r.Context(), bson.M{"event": eventID, "status": models.WaitlistStatusWaiting})
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch event's waitlist")
+		render.Render(w, r, util.ErrServer(err))
+		return
+	}
+
+	// Convert into list of renderers to turn into JSON
+	renderers := []render.Renderer{}
+	for i, entry := range entries {
+		e := entry                // Duplicate it before passing by reference to avoid only passing the last obj
+		e.Position = int64(i + 1) // Already in order
+		renderers = append(renderers, &e)
+	}
+
+	// Return as JSON array, fallback if it fails
+	if err := render.RenderList(w, r, renderers); err != nil {
+		render.Render(w, r, util.ErrRender(err))
+		return
+	}
+
+	// Write audit info log
+	log.Info().
+		Str("type", "audit").
+		Str("controller", "waitlist").
+		Str("requester_uid", uid).
+		Str("eventId", eventID.Hex()).
+		Str("action", "listEventWaitlist").
+		Bool("privileged", true).
+		Msg("listed event's waitlist")
+}
+
+// getWaitlistRequestInfo gets the event ID from the URL and the requester's UID, rendering
+// an error response if either can't be found.
+func getWaitlistRequestInfo(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, string, bool) {
+	// Get ID of requested event
+	id := chi.URLParam(r, "eventID")
+
+	// Try to convert the given ID into an Object ID
+	eventID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error().Err(err).Msg("could not convert url param to object id")
+		render.Render(w, r, util.ErrInvalidRequest(err))
+		return primitive.NilObjectID, "", false
+	}
+
+	// Get user UID
+	userToken, err := util.GetUserTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Send()
+		render.Render(w, r, util.ErrServer(err))
+		return primitive.NilObjectID, "", false
+	}
+
+	return eventID, userToken.UID, true
+}
+
+// PromoteFromWaitlist gives any free spots at an event to the people waiting for it, writing
+// an audit log for each one. It's also used by the order expiry job, which has no requester. A
+// failure here shouldn't fail whatever freed up the spot, so errors are only logged.
+func PromoteFromWaitlist(
+	ctx context.Context,
+	eventID primitive.ObjectID,
+	tierID primitive.ObjectID,
+	maxScanCount int,
+	requesterUID string,
+) {
+	promotedTickets, promotedOrders, err := models.PromoteFromWaitlist(ctx, eventID, tierID, maxScanCount)
+	if err != nil {
+		log.Error().Err(err).Str("eventId", eventID.Hex()).Msg("could not promote from waitlist")
+	}
+
+	// Write audit info log for every new ticket & order
+	for _, ticket := range promotedTickets {
+		log.Info().
+			Str("type", "audit").
+			Str("controller", "waitlist").
+			Str("requester_uid", requesterUID).
+			Any("ticket_data", ticket).
+			Str("action", "promoteFromWaitlist").
+			Bool("privileged", true).
+			Msg("promoted user from waitlist to ticket")
+	}
+	for _, order := range promotedOrders {
+		log.Info().
+			Str("type", "audit").
+			Str("controller", "waitlist").
+			Str("requester_uid", requesterUID).
+			Any("order", order).
+			Str("action", "promoteFromWaitlistToOrder").
+			Bool("privileged", true).
+			Msg("promoted user from waitlist to order")
+	}
+}
@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// FakePaymentProvider is an in-process payment provider for development and tests. It never
+// moves real money: checkout sessions are only kept in memory, and they're "paid" by sending
+// a webhook signed with FAKE_PAYMENT_WEBHOOK_SECRET, ex.
+//
+//	body='{"sessionID":"fake_cs_...","status":"succeeded"}'
+//	sig=$(printf '%s' "$body" | openssl dgst -sha256 -hmac "$FAKE_PAYMENT_WEBHOOK_SECRET" | cut -d' ' -f2)
+//	curl -X POST localhost:$PORT/orders/webhook -H "X-Fake-Payment-Signature: $sig" -d "$body"
+type FakePaymentProvider struct {
+	webhookSecret []byte
+	checkoutURL   string
+
+	mu       sync.Mutex
+	sessions map[string]CheckoutRequest
+}
+
+type fakePaymentWebhookBody struct {
+	SessionID string `json:"sessionID"`
+	Status    string `json:"status"`
+}
+
+// CreateNewFakePaymentProvider loads the fake provider's settings from the environment.
+// FAKE_PAYMENT_CHECKOUT_URL is optional, and gets the session ID appended to it.
+func CreateNewFakePaymentProvider() *FakePaymentProvider {
+	webhookSecret := os.Getenv("FAKE_PAYMENT_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		log.Fatal().Msg("could not find FAKE_PAYMENT_WEBHOOK_SECRET in env")
+	}
+
+	return &FakePaymentProvider{
+		webhookSecret: []byte(webhookSecret),
+		checkoutURL:   os.Getenv("FAKE_PAYMENT_CHECKOUT_URL"),
+		sessions:      map[string]CheckoutRequest{},
+	}
+}
+
+func (provider *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (provider *FakePaymentProvider) CreateCheckout(ctx context.Context, req CheckoutRequest) (CheckoutSession, error) {
+	sessionID := "fake_cs_" + uuid.NewString()
+
+	provider.mu.Lock()
+	provider.sessions[sessionID] = req
+	provider.mu.Unlock()
+
+	return CheckoutSession{ID: sessionID, URL: provider.checkoutURL + sessionID}, nil
+}
+
+func (provider *FakePaymentProvider) ExpireCheckout(ctx context.Context, sessionID string) error {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if _, ok := provider.sessions[sessionID]; !ok {
+		return ErrUnknownSession
+	}
+	delete(provider.sessions, sessionID)
+	return nil
+}
+
+// Refund always succeeds since no real money was taken.
+func (provider *FakePaymentProvider) Refund(ctx context.Context, paymentID string, amount int64) (string, error) {
+	return "fake_re_" + uuid.NewString(), nil
+}
+
+func (provider *FakePaymentProvider) ParseWebhook(r *http.Request) (PaymentWebhookEvent, error) {
+	rawBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		return PaymentWebhookEvent{}, err
+	}
+
+	// Check signature before trusting anything in the body
+	sig, err := hex.DecodeString(r.Header.Get("X-Fake-Payment-Signature"))
+	if err != nil {
+		return PaymentWebhookEvent{}, ErrInvalidWebhook
+	}
+	mac := hmac.New(sha256.New, provider.webhookSecret)
+	mac.Write(rawBody)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return PaymentWebhookEvent{}, ErrInvalidWebhook
+	}
+
+	var body fakePaymentWebhookBody
+	if err := json.Unmarshal(rawBody, &body); err != nil {
+		return PaymentWebhookEvent{}, ErrInvalidWebhook
+	}
+	if body.Status != PaymentStatusSucceeded && body.Status != PaymentStatusFailed {
+		return PaymentWebhookEvent{}, ErrInvalidWebhook
+	}
+
+	// Sessions only exist in memory, so they're gone after a restart
+	provider.mu.Lock()
+	req, ok := provider.sessions[body.SessionID]
+	if ok {
+		delete(provider.sessions, body.SessionID)
+	}
+	provider.mu.Unlock()
+	if !ok {
+		return PaymentWebhookEvent{}, ErrUnknownSession
+	}
+
+	event := PaymentWebhookEvent{
+		SessionID: body.SessionID,
+		Status:    body.Status,
+		Amount:    req.Amount,
+	}
+	if body.Status == PaymentStatusSucceeded {
+		event.PaymentID = "fake_pay_" + uuid.NewString()
+	}
+	return event, nil
+}
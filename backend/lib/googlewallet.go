@@ -229,7 +229,7 @@ func (ticket WalletTicketClass) generateString() string {
 		"id": "%s.%s.%s",
 		"hexBackgroundColor": "#4285f4"
 	}
-	`, issuerId, ticket.event.suffix, ticket.ownerName, ticket.event.heroImageUri, ticket.qrCodeValue, ticket.event.latitude, ticket.event.longitude, ticket.id, ticket.id, ticket.studentNumber, issuerId, ticket.event.suffix, ticket.id)
+	`, issuerId, ticket.event.suffix, ticket.ownerName, ticket.qrCodeValue, ticket.event.latitude, ticket.event.longitude, ticket.event.name, ticket.ownerName, ticket.studentNumber, ticket.id, ticket.id, issuerId, ticket.event.suffix, ticket.id)
 }
 
 func main() {
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultOrderHoldMinutes        = 15
+	defaultWaitlistCheckoutMinutes = 24 * 60
+)
+
+var (
+	Payments PaymentProvider
+
+	ErrInvalidWebhook = errors.New("lib: payment webhook is malformed or has an invalid signature")
+	ErrUnknownSession = errors.New("lib: payment provider does not know about checkout session")
+)
+
+// Outcomes a payment can have once the provider is done with it
+const (
+	PaymentStatusSucceeded = "succeeded"
+	PaymentStatusFailed    = "failed"
+)
+
+// CheckoutRequest is what's needed to start taking a payment from a student.
+type CheckoutRequest struct {
+	OrderID     string
+	Amount      int64 // In cents
+	Currency    string
+	Description string // Shown to the student on the checkout page
+	ExpiresAt   time.Time
+}
+
+// CheckoutSession is a started payment that the student finishes on the provider's page.
+type CheckoutSession struct {
+	ID  string
+	URL string // Where to send the student to pay
+}
+
+// PaymentWebhookEvent is a verified update from the provider about a checkout session.
+type PaymentWebhookEvent struct {
+	SessionID string
+	PaymentID string // Provider's ID for the settled payment, empty if it failed
+	Status    string
+	Amount    int64 // In cents
+}
+
+// PaymentProvider takes payments for orders. Providers let us know when a payment settles
+// through a webhook, which is the only thing that should ever issue a paid ticket.
+type PaymentProvider interface {
+	// Name is stored on orders to know which provider took the payment.
+	Name() string
+
+	// CreateCheckout starts a payment for an order.
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (CheckoutSession, error)
+
+	// ExpireCheckout stops a checkout session from being paid, ex. when the order expires.
+	ExpireCheckout(ctx context.Context, sessionID string) error
+
+	// Refund gives back part or all of a settled payment, returning the provider's ID for the refund.
+	Refund(ctx context.Context, paymentID string, amount int64) (string, error)
+
+	// ParseWebhook verifies that a webhook request came from the provider and reads it.
+	// Returns ErrInvalidWebhook if it can't be trusted.
+	ParseWebhook(r *http.Request) (PaymentWebhookEvent, error)
+}
+
+// CreateNewPaymentProvider sets up the provider named by PAYMENT_PROVIDER.
+func CreateNewPaymentProvider() PaymentProvider {
+	providerName := os.Getenv("PAYMENT_PROVIDER")
+	if providerName == "" {
+		providerName = "fake"
+	}
+
+	switch providerName {
+	case "fake":
+		if os.Getenv("FRASERTICKETS_ENV") == "production" {
+			log.Fatal().Msg("refusing to use fake payment provider in production")
+		}
+		return CreateNewFakePaymentProvider()
+	default:
+		log.Fatal().Str("provider", providerName).Msg("unknown PAYMENT_PROVIDER")
+		return nil
+	}
+}
+
+// GetOrderHoldDuration gets how long an unpaid order holds a spot for from ORDER_HOLD_MINUTES.
+func GetOrderHoldDuration() time.Duration {
+	return getMinutesFromEnv("ORDER_HOLD_MINUTES", defaultOrderHoldMinutes)
+}
+
+// GetWaitlistCheckoutDuration gets how long someone promoted from a waitlist into a priced tier
+// has to pay for their spot from WAITLIST_CHECKOUT_MINUTES. It's longer than a normal order's
+// hold since they weren't the one who started the checkout.
+func GetWaitlistCheckoutDuration() time.Duration {
+	return getMinutesFromEnv("WAITLIST_CHECKOUT_MINUTES", defaultWaitlistCheckoutMinutes)
+}
+
+// GetPaymentCurrency gets the currency orders are charged in from PAYMENT_CURRENCY.
+func GetPaymentCurrency() string {
+	currency := os.Getenv("PAYMENT_CURRENCY")
+	if currency == "" {
+		currency = "cad"
+	}
+	return currency
+}
+
+func getMinutesFromEnv(key string, defaultMinutes int) time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || minutes <= 0 {
+		minutes = defaultMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
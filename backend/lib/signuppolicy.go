@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	SignUpPolicy *EmailSignUpPolicy
+
+	ErrSignUpEmailDenied          = errors.New("lib: email address is not allowed to sign up")
+	ErrSignUpDomainNotAllowed     = errors.New("lib: email domain is not allowed to sign up")
+	ErrSignUpInvalidStudentNumber = errors.New("lib: email address does not contain a valid student number")
+)
+
+// defaultSignUpPolicy only lets in school board accounts. Student accounts are their student
+// number, and staff accounts (ex. first.last) are let in without one.
+const defaultSignUpPolicy = `{
+	"domains": [
+		{"domain": "pdsb.net", "studentNumberPattern": "^([0-9]+)$", "allowWithoutStudentNumber": true}
+	]
+}`
+
+// SignUpDomainRule decides who can sign up with an email domain and how their student number
+// is found.
+type SignUpDomainRule struct {
+	Domain string `json:"domain"` // Matched exactly against everything after the @, ex. "pdsb.net"
+
+	// Applied to everything before the @. The first capture group is the student number, or the
+	// whole match if there aren't any groups. Leave empty if accounts from this domain never
+	// have a student number.
+	StudentNumberPattern string `json:"studentNumberPattern"`
+
+	// Whether addresses that don't match the pattern can still sign up, without a student
+	// number (ex. staff accounts).
+	AllowWithoutStudentNumber bool `json:"allowWithoutStudentNumber"`
+}
+
+// SignUpPolicyConfig is the raw policy, as given in SIGN_UP_POLICY.
+type SignUpPolicyConfig struct {
+	Domains       []SignUpDomainRule `json:"domains"`
+	AllowedEmails []string           `json:"allowedEmails"` // Can sign up even if their domain isn't allowed
+	DeniedEmails  []string           `json:"deniedEmails"`  // Can never sign up
+}
+
+type signUpDomain struct {
+	rule                 SignUpDomainRule
+	studentNumberPattern *regexp.Regexp
+}
+
+// EmailSignUpPolicy decides who can create an account based on their email address.
+type EmailSignUpPolicy struct {
+	domains       map[string]signUpDomain
+	allowedEmails map[string]bool
+	deniedEmails  map[string]bool
+}
+
+// SignUpResult is what the policy worked out about someone allowed to sign up.
+type SignUpResult struct {
+	StudentNumber string // Empty if they don't have one, ex. staff
+}
+
+// CreateNewSignUpPolicy loads the sign-up policy from SIGN_UP_POLICY, which is JSON in the
+// format of SignUpPolicyConfig. Only school board accounts are let in if it isn't set.
+func CreateNewSignUpPolicy() *EmailSignUpPolicy {
+	rawPolicy := os.Getenv("SIGN_UP_POLICY")
+	if rawPolicy == "" {
+		rawPolicy = defaultSignUpPolicy
+	}
+
+	var config SignUpPolicyConfig
+	decoder := json.NewDecoder(strings.NewReader(rawPolicy))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		log.Fatal().Err(err).Msg("could not parse SIGN_UP_POLICY")
+	}
+
+	policy, err := NewSignUpPolicy(config)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid SIGN_UP_POLICY")
+	}
+	return policy
+}
+
+// NewSignUpPolicy checks a policy config and gets it ready to be used.
+func NewSignUpPolicy(config SignUpPolicyConfig) (*EmailSignUpPolicy, error) {
+	policy := &EmailSignUpPolicy{
+		domains:       map[string]signUpDomain{},
+		allowedEmails: map[string]bool{},
+		deniedEmails:  map[string]bool{},
+	}
+
+	for _, rule := range config.Domains {
+		domain := strings.ToLower(strings.TrimSpace(rule.Domain))
+		if domain == "" || strings.Contains(domain, "@") {
+			return nil, errors.New("sign-up domain must be a bare domain, ex. 'pdsb.net'")
+		}
+		if _, exists := policy.domains[domain]; exists {
+			return nil, errors.New("sign-up domain listed more than once: " + domain)
+		}
+
+		compiledDomain := signUpDomain{rule: rule}
+		if rule.StudentNumberPattern != "" {
+			pattern, err := regexp.Compile(rule.StudentNumberPattern)
+			if err != nil {
+				return nil, err
+			}
+			compiledDomain.studentNumberPattern = pattern
+		}
+		policy.domains[domain] = compiledDomain
+	}
+
+	for _, email := range config.AllowedEmails {
+		policy.allowedEmails[normalizeSignUpEmail(email)] = true
+	}
+	for _, email := range config.DeniedEmails {
+		policy.deniedEmails[normalizeSignUpEmail(email)] = true
+	}
+
+	return policy, nil
+}
+
+func normalizeSignUpEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Check decides whether someone can sign up with an email address, and finds their student
+// number if their domain has one.
+func (policy *EmailSignUpPolicy) Check(email string) (SignUpResult, error) {
+	email = normalizeSignUpEmail(email)
+	if policy.deniedEmails[email] {
+		return SignUpResult{}, ErrSignUpEmailDenied
+	}
+
+	// Domain is everything after the last @, so "x@pdsb.net.evil.com" doesn't count as pdsb.net
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return SignUpResult{}, ErrSignUpDomainNotAllowed
+	}
+	localPart, domain := email[:at], email[at+1:]
+
+	domainPolicy, domainAllowed := policy.domains[domain]
+	if !domainAllowed {
+		if policy.allowedEmails[email] {
+			return SignUpResult{}, nil
+		}
+		return SignUpResult{}, ErrSignUpDomainNotAllowed
+	}
+
+	if domainPolicy.studentNumberPattern == nil {
+		return SignUpResult{}, nil
+	}
+
+	match := domainPolicy.studentNumberPattern.FindStringSubmatch(localPart)
+	if match == nil {
+		if domainPolicy.rule.AllowWithoutStudentNumber || policy.allowedEmails[email] {
+			return SignUpResult{}, nil
+		}
+		return SignUpResult{}, ErrSignUpInvalidStudentNumber
+	}
+
+	studentNumber := match[0]
+	if len(match) > 1 {
+		studentNumber = match[1]
+	}
+	return SignUpResult{StudentNumber: studentNumber}, nil
+}
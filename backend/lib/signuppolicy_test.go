@@ -0,0 +1,84 @@
+package lib
+
+import "testing"
+
+func TestEmailSignUpPolicyCheck(t *testing.T) {
+	policy, err := NewSignUpPolicy(SignUpPolicyConfig{
+		Domains: []SignUpDomainRule{
+			{Domain: "pdsb.net", StudentNumberPattern: "^([0-9]+)$", AllowWithoutStudentNumber: true},
+			{Domain: "students.example.com", StudentNumberPattern: `^s(\d{6})\.[a-z]+$`},
+			{Domain: "staff.example.com"},
+		},
+		AllowedEmails: []string{"Guest@Gmail.com", "teacher@students.example.com"},
+		DeniedEmails:  []string{"banned@pdsb.net", "blocked@gmail.com"},
+	})
+	if err != nil {
+		t.Fatalf("could not create policy: %v", err)
+	}
+
+	testCases := []struct {
+		email             string
+		wantErr           error
+		wantStudentNumber string
+	}{
+		// Student numbers come from the first capture group
+		{"123456@pdsb.net", nil, "123456"},
+		{"s654321.smith@students.example.com", nil, "654321"},
+		{" 123456@PDSB.net ", nil, "123456"},
+
+		// Staff without a student number are let in only where the domain allows it
+		{"first.last@pdsb.net", nil, ""},
+		{"first.last@students.example.com", ErrSignUpInvalidStudentNumber, ""},
+		{"s12345.smith@students.example.com", ErrSignUpInvalidStudentNumber, ""},
+		{"anyone@staff.example.com", nil, ""},
+
+		// Domains have to match exactly
+		{"123456@pdsb.net.evil.com", ErrSignUpDomainNotAllowed, ""},
+		{"123456@evilpdsb.net", ErrSignUpDomainNotAllowed, ""},
+		{"123456@student.pdsb.net", ErrSignUpDomainNotAllowed, ""},
+		{"123456@pdsb.net@evil.com", ErrSignUpDomainNotAllowed, ""},
+		{"123456@gmail.com", ErrSignUpDomainNotAllowed, ""},
+
+		// Malformed addresses
+		{"pdsb.net", ErrSignUpDomainNotAllowed, ""},
+		{"@pdsb.net", ErrSignUpDomainNotAllowed, ""},
+		{"123456@", ErrSignUpDomainNotAllowed, ""},
+
+		// Allow list lets people in from other domains, or without a student number
+		{"guest@gmail.com", nil, ""},
+		{"teacher@students.example.com", nil, ""},
+
+		// Deny list wins over everything else
+		{"banned@pdsb.net", ErrSignUpEmailDenied, ""},
+		{"BLOCKED@gmail.com", ErrSignUpEmailDenied, ""},
+	}
+
+	for _, testCase := range testCases {
+		result, err := policy.Check(testCase.email)
+		if err != testCase.wantErr {
+			t.Errorf("%q: got error %v, wanted %v", testCase.email, err, testCase.wantErr)
+			continue
+		}
+		if result.StudentNumber != testCase.wantStudentNumber {
+			t.Errorf("%q: got student number %q, wanted %q", testCase.email, result.StudentNumber, testCase.wantStudentNumber)
+		}
+	}
+}
+
+func TestNewSignUpPolicyInvalid(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config SignUpPolicyConfig
+	}{
+		{"empty domain", SignUpPolicyConfig{Domains: []SignUpDomainRule{{Domain: " "}}}},
+		{"domain with @", SignUpPolicyConfig{Domains: []SignUpDomainRule{{Domain: "@pdsb.net"}}}},
+		{"repeated domain", SignUpPolicyConfig{Domains: []SignUpDomainRule{{Domain: "pdsb.net"}, {Domain: "PDSB.net"}}}},
+		{"bad pattern", SignUpPolicyConfig{Domains: []SignUpDomainRule{{Domain: "pdsb.net", StudentNumberPattern: "("}}}},
+	}
+
+	for _, testCase := range testCases {
+		if _, err := NewSignUpPolicy(testCase.config); err == nil {
+			t.Errorf("%s: policy was accepted", testCase.name)
+		}
+	}
+}
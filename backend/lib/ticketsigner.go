@@ -0,0 +1,178 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	TicketSigner *Ed25519TicketSigner
+
+	ErrInvalidSignedPayload = errors.New("lib: signed payload is malformed or has an invalid signature")
+	ErrUnknownSigningKey    = errors.New("lib: signed payload uses an unknown signing key")
+)
+
+// TicketPayload is the data encoded into a ticket's QR code.
+type TicketPayload struct {
+	TicketID string `json:"t"`
+	EventID  string `json:"e"`
+	IssuedAt int64  `json:"iat"` // Unix timestamp
+	KeyID    string `json:"kid"`
+}
+
+// TicketSigningKey is a public key that scanning devices use to check QR codes and manifests
+// without being able to sign their own.
+type TicketSigningKey struct {
+	KeyID     string `json:"kid"`
+	PublicKey string `json:"publicKey"` // Base64, raw 32 byte Ed25519 public key
+	Active    bool   `json:"active"`    // Whether new payloads are signed with it
+}
+
+func (key *TicketSigningKey) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Ed25519TicketSigner signs and verifies payloads using Ed25519. Only the server has the
+// private keys, so devices given the public keys can check signatures offline but can't forge
+// them. Several keys can be loaded at once so that keys can be rotated: new payloads are always
+// signed with the active key, while payloads signed with any other loaded key still verify
+// until that key is removed from the environment.
+type Ed25519TicketSigner struct {
+	activeKeyID string
+	keys        map[string]ed25519.PrivateKey
+}
+
+// CreateNewTicketSigner loads the signing keys from the environment. TICKET_SIGNING_KEYS
+// is a comma-separated list of "keyID:base64Seed" pairs, where each seed is 32 random bytes
+// (ex. from `openssl rand -base64 32`) that the Ed25519 key is made from, and
+// TICKET_SIGNING_ACTIVE_KEY_ID is the ID of the key used to sign new payloads.
+func CreateNewTicketSigner() *Ed25519TicketSigner {
+	signer := &Ed25519TicketSigner{keys: map[string]ed25519.PrivateKey{}}
+
+	rawKeys := os.Getenv("TICKET_SIGNING_KEYS")
+	if rawKeys == "" {
+		log.Fatal().Msg("could not find TICKET_SIGNING_KEYS in env")
+	}
+
+	for _, rawKey := range strings.Split(rawKeys, ",") {
+		keyID, encodedSeed, found := strings.Cut(strings.TrimSpace(rawKey), ":")
+		if !found || keyID == "" {
+			log.Fatal().Msg("ticket signing key is not in format 'keyID:base64Seed'")
+		}
+
+		seed, err := base64.StdEncoding.DecodeString(encodedSeed)
+		if err != nil {
+			log.Fatal().Err(err).Str("keyID", keyID).Msg("could not decode ticket signing key")
+		}
+		if len(seed) != ed25519.SeedSize {
+			log.Fatal().Str("keyID", keyID).Msg("ticket signing key must be a 32 byte seed")
+		}
+		signer.keys[keyID] = ed25519.NewKeyFromSeed(seed)
+	}
+
+	signer.activeKeyID = os.Getenv("TICKET_SIGNING_ACTIVE_KEY_ID")
+	if _, ok := signer.keys[signer.activeKeyID]; !ok {
+		log.Fatal().Str("keyID", signer.activeKeyID).Msg("active ticket signing key was not found in TICKET_SIGNING_KEYS")
+	}
+
+	return signer
+}
+
+// ActiveKeyID returns the ID of the key currently used for signing.
+func (signer *Ed25519TicketSigner) ActiveKeyID() string {
+	return signer.activeKeyID
+}
+
+// PublicKeys lists the public half of every loaded key, sorted by key ID, for scanning devices
+// to verify with.
+func (signer *Ed25519TicketSigner) PublicKeys() []TicketSigningKey {
+	publicKeys := []TicketSigningKey{}
+	for keyID, key := range signer.keys {
+		publicKeys = append(publicKeys, TicketSigningKey{
+			KeyID:     keyID,
+			PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			Active:    keyID == signer.activeKeyID,
+		})
+	}
+	sort.Slice(publicKeys, func(i, j int) bool { return publicKeys[i].KeyID < publicKeys[j].KeyID })
+	return publicKeys
+}
+
+// SignTicketPayload signs a ticket payload with the active key, returning the string
+// that should be put in the ticket's QR code.
+func (signer *Ed25519TicketSigner) SignTicketPayload(payload TicketPayload) (string, error) {
+	payload.KeyID = signer.activeKeyID
+
+	rawPayload, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return signer.sign(rawPayload, signer.activeKeyID), nil
+}
+
+// VerifyTicketPayload checks the signature on a QR code string and returns the payload inside.
+func (signer *Ed25519TicketSigner) VerifyTicketPayload(signed string) (TicketPayload, error) {
+	encodedPayload, encodedSig, found := strings.Cut(signed, ".")
+	if !found {
+		return TicketPayload{}, ErrInvalidSignedPayload
+	}
+
+	rawPayload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return TicketPayload{}, ErrInvalidSignedPayload
+	}
+
+	// Need to decode before verifying to know which key it was signed with
+	var payload TicketPayload
+	if err := json.Unmarshal(rawPayload, &payload); err != nil {
+		return TicketPayload{}, ErrInvalidSignedPayload
+	}
+
+	if err := signer.verify(encodedPayload, encodedSig, payload.KeyID); err != nil {
+		return TicketPayload{}, err
+	}
+
+	return payload, nil
+}
+
+// SignData signs arbitrary data (ex. an offline scanning manifest) with the active key,
+// returning "base64url(data).base64url(signature)".
+func (signer *Ed25519TicketSigner) SignData(data []byte) string {
+	return signer.sign(data, signer.activeKeyID)
+}
+
+// sign returns "base64url(data).base64url(signature)" using the given key. The signature is
+// over the encoded data, so devices can verify it without decoding first.
+func (signer *Ed25519TicketSigner) sign(data []byte, keyID string) string {
+	encodedData := base64.RawURLEncoding.EncodeToString(data)
+	sig := ed25519.Sign(signer.keys[keyID], []byte(encodedData))
+
+	return encodedData + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (signer *Ed25519TicketSigner) verify(encodedData string, encodedSig string, keyID string) error {
+	key, ok := signer.keys[keyID]
+	if !ok {
+		return ErrUnknownSigningKey
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return ErrInvalidSignedPayload
+	}
+
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(encodedData), sig) {
+		return ErrInvalidSignedPayload
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// newTestTicketSigner loads a signer from the environment like the server does, with a seed
+// made from each key ID so that the same ID always gives the same key.
+func newTestTicketSigner(t *testing.T, activeKeyID string, keyIDs ...string) *Ed25519TicketSigner {
+	t.Helper()
+
+	rawKeys := []string{}
+	for _, keyID := range keyIDs {
+		seed := make([]byte, ed25519.SeedSize)
+		copy(seed, keyID)
+		rawKeys = append(rawKeys, keyID+":"+base64.StdEncoding.EncodeToString(seed))
+	}
+	t.Setenv("TICKET_SIGNING_KEYS", strings.Join(rawKeys, ","))
+	t.Setenv("TICKET_SIGNING_ACTIVE_KEY_ID", activeKeyID)
+
+	return CreateNewTicketSigner()
+}
+
+func TestTicketSignerRoundTrip(t *testing.T) {
+	signer := newTestTicketSigner(t, "k1", "k1")
+
+	signed, err := signer.SignTicketPayload(TicketPayload{TicketID: "ticket", EventID: "event", IssuedAt: 1700000000})
+	if err != nil {
+		t.Fatalf("could not sign payload: %v", err)
+	}
+
+	payload, err := signer.VerifyTicketPayload(signed)
+	if err != nil {
+		t.Fatalf("could not verify payload: %v", err)
+	}
+	want := TicketPayload{TicketID: "ticket", EventID: "event", IssuedAt: 1700000000, KeyID: "k1"}
+	if payload != want {
+		t.Errorf("got payload %+v, wanted %+v", payload, want)
+	}
+}
+
+func TestTicketSignerKeyRotation(t *testing.T) {
+	oldSigner := newTestTicketSigner(t, "old", "old")
+	oldSigned, err := oldSigner.SignTicketPayload(TicketPayload{TicketID: "ticket", EventID: "event"})
+	if err != nil {
+		t.Fatalf("could not sign payload: %v", err)
+	}
+
+	// Old key is still loaded, so its payloads still verify while new ones use the new key
+	rotatedSigner := newTestTicketSigner(t, "new", "old", "new")
+	if _, err := rotatedSigner.VerifyTicketPayload(oldSigned); err != nil {
+		t.Errorf("payload signed with old key was rejected: %v", err)
+	}
+	newSigned, err := rotatedSigner.SignTicketPayload(TicketPayload{TicketID: "ticket", EventID: "event"})
+	if err != nil {
+		t.Fatalf("could not sign payload: %v", err)
+	}
+	payload, err := rotatedSigner.VerifyTicketPayload(newSigned)
+	if err != nil {
+		t.Fatalf("could not verify payload: %v", err)
+	}
+	if payload.KeyID != "new" {
+		t.Errorf("new payload was signed with key %q", payload.KeyID)
+	}
+
+	// Once the old key is removed, its payloads stop working
+	newOnlySigner := newTestTicketSigner(t, "new", "new")
+	if _, err := newOnlySigner.VerifyTicketPayload(oldSigned); err != ErrUnknownSigningKey {
+		t.Errorf("payload signed with removed key got error %v, wanted %v", err, ErrUnknownSigningKey)
+	}
+	if _, err := newOnlySigner.VerifyTicketPayload(newSigned); err != nil {
+		t.Errorf("payload signed with new key was rejected: %v", err)
+	}
+}
+
+func TestTicketSignerRejectsTampering(t *testing.T) {
+	signer := newTestTicketSigner(t, "k1", "k1", "k2")
+	signed, err := signer.SignTicketPayload(TicketPayload{TicketID: "ticket", EventID: "event"})
+	if err != nil {
+		t.Fatalf("could not sign payload: %v", err)
+	}
+	encodedPayload, encodedSig, _ := strings.Cut(signed, ".")
+
+	// Encodes a payload without signing it again
+	encode := func(payload TicketPayload) string {
+		raw, _ := json.Marshal(payload)
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	flippedSig := []byte(encodedSig)
+	if flippedSig[0] == 'A' {
+		flippedSig[0] = 'B'
+	} else {
+		flippedSig[0] = 'A'
+	}
+
+	testCases := []struct {
+		name    string
+		signed  string
+		wantErr error
+	}{
+		{"changed ticket", encode(TicketPayload{TicketID: "other", EventID: "event", KeyID: "k1"}) + "." + encodedSig, ErrInvalidSignedPayload},
+		{"other key's ID", encode(TicketPayload{TicketID: "ticket", EventID: "event", KeyID: "k2"}) + "." + encodedSig, ErrInvalidSignedPayload},
+		{"unknown key", encode(TicketPayload{TicketID: "ticket", EventID: "event", KeyID: "k3"}) + "." + encodedSig, ErrUnknownSigningKey},
+		{"changed signature", encodedPayload + "." + string(flippedSig), ErrInvalidSignedPayload},
+		{"missing signature", encodedPayload, ErrInvalidSignedPayload},
+		{"empty signature", encodedPayload + ".", ErrInvalidSignedPayload},
+		{"bad payload encoding", "!!!." + encodedSig, ErrInvalidSignedPayload},
+		{"payload isn't json", base64.RawURLEncoding.EncodeToString([]byte("ticket")) + "." + encodedSig, ErrInvalidSignedPayload},
+		{"empty", "", ErrInvalidSignedPayload},
+	}
+
+	for _, testCase := range testCases {
+		if _, err := signer.VerifyTicketPayload(testCase.signed); err != testCase.wantErr {
+			t.Errorf("%s: got error %v, wanted %v", testCase.name, err, testCase.wantErr)
+		}
+	}
+}
+
+func TestTicketSignerPublicKeys(t *testing.T) {
+	signer := newTestTicketSigner(t, "k2", "k1", "k2")
+
+	publicKeys := signer.PublicKeys()
+	if len(publicKeys) != 2 || publicKeys[0].KeyID != "k1" || publicKeys[1].KeyID != "k2" {
+		t.Fatalf("got public keys %+v, wanted k1 & k2", publicKeys)
+	}
+	if publicKeys[0].Active || !publicKeys[1].Active {
+		t.Errorf("only k2 should be active: %+v", publicKeys)
+	}
+
+	// Devices only get the public key, which has to be enough to check signed data
+	publicKey, err := base64.StdEncoding.DecodeString(publicKeys[1].PublicKey)
+	if err != nil {
+		t.Fatalf("could not decode public key: %v", err)
+	}
+	encodedData, encodedSig, _ := strings.Cut(signer.SignData([]byte(`{"tickets":[]}`)), ".")
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		t.Fatalf("could not decode signature: %v", err)
+	}
+	if !ed25519.Verify(publicKey, []byte(encodedData), sig) {
+		t.Errorf("signed data didn't verify with the published public key")
+	}
+	if ed25519.Verify(publicKey, []byte(encodedData+"x"), sig) {
+		t.Errorf("changed data verified with the published public key")
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+
+	"firebase.google.com/go/auth"
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/models"
+	"github.com/aritrosaha10/frasertickets/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkTokenNotRevoked makes sure a privileged requester hasn't had their sign-in revoked,
+// rendering an error and returning false if they have.
+func checkTokenNotRevoked(w http.ResponseWriter, r *http.Request, idToken *auth.Token) bool {
+	jwtToken, err := util.GetUserJWTTokenFromContext(r.Context())
+	if err != nil {
+		log.Error().Err(err).Msg("could not fetch user token from context")
+	}
+
+	// We no longer check for revocation in normal authentication since it's not really worth it
+	// (everything is read-only for regular users anyways) and as such, isn't worth the time penalty.
+	// However, it does make sense for privileged routes since they have write access to models.
+	_, err = lib.Auth.Client.VerifyIDTokenAndCheckRevoked(r.Context(), jwtToken)
+	if err != nil {
+		log.Error().Err(err).Any("uid", idToken.UID).Msg("could not confirm token is correct")
+		render.Render(w, r, util.ErrUnauthorized)
+		return false
+	}
+	return true
+}
+
+// RequirePermission only lets through requesters whose role gives them the permission.
+func RequirePermission(permission util.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idToken, err := util.GetUserTokenFromContext(r.Context())
+			if err != nil {
+				log.Error().Err(err).Msg("could not fetch user token from context")
+				render.Render(w, r, util.ErrServer(err))
+				return
+			}
+
+			role := util.GetRoleFromClaims(idToken.Claims)
+			if !role.HasPermission(permission) {
+				log.Warn().
+					Str("uid", idToken.UID).
+					Str("role", string(role)).
+					Str("permission", string(permission)).
+					Msg("unauthorized user attempting to access route without permission")
+				render.Render(w, r, util.ErrForbidden)
+				return
+			}
+
+			if !checkTokenNotRevoked(w, r, idToken) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireStaffPermission only lets through requesters whose role gives them the permission, or who
+// are staff with the permission for any event. Meant for routes that can only tell which event is
+// involved once the request is read, so the handler still has to check the event itself.
+func RequireStaffPermission(permission util.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idToken, err := util.GetUserTokenFromContext(r.Context())
+			if err != nil {
+				log.Error().Err(err).Msg("could not fetch user token from context")
+				render.Render(w, r, util.ErrServer(err))
+				return
+			}
+
+			role := util.GetRoleFromClaims(idToken.Claims)
+			allowed, err := models.HasAnyEventPermission(r.Context(), idToken.UID, role, permission)
+			if err != nil {
+				log.Error().Err(err).Msg("could not check event staff permissions")
+				render.Render(w, r, util.ErrServer(err))
+				return
+			}
+			if !allowed {
+				log.Warn().
+					Str("uid", idToken.UID).
+					Str("role", string(role)).
+					Str("permission", string(permission)).
+					Msg("unauthorized user attempting to access route without permission")
+				render.Render(w, r, util.ErrForbidden)
+				return
+			}
+
+			if !checkTokenNotRevoked(w, r, idToken) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireEventPermission only lets through requesters whose role gives them the permission, or who
+// are staff with the permission for the event in the "id" URL param.
+func RequireEventPermission(permission util.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idToken, err := util.GetUserTokenFromContext(r.Context())
+			if err != nil {
+				log.Error().Err(err).Msg("could not fetch user token from context")
+				render.Render(w, r, util.ErrServer(err))
+				return
+			}
+
+			eventID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+			if err != nil {
+				log.Error().Err(err).Msg("could not convert url param to object id")
+				render.Render(w, r, util.ErrInvalidRequest(err))
+				return
+			}
+
+			role := util.GetRoleFromClaims(idToken.Claims)
+			allowed, err := models.HasEventPermission(r.Context(), eventID, idToken.UID, role, permission)
+			if err != nil {
+				log.Error().Err(err).Msg("could not check event staff permissions")
+				render.Render(w, r, util.ErrServer(err))
+				return
+			}
+			if !allowed {
+				log.Warn().
+					Str("uid", idToken.UID).
+					Str("role", string(role)).
+					Str("eventId", eventID.Hex()).
+					Str("permission", string(permission)).
+					Msg("unauthorized user attempting to access event route without permission")
+				render.Render(w, r, util.ErrForbidden)
+				return
+			}
+
+			if !checkTokenNotRevoked(w, r, idToken) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GuestAttendanceGroup is what guest tickets are grouped under in grade breakdowns, since
+// guests aren't students.
+const GuestAttendanceGroup = "guest"
+
+// AttendanceBucket is the scans made during one slice of time at an event.
+type AttendanceBucket struct {
+	Start    time.Time `json:"start"    bson:"_id"`
+	Arrivals int64     `json:"arrivals" bson:"arrivals"` // First time each ticket was scanned in
+	Entries  int64     `json:"entries"  bson:"entries"`  // Includes re-entries
+	Exits    int64     `json:"exits"    bson:"exits"`
+}
+
+// AttendanceBreakdown is the attendance of tickets that share a value, ex. a grade or a
+// custom field's answer.
+type AttendanceBreakdown struct {
+	Value    interface{} `json:"value"    bson:"_id"`
+	Tickets  int64       `json:"tickets"  bson:"tickets"`
+	Attended int64       `json:"attended" bson:"attended"`
+	NoShows  int64       `json:"noShows"  bson:"-"`
+}
+
+// EventAttendanceAnalytics sums up who came to an event and when. Voided tickets aren't counted.
+type EventAttendanceAnalytics struct {
+	EventID          primitive.ObjectID               `json:"eventID"`
+	BucketMinutes    int                              `json:"bucketMinutes"`
+	Tickets          int64                            `json:"tickets"`
+	Attended         int64                            `json:"attended"` // Scanned in at least once
+	NoShows          int64                            `json:"noShows"`
+	NoShowRate       float64                          `json:"noShowRate"` // Between 0 and 1
+	CurrentlyInside  int64                            `json:"currentlyInside"`
+	ReentryScans     int64                            `json:"reentryScans"`     // Entries after a ticket's first
+	ReenteredTickets int64                            `json:"reenteredTickets"` // Tickets that came back in at least once
+	Timeline         []AttendanceBucket               `json:"timeline"`
+	Grades           []AttendanceBreakdown            `json:"grades"`
+	CustomFields     map[string][]AttendanceBreakdown `json:"customFields"` // Custom field name -> breakdown by answer
+}
+
+func (analytics *EventAttendanceAnalytics) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// AttendanceAnalyticsOptions changes how attendance is grouped.
+type AttendanceAnalyticsOptions struct {
+	BucketMinutes             int      // Length of each slice of the timeline
+	GradeField                string   // Custom field holding each student's grade, leave empty to use student numbers
+	StudentNumberPrefixLength int      // How many leading digits of a student number decide their grade if there's no grade field
+	CustomFields              []string // Custom fields to break down, leave empty for every field with a fixed set of answers
+}
+
+// GetBreakdownCustomFields picks the custom fields that are worth breaking attendance down by
+// by default, which are the ones with a fixed set of answers (ex. meal choice).
+func GetBreakdownCustomFields(event Event) []string {
+	properties, _ := event.RawCustomFieldsSchema["properties"].(map[string]interface{})
+
+	fields := []string{}
+	for key, rawProperty := range properties {
+		property, ok := rawProperty.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		_, hasEnum := property["enum"]
+		if hasEnum || property["type"] == "boolean" {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+
+	return fields
+}
+
+// attendanceCountsStage sums up how many tickets are in a group and how many of them were used.
+func attendanceCountsStage(groupBy interface{}) bson.D {
+	return bson.D{
+		{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: groupBy},
+			{Key: "tickets", Value: bson.M{"$sum": 1}},
+			{Key: "attended", Value: bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$gt": bson.A{"$scanCount", 0}}, 1, 0},
+			}}},
+		}},
+	}
+}
+
+// decodeAttendanceBreakdowns reads the breakdowns out of a facet, filling in no-shows.
+func decodeAttendanceBreakdowns(facet bson.RawValue) ([]AttendanceBreakdown, error) {
+	breakdowns := []AttendanceBreakdown{}
+	if err := facet.Unmarshal(&breakdowns); err != nil {
+		return nil, err
+	}
+	for i := range breakdowns {
+		breakdowns[i].NoShows = breakdowns[i].Tickets - breakdowns[i].Attended
+	}
+	return breakdowns, nil
+}
+
+// GetEventAttendanceAnalytics works out an event's arrival curve, no-shows, re-entries, and
+// attendance by grade and custom field.
+func GetEventAttendanceAnalytics(ctx context.Context, event Event, opts AttendanceAnalyticsOptions) (EventAttendanceAnalytics, error) {
+	analytics := EventAttendanceAnalytics{
+		EventID:       event.ID,
+		BucketMinutes: opts.BucketMinutes,
+		Timeline:      []AttendanceBucket{},
+		Grades:        []AttendanceBreakdown{},
+		CustomFields:  map[string][]AttendanceBreakdown{},
+	}
+
+	// Group guests separately, then students by their grade field or student number
+	var studentGrade interface{} = bson.M{"$substrCP": bson.A{
+		bson.M{"$ifNull": bson.A{"$ownerData.student_number", ""}},
+		0,
+		opts.StudentNumberPrefixLength,
+	}}
+	if opts.GradeField != "" {
+		studentGrade = "$customFields." + opts.GradeField
+	}
+	gradeExpr := bson.M{"$cond": bson.A{
+		bson.M{"$gt": bson.A{"$guest", nil}},
+		GuestAttendanceGroup,
+		studentGrade,
+	}}
+
+	// Custom fields can't be used as facet names since they might have dots in them
+	facets := bson.D{
+		{Key: "totals", Value: bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "tickets", Value: bson.M{"$sum": 1}},
+				{Key: "attended", Value: bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$gt": bson.A{"$scanCount", 0}}, 1, 0},
+				}}},
+				{Key: "inside", Value: bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$inside", true}}, 1, 0},
+				}}},
+			}}},
+		}},
+		{Key: "grades", Value: bson.A{
+			attendanceCountsStage(gradeExpr),
+			bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		}},
+	}
+	for i, field := range opts.CustomFields {
+		facets = append(facets, bson.E{Key: fmt.Sprintf("field%d", i), Value: bson.A{
+			attendanceCountsStage("$customFields." + field),
+			bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		}})
+	}
+
+	ticketPipeline := mongo.Pipeline{
+		{
+			{Key: "$match", Value: bson.M{"event": event.ID, "voided": bson.M{"$ne": true}}},
+		},
+		{
+			{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "users"},
+				{Key: "localField", Value: "owner"},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: "ownerData"},
+			},
+			},
+		},
+		{
+			{Key: "$unwind", Value: bson.D{
+				{Key: "path", Value: "$ownerData"},
+				{Key: "preserveNullAndEmptyArrays", Value: true},
+			}},
+		},
+		{
+			{Key: "$facet", Value: facets},
+		},
+	}
+
+	cursor, err := lib.Datastore.Db.Collection(ticketsColName).Aggregate(ctx, ticketPipeline)
+	if err != nil {
+		return EventAttendanceAnalytics{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var ticketResults []bson.Raw
+	if err := cursor.All(ctx, &ticketResults); err != nil {
+		return EventAttendanceAnalytics{}, err
+	}
+	if len(ticketResults) == 1 {
+		ticketResult := ticketResults[0]
+
+		var totals []struct {
+			Tickets  int64 `bson:"tickets"`
+			Attended int64 `bson:"attended"`
+			Inside   int64 `bson:"inside"`
+		}
+		if err := ticketResult.Lookup("totals").Unmarshal(&totals); err != nil {
+			return EventAttendanceAnalytics{}, err
+		}
+		if len(totals) == 1 {
+			analytics.Tickets = totals[0].Tickets
+			analytics.Attended = totals[0].Attended
+			analytics.CurrentlyInside = totals[0].Inside
+		}
+
+		analytics.Grades, err = decodeAttendanceBreakdowns(ticketResult.Lookup("grades"))
+		if err != nil {
+			return EventAttendanceAnalytics{}, err
+		}
+
+		for i, field := range opts.CustomFields {
+			analytics.CustomFields[field], err = decodeAttendanceBreakdowns(ticketResult.Lookup(fmt.Sprintf("field%d", i)))
+			if err != nil {
+				return EventAttendanceAnalytics{}, err
+			}
+		}
+	}
+	analytics.NoShows = analytics.Tickets - analytics.Attended
+	if analytics.Tickets > 0 {
+		analytics.NoShowRate = float64(analytics.NoShows) / float64(analytics.Tickets)
+	}
+
+	// Entry scans store how many times the ticket had been scanned in, so 1 is an arrival
+	isEntry := bson.M{"$ne": bson.A{"$direction", ScanDirectionExit}}
+	isArrival := bson.M{"$and": bson.A{isEntry, bson.M{"$eq": bson.A{"$index", 1}}}}
+	isReentry := bson.M{"$and": bson.A{isEntry, bson.M{"$gt": bson.A{"$index", 1}}}}
+	bucketMillis := int64(opts.BucketMinutes) * int64(time.Minute/time.Millisecond)
+	bucketExpr := bson.M{"$toDate": bson.M{"$subtract": bson.A{
+		bson.M{"$toLong": "$timestamp"},
+		bson.M{"$mod": bson.A{bson.M{"$toLong": "$timestamp"}, bucketMillis}},
+	}}}
+
+	scanPipeline := mongo.Pipeline{
+		{
+			{Key: "$match", Value: bson.M{"event": event.ID, "processed": true}},
+		},
+		{
+			{Key: "$facet", Value: bson.D{
+				{Key: "timeline", Value: bson.A{
+					bson.D{{Key: "$group", Value: bson.D{
+						{Key: "_id", Value: bucketExpr},
+						{Key: "arrivals", Value: bson.M{"$sum": bson.M{"$cond": bson.A{isArrival, 1, 0}}}},
+						{Key: "entries", Value: bson.M{"$sum": bson.M{"$cond": bson.A{isEntry, 1, 0}}}},
+						{Key: "exits", Value: bson.M{"$sum": bson.M{"$cond": bson.A{isEntry, 0, 1}}}},
+					}}},
+					bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+				}},
+				{Key: "reentries", Value: bson.A{
+					bson.D{{Key: "$match", Value: bson.M{"$expr": isReentry}}},
+					bson.D{{Key: "$group", Value: bson.D{
+						{Key: "_id", Value: nil},
+						{Key: "scans", Value: bson.M{"$sum": 1}},
+						{Key: "tickets", Value: bson.M{"$addToSet": "$ticket"}},
+					}}},
+					bson.D{{Key: "$project", Value: bson.D{
+						{Key: "scans", Value: 1},
+						{Key: "tickets", Value: bson.M{"$size": "$tickets"}},
+					}}},
+				}},
+			}},
+		},
+	}
+
+	scanCursor, err := lib.Datastore.Db.Collection(ticketScansColName).Aggregate(ctx, scanPipeline)
+	if err != nil {
+		return EventAttendanceAnalytics{}, err
+	}
+	defer scanCursor.Close(ctx)
+
+	var scanResults []struct {
+		Timeline  []AttendanceBucket `bson:"timeline"`
+		Reentries []struct {
+			Scans   int64 `bson:"scans"`
+			Tickets int64 `bson:"tickets"`
+		} `bson:"reentries"`
+	}
+	if err := scanCursor.All(ctx, &scanResults); err != nil {
+		return EventAttendanceAnalytics{}, err
+	}
+	if len(scanResults) == 1 {
+		if scanResults[0].Timeline != nil {
+			analytics.Timeline = scanResults[0].Timeline
+		}
+		if len(scanResults[0].Reentries) == 1 {
+			analytics.ReentryScans = scanResults[0].Reentries[0].Scans
+			analytics.ReenteredTickets = scanResults[0].Reentries[0].Tickets
+		}
+	}
+
+	return analytics, nil
+}
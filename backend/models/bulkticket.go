@@ -0,0 +1,295 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	BulkTicketRowCreated = "created" // Student has an account, so a ticket was made
+	BulkTicketRowQueued  = "queued"  // Student hasn't signed up yet, so a queued ticket was made
+	BulkTicketRowFailed  = "failed"
+)
+
+// BulkTicketRow is one ticket to create as part of a bulk request.
+type BulkTicketRow struct {
+	StudentNumber string                 `json:"studentNumber"`
+	FullName      string                 `json:"fullName"`     // Applied to the student's account once a queued ticket is claimed
+	TierID        primitive.ObjectID     `json:"tierID"`       // Leave empty if event doesn't use tiers
+	MaxScanCount  int                    `json:"maxScanCount"` // Defaults to tier's max scan count if 0 and a tier is given
+	CustomFields  map[string]interface{} `json:"customFields"`
+}
+
+// BulkTicketRowResult is what happened to one row of a bulk request.
+type BulkTicketRowResult struct {
+	Row            int    `json:"row"` // 1-based position of the row in the request
+	StudentNumber  string `json:"studentNumber"`
+	Status         string `json:"status"`
+	TicketID       string `json:"ticketID,omitempty"`
+	QueuedTicketID string `json:"queuedTicketID,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// BulkTicketResult is the report for a whole bulk request. On a dry run, nothing is saved and
+// each row's status is what would have happened.
+type BulkTicketResult struct {
+	DryRun  bool                  `json:"dryRun"`
+	Created int                   `json:"created"`
+	Queued  int                   `json:"queued"`
+	Failed  int                   `json:"failed"`
+	Rows    []BulkTicketRowResult `json:"rows"`
+}
+
+func (result *BulkTicketResult) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// BulkTicketOptions changes how a bulk request is handled.
+type BulkTicketOptions struct {
+	DryRun          bool
+	ExcludedOwner   string // UID of a user who can't be given a ticket, ex. the admin making the request
+	UpdateFullNames bool   // Whether to also apply given full names to students who already have an account
+}
+
+// bulkTicketErrorMessage turns an error from creating a ticket into something readable for the report.
+func bulkTicketErrorMessage(err error) string {
+	switch err {
+	case ErrAlreadyExists:
+		return "student already has a ticket for this event"
+	case ErrEventFull:
+		return "event has reached its capacity"
+	case ErrTierFull:
+		return "ticket tier has reached its capacity"
+	case ErrTierNotFound:
+		return "tier does not exist for event"
+	default:
+		return err.Error()
+	}
+}
+
+// bulkTicketCapacity keeps track of how many spots are left during a dry run, since nothing
+// is saved to count against the event's capacity.
+type bulkTicketCapacity struct {
+	event      Event
+	eventCount int
+	tierCounts map[primitive.ObjectID]int
+}
+
+// newBulkTicketCapacity starts counting from the spots already taken at the event.
+func newBulkTicketCapacity(ctx context.Context, eventID primitive.ObjectID) (bulkTicketCapacity, error) {
+	event, err := getIssuedCounts(ctx, eventID)
+	if err != nil {
+		return bulkTicketCapacity{}, err
+	}
+
+	capacity := bulkTicketCapacity{
+		event:      event,
+		eventCount: event.IssuedCount,
+		tierCounts: map[primitive.ObjectID]int{},
+	}
+	for _, tier := range event.TicketTiers {
+		capacity.tierCounts[tier.ID] = tier.IssuedCount
+	}
+	return capacity, nil
+}
+
+func (capacity *bulkTicketCapacity) reserve(tier TicketTier) error {
+	if capacity.event.Capacity != 0 && capacity.eventCount >= capacity.event.Capacity {
+		return ErrEventFull
+	}
+
+	if !tier.ID.IsZero() {
+		if tier.Capacity != 0 && capacity.tierCounts[tier.ID] >= tier.Capacity {
+			return ErrTierFull
+		}
+		capacity.tierCounts[tier.ID]++
+	}
+
+	capacity.eventCount++
+	return nil
+}
+
+// CreateBulkTickets creates a ticket for each row, or a queued ticket if the student hasn't
+// signed up yet. Rows are handled one at a time and a failed row doesn't stop the rest, so
+// the result says what happened to each one.
+func CreateBulkTickets(ctx context.Context, eventID primitive.ObjectID, rows []BulkTicketRow, opts BulkTicketOptions) (BulkTicketResult, error) {
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return BulkTicketResult{}, ErrNotFound
+	} else if err != nil {
+		return BulkTicketResult{}, err
+	}
+
+	// Dry runs don't save anything, so spots have to be counted here instead
+	var capacity bulkTicketCapacity
+	if opts.DryRun {
+		capacity, err = newBulkTicketCapacity(ctx, event.ID)
+		if err != nil {
+			return BulkTicketResult{}, err
+		}
+	}
+
+	result := BulkTicketResult{
+		DryRun: opts.DryRun,
+		Rows:   []BulkTicketRowResult{},
+	}
+	seenStudentNumbers := map[string]int{}
+
+	for i, row := range rows {
+		rowResult := BulkTicketRowResult{
+			Row:           i + 1,
+			StudentNumber: strings.TrimSpace(row.StudentNumber),
+		}
+
+		// Each row either creates something or fails with a reason
+		status, err := func() (string, error) {
+			if rowResult.StudentNumber == "" {
+				return "", fmt.Errorf("missing student number")
+			}
+			if firstRow, ok := seenStudentNumbers[rowResult.StudentNumber]; ok {
+				return "", fmt.Errorf("same student number as row %d", firstRow)
+			}
+			seenStudentNumbers[rowResult.StudentNumber] = rowResult.Row
+
+			if row.MaxScanCount < 0 {
+				return "", fmt.Errorf("max scan count must be greater than or equal to 0")
+			}
+
+			// Check if tier exists for event
+			tier := TicketTier{}
+			if !row.TierID.IsZero() {
+				var ok bool
+				tier, ok = event.GetTicketTier(row.TierID)
+				if !ok {
+					return "", ErrTierNotFound
+				}
+			}
+			maxScanCount := row.MaxScanCount
+			if maxScanCount == 0 {
+				maxScanCount = tier.MaxScanCount
+			}
+
+			// Check custom fields up front, since queued tickets aren't checked until they're claimed
+			customFields := row.CustomFields
+			if customFields == nil {
+				customFields = map[string]interface{}{}
+			}
+			valid, schemaErrs, err := ValidateCustomEventFields(ctx, event, customFields)
+			if err != nil {
+				return "", err
+			}
+			if !valid {
+				errStrs := []string{}
+				for _, schemaErr := range schemaErrs {
+					errStrs = append(errStrs, schemaErr.String())
+				}
+				return "", fmt.Errorf("custom fields do not match event's schema: %s", strings.Join(errStrs, "; "))
+			}
+
+			// Students who haven't signed up yet get a queued ticket instead
+			user, err := GetUserByKey(ctx, "student_number", rowResult.StudentNumber)
+			hasAccount := err == nil
+			if err != nil && err != mongo.ErrNoDocuments {
+				return "", err
+			}
+			if hasAccount && opts.ExcludedOwner != "" && user.ID == opts.ExcludedOwner {
+				return "", fmt.Errorf("cannot create a ticket for yourself")
+			}
+
+			if opts.DryRun {
+				var exists bool
+				if hasAccount {
+					_, err := SearchForTicket(ctx, event.ID, user.ID)
+					if err != nil && err != mongo.ErrNoDocuments {
+						return "", err
+					}
+					exists = err == nil
+				} else {
+					exists, err = CheckIfQueuedTicketExists(ctx, bson.M{
+						"student_number": rowResult.StudentNumber,
+						"event_id":       event.ID,
+					})
+					if err != nil {
+						return "", err
+					}
+				}
+				if exists {
+					return "", ErrAlreadyExists
+				}
+				if err := capacity.reserve(tier); err != nil {
+					return "", err
+				}
+
+				if hasAccount {
+					return BulkTicketRowCreated, nil
+				}
+				return BulkTicketRowQueued, nil
+			}
+
+			if hasAccount {
+				ticket := Ticket{
+					Owner:        user.ID,
+					Event:        event.ID,
+					Tier:         tier.ID,
+					MaxScanCount: maxScanCount,
+					CustomFields: customFields,
+					OwnerHistory: []TicketOwnerChange{},
+				}
+				ticketID, err := CreateNewTicket(ctx, ticket)
+				if err != nil {
+					return "", err
+				}
+				rowResult.TicketID = ticketID.Hex()
+
+				// Same as when a queued ticket is claimed, not worth failing the row over
+				fullName := strings.TrimSpace(row.FullName)
+				if opts.UpdateFullNames && fullName != "" {
+					UpdateExistingUserByKeys(ctx, user.ID, map[string]interface{}{
+						"full_name": fullName,
+					})
+				}
+				return BulkTicketRowCreated, nil
+			}
+
+			queuedTicket := QueuedTicket{
+				StudentNumber:  rowResult.StudentNumber,
+				EventID:        event.ID,
+				Tier:           tier.ID,
+				MaxScanCount:   maxScanCount,
+				FullNameUpdate: strings.TrimSpace(row.FullName),
+				CustomFields:   customFields,
+				OwnerHistory:   []TicketOwnerChange{},
+			}
+			queuedTicketID, err := CreateQueuedTicket(ctx, queuedTicket)
+			if err != nil {
+				return "", err
+			}
+			rowResult.QueuedTicketID = queuedTicketID.Hex()
+			return BulkTicketRowQueued, nil
+		}()
+
+		if err != nil {
+			log.Warn().Err(err).Str("event_id", event.ID.Hex()).Int("row", rowResult.Row).Msg("could not create ticket from bulk request row")
+			rowResult.Status = BulkTicketRowFailed
+			rowResult.Error = bulkTicketErrorMessage(err)
+			result.Failed++
+		} else {
+			rowResult.Status = status
+			if status == BulkTicketRowCreated {
+				result.Created++
+			} else {
+				result.Queued++
+			}
+		}
+		result.Rows = append(result.Rows, rowResult)
+	}
+
+	return result, nil
+}
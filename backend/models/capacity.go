@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Spots at an event are counted on the event itself (and on each tier) instead of by counting
+// tickets, so that taking a spot can be done in one conditional update. Anything that takes up a
+// spot (tickets, queued tickets, and unpaid orders) reserves one before it's saved, and gives it
+// back once it stops taking up space.
+
+// countTicketSpaces counts everything taking up a spot at an event, and in a tier if one is given.
+// Unpaid orders keep their spot until they're marked as expired, same as the counts on the event.
+func countTicketSpaces(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID) (int64, error) {
+	ticketFilter := bson.M{"event": eventID, "voided": bson.M{"$ne": true}}
+	queuedTicketFilter := bson.M{"event_id": eventID}
+	orderFilter := bson.M{"event": eventID, "status": OrderStatusPending}
+	if !tierID.IsZero() {
+		ticketFilter["tier"] = tierID
+		queuedTicketFilter["tier"] = tierID
+		orderFilter["tier"] = tierID
+	}
+
+	ticketCount, err := lib.Datastore.Db.Collection(ticketsColName).CountDocuments(ctx, ticketFilter)
+	if err != nil {
+		return -1, err
+	}
+	queuedTicketCount, err := lib.Datastore.Db.Collection(queuedTicketsColName).CountDocuments(ctx, queuedTicketFilter)
+	if err != nil {
+		return -1, err
+	}
+	heldOrderCount, err := lib.Datastore.Db.Collection(ordersColName).CountDocuments(ctx, orderFilter)
+	if err != nil {
+		return -1, err
+	}
+
+	return ticketCount + queuedTicketCount + heldOrderCount, nil
+}
+
+// initIssuedCounts fills in the spot counts of events from before they were kept on the event.
+// Only the first caller's counts are saved if it's called more than once at the same time.
+func initIssuedCounts(ctx context.Context, eventID primitive.ObjectID) error {
+	initialized, err := lib.Datastore.Db.Collection(eventsColName).
+		CountDocuments(ctx, bson.M{"_id": eventID, "issued_count": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	if initialized > 0 {
+		return nil
+	}
+
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	eventCount, err := countTicketSpaces(ctx, eventID, primitive.NilObjectID)
+	if err != nil {
+		return err
+	}
+	updates := bson.M{"issued_count": eventCount}
+	arrayFilters := []interface{}{}
+	for i, tier := range event.TicketTiers {
+		tierCount, err := countTicketSpaces(ctx, eventID, tier.ID)
+		if err != nil {
+			return err
+		}
+		updates[fmt.Sprintf("ticket_tiers.$[tier%d].issued_count", i)] = tierCount
+		arrayFilters = append(arrayFilters, bson.M{fmt.Sprintf("tier%d._id", i): tier.ID})
+	}
+
+	opts := options.Update()
+	if len(arrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: arrayFilters})
+	}
+	_, err = lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": eventID, "issued_count": bson.M{"$exists": false}},
+		bson.M{"$set": updates},
+		opts,
+	)
+	return err
+}
+
+// ticketSpaceFilter matches the event if it has a spot left, and if the tier is given, if the
+// tier has one left too. Capacities are read from the event as it's being updated rather than
+// from a copy that could be out of date.
+func ticketSpaceFilter(eventID primitive.ObjectID, tierID primitive.ObjectID) bson.M {
+	// Capacity of 0 means unlimited
+	conditions := bson.A{
+		bson.M{"$or": bson.A{
+			bson.M{"$lte": bson.A{"$capacity", 0}},
+			bson.M{"$lt": bson.A{"$issued_count", "$capacity"}},
+		}},
+	}
+	if !tierID.IsZero() {
+		conditions = append(conditions, bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+			"input": "$ticket_tiers",
+			"as":    "tier",
+			"in": bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$$tier._id", tierID}},
+				bson.M{"$or": bson.A{
+					bson.M{"$lte": bson.A{"$$tier.capacity", 0}},
+					bson.M{"$lt": bson.A{"$$tier.issued_count", "$$tier.capacity"}},
+				}},
+			}},
+		}}}})
+	}
+
+	return bson.M{
+		"_id":          eventID,
+		"issued_count": bson.M{"$exists": true},
+		"$expr":        bson.M{"$and": conditions},
+	}
+}
+
+// reserveTicketSpace takes up a spot at an event, and in a tier if one is given, as long as
+// neither is full. The spot has to be given back with releaseTicketSpace if whatever it was
+// reserved for doesn't end up being saved.
+func reserveTicketSpace(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID) error {
+	if err := initIssuedCounts(ctx, eventID); err != nil {
+		return err
+	}
+
+	update := bson.M{"issued_count": 1}
+	opts := options.Update()
+	if !tierID.IsZero() {
+		update["ticket_tiers.$[tier].issued_count"] = 1
+		opts.SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"tier._id": tierID}}})
+	}
+
+	res, err := lib.Datastore.Db.Collection(eventsColName).
+		UpdateOne(ctx, ticketSpaceFilter(eventID, tierID), bson.M{"$inc": update}, opts)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
+
+	// Figure out why there wasn't a spot
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if event.Capacity > 0 && event.IssuedCount >= event.Capacity {
+		return ErrEventFull
+	}
+	if _, ok := event.GetTicketTier(tierID); !ok {
+		return ErrTierNotFound
+	}
+	return ErrTierFull
+}
+
+// releaseTicketSpace gives back a spot taken with reserveTicketSpace.
+func releaseTicketSpace(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID) error {
+	update := bson.M{"issued_count": -1}
+	opts := options.Update()
+	if !tierID.IsZero() {
+		update["ticket_tiers.$[tier].issued_count"] = -1
+		opts.SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"tier._id": tierID, "tier.issued_count": bson.M{"$gt": 0}},
+		}})
+	}
+
+	// Events that haven't had their counts filled in yet don't have anything to give back
+	_, err := lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": eventID, "issued_count": bson.M{"$gt": 0}},
+		bson.M{"$inc": update},
+		opts,
+	)
+	return err
+}
+
+// getIssuedCounts fetches an event with its spot counts filled in.
+func getIssuedCounts(ctx context.Context, eventID primitive.ObjectID) (Event, error) {
+	if err := initIssuedCounts(ctx, eventID); err != nil {
+		return Event{}, err
+	}
+	return GetEvent(ctx, bson.M{"_id": eventID})
+}
@@ -1,8 +1,20 @@
 package models
 
 const (
-	usersColName         = "users"
-	eventsColName        = "events"
-	ticketsColName       = "tickets"
-	queuedTicketsColName = "queued-tickets"
+	usersColName            = "users"
+	eventsColName           = "events"
+	ticketsColName          = "tickets"
+	queuedTicketsColName    = "queued-tickets"
+	ticketScansColName      = "ticket_scans"
+	scanStationsColName     = "scan-stations"
+	transfersColName        = "ticket-transfers"
+	waitlistColName         = "waitlist"
+	ordersColName           = "orders"
+	paymentsColName         = "payments"
+	refundsColName          = "refunds"
+	promoCodesColName       = "promo-codes"
+	promoRedemptionsColName = "promo-redemptions"
+	seatingGroupsColName    = "seating-groups"
+	roleChangesColName      = "role-changes"
+	eventStaffColName       = "event-staff"
 )
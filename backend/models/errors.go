@@ -5,10 +5,40 @@ import (
 )
 
 var (
-	ErrNoDocumentModified error
-	ErrEditNotAllowed     error
-	ErrAlreadyExists      error
-	ErrNotFound           error
+	ErrNoDocumentModified    error
+	ErrEditNotAllowed        error
+	ErrAlreadyExists         error
+	ErrNotFound              error
+	ErrMaxScanCountExceeded  error
+	ErrAlreadyInside         error
+	ErrNotInside             error
+	ErrInvalidStationRole    error
+	ErrScanTooEarly          error
+	ErrEventEnded            error
+	ErrTicketVoided          error
+	ErrTransferNotAllowed    error
+	ErrEventFull             error
+	ErrEventNotFull          error
+	ErrTierNotFound          error
+	ErrTierFull              error
+	ErrTierInUse             error
+	ErrTierNotOnSale         error
+	ErrInvalidCustomFields   error
+	ErrRefundTooLarge        error
+	ErrPromoCodeNotUsable    error
+	ErrPromoCodeUsedUp       error
+	ErrPromoCodeInUse        error
+	ErrInvalidPromoCodeType  error
+	ErrInvalidPromoCodeValue error
+	ErrGuestsNotAllowed      error
+	ErrGuestLimitReached     error
+	ErrTableNotFound         error
+	ErrTableFull             error
+	ErrTableInUse            error
+	ErrGroupSeated           error
+	ErrRoleUnchanged         error
+	ErrInvalidRoleSource     error
+	ErrEventHasOrders        error
 )
 
 func init() {
@@ -16,4 +46,34 @@ func init() {
 	ErrEditNotAllowed = errors.New("models: cannot update forbidden / unknown attr")
 	ErrAlreadyExists = errors.New("models: document already exists when it should be unique")
 	ErrNotFound = errors.New("models: document could not be found")
+	ErrMaxScanCountExceeded = errors.New("models: ticket has already reached its max scan count")
+	ErrAlreadyInside = errors.New("models: ticket holder is already inside")
+	ErrNotInside = errors.New("models: ticket holder is not inside")
+	ErrInvalidStationRole = errors.New("models: scan station role must be 'entry', 'exit', or 'any'")
+	ErrScanTooEarly = errors.New("models: doors have not opened for event yet")
+	ErrEventEnded = errors.New("models: doors have closed for event")
+	ErrTicketVoided = errors.New("models: ticket has been voided")
+	ErrTransferNotAllowed = errors.New("models: ticket can no longer be transferred")
+	ErrEventFull = errors.New("models: event has reached its capacity")
+	ErrEventNotFull = errors.New("models: event has not reached its capacity")
+	ErrTierNotFound = errors.New("models: ticket tier does not exist for event")
+	ErrTierFull = errors.New("models: ticket tier has reached its capacity")
+	ErrTierInUse = errors.New("models: ticket tier still has tickets")
+	ErrTierNotOnSale = errors.New("models: ticket tier is not on sale right now")
+	ErrInvalidCustomFields = errors.New("models: custom fields do not match event's schema")
+	ErrRefundTooLarge = errors.New("models: refund is more than what is left on the payment")
+	ErrPromoCodeNotUsable = errors.New("models: promo code does not exist, has expired, or does not apply to tier")
+	ErrPromoCodeUsedUp = errors.New("models: promo code has reached its usage limit")
+	ErrPromoCodeInUse = errors.New("models: promo code has already been used")
+	ErrInvalidPromoCodeType = errors.New("models: promo code type must be 'percentage', 'fixed', or 'free'")
+	ErrInvalidPromoCodeValue = errors.New("models: promo code value must be 1-100 for percentage codes, positive for fixed codes, and empty for free codes")
+	ErrGuestsNotAllowed = errors.New("models: ticket can't have guests")
+	ErrGuestLimitReached = errors.New("models: ticket already has as many guests as the event allows")
+	ErrTableNotFound = errors.New("models: seating table does not exist for event")
+	ErrTableFull = errors.New("models: seating table does not have enough free seats")
+	ErrTableInUse = errors.New("models: seating table still has groups seated at it")
+	ErrGroupSeated = errors.New("models: seating group has already been seated")
+	ErrRoleUnchanged = errors.New("models: user already has that role")
+	ErrInvalidRoleSource = errors.New("models: role source must be 'claims' or 'database'")
+	ErrEventHasOrders = errors.New("models: event has payments or unpaid orders")
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aritrosaha10/frasertickets/lib"
@@ -15,21 +17,60 @@ import (
 )
 
 type Event struct {
-	ID                    primitive.ObjectID     `json:"id"              bson:"_id,omitempty"`
-	Name                  string                 `json:"name"            bson:"name"`
-	Description           string                 `json:"description"     bson:"description"`
-	ImageURLs             []string               `json:"img_urls"        bson:"img_urls"`
-	Location              string                 `json:"location"        bson:"location"` // Ex. name of venue
-	Address               string                 `json:"address"         bson:"address"`
-	StartTimestamp        time.Time              `json:"start_timestamp" bson:"start_timestamp"`
-	EndTimestamp          time.Time              `json:"end_timestamp"   bson:"end_timestamp"`
-	RawCustomFieldsSchema map[string]interface{} `json:"custom_fields_schema" bson:"custom_fields_schema"` // Schema for extra data in JSON Schema format
+	ID                       primitive.ObjectID     `json:"id"              bson:"_id,omitempty"`
+	Name                     string                 `json:"name"            bson:"name"`
+	Description              string                 `json:"description"     bson:"description"`
+	ImageURLs                []string               `json:"img_urls"        bson:"img_urls"`
+	Location                 string                 `json:"location"        bson:"location"` // Ex. name of venue
+	Address                  string                 `json:"address"         bson:"address"`
+	StartTimestamp           time.Time              `json:"start_timestamp" bson:"start_timestamp"`
+	EndTimestamp             time.Time              `json:"end_timestamp"   bson:"end_timestamp"`
+	DoorsOpenTimestamp       time.Time              `json:"doors_open_timestamp"  bson:"doors_open_timestamp"`            // When tickets start being scanned in, defaults to start timestamp
+	DoorsCloseTimestamp      time.Time              `json:"doors_close_timestamp" bson:"doors_close_timestamp"`           // When tickets stop being scanned in, defaults to end timestamp
+	EarlyGraceMinutes        int                    `json:"early_grace_minutes"   bson:"early_grace_minutes"`             // How long before doors open scans are still let through
+	LateGraceMinutes         int                    `json:"late_grace_minutes"    bson:"late_grace_minutes"`              // How long after doors close scans are still let through
+	Capacity                 int                    `json:"capacity" bson:"capacity"`                                     // Max number of tickets & queued tickets, 0 means unlimited
+	IssuedCount              int                    `json:"-" bson:"issued_count,omitempty"`                              // Spots taken up, kept up to date when reserving & releasing spots
+	TransfersRequireApproval bool                   `json:"transfers_require_approval" bson:"transfers_require_approval"` // Whether an admin has to approve ticket transfers
+	MaxGuestsPerStudent      int                    `json:"max_guests_per_student" bson:"max_guests_per_student"`         // How many outside guests each student can bring, 0 means guests aren't allowed
+	TicketTiers              []TicketTier           `json:"ticket_tiers" bson:"ticket_tiers"`                             // Types of tickets, managed through the tier endpoints
+	SeatingTables            []SeatingTable         `json:"seating_tables" bson:"seating_tables"`                         // Tables for seated events, managed through the seating endpoints
+	RawCustomFieldsSchema    map[string]interface{} `json:"custom_fields_schema" bson:"custom_fields_schema"`             // Schema for extra data in JSON Schema format
 }
 
 func (event *Event) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// ScanWindow returns the times that tickets for the event can start and stop being
+// scanned in, including grace periods.
+func (event Event) ScanWindow() (time.Time, time.Time) {
+	opens := event.DoorsOpenTimestamp
+	if opens.IsZero() {
+		opens = event.StartTimestamp
+	}
+	closes := event.DoorsCloseTimestamp
+	if closes.IsZero() {
+		closes = event.EndTimestamp
+	}
+
+	opens = opens.Add(-time.Duration(event.EarlyGraceMinutes) * time.Minute)
+	closes = closes.Add(time.Duration(event.LateGraceMinutes) * time.Minute)
+	return opens, closes
+}
+
+// CheckScanTime makes sure a ticket for the event can be scanned in at the given time.
+func (event Event) CheckScanTime(t time.Time) error {
+	opens, closes := event.ScanWindow()
+	if t.Before(opens) {
+		return ErrScanTooEarly
+	}
+	if t.After(closes) {
+		return ErrEventEnded
+	}
+	return nil
+}
+
 func GetAllEvents(ctx context.Context) ([]Event, error) {
 	// Try to get data from MongoDB
 	cursor, err := lib.Datastore.Db.Collection(eventsColName).Find(ctx, bson.D{})
@@ -71,6 +112,14 @@ func CreateNewEvent(ctx context.Context, event Event) (primitive.ObjectID, error
 		return primitive.NilObjectID, err
 	}
 
+	// Tiers and tables are added later through their own endpoints, which need an array to push onto
+	if event.TicketTiers == nil {
+		event.TicketTiers = []TicketTier{}
+	}
+	if event.SeatingTables == nil {
+		event.SeatingTables = []SeatingTable{}
+	}
+
 	// Try to add document
 	res, err := lib.Datastore.Db.Collection(eventsColName).InsertOne(ctx, event)
 
@@ -94,16 +143,64 @@ func ValidateCustomEventFields(ctx context.Context, event Event, customFields ma
 	}
 }
 
+// ParseCustomEventFields converts custom fields given as text (ex. from a CSV) into the types
+// the event's schema expects. Empty values are left out so that required fields still fail
+// validation, and anything that can't be converted is kept as text for validation to reject.
+func ParseCustomEventFields(event Event, rawCustomFields map[string]string) map[string]interface{} {
+	properties, _ := event.RawCustomFieldsSchema["properties"].(map[string]interface{})
+
+	customFields := map[string]interface{}{}
+	for key, rawValue := range rawCustomFields {
+		rawValue = strings.TrimSpace(rawValue)
+		if rawValue == "" {
+			continue
+		}
+
+		fieldType := ""
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			fieldType, _ = property["type"].(string)
+		}
+
+		var value interface{} = rawValue
+		switch fieldType {
+		case "integer":
+			if parsed, err := strconv.ParseInt(rawValue, 10, 64); err == nil {
+				value = parsed
+			}
+		case "number":
+			if parsed, err := strconv.ParseFloat(rawValue, 64); err == nil {
+				value = parsed
+			}
+		case "boolean":
+			if parsed, err := strconv.ParseBool(rawValue); err == nil {
+				value = parsed
+			}
+		}
+		customFields[key] = value
+	}
+
+	return customFields
+}
+
 func UpdateExistingEvent(ctx context.Context, id string, updates map[string]interface{}) error {
 	UPDATABLE_KEYS := map[string]bool{
-		"name":                 true,
-		"description":          true,
-		"img_urls":             true,
-		"location":             true,
-		"address":              true,
-		"start_timestamp":      true,
-		"end_timestamp":        true,
-		"custom_fields_schema": false, // Not allowed because since a ticket might exist with only old attributes
+		"name":                       true,
+		"description":                true,
+		"img_urls":                   true,
+		"location":                   true,
+		"address":                    true,
+		"start_timestamp":            true,
+		"end_timestamp":              true,
+		"doors_open_timestamp":       true,
+		"doors_close_timestamp":      true,
+		"early_grace_minutes":        true,
+		"late_grace_minutes":         true,
+		"transfers_require_approval": true,
+		"capacity":                   true,
+		"max_guests_per_student":     true,
+		"ticket_tiers":               false, // Has its own endpoints so that tier IDs stay stable
+		"seating_tables":             false, // Same as ticket tiers
+		"custom_fields_schema":       false, // Not allowed because since a ticket might exist with only old attributes
 	}
 
 	// Get event to get the custom field schema
@@ -121,7 +218,7 @@ func UpdateExistingEvent(ctx context.Context, id string, updates map[string]inte
 		}
 
 		// Convert timestamps to time.Time objects
-		if key == "start_timestamp" || key == "end_timestamp" {
+		if key == "start_timestamp" || key == "end_timestamp" || key == "doors_open_timestamp" || key == "doors_close_timestamp" {
 			// TODO: Validate if the start_timestamp is before end_timestamp, probably not necessary but may be helpful
 			if timestampStr, ok := val.(string); ok {
 				timestamp, err := time.Parse(time.RFC3339, timestampStr)
@@ -135,6 +232,28 @@ func UpdateExistingEvent(ctx context.Context, id string, updates map[string]inte
 				log.Warn().Err(err).Str("key", key).Msg("could not parse timestamp as string")
 				return errors.Join(fmt.Errorf("could not parse timestamp as string"), err)
 			}
+		} else if key == "capacity" {
+			capacity, ok := val.(float64)
+			if !ok || capacity < 0 || capacity != float64(int(capacity)) {
+				log.Warn().Any("val", val).Str("key", key).Msg("capacity is not a non-negative whole number")
+				return fmt.Errorf("capacity must be a non-negative whole number")
+			}
+			bsonUpdates = append(bsonUpdates, bson.E{Key: key, Value: int(capacity)})
+		} else if key == "max_guests_per_student" {
+			maxGuests, ok := val.(float64)
+			if !ok || maxGuests < 0 || maxGuests != float64(int(maxGuests)) {
+				log.Warn().Any("val", val).Str("key", key).Msg("max guests per student is not a non-negative whole number")
+				return fmt.Errorf("max guests per student must be a non-negative whole number")
+			}
+			bsonUpdates = append(bsonUpdates, bson.E{Key: key, Value: int(maxGuests)})
+		} else if key == "early_grace_minutes" || key == "late_grace_minutes" {
+			// JSON numbers come in as floats, but grace periods are whole minutes
+			minutes, ok := val.(float64)
+			if !ok || minutes < 0 || minutes != float64(int(minutes)) {
+				log.Warn().Any("val", val).Str("key", key).Msg("grace period is not a non-negative whole number")
+				return fmt.Errorf("grace period must be a non-negative whole number of minutes")
+			}
+			bsonUpdates = append(bsonUpdates, bson.E{Key: key, Value: int(minutes)})
 		} else {
 			// Add the key/val pair in BSON
 			bsonUpdates = append(bsonUpdates, bson.E{Key: key, Value: val})
@@ -153,6 +272,31 @@ func UpdateExistingEvent(ctx context.Context, id string, updates map[string]inte
 	return nil
 }
 
+// CheckIfEventHasSpace checks whether another ticket can be issued for an event without
+// going over its capacity. Spots can be taken right after checking, so anything that takes
+// one has to use reserveTicketSpace instead.
+func CheckIfEventHasSpace(ctx context.Context, event Event) (bool, error) {
+	if err := initIssuedCounts(ctx, event.ID); err != nil {
+		return false, err
+	}
+
+	count, err := lib.Datastore.Db.Collection(eventsColName).
+		CountDocuments(ctx, ticketSpaceFilter(event.ID, primitive.NilObjectID))
+	return count > 0, err
+}
+
+// CheckIfTierHasSpace checks whether a ticket could be issued in a tier right now, which also
+// needs the event to have space. Tickets without a tier only need the event to have space.
+func CheckIfTierHasSpace(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID) (bool, error) {
+	if err := initIssuedCounts(ctx, eventID); err != nil {
+		return false, err
+	}
+
+	count, err := lib.Datastore.Db.Collection(eventsColName).
+		CountDocuments(ctx, ticketSpaceFilter(eventID, tierID))
+	return count > 0, err
+}
+
 func DeleteEvent(ctx context.Context, id primitive.ObjectID) error {
 	// Check if event exists
 	exists, err := CheckIfEventExists(ctx, id)
@@ -163,12 +307,84 @@ func DeleteEvent(ctx context.Context, id primitive.ObjectID) error {
 		return ErrNotFound
 	}
 
+	// Money records have to be kept, and unpaid orders could still be paid for
+	paymentCount, err := lib.Datastore.Db.Collection(paymentsColName).CountDocuments(ctx, bson.M{"event": id})
+	if err != nil {
+		return err
+	}
+	pendingOrderCount, err := lib.Datastore.Db.Collection(ordersColName).
+		CountDocuments(ctx, bson.M{"event": id, "status": OrderStatusPending})
+	if err != nil {
+		return err
+	}
+	if paymentCount > 0 || pendingOrderCount > 0 {
+		return ErrEventHasOrders
+	}
+
 	// Delete all tickets to event
 	err = DeleteAllTicketsForEvent(ctx, id)
 	if err != nil {
 		return err
 	}
 
+	// Delete scan stations of event
+	err = DeleteAllScanStationsForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete waitlist of event
+	err = DeleteWaitlistForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete scan history of event
+	err = DeleteAllTicketScansForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete staff of event
+	err = DeleteAllEventStaffForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete queued tickets of event
+	err = DeleteAllQueuedTicketsForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete transfers of event
+	err = DeleteAllTicketTransfersForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete orders of event, none of which had money behind them
+	err = DeleteAllOrdersForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete promo codes of event and their uses
+	err = DeleteAllPromoRedemptionsForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = DeleteAllPromoCodesForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Delete seating groups of event
+	err = DeleteAllSeatingGroupsForEvent(ctx, id)
+	if err != nil {
+		return err
+	}
+
 	// Delete event
 	res, err := lib.Datastore.Db.Collection(eventsColName).DeleteOne(ctx, bson.M{"_id": id})
 
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EventManifest is a compact list of every valid ticket for an event, meant to be downloaded
+// by scanning devices before an event so they can keep scanning without a connection.
+type EventManifest struct {
+	EventID     primitive.ObjectID    `json:"eventID"`
+	GeneratedAt time.Time             `json:"generatedAt"`
+	Tickets     []EventManifestTicket `json:"tickets"`
+	KeyID       string                `json:"kid"` // Key used to sign the manifest
+}
+
+type EventManifestTicket struct {
+	ID            primitive.ObjectID `json:"id"            bson:"_id"`
+	OwnerName     string             `json:"ownerName"     bson:"ownerName"`
+	StudentNumber string             `json:"studentNumber" bson:"studentNumber"` // Sponsor's for guest tickets
+	GuestName     string             `json:"guestName,omitempty" bson:"guestName,omitempty"`
+	ScanCount     int                `json:"scanCount"     bson:"scanCount"`
+	MaxScanCount  int                `json:"maxScanCount"  bson:"maxScanCount"`
+}
+
+func GetEventManifest(ctx context.Context, eventID primitive.ObjectID) (EventManifest, error) {
+	pipeline := mongo.Pipeline{
+		{
+			{Key: "$match", Value: bson.M{"event": eventID, "voided": bson.M{"$ne": true}}},
+		},
+		{
+			{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "users"},
+				{Key: "localField", Value: "owner"},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: "ownerData"},
+			},
+			},
+		},
+		{
+			{Key: "$unwind", Value: "$ownerData"},
+		},
+		{
+			// Only keep what a scanner needs to keep things small
+			{Key: "$project", Value: bson.M{
+				"_id":           1,
+				"ownerName":     "$ownerData.full_name",
+				"studentNumber": "$ownerData.student_number",
+				"guestName":     "$guest.name",
+				"scanCount":     1,
+				"maxScanCount":  1,
+			}},
+		},
+	}
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(ticketsColName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return EventManifest{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into manifest entries
+	tickets := []EventManifestTicket{}
+	if err := cursor.All(ctx, &tickets); err != nil {
+		return EventManifest{}, err
+	}
+
+	return EventManifest{
+		EventID:     eventID,
+		GeneratedAt: time.Now(),
+		Tickets:     tickets,
+	}, nil
+}
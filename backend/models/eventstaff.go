@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EventStaff is someone given a role for just one event, without needing a global role.
+type EventStaff struct {
+	ID               primitive.ObjectID  `json:"id"          bson:"_id,omitempty"`
+	EventID          primitive.ObjectID  `json:"eventID"     bson:"event"`
+	UserID           string              `json:"userID"      bson:"user"`
+	Role             util.EventStaffRole `json:"role"        bson:"role"`
+	AddedBy          string              `json:"addedBy"     bson:"added_by"`
+	CreatedTimestamp time.Time           `json:"createdTime" bson:"created_time"`
+}
+
+func (staff *EventStaff) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func CreateEventStaffIndices(ctx context.Context) error {
+	// Create appropriate indices
+	eventUserIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+			{Key: "user", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	userIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(eventStaffColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				eventUserIdxModel,
+				userIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetEventStaffList(ctx context.Context, filter bson.M) ([]EventStaff, error) {
+	// Oldest first
+	opts := options.Find().SetSort(bson.D{{Key: "created_time", Value: 1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(eventStaffColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []EventStaff{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into EventStaff structs
+	var staff []EventStaff
+	if err := cursor.All(ctx, &staff); err != nil {
+		return []EventStaff{}, err
+	}
+
+	return staff, nil
+}
+
+func GetEventStaff(ctx context.Context, eventID primitive.ObjectID, uid string) (EventStaff, error) {
+	// Try to fetch data from DB
+	var staff EventStaff
+	err := lib.Datastore.Db.Collection(eventStaffColName).FindOne(ctx, bson.M{"event": eventID, "user": uid}).Decode(&staff)
+
+	// No error handling needed (staff & err will default to empty struct / nil)
+	return staff, err
+}
+
+// SetEventStaff gives someone a role for an event, replacing any role they already had for it.
+func SetEventStaff(ctx context.Context, staff EventStaff) (EventStaff, error) {
+	staff.CreatedTimestamp = time.Now()
+
+	var updated EventStaff
+	err := lib.Datastore.Db.Collection(eventStaffColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"event": staff.EventID, "user": staff.UserID},
+		bson.M{
+			"$set": bson.M{"role": staff.Role, "added_by": staff.AddedBy},
+			// Keep when they were first added
+			"$setOnInsert": bson.M{"created_time": staff.CreatedTimestamp},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&updated)
+
+	return updated, err
+}
+
+func DeleteEventStaff(ctx context.Context, eventID primitive.ObjectID, uid string) error {
+	// Try to delete document
+	res, err := lib.Datastore.Db.Collection(eventStaffColName).DeleteOne(ctx, bson.M{"event": eventID, "user": uid})
+
+	// Handle no document found
+	if err == nil && res.DeletedCount == 0 {
+		err = ErrNotFound
+	}
+
+	return err
+}
+
+func DeleteAllEventStaffForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all staff for event
+	_, err := lib.Datastore.Db.Collection(eventStaffColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
+
+// HasAnyEventPermission checks whether someone can do something for at least one event, either
+// through their global role or through being staff for an event.
+func HasAnyEventPermission(ctx context.Context, uid string, role util.Role, permission util.Permission) (bool, error) {
+	if role.HasPermission(permission) {
+		return true, nil
+	}
+
+	count, err := lib.Datastore.Db.Collection(eventStaffColName).CountDocuments(ctx, bson.M{
+		"user": uid,
+		"role": bson.M{"$in": util.EventStaffRolesWithPermission(permission)},
+	})
+	return count > 0, err
+}
+
+// HasEventPermission checks whether someone can do something for an event, either through their
+// global role or through being staff for that event.
+func HasEventPermission(
+	ctx context.Context,
+	eventID primitive.ObjectID,
+	uid string,
+	role util.Role,
+	permission util.Permission,
+) (bool, error) {
+	if role.HasPermission(permission) {
+		return true, nil
+	}
+
+	staff, err := GetEventStaff(ctx, eventID, uid)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return staff.Role.HasPermission(permission), nil
+}
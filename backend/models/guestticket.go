@@ -0,0 +1,142 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GuestInfo is who a guest ticket is for. Guests aren't students, so they don't have an
+// account and their ticket is owned by the student sponsoring them.
+type GuestInfo struct {
+	Name         string `json:"name"         bson:"name"`
+	Email        string `json:"email"        bson:"email"`
+	Phone        string `json:"phone"        bson:"phone"`
+	AgeConfirmed bool   `json:"ageConfirmed" bson:"age_confirmed"` // Sponsor confirmed the guest meets the event's age requirement
+}
+
+// sponsoredGuestsFilter matches the guest tickets a ticket is sponsoring that can still be used.
+func sponsoredGuestsFilter(sponsorTicketID primitive.ObjectID) bson.M {
+	return bson.M{"sponsor_ticket": sponsorTicketID, "voided": bson.M{"$ne": true}}
+}
+
+// GetGuestTickets fetches every guest ticket sponsored by a ticket, including voided ones.
+func GetGuestTickets(ctx context.Context, sponsorTicketID primitive.ObjectID) ([]Ticket, error) {
+	return GetTickets(ctx, bson.M{"sponsor_ticket": sponsorTicketID})
+}
+
+// CreateGuestTicket issues a ticket for a guest of the student holding the sponsor ticket. The
+// guest ticket is owned by the sponsor and has the same tier and max scan count as their ticket,
+// and takes up a spot at the event like any other ticket.
+func CreateGuestTicket(ctx context.Context, sponsorTicketID primitive.ObjectID, guest GuestInfo) (Ticket, error) {
+	// Get sponsor's ticket if it exists
+	var sponsorTicket Ticket
+	err := lib.Datastore.Db.Collection(ticketsColName).
+		FindOne(ctx, bson.M{"_id": sponsorTicketID}).
+		Decode(&sponsorTicket)
+	if err == mongo.ErrNoDocuments {
+		return Ticket{}, ErrNotFound
+	} else if err != nil {
+		return Ticket{}, err
+	}
+
+	// Guests can't bring their own guests
+	if sponsorTicket.Guest != nil {
+		return Ticket{}, ErrGuestsNotAllowed
+	}
+	if sponsorTicket.Voided {
+		return Ticket{}, ErrTicketVoided
+	}
+
+	// Event decides how many guests each student can bring
+	event, err := GetEvent(ctx, bson.M{"_id": sponsorTicket.Event})
+	if err == mongo.ErrNoDocuments {
+		return Ticket{}, ErrNotFound
+	} else if err != nil {
+		return Ticket{}, err
+	}
+	if event.MaxGuestsPerStudent == 0 {
+		return Ticket{}, ErrGuestsNotAllowed
+	}
+	guestCount, err := lib.Datastore.Db.Collection(ticketsColName).CountDocuments(ctx, sponsoredGuestsFilter(sponsorTicket.ID))
+	if err != nil {
+		return Ticket{}, err
+	}
+	if guestCount >= int64(event.MaxGuestsPerStudent) {
+		return Ticket{}, ErrGuestLimitReached
+	}
+
+	ticket := Ticket{
+		Owner:           sponsorTicket.Owner,
+		Event:           sponsorTicket.Event,
+		Tier:            sponsorTicket.Tier,
+		MaxScanCount:    sponsorTicket.MaxScanCount,
+		Guest:           &guest,
+		SponsorTicketID: sponsorTicket.ID,
+		OwnerHistory:    []TicketOwnerChange{},
+	}
+	ticket.ID, err = createNewTicket(ctx, ticket, true)
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	return GetTicket(ctx, ticket.ID)
+}
+
+// voidGuestTickets voids every usable guest ticket sponsored by a ticket, giving back their spots.
+func voidGuestTickets(ctx context.Context, sponsorTicketID primitive.ObjectID, reason string, voidedBy string) error {
+	cursor, err := lib.Datastore.Db.Collection(ticketsColName).Find(ctx, sponsoredGuestsFilter(sponsorTicketID))
+	if err != nil {
+		return err
+	}
+	var guestTickets []Ticket
+	if err := cursor.All(ctx, &guestTickets); err != nil {
+		return err
+	}
+
+	// Voided one at a time so that each spot and seat is only given back once
+	for _, guestTicket := range guestTickets {
+		var previousTicket Ticket
+		err := lib.Datastore.Db.Collection(ticketsColName).FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": guestTicket.ID, "voided": bson.M{"$ne": true}},
+			bson.M{
+				"$set": bson.M{
+					"voided":              true,
+					"voidReason":          reason,
+					"voidedBy":            voidedBy,
+					"voidTime":            time.Now(),
+					"inside":              false,
+					"voided_with_sponsor": true,
+				},
+				"$unset": bson.M{"seat": ""},
+			},
+		).Decode(&previousTicket)
+		if err == mongo.ErrNoDocuments {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := releaseTicketSpace(ctx, previousTicket.Event, previousTicket.Tier); err != nil {
+			return err
+		}
+		if err := freeSeat(ctx, previousTicket.Event, previousTicket.Seat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveGuestTickets gives a sponsor's guest tickets to whoever their ticket was transferred to.
+func moveGuestTickets(ctx context.Context, sponsorTicketID primitive.ObjectID, newOwner string) error {
+	_, err := lib.Datastore.Db.Collection(ticketsColName).UpdateMany(
+		ctx,
+		bson.M{"sponsor_ticket": sponsorTicketID},
+		bson.M{"$set": bson.M{"owner": newOwner}},
+	)
+	return err
+}
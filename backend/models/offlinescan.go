@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OfflineScan is a scan made by a device while it had no connection.
+type OfflineScan struct {
+	TicketID    primitive.ObjectID `json:"ticketID"`
+	Timestamp   time.Time          `json:"timestamp"`
+	DeviceLabel string             `json:"deviceLabel"`
+}
+
+// OfflineScanConflict is an offline scan that was let in on the device, but that the
+// server couldn't accept (ex. the same ticket was let in by two devices).
+type OfflineScanConflict struct {
+	TicketID               primitive.ObjectID `json:"ticketID"`
+	Timestamp              time.Time          `json:"timestamp"`
+	DeviceLabel            string             `json:"deviceLabel"`
+	Reason                 string             `json:"reason"`
+	ConflictingDeviceLabel string             `json:"conflictingDeviceLabel,omitempty"`
+	ConflictingTimestamp   *time.Time         `json:"conflictingTimestamp,omitempty"`
+}
+
+type OfflineScanSyncResult struct {
+	Processed  int                   `json:"processed"`
+	Duplicates int                   `json:"duplicates"` // Scans that were already synced before
+	Conflicts  []OfflineScanConflict `json:"conflicts"`
+}
+
+func (result *OfflineScanSyncResult) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// SyncOfflineScans replays a batch of offline scans made at a station in the order they happened,
+// applying the same max scan count rules as regular scans. Scans that were already synced
+// are skipped, so devices can safely retry a sync that failed halfway through.
+func SyncOfflineScans(
+	ctx context.Context,
+	station ScanStation,
+	scannerUID string,
+	scans []OfflineScan,
+) (OfflineScanSyncResult, error) {
+	result := OfflineScanSyncResult{Conflicts: []OfflineScanConflict{}}
+	eventID := station.Event
+
+	// Need event to know when doors were open
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err != nil {
+		return OfflineScanSyncResult{}, err
+	}
+
+	// Get IDs of every ticket for the event to catch scans of other events' tickets
+	cursor, err := lib.Datastore.Db.Collection(ticketsColName).
+		Find(ctx, bson.M{"event": eventID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return OfflineScanSyncResult{}, err
+	}
+	var eventTickets []Ticket
+	if err := cursor.All(ctx, &eventTickets); err != nil {
+		return OfflineScanSyncResult{}, err
+	}
+	eventTicketIDs := map[primitive.ObjectID]bool{}
+	for _, ticket := range eventTickets {
+		eventTicketIDs[ticket.ID] = true
+	}
+
+	// Replay scans in the order they actually happened across all devices
+	sort.SliceStable(scans, func(i, j int) bool {
+		return scans[i].Timestamp.Before(scans[j].Timestamp)
+	})
+
+	for _, scan := range scans {
+		scanRecord := TicketScan{
+			TicketID:    scan.TicketID,
+			EventID:     eventID,
+			Timestamp:   scan.Timestamp,
+			ScannerUID:  scannerUID,
+			DeviceLabel: scan.DeviceLabel,
+			Offline:     true,
+			Direction:   station.Direction(),
+			StationID:   station.ID,
+		}
+
+		// Skip anything that was already synced in a previous attempt
+		alreadySynced, err := CheckIfTicketScanExists(ctx, bson.M{
+			"ticket":      scan.TicketID,
+			"timestamp":   scan.Timestamp,
+			"deviceLabel": scan.DeviceLabel,
+			"offline":     true,
+		})
+		if err != nil {
+			return result, err
+		}
+		if alreadySynced {
+			result.Duplicates++
+			continue
+		}
+
+		if !eventTicketIDs[scan.TicketID] {
+			result.Conflicts = append(result.Conflicts, OfflineScanConflict{
+				TicketID:    scan.TicketID,
+				Timestamp:   scan.Timestamp,
+				DeviceLabel: scan.DeviceLabel,
+				Reason:      TicketScanReasonNotForEvent,
+			})
+			continue
+		}
+
+		if !station.IsActive(scan.Timestamp) {
+			result.Conflicts = append(result.Conflicts, OfflineScanConflict{
+				TicketID:    scan.TicketID,
+				Timestamp:   scan.Timestamp,
+				DeviceLabel: scan.DeviceLabel,
+				Reason:      TicketScanReasonStationNotActive,
+			})
+			continue
+		}
+
+		if scanRecord.Direction != ScanDirectionExit {
+			if err := event.CheckScanTime(scan.Timestamp); err != nil {
+				reason, _ := GetTicketScanReasonForError(err)
+				result.Conflicts = append(result.Conflicts, OfflineScanConflict{
+					TicketID:    scan.TicketID,
+					Timestamp:   scan.Timestamp,
+					DeviceLabel: scan.DeviceLabel,
+					Reason:      reason,
+				})
+				continue
+			}
+		}
+
+		prevTicket, err := ScanTicket(ctx, scan.TicketID, scan.Timestamp, scanRecord.Direction)
+		if reason, rejected := GetTicketScanReasonForError(err); rejected {
+			// Find out who last let them through so the devices can be compared
+			conflict := OfflineScanConflict{
+				TicketID:    scan.TicketID,
+				Timestamp:   scan.Timestamp,
+				DeviceLabel: scan.DeviceLabel,
+				Reason:      reason,
+			}
+			latestScan, err := GetLatestProcessedTicketScan(ctx, scan.TicketID)
+			if err == nil {
+				conflict.ConflictingDeviceLabel = latestScan.DeviceLabel
+				conflict.ConflictingTimestamp = &latestScan.Timestamp
+			} else if err != mongo.ErrNoDocuments {
+				return result, err
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+
+			// Still keep rejected scan in history
+			currentTicket, err := GetTicket(ctx, scan.TicketID)
+			if err != nil {
+				return result, err
+			}
+			scanRecord.Index = currentTicket.ScanCount
+			scanRecord.NoProcessReason = reason
+		} else if err != nil {
+			return result, err
+		} else {
+			scanRecord.Index = prevTicket.ScanCount
+			if scanRecord.Direction != ScanDirectionExit {
+				scanRecord.Index++
+			}
+			scanRecord.Processed = true
+			result.Processed++
+		}
+
+		if _, err := CreateTicketScan(ctx, scanRecord); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
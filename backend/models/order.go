@@ -0,0 +1,557 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Order is a student buying a ticket for themselves. Pending orders hold a spot at the
+// event until they're paid for or they expire.
+type Order struct {
+	ID                primitive.ObjectID     `json:"id"                bson:"_id,omitempty"`
+	EventID           primitive.ObjectID     `json:"eventID"           bson:"event"`
+	TierID            primitive.ObjectID     `json:"tierID"            bson:"tier"`
+	UserID            string                 `json:"userID"            bson:"user"`
+	Amount            int64                  `json:"amount"            bson:"amount"`               // In cents, after any discount
+	Discount          int64                  `json:"discount"          bson:"discount"`             // In cents
+	PromoCodeID       primitive.ObjectID     `json:"promoCodeID"       bson:"promo_code,omitempty"` // Set if a promo code was used
+	Currency          string                 `json:"currency"          bson:"currency"`
+	CustomFields      map[string]interface{} `json:"customFields"      bson:"customFields"` // Copied onto the ticket once paid
+	Status            string                 `json:"status"            bson:"status"`
+	FailureReason     string                 `json:"failureReason"     bson:"failure_reason,omitempty"`
+	Provider          string                 `json:"provider"          bson:"provider"`
+	CheckoutSessionID string                 `json:"checkoutSessionID" bson:"checkout_session"`
+	CheckoutURL       string                 `json:"checkoutURL"       bson:"checkout_url"`
+	PaymentID         string                 `json:"paymentID"         bson:"payment,omitempty"` // Provider's ID for the payment once it settles
+	TicketID          primitive.ObjectID     `json:"ticketID"          bson:"ticket,omitempty"`  // Set once the ticket is issued
+	CreatedTimestamp  time.Time              `json:"createdTime"       bson:"created_time"`
+	ExpiresTimestamp  time.Time              `json:"expiresTime"       bson:"expires_time"` // Spot is given up if not paid by then
+	PaidTimestamp     time.Time              `json:"paidTime"          bson:"paid_time"`
+}
+
+// Statuses an order can have
+const (
+	OrderStatusPending   = "pending" // Waiting for payment, holding a spot
+	OrderStatusPaid      = "paid"
+	OrderStatusExpired   = "expired"   // Not paid in time
+	OrderStatusCancelled = "cancelled" // Student gave up before paying
+	OrderStatusFailed    = "failed"    // Payment failed, or ticket couldn't be issued after paying
+	OrderStatusRefunded  = "refunded"  // All of the payment was given back
+)
+
+func (order *Order) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// heldOrdersFilter matches the orders that are still holding a spot at an event.
+func heldOrdersFilter(eventID primitive.ObjectID) bson.M {
+	return bson.M{
+		"event":        eventID,
+		"status":       OrderStatusPending,
+		"expires_time": bson.M{"$gt": time.Now()},
+	}
+}
+
+func CreateOrderIndices(ctx context.Context) error {
+	// Create appropriate indices
+	eventStatusIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+			{Key: "status", Value: 1},
+		},
+	}
+	userIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user", Value: 1},
+		},
+	}
+	checkoutSessionIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "checkout_session", Value: 1},
+		},
+	}
+	statusExpiresIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "status", Value: 1},
+			{Key: "expires_time", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(ordersColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				eventStatusIdxModel,
+				userIdxModel,
+				checkoutSessionIdxModel,
+				statusExpiresIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetOrders(ctx context.Context, filter bson.M) ([]Order, error) {
+	// Newest first
+	opts := options.Find().SetSort(bson.D{{Key: "created_time", Value: -1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(ordersColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []Order{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into Order structs
+	var orders []Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return []Order{}, err
+	}
+
+	return orders, nil
+}
+
+func GetOrder(ctx context.Context, filter bson.M) (Order, error) {
+	// Try to fetch data from DB
+	var order Order
+	err := lib.Datastore.Db.Collection(ordersColName).
+		FindOne(ctx, filter).
+		Decode(&order)
+
+	// No error handling needed (order & err will default to empty struct / nil)
+	return order, err
+}
+
+// CreateOrder checks that a student can buy a ticket in a tier and saves a pending order
+// that holds their spot. If a promo code is given, a use of it is held along with the spot.
+// The checkout session is attached afterwards with SetOrderCheckout.
+func CreateOrder(ctx context.Context, order Order, promoCode string, holdFor time.Duration) (Order, error) {
+	// Get event if it exists
+	event, err := GetEvent(ctx, bson.M{"_id": order.EventID})
+	if err == mongo.ErrNoDocuments {
+		return Order{}, ErrNotFound
+	} else if err != nil {
+		return Order{}, err
+	}
+
+	// Students can only buy tiers they're able to see, while they're on sale
+	tier, ok := event.GetTicketTier(order.TierID)
+	if !ok || tier.Hidden {
+		return Order{}, ErrTierNotFound
+	}
+	now := time.Now()
+	if !tier.IsOnSale(now) {
+		return Order{}, ErrTierNotOnSale
+	}
+
+	// Can't buy a second ticket or have two checkouts going at once
+	if _, err := SearchForTicket(ctx, order.EventID, order.UserID); err == nil {
+		return Order{}, ErrAlreadyExists
+	} else if err != mongo.ErrNoDocuments {
+		return Order{}, err
+	}
+	heldFilter := heldOrdersFilter(order.EventID)
+	heldFilter["user"] = order.UserID
+	alreadyHeld, err := lib.Datastore.Db.Collection(ordersColName).CountDocuments(ctx, heldFilter)
+	if err != nil {
+		return Order{}, err
+	}
+	if alreadyHeld > 0 {
+		return Order{}, ErrAlreadyExists
+	}
+
+	// Custom fields are checked now so that the ticket can't fail to be made after paying
+	if order.CustomFields == nil {
+		order.CustomFields = map[string]interface{}{}
+	}
+	valid, _, err := ValidateCustomEventFields(ctx, event, order.CustomFields)
+	if err != nil {
+		return Order{}, err
+	}
+	if !valid {
+		return Order{}, ErrInvalidCustomFields
+	}
+
+	order.Amount = tier.Price
+	order.Status = OrderStatusPending
+	order.CreatedTimestamp = now
+	order.ExpiresTimestamp = now.Add(holdFor)
+
+	// Find the promo code before taking a spot so that a bad code doesn't have to give it back
+	var code PromoCode
+	if promoCode != "" {
+		code, err = findUsablePromoCode(ctx, order.EventID, order.TierID, promoCode)
+		if err != nil {
+			return Order{}, err
+		}
+		order.Discount = code.Discount(tier.Price)
+		order.Amount = tier.Price - order.Discount
+		order.PromoCodeID = code.ID
+	}
+
+	// Hold a spot at the event and in the tier
+	if err := reserveTicketSpace(ctx, order.EventID, order.TierID); err != nil {
+		return Order{}, err
+	}
+
+	// Hold a use of the promo code last so that it isn't used up by orders that can't go through
+	var redemption PromoRedemption
+	if !order.PromoCodeID.IsZero() {
+		redemption, err = holdPromoCode(ctx, code, order, order.Discount)
+		if err != nil {
+			releaseTicketSpace(ctx, order.EventID, order.TierID)
+			return Order{}, err
+		}
+	}
+
+	// Try to add document
+	res, err := lib.Datastore.Db.Collection(ordersColName).InsertOne(ctx, order)
+	if err != nil {
+		releaseTicketSpace(ctx, order.EventID, order.TierID)
+		if !order.PromoCodeID.IsZero() {
+			releasePromoCodeUse(ctx, order.PromoCodeID, order.UserID)
+		}
+		return Order{}, err
+	}
+	order.ID = res.InsertedID.(primitive.ObjectID)
+
+	if !order.PromoCodeID.IsZero() {
+		redemption.OrderID = order.ID
+		if err := createPromoRedemption(ctx, redemption); err != nil {
+			// Without a redemption the promo code use could never be given back, so undo the whole order
+			lib.Datastore.Db.Collection(ordersColName).DeleteOne(ctx, bson.M{"_id": order.ID})
+			releaseTicketSpace(ctx, order.EventID, order.TierID)
+			releasePromoCodeUse(ctx, order.PromoCodeID, order.UserID)
+			return Order{}, err
+		}
+	}
+
+	return order, nil
+}
+
+// createWaitlistOrder saves a pending order holding the spot someone was given from the waitlist
+// in a priced tier, and starts its checkout. Unlike CreateOrder, the tier doesn't have to be on
+// sale or visible, since the spot was theirs once it freed up. Their custom fields should already
+// have been checked.
+func createWaitlistOrder(ctx context.Context, tier TicketTier, entry WaitlistEntry) (Order, error) {
+	// Can't have a second ticket or two checkouts going at once
+	if _, err := SearchForTicket(ctx, entry.EventID, entry.UserID); err == nil {
+		return Order{}, ErrAlreadyExists
+	} else if err != mongo.ErrNoDocuments {
+		return Order{}, err
+	}
+	heldFilter := heldOrdersFilter(entry.EventID)
+	heldFilter["user"] = entry.UserID
+	alreadyHeld, err := lib.Datastore.Db.Collection(ordersColName).CountDocuments(ctx, heldFilter)
+	if err != nil {
+		return Order{}, err
+	}
+	if alreadyHeld > 0 {
+		return Order{}, ErrAlreadyExists
+	}
+	userExists, err := CheckIfUserExists(ctx, entry.UserID)
+	if err != nil {
+		return Order{}, err
+	}
+	if !userExists {
+		return Order{}, ErrNotFound
+	}
+
+	now := time.Now()
+	order := Order{
+		EventID:          entry.EventID,
+		TierID:           tier.ID,
+		UserID:           entry.UserID,
+		Amount:           tier.Price,
+		Currency:         lib.GetPaymentCurrency(),
+		CustomFields:     entry.CustomFields,
+		Status:           OrderStatusPending,
+		CreatedTimestamp: now,
+		ExpiresTimestamp: now.Add(lib.GetWaitlistCheckoutDuration()),
+	}
+
+	// Hold a spot at the event and in the tier
+	if err := reserveTicketSpace(ctx, order.EventID, order.TierID); err != nil {
+		return Order{}, err
+	}
+
+	// Try to add document
+	res, err := lib.Datastore.Db.Collection(ordersColName).InsertOne(ctx, order)
+	if err != nil {
+		releaseTicketSpace(ctx, order.EventID, order.TierID)
+		return Order{}, err
+	}
+	order.ID = res.InsertedID.(primitive.ObjectID)
+
+	// Start taking payment
+	session, err := lib.Payments.CreateCheckout(ctx, lib.CheckoutRequest{
+		OrderID:     order.ID.Hex(),
+		Amount:      order.Amount,
+		Currency:    order.Currency,
+		Description: "FraserTickets order " + order.ID.Hex(),
+		ExpiresAt:   order.ExpiresTimestamp,
+	})
+	if err == nil {
+		err = SetOrderCheckout(ctx, &order, lib.Payments.Name(), session)
+	}
+	if err != nil {
+		// Don't hold a spot for an order that can't be paid
+		UpdateOrderStatus(ctx, order.ID, []string{OrderStatusPending}, OrderStatusFailed, "could not start checkout")
+		return Order{}, err
+	}
+
+	return order, nil
+}
+
+// SetOrderCheckout saves the payment provider's checkout session for an order.
+func SetOrderCheckout(ctx context.Context, order *Order, provider string, session lib.CheckoutSession) error {
+	order.Provider = provider
+	order.CheckoutSessionID = session.ID
+	order.CheckoutURL = session.URL
+
+	_, err := lib.Datastore.Db.Collection(ordersColName).UpdateByID(ctx, order.ID, bson.M{"$set": bson.M{
+		"provider":         order.Provider,
+		"checkout_session": order.CheckoutSessionID,
+		"checkout_url":     order.CheckoutURL,
+	}})
+	return err
+}
+
+// UpdateOrderStatus moves an order to a new status, but only if it's currently in one of
+// the given statuses. Orders that didn't go through give back any promo code use they held,
+// and the spot they were holding if they hadn't been paid for yet.
+func UpdateOrderStatus(ctx context.Context, id primitive.ObjectID, fromStatuses []string, toStatus string, failureReason string) error {
+	updates := bson.M{"status": toStatus}
+	if failureReason != "" {
+		updates["failure_reason"] = failureReason
+	}
+
+	var previousOrder Order
+	err := lib.Datastore.Db.Collection(ordersColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": fromStatuses}},
+		bson.M{"$set": updates},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&previousOrder)
+	if err == mongo.ErrNoDocuments {
+		return ErrNoDocumentModified
+	} else if err != nil {
+		return err
+	}
+
+	if toStatus == OrderStatusExpired || toStatus == OrderStatusCancelled || toStatus == OrderStatusFailed {
+		if previousOrder.Status == OrderStatusPending {
+			if err := releaseTicketSpace(ctx, previousOrder.EventID, previousOrder.TierID); err != nil {
+				return err
+			}
+		}
+		return releasePromoCodeForOrder(ctx, id)
+	}
+	return nil
+}
+
+// FulfillOrder marks an order as paid and issues its ticket. Orders that expired before the
+// payment settled lost their held spot, so they only get a ticket if there's still space.
+// If the ticket can't be issued, the order is marked as failed with the reason, and the
+// error is returned. Orders that were already paid return ErrNoDocumentModified so that
+// webhooks sent more than once don't do anything. Any money received is recorded as a
+// payment whether or not the ticket could be issued, so that it can be refunded.
+func FulfillOrder(ctx context.Context, orderID primitive.ObjectID, paymentID string, paidAmount int64) (Order, Ticket, error) {
+	// Claim order so that it can't be fulfilled twice
+	var order Order
+	err := lib.Datastore.Db.Collection(ordersColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": orderID, "status": bson.M{"$in": bson.A{OrderStatusPending, OrderStatusExpired}}},
+		bson.M{"$set": bson.M{"status": OrderStatusPaid, "payment": paymentID, "paid_time": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return Order{}, Ticket{}, ErrNoDocumentModified
+	} else if err != nil {
+		return Order{}, Ticket{}, err
+	}
+	heldSpot := order.Status == OrderStatusPending
+	order.Status = OrderStatusPaid
+	order.PaymentID = paymentID
+
+	// Record money in ledger before anything else can go wrong
+	var payment Payment
+	if paidAmount > 0 {
+		payment = Payment{
+			OrderID:           order.ID,
+			EventID:           order.EventID,
+			TierID:            order.TierID,
+			UserID:            order.UserID,
+			Amount:            paidAmount,
+			Currency:          order.Currency,
+			Provider:          order.Provider,
+			ProviderPaymentID: paymentID,
+		}
+		payment.ID, err = CreatePayment(ctx, payment)
+		if err != nil {
+			return order, Ticket{}, err
+		}
+	}
+
+	ticket := Ticket{
+		Owner:        order.UserID,
+		Event:        order.EventID,
+		Tier:         order.TierID,
+		OrderID:      order.ID,
+		CustomFields: order.CustomFields,
+	}
+
+	// Max scan count comes from the tier
+	event, err := GetEvent(ctx, bson.M{"_id": order.EventID})
+	if err == nil {
+		tier, ok := event.GetTicketTier(order.TierID)
+		if !ok {
+			err = ErrTierNotFound
+		} else {
+			ticket.MaxScanCount = tier.MaxScanCount
+			ticket.ID, err = createNewTicket(ctx, ticket, !heldSpot)
+		}
+	}
+
+	if err != nil {
+		switch err {
+		case ErrAlreadyExists:
+			order.FailureReason = "already had a ticket for this event when payment settled"
+		case ErrEventFull, ErrTierFull:
+			order.FailureReason = "event filled up before payment settled"
+		case mongo.ErrNoDocuments, ErrNotFound, ErrTierNotFound:
+			order.FailureReason = "event, tier, or user no longer exists"
+		default:
+			order.FailureReason = "could not issue ticket"
+		}
+		order.Status = OrderStatusFailed
+		UpdateOrderStatus(ctx, order.ID, []string{OrderStatusPaid}, order.Status, order.FailureReason)
+		if heldSpot {
+			// Order was already paid when it was marked as failed, so its spot has to be given back here
+			releaseTicketSpace(ctx, order.EventID, order.TierID)
+		}
+		return order, Ticket{}, err
+	}
+
+	order.TicketID = ticket.ID
+	_, err = lib.Datastore.Db.Collection(ordersColName).UpdateByID(ctx, order.ID, bson.M{"$set": bson.M{"ticket": ticket.ID}})
+	if err != nil {
+		return order, ticket, err
+	}
+	if err := redeemPromoCodeForOrder(ctx, order); err != nil {
+		return order, ticket, err
+	}
+	if !payment.ID.IsZero() {
+		_, err = lib.Datastore.Db.Collection(paymentsColName).UpdateByID(ctx, payment.ID, bson.M{"$set": bson.M{"ticket": ticket.ID}})
+	}
+	return order, ticket, err
+}
+
+// RejectOrderPayment marks an order as failed instead of issuing its ticket, ex. when the amount
+// paid doesn't match the order, then records the payment and refunds all of it. Any spot or promo
+// code use the order was holding is given back. Orders that were already paid or rejected return
+// ErrNoDocumentModified so that webhooks sent more than once don't do anything. If the provider
+// won't refund, a failed refund is recorded and its error is returned, and an admin has to refund
+// the order by hand.
+func RejectOrderPayment(ctx context.Context, orderID primitive.ObjectID, paymentID string, paidAmount int64, reason string) (Order, Refund, error) {
+	// Claim order so that it can't be fulfilled while it's being rejected
+	var order Order
+	err := lib.Datastore.Db.Collection(ordersColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": orderID, "status": bson.M{"$in": bson.A{OrderStatusPending, OrderStatusExpired}}},
+		bson.M{"$set": bson.M{
+			"status":         OrderStatusFailed,
+			"failure_reason": reason,
+			"payment":        paymentID,
+			"paid_time":      time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return Order{}, Refund{}, ErrNoDocumentModified
+	} else if err != nil {
+		return Order{}, Refund{}, err
+	}
+	heldSpot := order.Status == OrderStatusPending
+	order.Status = OrderStatusFailed
+	order.FailureReason = reason
+	order.PaymentID = paymentID
+
+	if heldSpot {
+		if err := releaseTicketSpace(ctx, order.EventID, order.TierID); err != nil {
+			return order, Refund{}, err
+		}
+	}
+	if err := releasePromoCodeForOrder(ctx, order.ID); err != nil {
+		return order, Refund{}, err
+	}
+
+	if paidAmount <= 0 {
+		return order, Refund{}, nil
+	}
+
+	// Record money in ledger so that it can be refunded
+	payment := Payment{
+		OrderID:           order.ID,
+		EventID:           order.EventID,
+		TierID:            order.TierID,
+		UserID:            order.UserID,
+		Amount:            paidAmount,
+		Currency:          order.Currency,
+		Provider:          order.Provider,
+		ProviderPaymentID: paymentID,
+	}
+	payment.ID, err = CreatePayment(ctx, payment)
+	if err != nil {
+		return order, Refund{}, err
+	}
+
+	refund, err := RefundPayment(ctx, payment, paidAmount, reason, "")
+	if err == nil {
+		order.Status = OrderStatusRefunded
+	}
+	return order, refund, err
+}
+
+// ExpireStaleOrders marks pending orders that weren't paid in time as expired, giving back
+// the spots they were holding, and returns the orders that were expired.
+func ExpireStaleOrders(ctx context.Context) ([]Order, error) {
+	staleFilter := bson.M{"status": OrderStatusPending, "expires_time": bson.M{"$lte": time.Now()}}
+	stale, err := GetOrders(ctx, staleFilter)
+	if err != nil {
+		return []Order{}, err
+	}
+
+	expired := []Order{}
+	for _, order := range stale {
+		// Order might have been paid in the meantime
+		err := UpdateOrderStatus(ctx, order.ID, []string{OrderStatusPending}, OrderStatusExpired, "")
+		if err == ErrNoDocumentModified {
+			continue
+		} else if err != nil {
+			return expired, err
+		}
+
+		order.Status = OrderStatusExpired
+		expired = append(expired, order)
+	}
+
+	return expired, nil
+}
+
+func DeleteAllOrdersForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all orders for event
+	_, err := lib.Datastore.Db.Collection(ordersColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
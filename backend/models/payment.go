@@ -0,0 +1,233 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Payment is money received for an order. Payments are never changed apart from keeping
+// track of how much of them has been refunded, so that they work as a ledger.
+type Payment struct {
+	ID                primitive.ObjectID `json:"id"                bson:"_id,omitempty"`
+	OrderID           primitive.ObjectID `json:"orderID"           bson:"order"`
+	EventID           primitive.ObjectID `json:"eventID"           bson:"event"`
+	TierID            primitive.ObjectID `json:"tierID"            bson:"tier"`
+	UserID            string             `json:"userID"            bson:"user"`
+	TicketID          primitive.ObjectID `json:"ticketID"          bson:"ticket,omitempty"` // Empty if the ticket couldn't be issued
+	Amount            int64              `json:"amount"            bson:"amount"`           // In cents
+	RefundedAmount    int64              `json:"refundedAmount"    bson:"refunded_amount"`  // In cents
+	Currency          string             `json:"currency"          bson:"currency"`
+	Provider          string             `json:"provider"          bson:"provider"`
+	ProviderPaymentID string             `json:"providerPaymentID" bson:"provider_payment"`
+	Timestamp         time.Time          `json:"timestamp"         bson:"timestamp"`
+}
+
+func (payment *Payment) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// RefundableAmount is how much of the payment hasn't been refunded yet.
+func (payment Payment) RefundableAmount() int64 {
+	return payment.Amount - payment.RefundedAmount
+}
+
+func CreatePaymentIndices(ctx context.Context) error {
+	// Create appropriate indices
+	orderIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "order", Value: 1},
+		},
+	}
+	eventIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(paymentsColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				orderIdxModel,
+				eventIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetPayments(ctx context.Context, filter bson.M) ([]Payment, error) {
+	// Oldest first, like a ledger
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(paymentsColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []Payment{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into Payment structs
+	var payments []Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return []Payment{}, err
+	}
+
+	return payments, nil
+}
+
+func GetPayment(ctx context.Context, filter bson.M) (Payment, error) {
+	// Try to fetch data from DB
+	var payment Payment
+	err := lib.Datastore.Db.Collection(paymentsColName).
+		FindOne(ctx, filter).
+		Decode(&payment)
+
+	// No error handling needed (payment & err will default to empty struct / nil)
+	return payment, err
+}
+
+func CreatePayment(ctx context.Context, payment Payment) (primitive.ObjectID, error) {
+	payment.Timestamp = time.Now()
+
+	// Try to add document
+	res, err := lib.Datastore.Db.Collection(paymentsColName).InsertOne(ctx, payment)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Return object ID
+	return res.InsertedID.(primitive.ObjectID), err
+}
+
+// reservePaymentRefund counts an amount as refunded on a payment, as long as that doesn't go
+// over what was paid. Done in one operation so that two refunds can't both take the same money.
+func reservePaymentRefund(ctx context.Context, paymentID primitive.ObjectID, amount int64) error {
+	res, err := lib.Datastore.Db.Collection(paymentsColName).UpdateOne(
+		ctx,
+		bson.M{
+			"_id":   paymentID,
+			"$expr": bson.M{"$lte": bson.A{bson.M{"$add": bson.A{"$refunded_amount", amount}}, "$amount"}},
+		},
+		bson.M{"$inc": bson.M{"refunded_amount": amount}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrRefundTooLarge
+	}
+	return nil
+}
+
+// TierFinancialSummary is the money taken in for one ticket tier. Payments without a tier
+// have an empty tier ID.
+type TierFinancialSummary struct {
+	TierID   primitive.ObjectID `json:"tierID"   bson:"_id"`
+	Name     string             `json:"name"     bson:"name"`
+	Payments int64              `json:"payments" bson:"payments"` // Number of payments
+	Gross    int64              `json:"gross"    bson:"gross"`    // In cents
+	Refunded int64              `json:"refunded" bson:"refunded"` // In cents
+	Net      int64              `json:"net"      bson:"net"`      // In cents
+}
+
+// EventFinancialSummary is the money taken in for an event, broken down by tier.
+type EventFinancialSummary struct {
+	EventID  primitive.ObjectID     `json:"eventID"`
+	Gross    int64                  `json:"gross"`    // In cents
+	Refunded int64                  `json:"refunded"` // In cents
+	Net      int64                  `json:"net"`      // In cents
+	Tiers    []TierFinancialSummary `json:"tiers"`
+}
+
+func (summary *EventFinancialSummary) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// GetEventFinancialSummary adds up the payments and successful refunds for an event.
+func GetEventFinancialSummary(ctx context.Context, event Event) (EventFinancialSummary, error) {
+	sumByTier := func(colName string, filter bson.M) (map[primitive.ObjectID][2]int64, error) {
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$tier"},
+				{Key: "count", Value: bson.M{"$sum": 1}},
+				{Key: "total", Value: bson.M{"$sum": "$amount"}},
+			}}},
+		}
+
+		cursor, err := lib.Datastore.Db.Collection(colName).Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var results []struct {
+			TierID primitive.ObjectID `bson:"_id"`
+			Count  int64              `bson:"count"`
+			Total  int64              `bson:"total"`
+		}
+		if err := cursor.All(ctx, &results); err != nil {
+			return nil, err
+		}
+
+		sums := map[primitive.ObjectID][2]int64{}
+		for _, result := range results {
+			sums[result.TierID] = [2]int64{result.Count, result.Total}
+		}
+		return sums, nil
+	}
+
+	paid, err := sumByTier(paymentsColName, bson.M{"event": event.ID})
+	if err != nil {
+		return EventFinancialSummary{}, err
+	}
+	refunded, err := sumByTier(refundsColName, bson.M{"event": event.ID, "status": RefundStatusSucceeded})
+	if err != nil {
+		return EventFinancialSummary{}, err
+	}
+
+	summary := EventFinancialSummary{EventID: event.ID, Tiers: []TierFinancialSummary{}}
+	addTier := func(tierID primitive.ObjectID, name string) {
+		tierSummary := TierFinancialSummary{
+			TierID:   tierID,
+			Name:     name,
+			Payments: paid[tierID][0],
+			Gross:    paid[tierID][1],
+			Refunded: refunded[tierID][1],
+		}
+		tierSummary.Net = tierSummary.Gross - tierSummary.Refunded
+
+		summary.Gross += tierSummary.Gross
+		summary.Refunded += tierSummary.Refunded
+		summary.Tiers = append(summary.Tiers, tierSummary)
+		delete(paid, tierID)
+		delete(refunded, tierID)
+	}
+
+	for _, tier := range event.TicketTiers {
+		addTier(tier.ID, tier.Name)
+	}
+
+	// Tiers that have been deleted since
+	for tierID := range paid {
+		addTier(tierID, "")
+	}
+	for tierID := range refunded {
+		addTier(tierID, "")
+	}
+
+	summary.Net = summary.Gross - summary.Refunded
+	return summary, nil
+}
@@ -0,0 +1,347 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PromoCode gives a discount on tickets for an event, ex. for volunteers or club execs.
+type PromoCode struct {
+	ID                primitive.ObjectID   `json:"id"                 bson:"_id,omitempty"`
+	Code              string               `json:"code"               bson:"code"` // Always uppercase, unique within the event
+	EventID           primitive.ObjectID   `json:"eventID"            bson:"event"`
+	Type              string               `json:"type"               bson:"type"`
+	Value             int64                `json:"value"              bson:"value"`                // Percent off for percentage codes, cents off for fixed codes, unused for free codes
+	TierIDs           []primitive.ObjectID `json:"tierIDs"            bson:"tiers"`                // Empty means any tier
+	MaxUses           int                  `json:"maxUses"            bson:"max_uses"`             // 0 means unlimited
+	MaxUsesPerStudent int                  `json:"maxUsesPerStudent"  bson:"max_uses_per_student"` // 0 means unlimited
+	Uses              int                  `json:"uses"               bson:"uses"`                 // Includes unpaid orders that are holding a use
+	UsesByStudent     map[string]int       `json:"usesByStudent"      bson:"uses_by_student"`      // Keyed by UID
+	ExpiresTimestamp  time.Time            `json:"expiresTime"        bson:"expires_time"`         // Zero means it never expires
+	Disabled          bool                 `json:"disabled"           bson:"disabled"`
+	CreatedBy         string               `json:"createdBy"          bson:"created_by"`
+	CreatedTimestamp  time.Time            `json:"createdTime"        bson:"created_time"`
+}
+
+// Types of discounts a promo code can give
+const (
+	PromoCodeTypePercentage = "percentage"
+	PromoCodeTypeFixed      = "fixed"
+	PromoCodeTypeFree       = "free"
+)
+
+func (promoCode *PromoCode) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// NormalizePromoCode makes codes case-insensitive and ignores stray whitespace.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// AppliesToTier checks whether the code can be used on tickets in a tier.
+func (promoCode PromoCode) AppliesToTier(tierID primitive.ObjectID) bool {
+	if len(promoCode.TierIDs) == 0 {
+		return true
+	}
+	for _, allowedTierID := range promoCode.TierIDs {
+		if allowedTierID == tierID {
+			return true
+		}
+	}
+	return false
+}
+
+// Discount works out how much the code takes off of a price, never going below free.
+func (promoCode PromoCode) Discount(price int64) int64 {
+	var discount int64
+	switch promoCode.Type {
+	case PromoCodeTypeFree:
+		discount = price
+	case PromoCodeTypePercentage:
+		discount = price * promoCode.Value / 100
+	case PromoCodeTypeFixed:
+		discount = promoCode.Value
+	}
+
+	if discount > price {
+		return price
+	}
+	return discount
+}
+
+// validatePromoCodeValue makes sure the value makes sense for the type of code.
+func validatePromoCodeValue(codeType string, value int64) error {
+	switch codeType {
+	case PromoCodeTypePercentage:
+		if value < 1 || value > 100 {
+			return ErrInvalidPromoCodeValue
+		}
+	case PromoCodeTypeFixed:
+		if value < 1 {
+			return ErrInvalidPromoCodeValue
+		}
+	case PromoCodeTypeFree:
+		if value != 0 {
+			return ErrInvalidPromoCodeValue
+		}
+	default:
+		return ErrInvalidPromoCodeType
+	}
+	return nil
+}
+
+func CreatePromoCodeIndices(ctx context.Context) error {
+	// Create appropriate indices
+	eventCodeIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+			{Key: "code", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(promoCodesColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				eventCodeIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetPromoCodes(ctx context.Context, filter bson.M) ([]PromoCode, error) {
+	// Newest first
+	opts := options.Find().SetSort(bson.D{{Key: "created_time", Value: -1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(promoCodesColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []PromoCode{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into PromoCode structs
+	var promoCodes []PromoCode
+	if err := cursor.All(ctx, &promoCodes); err != nil {
+		return []PromoCode{}, err
+	}
+
+	return promoCodes, nil
+}
+
+func GetPromoCode(ctx context.Context, filter bson.M) (PromoCode, error) {
+	// Try to fetch data from DB
+	var promoCode PromoCode
+	err := lib.Datastore.Db.Collection(promoCodesColName).
+		FindOne(ctx, filter).
+		Decode(&promoCode)
+
+	// No error handling needed (promo code & err will default to empty struct / nil)
+	return promoCode, err
+}
+
+func CreatePromoCode(ctx context.Context, promoCode PromoCode) (primitive.ObjectID, error) {
+	promoCode.Code = NormalizePromoCode(promoCode.Code)
+	promoCode.Uses = 0
+	promoCode.UsesByStudent = map[string]int{}
+	promoCode.CreatedTimestamp = time.Now()
+	if promoCode.TierIDs == nil {
+		promoCode.TierIDs = []primitive.ObjectID{}
+	}
+
+	if err := validatePromoCodeValue(promoCode.Type, promoCode.Value); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Check if event exists, and that any tiers given belong to it
+	event, err := GetEvent(ctx, bson.M{"_id": promoCode.EventID})
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrNotFound
+	} else if err != nil {
+		return primitive.NilObjectID, err
+	}
+	for _, tierID := range promoCode.TierIDs {
+		if _, ok := event.GetTicketTier(tierID); !ok {
+			return primitive.NilObjectID, ErrTierNotFound
+		}
+	}
+
+	// Try to add document, unique index stops duplicate codes
+	res, err := lib.Datastore.Db.Collection(promoCodesColName).InsertOne(ctx, promoCode)
+	if mongo.IsDuplicateKeyError(err) {
+		return primitive.NilObjectID, ErrAlreadyExists
+	} else if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Return object ID
+	return res.InsertedID.(primitive.ObjectID), err
+}
+
+func UpdateExistingPromoCode(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	UPDATABLE_KEYS := map[string]bool{
+		"max_uses":             true,
+		"max_uses_per_student": true,
+		"expires_time":         true,
+		"disabled":             true,
+		"code":                 false, // Students might already have been given the old code
+		"type":                 false, // Would change the discount on unpaid orders
+		"value":                false,
+		"tiers":                false,
+		"uses":                 false, // Only changed by redemptions
+		"uses_by_student":      false,
+	}
+
+	// Convert the string/interface map to BSON updates
+	bsonUpdates := bson.D{}
+	for key, val := range updates {
+		// Don't allow other keys to be updated
+		if !UPDATABLE_KEYS[key] {
+			return ErrEditNotAllowed
+		}
+
+		if key == "expires_time" {
+			// Convert timestamp to time.Time object, empty string means it never expires
+			timestampStr, ok := val.(string)
+			if !ok {
+				log.Warn().Any("val", val).Str("key", key).Msg("could not parse timestamp as string")
+				return fmt.Errorf("could not parse timestamp as string")
+			}
+			timestamp := time.Time{}
+			if timestampStr != "" {
+				var err error
+				timestamp, err = time.Parse(time.RFC3339, timestampStr)
+				if err != nil {
+					log.Warn().Err(err).Str("key", key).Msg("could not parse timestamp as RFC3339")
+					return errors.Join(fmt.Errorf("could not parse timestamp as RFC3339"), err)
+				}
+			}
+			val = timestamp
+		} else if key == "max_uses" || key == "max_uses_per_student" {
+			// JSON numbers come in as floats, but limits are whole numbers
+			limit, ok := val.(float64)
+			if !ok || limit < 0 || limit != float64(int(limit)) {
+				log.Warn().Any("val", val).Str("key", key).Msg("usage limit is not a non-negative whole number")
+				return fmt.Errorf("usage limit must be a non-negative whole number")
+			}
+			val = int(limit)
+		}
+
+		bsonUpdates = append(bsonUpdates, bson.E{Key: key, Value: val})
+	}
+
+	// Try to update document in DB
+	res, err := lib.Datastore.Db.Collection(promoCodesColName).
+		UpdateByID(ctx, id, bson.D{{Key: "$set", Value: bsonUpdates}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	if res.ModifiedCount == 0 {
+		return ErrNoDocumentModified
+	}
+	return nil
+}
+
+// DeletePromoCode deletes a promo code that has never been used. Used codes should be
+// disabled instead so that their redemptions still make sense.
+func DeletePromoCode(ctx context.Context, id primitive.ObjectID) error {
+	redeemed, err := lib.Datastore.Db.Collection(promoRedemptionsColName).CountDocuments(ctx, bson.M{"promo_code": id})
+	if err != nil {
+		return err
+	}
+	if redeemed > 0 {
+		return ErrPromoCodeInUse
+	}
+
+	res, err := lib.Datastore.Db.Collection(promoCodesColName).DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// findUsablePromoCode looks up a code for an event and checks that it can be used on a tier.
+func findUsablePromoCode(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID, code string) (PromoCode, error) {
+	promoCode, err := GetPromoCode(ctx, bson.M{"event": eventID, "code": NormalizePromoCode(code)})
+	if err == mongo.ErrNoDocuments {
+		return PromoCode{}, ErrPromoCodeNotUsable
+	} else if err != nil {
+		return PromoCode{}, err
+	}
+
+	if promoCode.Disabled || !promoCode.AppliesToTier(tierID) {
+		return PromoCode{}, ErrPromoCodeNotUsable
+	}
+	if !promoCode.ExpiresTimestamp.IsZero() && time.Now().After(promoCode.ExpiresTimestamp) {
+		return PromoCode{}, ErrPromoCodeNotUsable
+	}
+
+	return promoCode, nil
+}
+
+// reservePromoCodeUse counts a use of a code for a student, as long as that doesn't go over
+// the code's usage limits. The limits are part of the update's filter so that codes can't be
+// used more than allowed, no matter how many students redeem them at once.
+func reservePromoCodeUse(ctx context.Context, promoCode PromoCode, uid string) error {
+	filter := bson.M{"_id": promoCode.ID, "disabled": bson.M{"$ne": true}}
+	if promoCode.MaxUses > 0 {
+		filter["uses"] = bson.M{"$lt": promoCode.MaxUses}
+	}
+	if promoCode.MaxUsesPerStudent > 0 {
+		// Missing counter means they've never used it
+		filter["uses_by_student."+uid] = bson.M{"$not": bson.M{"$gte": promoCode.MaxUsesPerStudent}}
+	}
+
+	res, err := lib.Datastore.Db.Collection(promoCodesColName).UpdateOne(
+		ctx,
+		filter,
+		bson.M{"$inc": bson.M{"uses": 1, "uses_by_student." + uid: 1}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPromoCodeUsedUp
+	}
+	return nil
+}
+
+// releasePromoCodeUse gives back a use of a code, ex. when an order using it expires.
+func releasePromoCodeUse(ctx context.Context, promoCodeID primitive.ObjectID, uid string) error {
+	_, err := lib.Datastore.Db.Collection(promoCodesColName).UpdateOne(
+		ctx,
+		bson.M{"_id": promoCodeID},
+		bson.M{"$inc": bson.M{"uses": -1, "uses_by_student." + uid: -1}},
+	)
+	return err
+}
+
+func DeleteAllPromoCodesForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all promo codes for event
+	_, err := lib.Datastore.Db.Collection(promoCodesColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
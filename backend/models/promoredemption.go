@@ -0,0 +1,162 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PromoRedemption is a promo code being used on an order.
+type PromoRedemption struct {
+	ID               primitive.ObjectID `json:"id"          bson:"_id,omitempty"`
+	PromoCodeID      primitive.ObjectID `json:"promoCodeID" bson:"promo_code"`
+	EventID          primitive.ObjectID `json:"eventID"     bson:"event"`
+	UserID           string             `json:"userID"      bson:"user"`
+	OrderID          primitive.ObjectID `json:"orderID"     bson:"order"`
+	Discount         int64              `json:"discount"    bson:"discount"` // In cents
+	Status           string             `json:"status"      bson:"status"`
+	CreatedTimestamp time.Time          `json:"createdTime" bson:"created_time"`
+}
+
+// Statuses a promo code redemption can have
+const (
+	PromoRedemptionStatusHeld     = "held"     // Order hasn't been paid yet
+	PromoRedemptionStatusRedeemed = "redeemed" // Ticket was issued
+	PromoRedemptionStatusReleased = "released" // Order never went through, so the use was given back
+)
+
+func (redemption *PromoRedemption) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func CreatePromoRedemptionIndices(ctx context.Context) error {
+	// Create appropriate indices
+	promoCodeIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "promo_code", Value: 1},
+		},
+	}
+	orderIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "order", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(promoRedemptionsColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				promoCodeIdxModel,
+				orderIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetPromoRedemptions(ctx context.Context, filter bson.M) ([]PromoRedemption, error) {
+	// Newest first
+	opts := options.Find().SetSort(bson.D{{Key: "created_time", Value: -1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(promoRedemptionsColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []PromoRedemption{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into PromoRedemption structs
+	var redemptions []PromoRedemption
+	if err := cursor.All(ctx, &redemptions); err != nil {
+		return []PromoRedemption{}, err
+	}
+
+	return redemptions, nil
+}
+
+// holdPromoCode reserves a use of a code for an order that hasn't been made yet, returning
+// the redemption to save once the order exists.
+func holdPromoCode(ctx context.Context, promoCode PromoCode, order Order, discount int64) (PromoRedemption, error) {
+	if err := reservePromoCodeUse(ctx, promoCode, order.UserID); err != nil {
+		return PromoRedemption{}, err
+	}
+
+	return PromoRedemption{
+		PromoCodeID:      promoCode.ID,
+		EventID:          order.EventID,
+		UserID:           order.UserID,
+		Discount:         discount,
+		Status:           PromoRedemptionStatusHeld,
+		CreatedTimestamp: time.Now(),
+	}, nil
+}
+
+func createPromoRedemption(ctx context.Context, redemption PromoRedemption) error {
+	_, err := lib.Datastore.Db.Collection(promoRedemptionsColName).InsertOne(ctx, redemption)
+	return err
+}
+
+// redeemPromoCodeForOrder marks an order's redemption as used once its ticket is issued.
+// If the order expired before being paid, its use was already given back, so it's counted
+// again even if that goes over the limit, since the student has already paid.
+func redeemPromoCodeForOrder(ctx context.Context, order Order) error {
+	if order.PromoCodeID.IsZero() {
+		return nil
+	}
+
+	var redemption PromoRedemption
+	err := lib.Datastore.Db.Collection(promoRedemptionsColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"order": order.ID, "status": bson.M{"$in": bson.A{PromoRedemptionStatusHeld, PromoRedemptionStatusReleased}}},
+		bson.M{"$set": bson.M{"status": PromoRedemptionStatusRedeemed}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&redemption)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if redemption.Status == PromoRedemptionStatusReleased {
+		_, err = lib.Datastore.Db.Collection(promoCodesColName).UpdateOne(
+			ctx,
+			bson.M{"_id": redemption.PromoCodeID},
+			bson.M{"$inc": bson.M{"uses": 1, "uses_by_student." + redemption.UserID: 1}},
+		)
+	}
+	return err
+}
+
+// releasePromoCodeForOrder gives back the use of a code held by an order that didn't go through.
+func releasePromoCodeForOrder(ctx context.Context, orderID primitive.ObjectID) error {
+	var redemption PromoRedemption
+	err := lib.Datastore.Db.Collection(promoRedemptionsColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"order": orderID, "status": PromoRedemptionStatusHeld},
+		bson.M{"$set": bson.M{"status": PromoRedemptionStatusReleased}},
+	).Decode(&redemption)
+	if err == mongo.ErrNoDocuments {
+		// Order didn't use a code, or it was already released
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return releasePromoCodeUse(ctx, redemption.PromoCodeID, redemption.UserID)
+}
+
+func DeleteAllPromoRedemptionsForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all promo code uses for event
+	_, err := lib.Datastore.Db.Collection(promoRedemptionsColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
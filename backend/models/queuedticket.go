@@ -16,11 +16,13 @@ type QueuedTicket struct {
 	ID             primitive.ObjectID     `json:"id"             bson:"_id,omitempty"`
 	StudentNumber  string                 `json:"studentNumber" bson:"student_number"`
 	EventID        primitive.ObjectID     `json:"eventID"       bson:"event_id"`
+	Tier           primitive.ObjectID     `json:"tierID"        bson:"tier,omitempty"` // Empty if event doesn't use tiers
 	EventData      Event                  `json:"eventData"      bson:"event_data"`
 	Timestamp      time.Time              `json:"timestamp"      bson:"timestamp"`
 	MaxScanCount   int                    `json:"max_scan_count" bson:"max_scan_count"`
 	FullNameUpdate string                 `json:"full_name_update" bson:"full_name_update"`
 	CustomFields   map[string]interface{} `json:"customFields" bson:"customFields"`
+	OwnerHistory   []TicketOwnerChange    `json:"ownerHistory" bson:"owner_history"` // Carried over from a ticket transferred to someone who hasn't signed up
 }
 
 func (queuedTicket *QueuedTicket) Render(w http.ResponseWriter, r *http.Request) error {
@@ -90,7 +92,7 @@ func GetQueuedTicket(ctx context.Context, queuedTicketID primitive.ObjectID) (Qu
 		{
 			{Key: "$lookup", Value: bson.D{
 				{Key: "from", Value: "events"},
-				{Key: "localField", Value: "eventId"},
+				{Key: "localField", Value: "event_id"},
 				{Key: "foreignField", Value: "_id"},
 				{Key: "as", Value: "event_data"},
 			},
@@ -138,6 +140,12 @@ func GetQueuedTicketsForStudentNumber(ctx context.Context, studentNumber string)
 }
 
 func CreateQueuedTicket(ctx context.Context, queuedTicket QueuedTicket) (primitive.ObjectID, error) {
+	return createQueuedTicket(ctx, queuedTicket, true)
+}
+
+// createQueuedTicket creates a queued ticket, optionally skipping taking a spot for tickets
+// that already have one saved (ex. tickets being transferred).
+func createQueuedTicket(ctx context.Context, queuedTicket QueuedTicket, enforceCapacity bool) (primitive.ObjectID, error) {
 	queuedTicket.Timestamp = time.Now()
 
 	// Check if queued ticket already exists
@@ -165,19 +173,33 @@ func CreateQueuedTicket(ctx context.Context, queuedTicket QueuedTicket) (primiti
 	}
 
 	// Check if event exists
-	eventExists, err := CheckIfEventExists(ctx, queuedTicket.EventID)
-	if err != nil {
+	event, err := GetEvent(ctx, bson.M{"_id": queuedTicket.EventID})
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrNotFound
+	} else if err != nil {
 		return primitive.NilObjectID, err
 	}
-	if !eventExists {
-		return primitive.NilObjectID, ErrNotFound
+
+	// Make sure tier is valid
+	if err := checkTicketTier(event, queuedTicket.Tier); err != nil {
+		return primitive.NilObjectID, err
 	}
 
 	// TODO: Check if any custom fields match the event's schema
 
+	// Don't go over event's capacity
+	if enforceCapacity {
+		if err := reserveTicketSpace(ctx, event.ID, queuedTicket.Tier); err != nil {
+			return primitive.NilObjectID, err
+		}
+	}
+
 	// Try to add ticket
 	res, err := lib.Datastore.Db.Collection(queuedTicketsColName).InsertOne(ctx, queuedTicket)
 	if err != nil {
+		if enforceCapacity {
+			releaseTicketSpace(ctx, event.ID, queuedTicket.Tier)
+		}
 		return primitive.NilObjectID, err
 	}
 
@@ -198,16 +220,26 @@ func ConvertQueuedTicketToTicket(ctx context.Context, queuedTicket QueuedTicket,
 		return Ticket{}, err
 	}
 
+	// Now that we know who the recipient is, fill them into any transfers
+	for i := range queuedTicket.OwnerHistory {
+		if queuedTicket.OwnerHistory[i].NewOwner == "" {
+			queuedTicket.OwnerHistory[i].NewOwner = user.ID
+		}
+	}
+
 	ticket := Ticket{
 		Owner:        user.ID,
 		Event:        queuedTicket.EventID,
+		Tier:         queuedTicket.Tier,
 		Timestamp:    time.Now(),
 		ScanCount:    0,
 		MaxScanCount: queuedTicket.MaxScanCount,
 		CustomFields: queuedTicket.CustomFields,
+		OwnerHistory: queuedTicket.OwnerHistory,
 	}
 
-	ticketId, err := CreateNewTicket(ctx, ticket)
+	// Queued ticket already has a spot saved at the event
+	ticketId, err := createNewTicket(ctx, ticket, false)
 	if err != nil {
 		return Ticket{}, err
 	}
@@ -221,10 +253,10 @@ func ConvertQueuedTicketToTicket(ctx context.Context, queuedTicket QueuedTicket,
 		})
 	}
 
-	// Delete queued ticket since it has already been converted
+	// Delete queued ticket since it has already been converted, its spot went to the new ticket
 	// No point in doing much with the error from this,
 	// if it doesn't succeed, should still return new ticket
-	DeleteQueuedTicket(ctx, queuedTicket.ID)
+	deleteQueuedTicket(ctx, queuedTicket.ID, false)
 
 	return ticket, nil
 }
@@ -236,14 +268,31 @@ func CheckIfQueuedTicketExists(ctx context.Context, filter bson.M) (bool, error)
 }
 
 func DeleteQueuedTicket(ctx context.Context, id primitive.ObjectID) error {
+	return deleteQueuedTicket(ctx, id, true)
+}
+
+// deleteQueuedTicket deletes a queued ticket, optionally keeping its spot taken for tickets
+// that are taking it over (ex. the ticket it was converted into).
+func deleteQueuedTicket(ctx context.Context, id primitive.ObjectID, releaseSpace bool) error {
 	// Delete queued ticket
-	res, err := lib.Datastore.Db.Collection(queuedTicketsColName).DeleteOne(ctx, bson.M{"_id": id})
+	var queuedTicket QueuedTicket
+	err := lib.Datastore.Db.Collection(queuedTicketsColName).FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&queuedTicket)
 
 	// Handle no document found
-	if err == nil {
-		if res.DeletedCount == 0 {
-			err = ErrNoDocumentModified
-		}
+	if err == mongo.ErrNoDocuments {
+		return ErrNoDocumentModified
+	} else if err != nil {
+		return err
+	}
+
+	if releaseSpace {
+		return releaseTicketSpace(ctx, queuedTicket.EventID, queuedTicket.Tier)
 	}
+	return nil
+}
+
+func DeleteAllQueuedTicketsForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all queued tickets for event
+	_, err := lib.Datastore.Db.Collection(queuedTicketsColName).DeleteMany(ctx, bson.M{"event_id": eventID})
 	return err
 }
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Refund is money given back for a payment. Failed refunds are kept too so that there's a
+// record of every attempt.
+type Refund struct {
+	ID               primitive.ObjectID `json:"id"               bson:"_id,omitempty"`
+	PaymentID        primitive.ObjectID `json:"paymentID"        bson:"payment"`
+	OrderID          primitive.ObjectID `json:"orderID"          bson:"order"`
+	EventID          primitive.ObjectID `json:"eventID"          bson:"event"`
+	TierID           primitive.ObjectID `json:"tierID"           bson:"tier"`
+	TicketID         primitive.ObjectID `json:"ticketID"         bson:"ticket,omitempty"`
+	Amount           int64              `json:"amount"           bson:"amount"` // In cents
+	Currency         string             `json:"currency"         bson:"currency"`
+	Reason           string             `json:"reason"           bson:"reason"`
+	Status           string             `json:"status"           bson:"status"`
+	ProviderRefundID string             `json:"providerRefundID" bson:"provider_refund,omitempty"`
+	IssuedBy         string             `json:"issuedBy"         bson:"issued_by"` // UID of admin who issued the refund
+	Timestamp        time.Time          `json:"timestamp"        bson:"timestamp"`
+}
+
+// Statuses a refund can have
+const (
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed" // Provider wouldn't send the money back
+)
+
+func (refund *Refund) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func CreateRefundIndices(ctx context.Context) error {
+	// Create appropriate indices
+	orderIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "order", Value: 1},
+		},
+	}
+	eventIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(refundsColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				orderIdxModel,
+				eventIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetRefunds(ctx context.Context, filter bson.M) ([]Refund, error) {
+	// Oldest first, like a ledger
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(refundsColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []Refund{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into Refund structs
+	var refunds []Refund
+	if err := cursor.All(ctx, &refunds); err != nil {
+		return []Refund{}, err
+	}
+
+	return refunds, nil
+}
+
+// RefundPayment gives back part or all of a payment through the payment provider and voids
+// the ticket it paid for. Returns ErrRefundTooLarge if more would be refunded than is left
+// on the payment. If the provider refuses, a failed refund is recorded and the provider's
+// error is returned.
+func RefundPayment(ctx context.Context, payment Payment, amount int64, reason string, issuedBy string) (Refund, error) {
+	refund := Refund{
+		PaymentID: payment.ID,
+		OrderID:   payment.OrderID,
+		EventID:   payment.EventID,
+		TierID:    payment.TierID,
+		TicketID:  payment.TicketID,
+		Amount:    amount,
+		Currency:  payment.Currency,
+		Reason:    reason,
+		IssuedBy:  issuedBy,
+		Timestamp: time.Now(),
+	}
+
+	// Set the money aside first so that it can't be refunded twice
+	if err := reservePaymentRefund(ctx, payment.ID, amount); err != nil {
+		return Refund{}, err
+	}
+
+	providerRefundID, providerErr := lib.Payments.Refund(ctx, payment.ProviderPaymentID, amount)
+	if providerErr != nil {
+		// Money never left, so give it back to the payment
+		lib.Datastore.Db.Collection(paymentsColName).
+			UpdateByID(ctx, payment.ID, bson.M{"$inc": bson.M{"refunded_amount": -amount}})
+		refund.Status = RefundStatusFailed
+	} else {
+		refund.Status = RefundStatusSucceeded
+		refund.ProviderRefundID = providerRefundID
+	}
+
+	// Record refund no matter what happened
+	res, err := lib.Datastore.Db.Collection(refundsColName).InsertOne(ctx, refund)
+	if err != nil {
+		return refund, err
+	}
+	refund.ID = res.InsertedID.(primitive.ObjectID)
+	if providerErr != nil {
+		return refund, providerErr
+	}
+
+	// Ticket can't be used once any money has been given back
+	if !payment.TicketID.IsZero() {
+		err := VoidTicket(ctx, payment.TicketID, "refunded: "+reason, issuedBy)
+		if err != nil && err != ErrTicketVoided {
+			return refund, err
+		}
+	}
+
+	// Order is fully refunded once nothing is left on the payment
+	payment, err = GetPayment(ctx, bson.M{"_id": payment.ID})
+	if err != nil {
+		return refund, err
+	}
+	if payment.RefundableAmount() == 0 {
+		UpdateOrderStatus(ctx, payment.OrderID, []string{OrderStatusPaid, OrderStatusFailed}, OrderStatusRefunded, "")
+	}
+
+	return refund, nil
+}
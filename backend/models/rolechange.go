@@ -0,0 +1,190 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RoleChange is a record of someone's role being changed, kept as an audit trail.
+type RoleChange struct {
+	ID            primitive.ObjectID `json:"id"            bson:"_id,omitempty"`
+	UserID        string             `json:"userID"        bson:"user"`
+	ChangedBy     string             `json:"changedBy"     bson:"changed_by"` // UID of whoever made the change, or the tool that made it
+	PreviousRole  util.Role          `json:"previousRole"  bson:"previous_role"`
+	NewRole       util.Role          `json:"newRole"       bson:"new_role"`
+	Reason        string             `json:"reason"        bson:"reason,omitempty"`
+	TokensRevoked bool               `json:"tokensRevoked" bson:"tokens_revoked"` // If false, the old role lasts until their token expires
+	Timestamp     time.Time          `json:"timestamp"     bson:"timestamp"`
+}
+
+func (change *RoleChange) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func CreateRoleChangeIndices(ctx context.Context) error {
+	// Create appropriate indices
+	userIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user", Value: 1},
+			{Key: "timestamp", Value: -1},
+		},
+	}
+	timestampIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "timestamp", Value: -1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(roleChangesColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				userIdxModel,
+				timestampIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetRoleChanges(ctx context.Context, filter bson.M, page int64, pageSize int64) ([]RoleChange, int64, error) {
+	// Get total first so clients know how many pages exist
+	total, err := lib.Datastore.Db.Collection(roleChangesColName).CountDocuments(ctx, filter)
+	if err != nil {
+		return []RoleChange{}, 0, err
+	}
+
+	// Try to get data from MongoDB, newest first
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetSkip((page - 1) * pageSize).
+		SetLimit(pageSize)
+	cursor, err := lib.Datastore.Db.Collection(roleChangesColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []RoleChange{}, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into RoleChange structs
+	var changes []RoleChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		return []RoleChange{}, 0, err
+	}
+
+	return changes, total, nil
+}
+
+// GetStaffUsers fetches every user that has a role, including ones from before roles existed.
+func GetStaffUsers(ctx context.Context) ([]User, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"role": bson.M{"$nin": bson.A{nil, ""}}},
+		bson.M{"admin": true},
+		bson.M{"superadmin": true},
+	}}
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(usersColName).Find(ctx, filter)
+	if err != nil {
+		return []User{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into User structs
+	var users []User
+	if err := cursor.All(ctx, &users); err != nil {
+		return []User{}, err
+	}
+
+	return users, nil
+}
+
+// setUserRoleFields updates the copy of a user's role kept in the database.
+func setUserRoleFields(ctx context.Context, uid string, role util.Role) error {
+	_, err := lib.Datastore.Db.Collection(usersColName).UpdateByID(ctx, uid, bson.M{"$set": bson.M{
+		"admin":      role.IsAdmin(),
+		"superadmin": role == util.RoleSuperAdmin,
+		"role":       string(role),
+	}})
+	return err
+}
+
+// SetUserRole gives a user a role, or takes their role away if it's util.RoleNone. Their auth
+// claims and user document are both updated, with the claims put back if the document can't be.
+// Their refresh tokens are then revoked so the new role takes effect right away, and the change
+// is recorded in the audit trail.
+func SetUserRole(ctx context.Context, uid string, role util.Role, changedBy string, reason string) (RoleChange, error) {
+	// Make sure they have a user document to keep in sync
+	if exists, err := CheckIfUserExists(ctx, uid); err != nil {
+		return RoleChange{}, err
+	} else if !exists {
+		return RoleChange{}, mongo.ErrNoDocuments
+	}
+
+	// Current claims are the source of truth for their role
+	userRecord, err := lib.Auth.Client.GetUser(ctx, uid)
+	if err != nil {
+		return RoleChange{}, err
+	}
+	previousClaims := userRecord.CustomClaims
+	if previousClaims == nil {
+		previousClaims = map[string]interface{}{}
+	}
+	previousRole := util.GetRoleFromClaims(previousClaims)
+	if previousRole == role {
+		return RoleChange{}, ErrRoleUnchanged
+	}
+
+	// Keep any other claims they have as is
+	newClaims := map[string]interface{}{}
+	for key, val := range previousClaims {
+		newClaims[key] = val
+	}
+	for key, val := range util.ClaimsForRole(role) {
+		newClaims[key] = val
+	}
+
+	// Claims go first since they're what's actually checked
+	if err := lib.Auth.Client.SetCustomUserClaims(ctx, uid, newClaims); err != nil {
+		return RoleChange{}, err
+	}
+	if err := setUserRoleFields(ctx, uid, role); err != nil {
+		// Put the old claims back so both stores agree
+		if rollbackErr := lib.Auth.Client.SetCustomUserClaims(ctx, uid, previousClaims); rollbackErr != nil {
+			return RoleChange{}, fmt.Errorf("could not update user (%v), and could not roll back claims: %w", err, rollbackErr)
+		}
+		return RoleChange{}, err
+	}
+
+	// Revoking is best effort since the change itself has already gone through
+	change := RoleChange{
+		UserID:        uid,
+		ChangedBy:     changedBy,
+		PreviousRole:  previousRole,
+		NewRole:       role,
+		Reason:        reason,
+		TokensRevoked: lib.Auth.Client.RevokeRefreshTokens(ctx, uid) == nil,
+		Timestamp:     time.Now(),
+	}
+
+	// Record the change
+	res, err := lib.Datastore.Db.Collection(roleChangesColName).InsertOne(ctx, change)
+	if err != nil {
+		return change, err
+	}
+	change.ID = res.InsertedID.(primitive.ObjectID)
+
+	return change, nil
+}
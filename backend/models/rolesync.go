@@ -0,0 +1,167 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/aritrosaha10/frasertickets/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/api/iterator"
+)
+
+// Which store is trusted when fixing a user whose role doesn't match between them
+const (
+	RoleSourceClaims   = "claims"   // Auth claims are right, user document gets overwritten
+	RoleSourceDatabase = "database" // User document is right, auth claims get overwritten
+)
+
+// RoleDrift is a user whose role in their auth claims doesn't match their user document.
+type RoleDrift struct {
+	UserID         string    `json:"userID"`
+	FullName       string    `json:"fullName"`
+	StudentNumber  string    `json:"studentNumber"`
+	ClaimsRole     util.Role `json:"claimsRole"`
+	DatabaseRole   util.Role `json:"databaseRole"`
+	MissingAuth    bool      `json:"missingAuth"`    // User document has no auth account, can't be fixed automatically
+	MissingUserDoc bool      `json:"missingUserDoc"` // Auth account with a role has no user document, can't be fixed automatically
+}
+
+// Repairable checks whether the drift can be fixed by copying the role from one store to the other.
+func (drift RoleDrift) Repairable() bool {
+	return !drift.MissingAuth && !drift.MissingUserDoc
+}
+
+// GetDatabaseRole works out a user's role from their user document. Users from before roles
+// existed only have the admin & superadmin fields, so those are used if there's no role.
+func (user User) GetDatabaseRole() util.Role {
+	return util.GetRoleFromClaims(map[string]interface{}{
+		"admin":      user.Admin,
+		"superadmin": user.SuperAdmin,
+		"role":       user.Role,
+	})
+}
+
+// FindRoleDrift walks every user in both auth and the database, and returns everyone whose role
+// doesn't match between the two.
+func FindRoleDrift(ctx context.Context) ([]RoleDrift, error) {
+	// Auth is paged through once up front instead of fetching each user separately
+	claimsRoles := map[string]util.Role{}
+	authUsers := lib.Auth.Client.Users(ctx, "")
+	for {
+		authUser, err := authUsers.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return []RoleDrift{}, err
+		}
+		claimsRoles[authUser.UID] = util.GetRoleFromClaims(authUser.CustomClaims)
+	}
+
+	cursor, err := lib.Datastore.Db.Collection(usersColName).Find(ctx, bson.D{})
+	if err != nil {
+		return []RoleDrift{}, err
+	}
+	defer cursor.Close(ctx)
+
+	drifts := []RoleDrift{}
+	seen := map[string]bool{}
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return []RoleDrift{}, err
+		}
+		seen[user.ID] = true
+
+		databaseRole := user.GetDatabaseRole()
+		claimsRole, hasAuth := claimsRoles[user.ID]
+		if hasAuth && claimsRole == databaseRole {
+			continue
+		}
+		if !hasAuth && databaseRole == util.RoleNone {
+			// Deleted accounts without a role don't give anyone access
+			continue
+		}
+
+		drifts = append(drifts, RoleDrift{
+			UserID:        user.ID,
+			FullName:      user.FullName,
+			StudentNumber: user.StudentNumber,
+			ClaimsRole:    claimsRole,
+			DatabaseRole:  databaseRole,
+			MissingAuth:   !hasAuth,
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		return []RoleDrift{}, err
+	}
+
+	// Anyone with a role in auth should have a user document too
+	for uid, claimsRole := range claimsRoles {
+		if !seen[uid] && claimsRole != util.RoleNone {
+			drifts = append(drifts, RoleDrift{
+				UserID:         uid,
+				ClaimsRole:     claimsRole,
+				MissingUserDoc: true,
+			})
+		}
+	}
+
+	return drifts, nil
+}
+
+// RepairRoleDrift makes both stores agree on a user's role by copying it from the given source,
+// recording the fix in the role change history.
+func RepairRoleDrift(ctx context.Context, drift RoleDrift, source string, changedBy string) (RoleChange, error) {
+	if !drift.Repairable() {
+		return RoleChange{}, ErrNotFound
+	}
+
+	change := RoleChange{
+		UserID:    drift.UserID,
+		ChangedBy: changedBy,
+		Reason:    "reconciled from " + source,
+		Timestamp: time.Now(),
+	}
+
+	switch source {
+	case RoleSourceClaims:
+		change.PreviousRole = drift.DatabaseRole
+		change.NewRole = drift.ClaimsRole
+		if err := setUserRoleFields(ctx, drift.UserID, drift.ClaimsRole); err != nil {
+			return RoleChange{}, err
+		}
+	case RoleSourceDatabase:
+		change.PreviousRole = drift.ClaimsRole
+		change.NewRole = drift.DatabaseRole
+
+		// Keep any other claims they have as is
+		userRecord, err := lib.Auth.Client.GetUser(ctx, drift.UserID)
+		if err != nil {
+			return RoleChange{}, err
+		}
+		claims := map[string]interface{}{}
+		for key, val := range userRecord.CustomClaims {
+			claims[key] = val
+		}
+		for key, val := range util.ClaimsForRole(drift.DatabaseRole) {
+			claims[key] = val
+		}
+		if err := lib.Auth.Client.SetCustomUserClaims(ctx, drift.UserID, claims); err != nil {
+			return RoleChange{}, err
+		}
+		change.TokensRevoked = lib.Auth.Client.RevokeRefreshTokens(ctx, drift.UserID) == nil
+	default:
+		return RoleChange{}, ErrInvalidRoleSource
+	}
+
+	// Record the change
+	res, err := lib.Datastore.Db.Collection(roleChangesColName).InsertOne(ctx, change)
+	if err != nil {
+		return change, err
+	}
+	change.ID = res.InsertedID.(primitive.ObjectID)
+
+	return change, nil
+}
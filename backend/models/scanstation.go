@@ -0,0 +1,270 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ScanStation is a door / scanning point at an event that scans have to be made from.
+type ScanStation struct {
+	ID               primitive.ObjectID `json:"id"               bson:"_id,omitempty"`
+	Name             string             `json:"name"             bson:"name"` // Ex. "Gym east doors"
+	Event            primitive.ObjectID `json:"eventID"          bson:"event"`
+	AllowedAdminUIDs []string           `json:"allowedAdminUIDs" bson:"allowed_admin_uids"` // Empty means any admin can use it
+	Role             string             `json:"role"             bson:"role"`
+	ActiveFrom       time.Time          `json:"activeFrom"       bson:"active_from"`  // Zero means no start limit
+	ActiveUntil      time.Time          `json:"activeUntil"      bson:"active_until"` // Zero means no end limit
+}
+
+// Roles a scan station can have
+const (
+	ScanStationRoleEntry = "entry" // Lets people in, tracking that they're inside
+	ScanStationRoleExit  = "exit"  // Lets people out, tracking that they've left
+	ScanStationRoleAny   = "any"   // Just counts scans without tracking who is inside
+)
+
+// ScanStationCount is the number of scans that went through a station.
+type ScanStationCount struct {
+	StationID primitive.ObjectID `json:"stationID" bson:"_id"`
+	Entries   int64              `json:"entries"   bson:"entries"`
+	Exits     int64              `json:"exits"     bson:"exits"`
+}
+
+func (station *ScanStation) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (count *ScanStationCount) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Direction returns the scan direction that scans at this station should use.
+func (station ScanStation) Direction() string {
+	switch station.Role {
+	case ScanStationRoleEntry:
+		return ScanDirectionEntry
+	case ScanStationRoleExit:
+		return ScanDirectionExit
+	default:
+		return ""
+	}
+}
+
+// IsActive checks whether the station can be scanned at during the given time.
+func (station ScanStation) IsActive(t time.Time) bool {
+	if !station.ActiveFrom.IsZero() && t.Before(station.ActiveFrom) {
+		return false
+	}
+	if !station.ActiveUntil.IsZero() && t.After(station.ActiveUntil) {
+		return false
+	}
+	return true
+}
+
+// CanBeUsedBy checks whether the given admin has been assigned to the station.
+func (station ScanStation) CanBeUsedBy(uid string) bool {
+	if len(station.AllowedAdminUIDs) == 0 {
+		return true
+	}
+	for _, allowedUID := range station.AllowedAdminUIDs {
+		if allowedUID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateScanStationIndices(ctx context.Context) error {
+	// Create appropriate indices
+	eventIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(scanStationsColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				eventIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetScanStations(ctx context.Context, filter bson.M) ([]ScanStation, error) {
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(scanStationsColName).Find(ctx, filter)
+	if err != nil {
+		return []ScanStation{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into ScanStation structs
+	var stations []ScanStation
+	if err := cursor.All(ctx, &stations); err != nil {
+		return []ScanStation{}, err
+	}
+
+	return stations, nil
+}
+
+func GetScanStation(ctx context.Context, id primitive.ObjectID) (ScanStation, error) {
+	// Try to fetch data from DB
+	var station ScanStation
+	err := lib.Datastore.Db.Collection(scanStationsColName).
+		FindOne(ctx, bson.M{"_id": id}).
+		Decode(&station)
+
+	// No error handling needed (station & err will default to empty struct / nil)
+	return station, err
+}
+
+func CreateNewScanStation(ctx context.Context, station ScanStation) (primitive.ObjectID, error) {
+	// Check if event exists
+	eventExists, err := CheckIfEventExists(ctx, station.Event)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if !eventExists {
+		return primitive.NilObjectID, ErrNotFound
+	}
+
+	if station.AllowedAdminUIDs == nil {
+		station.AllowedAdminUIDs = []string{}
+	}
+
+	// Try to add document
+	res, err := lib.Datastore.Db.Collection(scanStationsColName).InsertOne(ctx, station)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Return object ID
+	return res.InsertedID.(primitive.ObjectID), err
+}
+
+func UpdateExistingScanStation(ctx context.Context, id primitive.ObjectID, updates map[string]interface{}) error {
+	UPDATABLE_KEYS := map[string]bool{
+		"name":               true,
+		"allowed_admin_uids": true,
+		"role":               true,
+		"active_from":        true,
+		"active_until":       true,
+	}
+
+	// Convert the string/interface map to BSON updates
+	bsonUpdates := bson.D{}
+	for key, val := range updates {
+		// Don't allow other keys to be updated
+		if !UPDATABLE_KEYS[key] {
+			return ErrEditNotAllowed
+		}
+
+		if key == "role" && val != ScanStationRoleEntry && val != ScanStationRoleExit && val != ScanStationRoleAny {
+			return ErrInvalidStationRole
+		}
+
+		// Convert timestamps to time.Time objects
+		if key == "active_from" || key == "active_until" {
+			if timestampStr, ok := val.(string); ok {
+				timestamp, err := time.Parse(time.RFC3339, timestampStr)
+				if err != nil {
+					log.Warn().Err(err).Str("key", key).Msg("could not parse timestamp as RFC3339")
+					return errors.Join(fmt.Errorf("could not parse timestamp as RFC3339"), err)
+				}
+				bsonUpdates = append(bsonUpdates, bson.E{Key: key, Value: timestamp})
+			} else {
+				log.Warn().Str("key", key).Msg("could not parse timestamp as string")
+				return fmt.Errorf("could not parse timestamp as string")
+			}
+		} else {
+			// Add the key/val pair in BSON
+			bsonUpdates = append(bsonUpdates, bson.E{Key: key, Value: val})
+		}
+	}
+
+	// Try to update document in DB
+	res, err := lib.Datastore.Db.Collection(scanStationsColName).
+		UpdateByID(ctx, id, bson.D{{Key: "$set", Value: bsonUpdates}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	if res.ModifiedCount == 0 {
+		return ErrNoDocumentModified
+	}
+	return nil
+}
+
+func DeleteScanStation(ctx context.Context, id primitive.ObjectID) error {
+	// Delete scan station
+	res, err := lib.Datastore.Db.Collection(scanStationsColName).DeleteOne(ctx, bson.M{"_id": id})
+
+	// Handle no document found
+	if err == nil {
+		if res.DeletedCount == 0 {
+			err = ErrNoDocumentModified
+		}
+	}
+	return err
+}
+
+func DeleteAllScanStationsForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all scan stations for event
+	_, err := lib.Datastore.Db.Collection(scanStationsColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
+
+// GetScanStationCounts counts the successful scans made at each station for an event,
+// giving a breakdown of attendance by entrance.
+func GetScanStationCounts(ctx context.Context, eventID primitive.ObjectID) ([]ScanStationCount, error) {
+	pipeline := mongo.Pipeline{
+		{
+			{Key: "$match", Value: bson.M{"event": eventID, "processed": true}},
+		},
+		{
+			{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$station"},
+				{Key: "entries", Value: bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$direction", ScanDirectionExit}}, 0, 1},
+				}}},
+				{Key: "exits", Value: bson.M{"$sum": bson.M{
+					"$cond": bson.A{bson.M{"$eq": bson.A{"$direction", ScanDirectionExit}}, 1, 0},
+				}}},
+			}},
+		},
+	}
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(ticketScansColName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return []ScanStationCount{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into ScanStationCount structs
+	var counts []ScanStationCount
+	if err := cursor.All(ctx, &counts); err != nil {
+		return []ScanStationCount{}, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,741 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SeatingTable is a table or section at a seated event, ex. "Table 4" in the "Gym" section.
+type SeatingTable struct {
+	ID      primitive.ObjectID `json:"id"      bson:"_id"`
+	Name    string             `json:"name"    bson:"name"`
+	Section string             `json:"section" bson:"section"` // Optional, ex. which room the table is in
+	Seats   int                `json:"seats"   bson:"seats"`
+
+	TakenSeats []int `json:"-" bson:"taken_seats"` // Seat numbers handed out, so that seats can be claimed in one update
+}
+
+// SeatAssignment is where a ticket holder sits, shown on their ticket and when it's scanned.
+type SeatAssignment struct {
+	TableID    primitive.ObjectID `json:"tableID"    bson:"table"`
+	TableName  string             `json:"tableName"  bson:"table_name"`
+	Section    string             `json:"section"    bson:"section"`
+	SeatNumber int                `json:"seatNumber" bson:"seat_number"` // Starts at 1
+}
+
+// SeatingGroup is a set of students (and their guests) who want to sit together. Students
+// make a group and share its join code with their friends, then admins seat the whole group
+// at one table.
+type SeatingGroup struct {
+	ID               primitive.ObjectID   `json:"id"          bson:"_id,omitempty"`
+	EventID          primitive.ObjectID   `json:"eventID"     bson:"event"`
+	Name             string               `json:"name"        bson:"name"`
+	JoinCode         string               `json:"joinCode"    bson:"join_code"`
+	CreatedBy        string               `json:"createdBy"   bson:"created_by"`
+	TicketIDs        []primitive.ObjectID `json:"ticketIDs"   bson:"tickets"`
+	TableID          primitive.ObjectID   `json:"tableID"     bson:"table,omitempty"` // Empty until an admin seats the group
+	CreatedTimestamp time.Time            `json:"createdTime" bson:"created_time"`
+}
+
+// SeatingAutoAssignResult is what happened when automatically seating an event's groups.
+type SeatingAutoAssignResult struct {
+	Assigned   []SeatingGroup `json:"assigned"`
+	Unassigned []SeatingGroup `json:"unassigned"` // Groups that didn't fit at any table
+}
+
+func (table *SeatingTable) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// String describes the seat in a readable way, ex. "Gym - Table 4, seat 2".
+func (seat SeatAssignment) String() string {
+	table := seat.TableName
+	if seat.Section != "" {
+		table = fmt.Sprintf("%s - %s", seat.Section, seat.TableName)
+	}
+	return fmt.Sprintf("%s, seat %d", table, seat.SeatNumber)
+}
+
+func (group *SeatingGroup) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (result *SeatingAutoAssignResult) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Join codes leave out characters that are easy to mix up, ex. O and 0
+const (
+	seatingJoinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	seatingJoinCodeLength   = 6
+)
+
+// GetSeatingTable finds one of the event's tables by its ID.
+func (event Event) GetSeatingTable(id primitive.ObjectID) (SeatingTable, bool) {
+	for _, table := range event.SeatingTables {
+		if table.ID == id {
+			return table, true
+		}
+	}
+	return SeatingTable{}, false
+}
+
+func CreateSeatingGroupIndices(ctx context.Context) error {
+	// Create appropriate indices
+	eventJoinCodeIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+			{Key: "join_code", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}
+	ticketsIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "tickets", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(seatingGroupsColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				eventJoinCodeIdxModel,
+				ticketsIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func CreateSeatingTable(ctx context.Context, eventID primitive.ObjectID, table SeatingTable) (primitive.ObjectID, error) {
+	// Check if event exists
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrNotFound
+	} else if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Names need to be unique within a section so that tables can be told apart
+	for _, existingTable := range event.SeatingTables {
+		if existingTable.Name == table.Name && existingTable.Section == table.Section {
+			return primitive.NilObjectID, ErrAlreadyExists
+		}
+	}
+
+	// Tables are stored inside the event, so they need their own IDs
+	table.ID = primitive.NewObjectID()
+	table.TakenSeats = []int{}
+	_, err = lib.Datastore.Db.Collection(eventsColName).
+		UpdateByID(ctx, eventID, bson.M{"$push": bson.M{"seating_tables": table}})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return table.ID, nil
+}
+
+// UpdateSeatingTable changes a table's details. Tables can't be shrunk so that seats someone is
+// already sitting in are removed. Seated tickets keep the old name until they're reassigned.
+func UpdateSeatingTable(ctx context.Context, eventID primitive.ObjectID, tableID primitive.ObjectID, updates map[string]interface{}) error {
+	UPDATABLE_KEYS := map[string]bool{
+		"name":    true,
+		"section": true,
+		"seats":   true,
+	}
+
+	// Convert the string/interface map to BSON updates on the matched table
+	bsonUpdates := bson.D{}
+	tableFilter := bson.M{"_id": tableID}
+	for key, val := range updates {
+		// Don't allow other keys to be updated
+		if !UPDATABLE_KEYS[key] {
+			return ErrEditNotAllowed
+		}
+
+		if key == "seats" {
+			// JSON numbers come in as floats, but seats are whole numbers
+			seats, ok := val.(float64)
+			if !ok || seats < 1 || seats != float64(int(seats)) {
+				log.Warn().Any("val", val).Str("key", key).Msg("seats is not a positive whole number")
+				return fmt.Errorf("seats must be a positive whole number")
+			}
+
+			// Seats that are handed out can't be taken away, checked as part of the update
+			if err := initTakenSeats(ctx, eventID); err != nil {
+				return err
+			}
+			tableFilter["taken_seats"] = bson.M{"$not": bson.M{"$elemMatch": bson.M{"$gt": int(seats)}}}
+			val = int(seats)
+		}
+
+		bsonUpdates = append(bsonUpdates, bson.E{Key: "seating_tables.$." + key, Value: val})
+	}
+
+	// Try to update table in DB
+	res, err := lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": eventID, "seating_tables": bson.M{"$elemMatch": tableFilter}},
+		bson.D{{Key: "$set", Value: bsonUpdates}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		// Figure out whether the table doesn't exist or is too full to shrink
+		exists, err := lib.Datastore.Db.Collection(eventsColName).
+			CountDocuments(ctx, bson.M{"_id": eventID, "seating_tables._id": tableID})
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return ErrTableFull
+		}
+		return ErrNotFound
+	}
+	if res.ModifiedCount == 0 {
+		return ErrNoDocumentModified
+	}
+	return nil
+}
+
+// DeleteSeatingTable removes a table from an event. Tables with groups seated at them can't be deleted.
+func DeleteSeatingTable(ctx context.Context, eventID primitive.ObjectID, tableID primitive.ObjectID) error {
+	seatedGroups, err := lib.Datastore.Db.Collection(seatingGroupsColName).
+		CountDocuments(ctx, bson.M{"event": eventID, "table": tableID})
+	if err != nil {
+		return err
+	}
+	if seatedGroups > 0 {
+		return ErrTableInUse
+	}
+
+	res, err := lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": eventID, "seating_tables._id": tableID},
+		bson.M{"$pull": bson.M{"seating_tables": bson.M{"_id": tableID}}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func GetSeatingGroups(ctx context.Context, filter bson.M) ([]SeatingGroup, error) {
+	// Oldest first so that groups that formed earlier get seated first
+	opts := options.Find().SetSort(bson.D{{Key: "created_time", Value: 1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(seatingGroupsColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []SeatingGroup{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into SeatingGroup structs
+	var groups []SeatingGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return []SeatingGroup{}, err
+	}
+
+	return groups, nil
+}
+
+func GetSeatingGroup(ctx context.Context, filter bson.M) (SeatingGroup, error) {
+	// Try to fetch data from DB
+	var group SeatingGroup
+	err := lib.Datastore.Db.Collection(seatingGroupsColName).
+		FindOne(ctx, filter).
+		Decode(&group)
+
+	// No error handling needed (group & err will default to empty struct / nil)
+	return group, err
+}
+
+// GetSeatingGroupForUser finds the group a student is in for an event.
+func GetSeatingGroupForUser(ctx context.Context, eventID primitive.ObjectID, uid string) (SeatingGroup, error) {
+	ticket, err := SearchForTicket(ctx, eventID, uid)
+	if err != nil {
+		return SeatingGroup{}, err
+	}
+	return GetSeatingGroup(ctx, bson.M{"event": eventID, "tickets": ticket.ID})
+}
+
+// getSeatingTicketIDs gets a student's ticket for an event, along with any guest tickets they
+// sponsor, since guests sit with their sponsor.
+func getSeatingTicketIDs(ctx context.Context, eventID primitive.ObjectID, uid string) ([]primitive.ObjectID, error) {
+	ticket, err := SearchForTicket(ctx, eventID, uid)
+	if err == mongo.ErrNoDocuments {
+		return []primitive.ObjectID{}, ErrNotFound
+	} else if err != nil {
+		return []primitive.ObjectID{}, err
+	}
+	if ticket.Voided {
+		return []primitive.ObjectID{}, ErrTicketVoided
+	}
+
+	ticketIDs := []primitive.ObjectID{ticket.ID}
+	guestTickets, err := GetGuestTickets(ctx, ticket.ID)
+	if err != nil {
+		return []primitive.ObjectID{}, err
+	}
+	for _, guestTicket := range guestTickets {
+		if !guestTicket.Voided {
+			ticketIDs = append(ticketIDs, guestTicket.ID)
+		}
+	}
+
+	// Can only be in one group at a time
+	inGroup, err := lib.Datastore.Db.Collection(seatingGroupsColName).
+		CountDocuments(ctx, bson.M{"event": eventID, "tickets": bson.M{"$in": ticketIDs}})
+	if err != nil {
+		return []primitive.ObjectID{}, err
+	}
+	if inGroup > 0 {
+		return []primitive.ObjectID{}, ErrAlreadyExists
+	}
+
+	return ticketIDs, nil
+}
+
+func generateSeatingJoinCode() (string, error) {
+	code := make([]byte, seatingJoinCodeLength)
+	for i := range code {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(seatingJoinCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = seatingJoinCodeAlphabet[idx.Int64()]
+	}
+	return string(code), nil
+}
+
+// CreateSeatingGroup starts a new group with the student (and their guests) in it.
+func CreateSeatingGroup(ctx context.Context, eventID primitive.ObjectID, uid string, name string) (SeatingGroup, error) {
+	ticketIDs, err := getSeatingTicketIDs(ctx, eventID, uid)
+	if err != nil {
+		return SeatingGroup{}, err
+	}
+
+	group := SeatingGroup{
+		EventID:          eventID,
+		Name:             name,
+		CreatedBy:        uid,
+		TicketIDs:        ticketIDs,
+		CreatedTimestamp: time.Now(),
+	}
+
+	// Join codes are short, so try again if one is already taken
+	for attempt := 0; attempt < 5; attempt++ {
+		group.JoinCode, err = generateSeatingJoinCode()
+		if err != nil {
+			return SeatingGroup{}, err
+		}
+
+		res, err := lib.Datastore.Db.Collection(seatingGroupsColName).InsertOne(ctx, group)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		} else if err != nil {
+			return SeatingGroup{}, err
+		}
+
+		group.ID = res.InsertedID.(primitive.ObjectID)
+		return group, nil
+	}
+
+	return SeatingGroup{}, fmt.Errorf("could not generate unique join code")
+}
+
+// JoinSeatingGroup adds a student (and their guests) to a group using its join code. Groups
+// that have already been seated can't be joined, since their table might not have space.
+func JoinSeatingGroup(ctx context.Context, eventID primitive.ObjectID, uid string, joinCode string) (SeatingGroup, error) {
+	joinCode = strings.ToUpper(strings.TrimSpace(joinCode))
+	ticketIDs, err := getSeatingTicketIDs(ctx, eventID, uid)
+	if err != nil {
+		return SeatingGroup{}, err
+	}
+
+	var group SeatingGroup
+	err = lib.Datastore.Db.Collection(seatingGroupsColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"event": eventID, "join_code": joinCode, "table": bson.M{"$exists": false}},
+		bson.M{"$addToSet": bson.M{"tickets": bson.M{"$each": ticketIDs}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		// Figure out whether the code is wrong or the group was already seated
+		exists, err := lib.Datastore.Db.Collection(seatingGroupsColName).
+			CountDocuments(ctx, bson.M{"event": eventID, "join_code": joinCode})
+		if err != nil {
+			return SeatingGroup{}, err
+		}
+		if exists > 0 {
+			return SeatingGroup{}, ErrGroupSeated
+		}
+		return SeatingGroup{}, ErrNotFound
+	} else if err != nil {
+		return SeatingGroup{}, err
+	}
+
+	return group, nil
+}
+
+// LeaveSeatingGroup takes a student (and their guests) out of their group, giving up any seats
+// they were assigned. Groups are deleted once everyone has left.
+func LeaveSeatingGroup(ctx context.Context, eventID primitive.ObjectID, uid string) error {
+	ticket, err := SearchForTicket(ctx, eventID, uid)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return removeFromSeatingGroup(ctx, eventID, ticket.ID)
+}
+
+// removeFromSeatingGroup takes a ticket (and its guests) out of their group, giving up any seats
+// they were assigned. Groups are deleted once everyone has left.
+func removeFromSeatingGroup(ctx context.Context, eventID primitive.ObjectID, ticketID primitive.ObjectID) error {
+	guestTickets, err := GetGuestTickets(ctx, ticketID)
+	if err != nil {
+		return err
+	}
+	ticketIDs := bson.A{ticketID}
+	for _, guestTicket := range guestTickets {
+		ticketIDs = append(ticketIDs, guestTicket.ID)
+	}
+
+	var group SeatingGroup
+	err = lib.Datastore.Db.Collection(seatingGroupsColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"event": eventID, "tickets": ticketID},
+		bson.M{"$pullAll": bson.M{"tickets": ticketIDs}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// Give up seats
+	for _, id := range ticketIDs {
+		if err := unseatTicket(ctx, id.(primitive.ObjectID)); err != nil {
+			return err
+		}
+	}
+
+	// Clean up empty groups
+	if len(group.TicketIDs) == 0 {
+		_, err = lib.Datastore.Db.Collection(seatingGroupsColName).DeleteOne(ctx, bson.M{"_id": group.ID, "tickets": bson.M{"$size": 0}})
+	}
+	return err
+}
+
+// initTakenSeats fills in the taken seat numbers of tables from before they were kept on the
+// table. Only the first caller's numbers are saved if it's called more than once at the same time.
+func initTakenSeats(ctx context.Context, eventID primitive.ObjectID) error {
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	for _, table := range event.SeatingTables {
+		if table.TakenSeats != nil {
+			continue
+		}
+
+		cursor, err := lib.Datastore.Db.Collection(ticketsColName).Find(
+			ctx,
+			bson.M{"seat.table": table.ID, "voided": bson.M{"$ne": true}},
+			options.Find().SetProjection(bson.M{"seat": 1}),
+		)
+		if err != nil {
+			return err
+		}
+		var seatedTickets []Ticket
+		if err := cursor.All(ctx, &seatedTickets); err != nil {
+			return err
+		}
+		takenSeats := []int{}
+		for _, ticket := range seatedTickets {
+			takenSeats = append(takenSeats, ticket.Seat.SeatNumber)
+		}
+
+		_, err = lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+			ctx,
+			bson.M{"_id": eventID, "seating_tables": bson.M{"$elemMatch": bson.M{"_id": table.ID, "taken_seats": nil}}},
+			bson.M{"$set": bson.M{"seating_tables.$.taken_seats": takenSeats}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimSeats hands out the lowest free seat numbers at a table. The seats are checked to be
+// free and within the table's size in the same update that claims them, so two groups can
+// never be given the same seat. Claimed seats have to be given back with freeSeat once
+// they're no longer used.
+func claimSeats(ctx context.Context, eventID primitive.ObjectID, tableID primitive.ObjectID, count int) (SeatingTable, []int, error) {
+	if err := initTakenSeats(ctx, eventID); err != nil {
+		return SeatingTable{}, []int{}, err
+	}
+
+	// Only fails if someone else claimed seats at the table in the meantime, so try again
+	for attempt := 0; attempt < 5; attempt++ {
+		event, err := GetEvent(ctx, bson.M{"_id": eventID})
+		if err != nil {
+			return SeatingTable{}, []int{}, err
+		}
+		table, ok := event.GetSeatingTable(tableID)
+		if !ok {
+			return SeatingTable{}, []int{}, ErrTableNotFound
+		}
+		if count == 0 {
+			return table, []int{}, nil
+		}
+
+		taken := map[int]bool{}
+		for _, seatNumber := range table.TakenSeats {
+			taken[seatNumber] = true
+		}
+		seatNumbers := []int{}
+		for seatNumber := 1; seatNumber <= table.Seats && len(seatNumbers) < count; seatNumber++ {
+			if !taken[seatNumber] {
+				seatNumbers = append(seatNumbers, seatNumber)
+			}
+		}
+		if len(seatNumbers) < count {
+			return SeatingTable{}, []int{}, ErrTableFull
+		}
+
+		res, err := lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+			ctx,
+			bson.M{"_id": eventID, "seating_tables": bson.M{"$elemMatch": bson.M{
+				"_id":         tableID,
+				"seats":       table.Seats,
+				"taken_seats": bson.M{"$ne": nil, "$nin": seatNumbers},
+			}}},
+			bson.M{"$push": bson.M{"seating_tables.$.taken_seats": bson.M{"$each": seatNumbers}}},
+		)
+		if err != nil {
+			return SeatingTable{}, []int{}, err
+		}
+		if res.MatchedCount > 0 {
+			return table, seatNumbers, nil
+		}
+	}
+
+	return SeatingTable{}, []int{}, fmt.Errorf("could not claim seats at table")
+}
+
+// freeSeat gives a seat back to its table so that it can be handed out again.
+func freeSeat(ctx context.Context, eventID primitive.ObjectID, seat *SeatAssignment) error {
+	if seat == nil {
+		return nil
+	}
+
+	_, err := lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": eventID},
+		bson.M{"$pull": bson.M{"seating_tables.$[table].taken_seats": seat.SeatNumber}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"table._id": seat.TableID}}}),
+	)
+	return err
+}
+
+// unseatTicket takes away a ticket's seat, giving it back to its table. Voided tickets already
+// gave up their seat when they were voided.
+func unseatTicket(ctx context.Context, ticketID primitive.ObjectID) error {
+	var ticket Ticket
+	err := lib.Datastore.Db.Collection(ticketsColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": ticketID, "seat": bson.M{"$exists": true}, "voided": bson.M{"$ne": true}},
+		bson.M{"$unset": bson.M{"seat": ""}},
+	).Decode(&ticket)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return freeSeat(ctx, ticket.Event, ticket.Seat)
+}
+
+// AssignSeatingGroup seats a whole group at a table, giving each ticket in the group the
+// lowest seat numbers that are free. Groups that were already seated are moved, and tickets
+// already seated at the table keep their seats. An empty table ID unseats the group.
+func AssignSeatingGroup(ctx context.Context, eventID primitive.ObjectID, groupID primitive.ObjectID, tableID primitive.ObjectID) (SeatingGroup, error) {
+	group, err := GetSeatingGroup(ctx, bson.M{"_id": groupID, "event": eventID})
+	if err == mongo.ErrNoDocuments {
+		return SeatingGroup{}, ErrNotFound
+	} else if err != nil {
+		return SeatingGroup{}, err
+	}
+
+	if tableID.IsZero() {
+		for _, ticketID := range group.TicketIDs {
+			if err := unseatTicket(ctx, ticketID); err != nil {
+				return SeatingGroup{}, err
+			}
+		}
+
+		_, err = lib.Datastore.Db.Collection(seatingGroupsColName).
+			UpdateByID(ctx, group.ID, bson.M{"$unset": bson.M{"table": ""}})
+		group.TableID = primitive.NilObjectID
+		return group, err
+	}
+
+	// Voided tickets don't get a seat
+	cursor, err := lib.Datastore.Db.Collection(ticketsColName).Find(ctx, bson.M{
+		"_id":        bson.M{"$in": group.TicketIDs},
+		"voided":     bson.M{"$ne": true},
+		"seat.table": bson.M{"$ne": tableID},
+	})
+	if err != nil {
+		return SeatingGroup{}, err
+	}
+	var unseatedTickets []Ticket
+	if err := cursor.All(ctx, &unseatedTickets); err != nil {
+		return SeatingGroup{}, err
+	}
+
+	// Seats are handed out in the order people joined, so guests sit next to their sponsor
+	groupOrder := map[primitive.ObjectID]int{}
+	for i, ticketID := range group.TicketIDs {
+		groupOrder[ticketID] = i
+	}
+	sort.Slice(unseatedTickets, func(i, j int) bool {
+		return groupOrder[unseatedTickets[i].ID] < groupOrder[unseatedTickets[j].ID]
+	})
+
+	// Claim seats at the new table before giving up current ones, so that the group stays
+	// where it is if the table is full
+	table, seatNumbers, err := claimSeats(ctx, eventID, tableID, len(unseatedTickets))
+	if err != nil {
+		return SeatingGroup{}, err
+	}
+
+	for i, ticket := range unseatedTickets {
+		seat := &SeatAssignment{
+			TableID:    table.ID,
+			TableName:  table.Name,
+			Section:    table.Section,
+			SeatNumber: seatNumbers[i],
+		}
+
+		var previousTicket Ticket
+		err := lib.Datastore.Db.Collection(ticketsColName).FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": ticket.ID, "voided": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"seat": seat}},
+		).Decode(&previousTicket)
+		if err == mongo.ErrNoDocuments {
+			// Voided or deleted in the meantime, so nobody needs the seat
+			err = freeSeat(ctx, eventID, seat)
+		} else if err == nil {
+			err = freeSeat(ctx, eventID, previousTicket.Seat)
+		}
+		if err != nil {
+			return SeatingGroup{}, err
+		}
+	}
+
+	group.TableID = table.ID
+	_, err = lib.Datastore.Db.Collection(seatingGroupsColName).
+		UpdateByID(ctx, group.ID, bson.M{"$set": bson.M{"table": table.ID}})
+	return group, err
+}
+
+// AutoAssignSeating seats every group that hasn't been seated yet. Bigger groups are seated
+// first since they're the hardest to fit, each at whichever table has the most free seats.
+func AutoAssignSeating(ctx context.Context, eventID primitive.ObjectID) (SeatingAutoAssignResult, error) {
+	result := SeatingAutoAssignResult{Assigned: []SeatingGroup{}, Unassigned: []SeatingGroup{}}
+
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return result, ErrNotFound
+	} else if err != nil {
+		return result, err
+	}
+
+	groups, err := GetSeatingGroups(ctx, bson.M{"event": eventID, "table": bson.M{"$exists": false}})
+	if err != nil {
+		return result, err
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].TicketIDs) > len(groups[j].TicketIDs)
+	})
+
+	// Keep track of free seats as groups get seated
+	if err := initTakenSeats(ctx, eventID); err != nil {
+		return result, err
+	}
+	event, err = GetEvent(ctx, bson.M{"_id": eventID})
+	if err != nil {
+		return result, err
+	}
+	freeSeats := map[primitive.ObjectID]int{}
+	for _, table := range event.SeatingTables {
+		freeSeats[table.ID] = table.Seats - len(table.TakenSeats)
+	}
+
+	for _, group := range groups {
+		if len(group.TicketIDs) == 0 {
+			continue
+		}
+
+		bestTableID := primitive.NilObjectID
+		for _, table := range event.SeatingTables {
+			if freeSeats[table.ID] >= len(group.TicketIDs) && (bestTableID.IsZero() || freeSeats[table.ID] > freeSeats[bestTableID]) {
+				bestTableID = table.ID
+			}
+		}
+		if bestTableID.IsZero() {
+			result.Unassigned = append(result.Unassigned, group)
+			continue
+		}
+
+		seatedGroup, err := AssignSeatingGroup(ctx, eventID, group.ID, bestTableID)
+		if err == ErrTableFull {
+			// Someone else was seated there in the meantime
+			freeSeats[bestTableID] = 0
+			result.Unassigned = append(result.Unassigned, group)
+			continue
+		} else if err != nil {
+			return result, err
+		}
+		freeSeats[bestTableID] -= len(seatedGroup.TicketIDs)
+		result.Assigned = append(result.Assigned, seatedGroup)
+	}
+
+	return result, nil
+}
+
+func DeleteAllSeatingGroupsForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all seating groups for event
+	_, err := lib.Datastore.Db.Collection(seatingGroupsColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
@@ -19,28 +19,36 @@ type Ticket struct {
 	Owner             string                 `json:"ownerID"   bson:"owner"` // owner ID
 	OwnerData         User                   `json:"ownerData" bson:"ownerData"`
 	Event             primitive.ObjectID     `json:"eventID"   bson:"event"`
+	Tier              primitive.ObjectID     `json:"tierID"    bson:"tier,omitempty"`  // Empty if event doesn't use tiers
+	OrderID           primitive.ObjectID     `json:"orderID"   bson:"order,omitempty"` // Set if the ticket was bought by the student
 	EventData         Event                  `json:"eventData" bson:"eventData"`
 	Timestamp         time.Time              `json:"timestamp" bson:"timestamp"`
 	ScanCount         int                    `json:"scanCount" bson:"scanCount"`
 	LastScanTimestamp time.Time              `json:"lastScanTime" bson:"lastScanTime"`
 	MaxScanCount      int                    `json:"maxScanCount" bson:"maxScanCount"`
 	CustomFields      map[string]interface{} `json:"customFields" bson:"customFields"`
+	Inside            bool                   `json:"inside" bson:"inside"` // Whether holder is currently inside the venue
+	LastExitTimestamp time.Time              `json:"lastExitTime" bson:"lastExitTime"`
+	Voided            bool                   `json:"voided" bson:"voided"` // Voided tickets are kept for the audit trail but can't be used
+	VoidReason        string                 `json:"voidReason" bson:"voidReason"`
+	VoidedBy          string                 `json:"voidedBy" bson:"voidedBy"` // UID of admin who voided the ticket
+	VoidTimestamp     time.Time              `json:"voidTime" bson:"voidTime"`
+	VoidedWithSponsor bool                   `json:"voidedWithSponsor" bson:"voided_with_sponsor,omitempty"` // Guest ticket was voided because its sponsor's ticket was, so it comes back with it
+	OwnerHistory      []TicketOwnerChange    `json:"ownerHistory" bson:"ownerHistory"`
+	Guest             *GuestInfo             `json:"guest,omitempty" bson:"guest,omitempty"`                    // Only set for guest tickets, which are owned by their sponsor
+	SponsorTicketID   primitive.ObjectID     `json:"sponsorTicketID,omitempty" bson:"sponsor_ticket,omitempty"` // Sponsor's own ticket, only set for guest tickets
+	Seat              *SeatAssignment        `json:"seat,omitempty" bson:"seat,omitempty"`                      // Set once the holder's seating group is seated
 }
 
-func (ticket *Ticket) Render(w http.ResponseWriter, r *http.Request) error {
-	return nil
-}
-
-type TicketScan struct {
-	Index           int       `json:"index"`
-	Timestamp       time.Time `json:"timestamp"`
-	TicketData      Ticket    `json:"ticketData"`
-	UserData        User      `json:"userData"`
-	Processed       bool      `json:"processed"`
-	NoProcessReason string    `json:"noProcessReason"`
+// TicketOwnerChange is a record of a ticket being transferred to someone else.
+type TicketOwnerChange struct {
+	PreviousOwner string             `json:"previousOwnerID" bson:"previousOwner"`
+	NewOwner      string             `json:"newOwnerID"      bson:"newOwner"` // Empty until recipient signs up if ticket was queued
+	TransferID    primitive.ObjectID `json:"transferID"      bson:"transfer"`
+	Timestamp     time.Time          `json:"timestamp"       bson:"timestamp"`
 }
 
-func (scan *TicketScan) Render(w http.ResponseWriter, r *http.Request) error {
+func (ticket *Ticket) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
@@ -62,6 +70,22 @@ func CreateTicketIndices(ctx context.Context) error {
 			{Key: "owner", Value: 1},
 		},
 	}
+	eventInsideIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+			{Key: "inside", Value: 1},
+		},
+	}
+	sponsorTicketIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "sponsor_ticket", Value: 1},
+		},
+	}
+	seatTableIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "seat.table", Value: 1},
+		},
+	}
 
 	// Try creating the indices
 	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
@@ -73,6 +97,9 @@ func CreateTicketIndices(ctx context.Context) error {
 				eventOwnerPairIdxModel,
 				eventIdxModel,
 				ownerIdxModel,
+				eventInsideIdxModel,
+				sponsorTicketIdxModel,
+				seatTableIdxModel,
 			},
 			opts,
 		)
@@ -137,6 +164,8 @@ func GetTicketCount(ctx context.Context, filter bson.M) (int64, error) {
 	return count, nil
 }
 
+// SearchForTicket finds a user's own ticket for an event, ignoring any guest tickets
+// they're sponsoring.
 func SearchForTicket(
 	ctx context.Context,
 	eventID primitive.ObjectID,
@@ -144,7 +173,7 @@ func SearchForTicket(
 ) (Ticket, error) {
 	pipeline := mongo.Pipeline{
 		{
-			{Key: "$match", Value: bson.M{"event": eventID, "owner": userID}},
+			{Key: "$match", Value: bson.M{"event": eventID, "owner": userID, "guest": bson.M{"$exists": false}}},
 		},
 		{
 			{Key: "$lookup", Value: bson.D{
@@ -252,13 +281,22 @@ func CheckIfTicketExists(ctx context.Context, filter bson.M) (bool, error) {
 }
 
 func CreateNewTicket(ctx context.Context, ticket Ticket) (primitive.ObjectID, error) {
+	return createNewTicket(ctx, ticket, true)
+}
+
+// createNewTicket creates a ticket, optionally skipping taking a spot for tickets that
+// already have one saved (ex. queued tickets being converted).
+func createNewTicket(ctx context.Context, ticket Ticket, enforceCapacity bool) (primitive.ObjectID, error) {
 	// Set timestamp to now
 	ticket.Timestamp = time.Now()
 
-	// Check if ticket already exists
-	_, err := SearchForTicket(ctx, ticket.Event, ticket.Owner)
-	if err == nil {
-		return primitive.NilObjectID, ErrAlreadyExists
+	// Check if ticket already exists, sponsors can have more than one guest ticket though
+	isGuest := ticket.Guest != nil
+	if !isGuest {
+		_, err := SearchForTicket(ctx, ticket.Event, ticket.Owner)
+		if err == nil {
+			return primitive.NilObjectID, ErrAlreadyExists
+		}
 	}
 
 	// Get event if it exists
@@ -269,6 +307,11 @@ func CreateNewTicket(ctx context.Context, ticket Ticket) (primitive.ObjectID, er
 		return primitive.NilObjectID, err
 	}
 
+	// Make sure tier is valid
+	if err := checkTicketTier(event, ticket.Tier); err != nil {
+		return primitive.NilObjectID, err
+	}
+
 	// Check if user exists
 	userExists, err := CheckIfUserExists(ctx, ticket.Owner)
 	if err != nil {
@@ -278,22 +321,36 @@ func CreateNewTicket(ctx context.Context, ticket Ticket) (primitive.ObjectID, er
 		return primitive.NilObjectID, ErrNotFound
 	}
 
-	// Check if ticket's custom data matches schema
-	valid, schemaErrs, err := ValidateCustomEventFields(ctx, event, ticket.CustomFields)
-	if err != nil {
-		return primitive.NilObjectID, err
+	// Check if ticket's custom data matches schema, custom fields are about students so guests don't have any
+	if isGuest {
+		ticket.CustomFields = map[string]interface{}{}
+	} else {
+		valid, schemaErrs, err := ValidateCustomEventFields(ctx, event, ticket.CustomFields)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		if !valid {
+			errStr := ""
+			for _, schemaErr := range schemaErrs {
+				errStr += schemaErr.String() + "\n"
+			}
+			return primitive.NilObjectID, fmt.Errorf(errStr)
+		}
 	}
-	if !valid {
-		errStr := ""
-		for _, schemaErr := range schemaErrs {
-			errStr += schemaErr.String() + "\n"
+
+	// Take a spot last so that it isn't used up by tickets that can't be made
+	if enforceCapacity {
+		if err := reserveTicketSpace(ctx, event.ID, ticket.Tier); err != nil {
+			return primitive.NilObjectID, err
 		}
-		return primitive.NilObjectID, fmt.Errorf(errStr)
 	}
 
 	// Try to add ticket
 	res, err := lib.Datastore.Db.Collection(ticketsColName).InsertOne(ctx, ticket)
 	if err != nil {
+		if enforceCapacity {
+			releaseTicketSpace(ctx, event.ID, ticket.Tier)
+		}
 		return primitive.NilObjectID, err
 	}
 
@@ -311,6 +368,7 @@ func UpdateExistingTicketByKeys(
 		"scanCount":    true,
 		"lastScanTime": true,
 		"maxScanCount": true,
+		"inside":       true, // Allows fixing missed exit scans
 	}
 	CUSTOM_UPDATABLE_KEYS := map[string]bool{}
 
@@ -363,17 +421,218 @@ func UpdateExistingTicketByKeys(
 	return nil
 }
 
+// ScanTicket atomically records a scan on a ticket, returning the ticket as it was right
+// before the scan. Everything is checked and updated in one operation, so concurrent scans
+// of the same ticket can never go over its max scan count or let someone in twice.
+//
+// Entry scans count towards the max scan count and mark the holder as inside, and are
+// refused if they're already inside. Exit scans mark the holder as outside without counting
+// as a scan. Scans without a direction just count towards the max scan count.
+func ScanTicket(ctx context.Context, id primitive.ObjectID, timestamp time.Time, direction string) (Ticket, error) {
+	var filter bson.M
+	var update bson.D
+	if direction == ScanDirectionExit {
+		filter = bson.M{"_id": id, "inside": true, "voided": bson.M{"$ne": true}}
+		update = bson.D{
+			{Key: "$set", Value: bson.M{"inside": false}},
+			{Key: "$max", Value: bson.M{"lastExitTime": timestamp}},
+		}
+	} else {
+		// Max scan count of 0 means unlimited
+		filter = bson.M{
+			"_id":    id,
+			"voided": bson.M{"$ne": true},
+			"$or": bson.A{
+				bson.M{"maxScanCount": 0},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$scanCount", "$maxScanCount"}}},
+			},
+		}
+		update = bson.D{
+			{Key: "$inc", Value: bson.M{"scanCount": 1}},
+			{Key: "$max", Value: bson.M{"lastScanTime": timestamp}}, // Offline scans can be synced out of order
+		}
+		if direction == ScanDirectionEntry {
+			filter["inside"] = bson.M{"$ne": true}
+			update = append(update, bson.E{Key: "$set", Value: bson.M{"inside": true}})
+		}
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	// Try to update the ticket in one operation
+	var ticket Ticket
+	err := lib.Datastore.Db.Collection(ticketsColName).
+		FindOneAndUpdate(ctx, filter, update, opts).
+		Decode(&ticket)
+	if err == mongo.ErrNoDocuments {
+		// Figure out why the scan was refused
+		var currentTicket Ticket
+		err := lib.Datastore.Db.Collection(ticketsColName).
+			FindOne(ctx, bson.M{"_id": id}).
+			Decode(&currentTicket)
+		if err != nil {
+			return Ticket{}, err
+		}
+
+		if currentTicket.Voided {
+			return Ticket{}, ErrTicketVoided
+		} else if direction == ScanDirectionExit {
+			return Ticket{}, ErrNotInside
+		} else if direction == ScanDirectionEntry && currentTicket.Inside {
+			return Ticket{}, ErrAlreadyInside
+		}
+		return Ticket{}, ErrMaxScanCountExceeded
+	} else if err != nil {
+		return Ticket{}, err
+	}
+
+	return ticket, nil
+}
+
+// VoidTicket marks a ticket as unusable while keeping it around for the audit trail.
+// Guests can't come without their sponsor, so any guest tickets are voided along with it.
+func VoidTicket(ctx context.Context, id primitive.ObjectID, reason string, voidedBy string) error {
+	var ticket Ticket
+	err := lib.Datastore.Db.Collection(ticketsColName).FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id, "voided": bson.M{"$ne": true}},
+		bson.M{
+			"$set": bson.M{
+				"voided":     true,
+				"voidReason": reason,
+				"voidedBy":   voidedBy,
+				"voidTime":   time.Now(),
+				"inside":     false,
+			},
+			"$unset": bson.M{"seat": ""},
+		},
+	).Decode(&ticket)
+
+	// Figure out whether ticket doesn't exist or was already voided
+	if err == mongo.ErrNoDocuments {
+		exists, err := CheckIfTicketExists(ctx, bson.M{"_id": id})
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		return ErrTicketVoided
+	} else if err != nil {
+		return err
+	}
+
+	// Voided tickets don't take up a spot or a seat
+	if err := releaseTicketSpace(ctx, ticket.Event, ticket.Tier); err != nil {
+		return err
+	}
+	if err := freeSeat(ctx, ticket.Event, ticket.Seat); err != nil {
+		return err
+	}
+	return voidGuestTickets(ctx, id, "sponsor's ticket was voided: "+reason, voidedBy)
+}
+
+// RestoreTicket undoes voiding a ticket, as long as there's still a spot for it. Guest tickets
+// that were voided along with it are restored too while there's space for them, returning the
+// IDs of the ones that were.
+func RestoreTicket(ctx context.Context, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if err := restoreTicket(ctx, bson.M{"_id": id}); err != nil {
+		return []primitive.ObjectID{}, err
+	}
+
+	// Guests voided before this was tracked only have the reason to go by
+	cursor, err := lib.Datastore.Db.Collection(ticketsColName).Find(ctx, bson.M{
+		"sponsor_ticket": id,
+		"voided":         true,
+		"$or": bson.A{
+			bson.M{"voided_with_sponsor": true},
+			bson.M{"voidReason": bson.M{"$regex": "^sponsor's ticket was voided: "}},
+		},
+	})
+	if err != nil {
+		return []primitive.ObjectID{}, err
+	}
+	var guestTickets []Ticket
+	if err := cursor.All(ctx, &guestTickets); err != nil {
+		return []primitive.ObjectID{}, err
+	}
+
+	restoredGuests := []primitive.ObjectID{}
+	for _, guestTicket := range guestTickets {
+		err := restoreTicket(ctx, bson.M{"_id": guestTicket.ID})
+		if err == ErrEventFull || err == ErrTierFull {
+			// Rest of the guests can be restored one by one if space opens up
+			break
+		} else if err == ErrNoDocumentModified {
+			continue
+		} else if err != nil {
+			return restoredGuests, err
+		}
+		restoredGuests = append(restoredGuests, guestTicket.ID)
+	}
+
+	return restoredGuests, nil
+}
+
+// restoreTicket undoes voiding the ticket matching the filter, taking a spot for it first.
+func restoreTicket(ctx context.Context, filter bson.M) error {
+	// Figure out whether ticket doesn't exist or wasn't voided
+	var ticket Ticket
+	err := lib.Datastore.Db.Collection(ticketsColName).FindOne(ctx, filter).Decode(&ticket)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if !ticket.Voided {
+		return ErrNoDocumentModified
+	}
+
+	// Spot might have been given to someone else since it was voided
+	if err := reserveTicketSpace(ctx, ticket.Event, ticket.Tier); err != nil {
+		return err
+	}
+
+	res, err := lib.Datastore.Db.Collection(ticketsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": ticket.ID, "voided": true},
+		bson.M{
+			"$set":   bson.M{"voided": false},
+			"$unset": bson.M{"voidReason": "", "voidedBy": "", "voidTime": "", "voided_with_sponsor": ""},
+		},
+	)
+	if err == nil && res.MatchedCount == 0 {
+		// Restored by someone else in the meantime
+		err = ErrNoDocumentModified
+	}
+	if err != nil {
+		releaseTicketSpace(ctx, ticket.Event, ticket.Tier)
+		return err
+	}
+	return nil
+}
+
+// DeleteTicket permanently removes a ticket. Tickets should usually be voided instead,
+// since this loses the audit trail.
 func DeleteTicket(ctx context.Context, id primitive.ObjectID) error {
 	// Delete ticket
-	res, err := lib.Datastore.Db.Collection(ticketsColName).DeleteOne(ctx, bson.M{"_id": id})
+	var ticket Ticket
+	err := lib.Datastore.Db.Collection(ticketsColName).FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&ticket)
 
 	// Handle no document found
-	if err == nil {
-		if res.DeletedCount == 0 {
-			err = ErrNoDocumentModified
+	if err == mongo.ErrNoDocuments {
+		return ErrNoDocumentModified
+	} else if err != nil {
+		return err
+	}
+
+	// Voided tickets already gave up their spot and seat
+	if !ticket.Voided {
+		if err := freeSeat(ctx, ticket.Event, ticket.Seat); err != nil {
+			return err
 		}
+		return releaseTicketSpace(ctx, ticket.Event, ticket.Tier)
 	}
-	return err
+	return nil
 }
 
 func DeleteAllTicketsForEvent(ctx context.Context, eventID primitive.ObjectID) error {
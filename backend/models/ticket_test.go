@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// useTestDatastore points lib.Datastore at a throwaway database that gets dropped once the test is done.
+// The MongoDB instance comes from MONGODB_TEST_CONNECTION_STR, ex. one started with
+// `docker run --rm -p 27017:27017 mongo` (CI starts one too), and the test is skipped if it isn't set.
+func useTestDatastore(t *testing.T) {
+	t.Helper()
+
+	connectionStr := os.Getenv("MONGODB_TEST_CONNECTION_STR")
+	if connectionStr == "" {
+		t.Skip("MONGODB_TEST_CONNECTION_STR not set, skipping test that needs MongoDB")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionStr))
+	if err != nil {
+		t.Fatalf("could not connect to test MongoDB: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("could not reach test MongoDB: %v", err)
+	}
+
+	// Each test gets its own database so it never touches real data or other tests
+	db := client.Database("test_" + primitive.NewObjectID().Hex())
+	previousDatastore := lib.Datastore
+	lib.Datastore = &lib.MongoDatastore{Db: db}
+
+	t.Cleanup(func() {
+		lib.Datastore = previousDatastore
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+}
+
+// insertTestTicket makes a ticket that doesn't belong to any real user or event.
+func insertTestTicket(t *testing.T, maxScanCount int, inside bool) primitive.ObjectID {
+	t.Helper()
+
+	res, err := lib.Datastore.Db.Collection(ticketsColName).InsertOne(context.Background(), Ticket{
+		Owner:        "test-" + primitive.NewObjectID().Hex(),
+		Event:        primitive.NewObjectID(),
+		Timestamp:    time.Now(),
+		MaxScanCount: maxScanCount,
+		Inside:       inside,
+		CustomFields: map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("could not create test ticket: %v", err)
+	}
+	return res.InsertedID.(primitive.ObjectID)
+}
+
+func TestScanTicketConcurrent(t *testing.T) {
+	useTestDatastore(t)
+
+	const workers = 50
+	testCases := []struct {
+		name          string
+		direction     string
+		maxScanCount  int
+		startInside   bool
+		wantSuccesses int
+		wantRejectErr error
+		wantScanCount int
+		wantEndInside bool
+	}{
+		{"no direction, max 1", "", 1, false, 1, ErrMaxScanCountExceeded, 1, false},
+		{"no direction, max 3", "", 3, false, 3, ErrMaxScanCountExceeded, 3, false},
+		{"no direction, max 10", "", 10, false, 10, ErrMaxScanCountExceeded, 10, false},
+		// Only one entry can go through while the ticket is inside, no matter how many scans are left
+		{"entry, max 10", ScanDirectionEntry, 10, false, 1, ErrAlreadyInside, 1, true},
+		{"entry, unlimited", ScanDirectionEntry, 0, false, 1, ErrAlreadyInside, 1, true},
+		{"entry, already inside", ScanDirectionEntry, 10, true, 0, ErrAlreadyInside, 0, true},
+		// Exits don't use up scans
+		{"exit", ScanDirectionExit, 1, true, 1, ErrNotInside, 0, false},
+		{"exit, not inside", ScanDirectionExit, 1, false, 0, ErrNotInside, 0, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ticketID := insertTestTicket(t, testCase.maxScanCount, testCase.startInside)
+
+			// Release all workers at once to maximize contention
+			var waitGroup sync.WaitGroup
+			errs := make(chan error, workers)
+			start := make(chan struct{})
+			for i := 0; i < workers; i++ {
+				waitGroup.Add(1)
+				go func() {
+					defer waitGroup.Done()
+					<-start
+
+					_, err := ScanTicket(context.Background(), ticketID, time.Now(), testCase.direction)
+					errs <- err
+				}()
+			}
+			close(start)
+			waitGroup.Wait()
+			close(errs)
+
+			successfulScans := 0
+			rejectedScans := 0
+			for err := range errs {
+				if err == nil {
+					successfulScans++
+				} else if err == testCase.wantRejectErr {
+					rejectedScans++
+				} else {
+					t.Errorf("unexpected scan error: %v", err)
+				}
+			}
+
+			if successfulScans != testCase.wantSuccesses {
+				t.Errorf("%d scans went through, wanted %d", successfulScans, testCase.wantSuccesses)
+			}
+			if rejectedScans != workers-testCase.wantSuccesses {
+				t.Errorf("%d scans were rejected, wanted %d", rejectedScans, workers-testCase.wantSuccesses)
+			}
+
+			// The stored ticket has to match what was handed out
+			var ticket Ticket
+			err := lib.Datastore.Db.Collection(ticketsColName).FindOne(context.Background(), bson.M{"_id": ticketID}).Decode(&ticket)
+			if err != nil {
+				t.Fatalf("could not fetch test ticket: %v", err)
+			}
+			if ticket.ScanCount != testCase.wantScanCount {
+				t.Errorf("stored scan count is %d, wanted %d", ticket.ScanCount, testCase.wantScanCount)
+			}
+			if ticket.Inside != testCase.wantEndInside {
+				t.Errorf("stored inside is %t, wanted %t", ticket.Inside, testCase.wantEndInside)
+			}
+		})
+	}
+}
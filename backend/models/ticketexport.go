@@ -0,0 +1,309 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TicketExportStatusIssued = "issued"
+	TicketExportStatusQueued = "queued" // Student hasn't signed up to claim their ticket yet
+	TicketExportStatusVoided = "voided"
+
+	// ticketExportCustomFieldPrefix comes before the name of a custom field in its column key
+	ticketExportCustomFieldPrefix = "custom."
+)
+
+// TicketExportColumn is a column that can be included in an export of an event's tickets.
+type TicketExportColumn struct {
+	Key    string `json:"key"`
+	Header string `json:"header"`
+}
+
+func (column *TicketExportColumn) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// TicketExportOptions changes which tickets are included in an export.
+type TicketExportOptions struct {
+	IncludeQueued bool
+	IncludeVoided bool
+}
+
+// ticketExportStatusColumn is always the first column, so that queued tickets can be told apart.
+var ticketExportStatusColumn = TicketExportColumn{Key: "status", Header: "Status"}
+
+// ticketExportBaseColumns are the columns every event has, in the order they're exported.
+var ticketExportBaseColumns = []TicketExportColumn{
+	{Key: "ownerName", Header: "Name"},
+	{Key: "studentNumber", Header: "Student Number"},
+	{Key: "guestName", Header: "Guest Name"},
+	{Key: "tier", Header: "Tier"},
+	{Key: "seat", Header: "Seat"},
+	{Key: "scanCount", Header: "Scan Count"},
+	{Key: "maxScanCount", Header: "Max Scan Count"},
+	{Key: "lastScanTime", Header: "Last Scan Time"},
+	{Key: "inside", Header: "Inside"},
+	{Key: "issuedTime", Header: "Issued Time"},
+	{Key: "ticketID", Header: "Ticket ID"},
+}
+
+// GetTicketExportColumns lists the columns that can be exported for an event, including one
+// for each custom field named after its display name in the schema.
+func GetTicketExportColumns(event Event) []TicketExportColumn {
+	columns := append([]TicketExportColumn{}, ticketExportBaseColumns...)
+
+	properties, _ := event.RawCustomFieldsSchema["properties"].(map[string]interface{})
+	customFieldKeys := []string{}
+	for key := range properties {
+		customFieldKeys = append(customFieldKeys, key)
+	}
+	sort.Strings(customFieldKeys)
+
+	for _, key := range customFieldKeys {
+		header := key
+		if property, ok := properties[key].(map[string]interface{}); ok {
+			if displayName, ok := property["displayName"].(string); ok && displayName != "" {
+				header = displayName
+			}
+		}
+		columns = append(columns, TicketExportColumn{Key: ticketExportCustomFieldPrefix + key, Header: header})
+	}
+
+	return columns
+}
+
+// GetTicketExportColumnsByKey picks out columns by their keys, keeping the order they're given
+// in. The status column is always added first. No keys means every column.
+func GetTicketExportColumnsByKey(event Event, keys []string) ([]TicketExportColumn, error) {
+	available := GetTicketExportColumns(event)
+	if len(keys) == 0 {
+		return append([]TicketExportColumn{ticketExportStatusColumn}, available...), nil
+	}
+
+	columnsByKey := map[string]TicketExportColumn{}
+	for _, column := range available {
+		columnsByKey[column.Key] = column
+	}
+
+	columns := []TicketExportColumn{ticketExportStatusColumn}
+	for _, key := range keys {
+		if key == ticketExportStatusColumn.Key {
+			continue
+		}
+		column, ok := columnsByKey[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s", key)
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// formatTicketExportTime formats a time for a spreadsheet, leaving unset times empty.
+func formatTicketExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatTicketExportBool formats a yes / no value for a spreadsheet.
+func formatTicketExportBool(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// getTicketExportCustomField gets a custom field's value for a column, if the column is one.
+func getTicketExportCustomField(key string, customFields map[string]interface{}) (interface{}, bool) {
+	if !strings.HasPrefix(key, ticketExportCustomFieldPrefix) {
+		return nil, false
+	}
+	value, ok := customFields[strings.TrimPrefix(key, ticketExportCustomFieldPrefix)]
+	if !ok || value == nil {
+		return "", true
+	}
+	return value, true
+}
+
+func ticketExportRow(event Event, ticket Ticket, columns []TicketExportColumn) []interface{} {
+	row := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if value, ok := getTicketExportCustomField(column.Key, ticket.CustomFields); ok {
+			row[i] = value
+			continue
+		}
+
+		switch column.Key {
+		case "status":
+			row[i] = TicketExportStatusIssued
+			if ticket.Voided {
+				row[i] = TicketExportStatusVoided
+			}
+		case "ownerName":
+			row[i] = ticket.OwnerData.FullName
+		case "studentNumber":
+			row[i] = ticket.OwnerData.StudentNumber
+		case "guestName":
+			row[i] = ""
+			if ticket.Guest != nil {
+				row[i] = ticket.Guest.Name
+			}
+		case "tier":
+			tier, _ := event.GetTicketTier(ticket.Tier)
+			row[i] = tier.Name
+		case "seat":
+			row[i] = ""
+			if ticket.Seat != nil {
+				row[i] = ticket.Seat.String()
+			}
+		case "scanCount":
+			row[i] = ticket.ScanCount
+		case "maxScanCount":
+			row[i] = ticket.MaxScanCount
+		case "lastScanTime":
+			row[i] = formatTicketExportTime(ticket.LastScanTimestamp)
+		case "inside":
+			row[i] = formatTicketExportBool(ticket.Inside)
+		case "issuedTime":
+			row[i] = formatTicketExportTime(ticket.Timestamp)
+		case "ticketID":
+			row[i] = ticket.ID.Hex()
+		default:
+			row[i] = ""
+		}
+	}
+	return row
+}
+
+func queuedTicketExportRow(event Event, queuedTicket QueuedTicket, columns []TicketExportColumn) []interface{} {
+	row := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if value, ok := getTicketExportCustomField(column.Key, queuedTicket.CustomFields); ok {
+			row[i] = value
+			continue
+		}
+
+		// Anything to do with scanning doesn't apply until the ticket is claimed
+		switch column.Key {
+		case "status":
+			row[i] = TicketExportStatusQueued
+		case "ownerName":
+			row[i] = queuedTicket.FullNameUpdate
+		case "studentNumber":
+			row[i] = queuedTicket.StudentNumber
+		case "tier":
+			tier, _ := event.GetTicketTier(queuedTicket.Tier)
+			row[i] = tier.Name
+		case "maxScanCount":
+			row[i] = queuedTicket.MaxScanCount
+		case "issuedTime":
+			row[i] = formatTicketExportTime(queuedTicket.Timestamp)
+		default:
+			row[i] = ""
+		}
+	}
+	return row
+}
+
+// ExportEventTickets writes a row for each of an event's tickets, followed by its queued
+// tickets if asked for. Tickets are read from the DB one at a time so that exports of big
+// events don't have to be held in memory.
+func ExportEventTickets(
+	ctx context.Context,
+	event Event,
+	columns []TicketExportColumn,
+	opts TicketExportOptions,
+	writeRow func([]interface{}) error,
+) error {
+	filter := bson.M{"event": event.ID}
+	if !opts.IncludeVoided {
+		filter["voided"] = bson.M{"$ne": true}
+	}
+
+	pipeline := mongo.Pipeline{
+		{
+			{Key: "$match", Value: filter},
+		},
+		{
+			{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "users"},
+				{Key: "localField", Value: "owner"},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: "ownerData"},
+			},
+			},
+		},
+		{
+			{Key: "$unwind", Value: bson.D{
+				{Key: "path", Value: "$ownerData"},
+				{Key: "preserveNullAndEmptyArrays", Value: true},
+			}},
+		},
+		{
+			{Key: "$sort", Value: bson.D{
+				{Key: "ownerData.full_name", Value: 1},
+				{Key: "timestamp", Value: 1},
+			}},
+		},
+	}
+
+	// Stream tickets out as they're read
+	cursor, err := lib.Datastore.Db.Collection(ticketsColName).Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var ticket Ticket
+		if err := cursor.Decode(&ticket); err != nil {
+			return err
+		}
+		if err := writeRow(ticketExportRow(event, ticket, columns)); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if !opts.IncludeQueued {
+		return nil
+	}
+
+	// Queued tickets go after so they're easy to pick out
+	queuedCursor, err := lib.Datastore.Db.Collection(queuedTicketsColName).Find(
+		ctx,
+		bson.M{"event_id": event.ID},
+		options.Find().SetSort(bson.D{{Key: "student_number", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	defer queuedCursor.Close(ctx)
+
+	for queuedCursor.Next(ctx) {
+		var queuedTicket QueuedTicket
+		if err := queuedCursor.Decode(&queuedTicket); err != nil {
+			return err
+		}
+		if err := writeRow(queuedTicketExportRow(event, queuedTicket, columns)); err != nil {
+			return err
+		}
+	}
+
+	return queuedCursor.Err()
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TicketScan is both the result of a scan attempt and its record in the scan history.
+// Ticket and user data are only filled in when returning a fresh scan, they aren't stored.
+type TicketScan struct {
+	ID              primitive.ObjectID `json:"id"              bson:"_id,omitempty"`
+	TicketID        primitive.ObjectID `json:"ticketID"        bson:"ticket"`
+	EventID         primitive.ObjectID `json:"eventID"         bson:"event"`
+	Index           int                `json:"index"           bson:"index"`
+	Timestamp       time.Time          `json:"timestamp"       bson:"timestamp"`
+	TicketData      Ticket             `json:"ticketData"      bson:"-"`
+	UserData        User               `json:"userData"        bson:"-"`
+	Processed       bool               `json:"processed"       bson:"processed"`
+	NoProcessReason string             `json:"noProcessReason" bson:"noProcessReason"`
+	ScannerUID      string             `json:"scannerUID"      bson:"scannerUID"`
+	DeviceLabel     string             `json:"deviceLabel"     bson:"deviceLabel"`
+	Offline         bool               `json:"offline"         bson:"offline"`   // Whether scan was made offline and synced later
+	Direction       string             `json:"direction"       bson:"direction"` // "entry", "exit", or empty if not tracked
+	StationID       primitive.ObjectID `json:"stationID"       bson:"station,omitempty"`
+	Overridden      bool               `json:"overridden"      bson:"overridden"`               // Whether an admin let this scan through despite it being rejected
+	OverrideReason  string             `json:"overrideReason"  bson:"overrideReason,omitempty"` // Reason the scan would have been rejected for
+}
+
+// Directions a ticket can be scanned in, used to track who is currently inside
+const (
+	ScanDirectionEntry = "entry"
+	ScanDirectionExit  = "exit"
+)
+
+// Reasons given when a ticket scan is not processed
+const (
+	TicketScanReasonMaxScanCountExceeded = "max scan count exceeded"
+	TicketScanReasonNotForEvent          = "ticket is not for this event"
+	TicketScanReasonAlreadyInside        = "ticket holder is already inside"
+	TicketScanReasonNotInside            = "ticket holder is not currently inside"
+	TicketScanReasonStationNotActive     = "scan station was not active"
+	TicketScanReasonTooEarly             = "too early"
+	TicketScanReasonEventEnded           = "event ended"
+	TicketScanReasonVoided               = "ticket has been voided"
+)
+
+// GetTicketScanReasonForError converts an error from ScanTicket into the reason shown
+// to the scanner, returning false if the error isn't a normal scan rejection.
+func GetTicketScanReasonForError(err error) (string, bool) {
+	switch err {
+	case ErrMaxScanCountExceeded:
+		return TicketScanReasonMaxScanCountExceeded, true
+	case ErrAlreadyInside:
+		return TicketScanReasonAlreadyInside, true
+	case ErrNotInside:
+		return TicketScanReasonNotInside, true
+	case ErrScanTooEarly:
+		return TicketScanReasonTooEarly, true
+	case ErrEventEnded:
+		return TicketScanReasonEventEnded, true
+	case ErrTicketVoided:
+		return TicketScanReasonVoided, true
+	default:
+		return "", false
+	}
+}
+
+func (scan *TicketScan) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func CreateTicketScanIndices(ctx context.Context) error {
+	// Create appropriate indices
+	ticketTimestampIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "ticket", Value: 1},
+			{Key: "timestamp", Value: -1},
+		},
+	}
+	eventTimestampIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+			{Key: "timestamp", Value: -1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(ticketScansColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				ticketTimestampIdxModel,
+				eventTimestampIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+// GetTicketScans fetches one page of scan records matching the filter, newest first,
+// along with the total number of matching records.
+func GetTicketScans(ctx context.Context, filter bson.M, page int64, pageSize int64) ([]TicketScan, int64, error) {
+	// Get total first so clients know how many pages exist
+	total, err := lib.Datastore.Db.Collection(ticketScansColName).CountDocuments(ctx, filter)
+	if err != nil {
+		return []TicketScan{}, 0, err
+	}
+
+	// Try to get data from MongoDB
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetSkip((page - 1) * pageSize).
+		SetLimit(pageSize)
+	cursor, err := lib.Datastore.Db.Collection(ticketScansColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []TicketScan{}, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into TicketScan structs
+	var scans []TicketScan
+	if err := cursor.All(ctx, &scans); err != nil {
+		return []TicketScan{}, 0, err
+	}
+
+	return scans, total, nil
+}
+
+// GetLatestProcessedTicketScan fetches the most recent scan of a ticket that went through.
+func GetLatestProcessedTicketScan(ctx context.Context, ticketID primitive.ObjectID) (TicketScan, error) {
+	// Try to fetch data from DB
+	var scan TicketScan
+	opts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	err := lib.Datastore.Db.Collection(ticketScansColName).
+		FindOne(ctx, bson.M{"ticket": ticketID, "processed": true}, opts).
+		Decode(&scan)
+
+	// No error handling needed (scan & err will default to empty struct / nil)
+	return scan, err
+}
+
+func CheckIfTicketScanExists(ctx context.Context, filter bson.M) (bool, error) {
+	// Directly return results from DB
+	count, err := lib.Datastore.Db.Collection(ticketScansColName).CountDocuments(ctx, filter)
+	return count > 0, err
+}
+
+func CreateTicketScan(ctx context.Context, scan TicketScan) (primitive.ObjectID, error) {
+	// Try to add document
+	res, err := lib.Datastore.Db.Collection(ticketScansColName).InsertOne(ctx, scan)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Return object ID
+	return res.InsertedID.(primitive.ObjectID), err
+}
+
+func DeleteAllTicketScansForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all scan records for event
+	_, err := lib.Datastore.Db.Collection(ticketScansColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
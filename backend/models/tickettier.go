@@ -0,0 +1,315 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TicketTier is a type of ticket for an event, ex. "VIP", "Grade 12", or "Staff".
+type TicketTier struct {
+	ID                 primitive.ObjectID `json:"id"               bson:"_id"`
+	Name               string             `json:"name"             bson:"name"`
+	Price              int64              `json:"price"            bson:"price"`                    // In cents
+	Capacity           int                `json:"capacity"         bson:"capacity"`                 // Max number of tickets & queued tickets in this tier, 0 means unlimited
+	IssuedCount        int                `json:"-"                bson:"issued_count"`             // Spots taken up in this tier, same as the event's count
+	MaxScanCount       int                `json:"max_scan_count"   bson:"max_scan_count"`           // Default max scan count for tickets in this tier
+	Hidden             bool               `json:"hidden"           bson:"hidden"`                   // Hidden tiers are only shown to admins (ex. staff tickets)
+	SaleStartTimestamp time.Time          `json:"sale_start_timestamp" bson:"sale_start_timestamp"` // Zero means no start limit
+	SaleEndTimestamp   time.Time          `json:"sale_end_timestamp"   bson:"sale_end_timestamp"`   // Zero means no end limit
+}
+
+// TicketTierCount is the number of tickets issued in a tier. Tickets without a tier have an empty tier ID.
+type TicketTierCount struct {
+	TierID        primitive.ObjectID `json:"tierID"        bson:"_id"`
+	Name          string             `json:"name"          bson:"name"`
+	Tickets       int64              `json:"tickets"       bson:"tickets"` // Not counting voided tickets
+	QueuedTickets int64              `json:"queuedTickets" bson:"queuedTickets"`
+}
+
+func (tier *TicketTier) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (count *TicketTierCount) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// IsOnSale checks whether tickets in the tier can be sold at the given time.
+func (tier TicketTier) IsOnSale(t time.Time) bool {
+	if !tier.SaleStartTimestamp.IsZero() && t.Before(tier.SaleStartTimestamp) {
+		return false
+	}
+	if !tier.SaleEndTimestamp.IsZero() && t.After(tier.SaleEndTimestamp) {
+		return false
+	}
+	return true
+}
+
+// GetTicketTier finds one of the event's ticket tiers by its ID.
+func (event Event) GetTicketTier(id primitive.ObjectID) (TicketTier, bool) {
+	for _, tier := range event.TicketTiers {
+		if tier.ID == id {
+			return tier, true
+		}
+	}
+	return TicketTier{}, false
+}
+
+// VisibleTicketTiers returns the tiers that non-admins are allowed to see.
+func (event Event) VisibleTicketTiers() []TicketTier {
+	tiers := []TicketTier{}
+	for _, tier := range event.TicketTiers {
+		if !tier.Hidden {
+			tiers = append(tiers, tier)
+		}
+	}
+	return tiers
+}
+
+func CreateTicketTier(ctx context.Context, eventID primitive.ObjectID, tier TicketTier) (primitive.ObjectID, error) {
+	// Check if event exists
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrNotFound
+	} else if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Names need to be unique so that tiers can be told apart
+	for _, existingTier := range event.TicketTiers {
+		if existingTier.Name == tier.Name {
+			return primitive.NilObjectID, ErrAlreadyExists
+		}
+	}
+
+	// Tiers are stored inside the event, so they need their own IDs
+	tier.ID = primitive.NewObjectID()
+	_, err = lib.Datastore.Db.Collection(eventsColName).
+		UpdateByID(ctx, eventID, bson.M{"$push": bson.M{"ticket_tiers": tier}})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return tier.ID, nil
+}
+
+func UpdateTicketTier(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID, updates map[string]interface{}) error {
+	UPDATABLE_KEYS := map[string]bool{
+		"name":                 true,
+		"price":                true,
+		"capacity":             true,
+		"max_scan_count":       true,
+		"hidden":               true,
+		"sale_start_timestamp": true,
+		"sale_end_timestamp":   true,
+	}
+
+	// Convert the string/interface map to BSON updates on the matched tier
+	bsonUpdates := bson.D{}
+	for key, val := range updates {
+		// Don't allow other keys to be updated
+		if !UPDATABLE_KEYS[key] {
+			return ErrEditNotAllowed
+		}
+
+		if key == "sale_start_timestamp" || key == "sale_end_timestamp" {
+			// Convert timestamps to time.Time objects, empty string removes the limit
+			timestampStr, ok := val.(string)
+			if !ok {
+				log.Warn().Any("val", val).Str("key", key).Msg("could not parse timestamp as string")
+				return fmt.Errorf("could not parse timestamp as string")
+			}
+			timestamp := time.Time{}
+			if timestampStr != "" {
+				var err error
+				timestamp, err = time.Parse(time.RFC3339, timestampStr)
+				if err != nil {
+					log.Warn().Err(err).Str("key", key).Msg("could not parse timestamp as RFC3339")
+					return errors.Join(fmt.Errorf("could not parse timestamp as RFC3339"), err)
+				}
+			}
+			val = timestamp
+		} else if key == "price" || key == "capacity" || key == "max_scan_count" {
+			// JSON numbers come in as floats, but these are all whole numbers
+			num, ok := val.(float64)
+			if !ok || num < 0 || num != float64(int64(num)) {
+				log.Warn().Any("val", val).Str("key", key).Msg("value is not a non-negative whole number")
+				return fmt.Errorf("%s must be a non-negative whole number", key)
+			}
+			if key == "price" {
+				val = int64(num)
+			} else {
+				val = int(num)
+			}
+		}
+
+		bsonUpdates = append(bsonUpdates, bson.E{Key: "ticket_tiers.$." + key, Value: val})
+	}
+
+	// Make sure a rename doesn't clash with another tier
+	if name, ok := updates["name"]; ok {
+		nameTaken, err := lib.Datastore.Db.Collection(eventsColName).CountDocuments(ctx, bson.M{
+			"_id":          eventID,
+			"ticket_tiers": bson.M{"$elemMatch": bson.M{"name": name, "_id": bson.M{"$ne": tierID}}},
+		})
+		if err != nil {
+			return err
+		}
+		if nameTaken > 0 {
+			return ErrAlreadyExists
+		}
+	}
+
+	// Try to update tier in DB
+	res, err := lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": eventID, "ticket_tiers._id": tierID},
+		bson.D{{Key: "$set", Value: bsonUpdates}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	if res.ModifiedCount == 0 {
+		return ErrNoDocumentModified
+	}
+	return nil
+}
+
+// DeleteTicketTier removes a tier from an event. Tiers that still have tickets can't be deleted.
+func DeleteTicketTier(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID) error {
+	count, err := GetTierIssuedTicketCount(ctx, eventID, tierID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTierInUse
+	}
+
+	res, err := lib.Datastore.Db.Collection(eventsColName).UpdateOne(
+		ctx,
+		bson.M{"_id": eventID, "ticket_tiers._id": tierID},
+		bson.M{"$pull": bson.M{"ticket_tiers": bson.M{"_id": tierID}}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetTierIssuedTicketCount counts the tickets that take up space in a tier, which includes
+// queued tickets and unpaid orders that are holding a spot, but not voided tickets.
+func GetTierIssuedTicketCount(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID) (int64, error) {
+	ticketCount, err := lib.Datastore.Db.Collection(ticketsColName).
+		CountDocuments(ctx, bson.M{"event": eventID, "tier": tierID, "voided": bson.M{"$ne": true}})
+	if err != nil {
+		return -1, err
+	}
+
+	queuedTicketCount, err := lib.Datastore.Db.Collection(queuedTicketsColName).
+		CountDocuments(ctx, bson.M{"event_id": eventID, "tier": tierID})
+	if err != nil {
+		return -1, err
+	}
+
+	heldOrdersInTierFilter := heldOrdersFilter(eventID)
+	heldOrdersInTierFilter["tier"] = tierID
+	heldOrderCount, err := lib.Datastore.Db.Collection(ordersColName).
+		CountDocuments(ctx, heldOrdersInTierFilter)
+	if err != nil {
+		return -1, err
+	}
+
+	return ticketCount + queuedTicketCount + heldOrderCount, nil
+}
+
+// checkTicketTier makes sure a ticket's tier belongs to the event. Tickets without a tier are
+// always allowed.
+func checkTicketTier(event Event, tierID primitive.ObjectID) error {
+	if tierID.IsZero() {
+		return nil
+	}
+
+	if _, ok := event.GetTicketTier(tierID); !ok {
+		return ErrTierNotFound
+	}
+	return nil
+}
+
+// GetTicketTierCounts counts the tickets issued in each of an event's tiers, including
+// tiers that don't have any tickets yet.
+func GetTicketTierCounts(ctx context.Context, event Event) ([]TicketTierCount, error) {
+	countByTier := func(colName string, filter bson.M) (map[primitive.ObjectID]int64, error) {
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$tier"},
+				{Key: "count", Value: bson.M{"$sum": 1}},
+			}}},
+		}
+
+		cursor, err := lib.Datastore.Db.Collection(colName).Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+
+		var results []struct {
+			TierID primitive.ObjectID `bson:"_id"`
+			Count  int64              `bson:"count"`
+		}
+		if err := cursor.All(ctx, &results); err != nil {
+			return nil, err
+		}
+
+		counts := map[primitive.ObjectID]int64{}
+		for _, result := range results {
+			counts[result.TierID] += result.Count
+		}
+		return counts, nil
+	}
+
+	ticketCounts, err := countByTier(ticketsColName, bson.M{"event": event.ID, "voided": bson.M{"$ne": true}})
+	if err != nil {
+		return []TicketTierCount{}, err
+	}
+	queuedTicketCounts, err := countByTier(queuedTicketsColName, bson.M{"event_id": event.ID})
+	if err != nil {
+		return []TicketTierCount{}, err
+	}
+
+	counts := []TicketTierCount{}
+	for _, tier := range event.TicketTiers {
+		counts = append(counts, TicketTierCount{
+			TierID:        tier.ID,
+			Name:          tier.Name,
+			Tickets:       ticketCounts[tier.ID],
+			QueuedTickets: queuedTicketCounts[tier.ID],
+		})
+	}
+
+	// Tickets made before tiers existed, or without one
+	if ticketCounts[primitive.NilObjectID] > 0 || queuedTicketCounts[primitive.NilObjectID] > 0 {
+		counts = append(counts, TicketTierCount{
+			TierID:        primitive.NilObjectID,
+			Tickets:       ticketCounts[primitive.NilObjectID],
+			QueuedTickets: queuedTicketCounts[primitive.NilObjectID],
+		})
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,355 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TicketTransfer is a request from a ticket's owner to give it to another student.
+type TicketTransfer struct {
+	ID                primitive.ObjectID `json:"id"                bson:"_id,omitempty"`
+	TicketID          primitive.ObjectID `json:"ticketID"          bson:"ticket"`
+	EventID           primitive.ObjectID `json:"eventID"           bson:"event"`
+	FromUID           string             `json:"fromUID"           bson:"from_uid"`
+	ToStudentNumber   string             `json:"toStudentNumber"   bson:"to_student_number"`
+	ToUID             string             `json:"toUID"             bson:"to_uid"` // Empty if recipient hasn't signed up yet
+	Status            string             `json:"status"            bson:"status"`
+	FailureReason     string             `json:"failureReason"     bson:"failure_reason,omitempty"`
+	QueuedTicketID    primitive.ObjectID `json:"queuedTicketID"    bson:"queued_ticket,omitempty"` // Set if recipient gets a queued ticket
+	CreatedTimestamp  time.Time          `json:"createdTime"       bson:"created_time"`
+	ResolvedTimestamp time.Time          `json:"resolvedTime"      bson:"resolved_time"`
+	ResolvedBy        string             `json:"resolvedBy"        bson:"resolved_by"` // UID of whoever accepted / declined / approved / etc.
+}
+
+// Statuses a ticket transfer can have
+const (
+	TicketTransferStatusPending          = "pending"           // Waiting for recipient to accept
+	TicketTransferStatusAwaitingApproval = "awaiting_approval" // Waiting for an admin to approve
+	TicketTransferStatusCompleted        = "completed"
+	TicketTransferStatusDeclined         = "declined"  // Recipient didn't want it
+	TicketTransferStatusCancelled        = "cancelled" // Owner changed their mind
+	TicketTransferStatusRejected         = "rejected"  // Admin didn't approve it
+	TicketTransferStatusFailed           = "failed"    // Ticket couldn't be transferred anymore once accepted / approved
+)
+
+func (transfer *TicketTransfer) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// IsOpen checks whether the transfer is still waiting on someone.
+func (transfer TicketTransfer) IsOpen() bool {
+	return transfer.Status == TicketTransferStatusPending || transfer.Status == TicketTransferStatusAwaitingApproval
+}
+
+func CreateTicketTransferIndices(ctx context.Context) error {
+	// Create appropriate indices
+	ticketIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "ticket", Value: 1},
+		},
+	}
+	fromIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "from_uid", Value: 1},
+		},
+	}
+	toIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "to_uid", Value: 1},
+		},
+	}
+	statusIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "status", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(transfersColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				ticketIdxModel,
+				fromIdxModel,
+				toIdxModel,
+				statusIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+func GetTicketTransfers(ctx context.Context, filter bson.M) ([]TicketTransfer, error) {
+	// Newest first
+	opts := options.Find().SetSort(bson.D{{Key: "created_time", Value: -1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(transfersColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []TicketTransfer{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into TicketTransfer structs
+	var transfers []TicketTransfer
+	if err := cursor.All(ctx, &transfers); err != nil {
+		return []TicketTransfer{}, err
+	}
+
+	return transfers, nil
+}
+
+func GetTicketTransfer(ctx context.Context, id primitive.ObjectID) (TicketTransfer, error) {
+	// Try to fetch data from DB
+	var transfer TicketTransfer
+	err := lib.Datastore.Db.Collection(transfersColName).
+		FindOne(ctx, bson.M{"_id": id}).
+		Decode(&transfer)
+
+	// No error handling needed (transfer & err will default to empty struct / nil)
+	return transfer, err
+}
+
+func CreateTicketTransfer(ctx context.Context, transfer TicketTransfer) (primitive.ObjectID, error) {
+	// Only one open transfer is allowed per ticket
+	openExists, err := lib.Datastore.Db.Collection(transfersColName).CountDocuments(ctx, bson.M{
+		"ticket": transfer.TicketID,
+		"status": bson.M{"$in": bson.A{TicketTransferStatusPending, TicketTransferStatusAwaitingApproval}},
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if openExists > 0 {
+		return primitive.NilObjectID, ErrAlreadyExists
+	}
+
+	// Try to add document
+	res, err := lib.Datastore.Db.Collection(transfersColName).InsertOne(ctx, transfer)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Return object ID
+	return res.InsertedID.(primitive.ObjectID), err
+}
+
+// UpdateTicketTransferStatus moves a transfer to a new status, but only if it's currently in
+// one of the given statuses. This stops things like a transfer being accepted after the owner
+// already cancelled it.
+func UpdateTicketTransferStatus(
+	ctx context.Context,
+	id primitive.ObjectID,
+	fromStatuses []string,
+	toStatus string,
+	resolvedBy string,
+) error {
+	updates := bson.M{"status": toStatus, "resolved_by": resolvedBy}
+	if toStatus != TicketTransferStatusAwaitingApproval {
+		updates["resolved_time"] = time.Now()
+	}
+
+	res, err := lib.Datastore.Db.Collection(transfersColName).UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": bson.M{"$in": fromStatuses}},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNoDocumentModified
+	}
+	return nil
+}
+
+// CompleteTicketTransfer moves the ticket over to the recipient once a transfer has been
+// accepted and approved. Recipients who haven't signed up yet get a queued ticket instead,
+// and the original ticket is voided. Guest tickets go along with their sponsor's ticket, or
+// are voided if the recipient hasn't signed up yet. Only unused tickets still owned by the sender can be
+// transferred, otherwise the transfer is marked as failed and ErrTransferNotAllowed is returned.
+// The transfer should already have been claimed with UpdateTicketTransferStatus so that it can't
+// be completed twice.
+func CompleteTicketTransfer(ctx context.Context, transfer TicketTransfer, resolvedBy string) (TicketTransfer, error) {
+	ownerChange := TicketOwnerChange{
+		PreviousOwner: transfer.FromUID,
+		NewOwner:      transfer.ToUID,
+		TransferID:    transfer.ID,
+		Timestamp:     time.Now(),
+	}
+
+	// Ticket has to be in the same state as when the transfer was made, guest tickets
+	// can't be transferred on their own
+	transferableFilter := bson.M{
+		"_id":       transfer.TicketID,
+		"owner":     transfer.FromUID,
+		"voided":    bson.M{"$ne": true},
+		"scanCount": 0,
+		"guest":     bson.M{"$exists": false},
+	}
+
+	var err error
+	if transfer.ToUID != "" {
+		err = transferTicketToUser(ctx, transfer, transferableFilter, ownerChange)
+	} else {
+		transfer.QueuedTicketID, err = transferTicketToQueue(ctx, transfer, transferableFilter, ownerChange)
+	}
+
+	if err == ErrTransferNotAllowed {
+		transfer.Status = TicketTransferStatusFailed
+		transfer.FailureReason = "ticket was used, voided, or changed owners before the transfer went through"
+	} else if err == ErrAlreadyExists {
+		transfer.Status = TicketTransferStatusFailed
+		transfer.FailureReason = "recipient already has a ticket for this event"
+	} else if err != nil {
+		transfer.Status = TicketTransferStatusFailed
+		transfer.FailureReason = "could not transfer ticket"
+	} else {
+		transfer.Status = TicketTransferStatusCompleted
+	}
+	transfer.ResolvedBy = resolvedBy
+	transfer.ResolvedTimestamp = time.Now()
+
+	// Save result of transfer
+	updates := bson.M{
+		"status":         transfer.Status,
+		"failure_reason": transfer.FailureReason,
+		"resolved_by":    transfer.ResolvedBy,
+		"resolved_time":  transfer.ResolvedTimestamp,
+	}
+	if !transfer.QueuedTicketID.IsZero() {
+		updates["queued_ticket"] = transfer.QueuedTicketID
+	}
+	_, updateErr := lib.Datastore.Db.Collection(transfersColName).UpdateByID(ctx, transfer.ID, bson.M{"$set": updates})
+	if updateErr != nil {
+		return transfer, updateErr
+	}
+
+	return transfer, err
+}
+
+func transferTicketToUser(
+	ctx context.Context,
+	transfer TicketTransfer,
+	transferableFilter bson.M,
+	ownerChange TicketOwnerChange,
+) error {
+	// Recipient can't end up with two tickets to the same event
+	_, err := SearchForTicket(ctx, transfer.EventID, transfer.ToUID)
+	if err == nil {
+		return ErrAlreadyExists
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	// Swap owner in one operation so the ticket can't change in between
+	res, err := lib.Datastore.Db.Collection(ticketsColName).UpdateOne(
+		ctx,
+		transferableFilter,
+		bson.M{
+			"$set":  bson.M{"owner": transfer.ToUID},
+			"$push": bson.M{"ownerHistory": ownerChange},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrTransferNotAllowed
+	}
+	if err := moveGuestTickets(ctx, transfer.TicketID, transfer.ToUID); err != nil {
+		return err
+	}
+
+	// Seating groups are made by the people in them, so the recipient has to pick their own
+	if err := removeFromSeatingGroup(ctx, transfer.EventID, transfer.TicketID); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func transferTicketToQueue(
+	ctx context.Context,
+	transfer TicketTransfer,
+	transferableFilter bson.M,
+	ownerChange TicketOwnerChange,
+) (primitive.ObjectID, error) {
+	// Need ticket data to copy into the queued ticket
+	var ticket Ticket
+	err := lib.Datastore.Db.Collection(ticketsColName).FindOne(ctx, transferableFilter).Decode(&ticket)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrTransferNotAllowed
+	} else if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Queue up a copy of the ticket for when the recipient signs up
+	// Capacity isn't checked since the original ticket is giving up its spot
+	queuedTicketID, err := createQueuedTicket(ctx, QueuedTicket{
+		StudentNumber: transfer.ToStudentNumber,
+		EventID:       transfer.EventID,
+		Tier:          ticket.Tier,
+		MaxScanCount:  ticket.MaxScanCount,
+		CustomFields:  ticket.CustomFields,
+		OwnerHistory:  append(ticket.OwnerHistory, ownerChange),
+	}, false)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// Void original ticket, as long as it still hasn't changed
+	err = lib.Datastore.Db.Collection(ticketsColName).FindOneAndUpdate(
+		ctx,
+		transferableFilter,
+		bson.M{
+			"$set": bson.M{
+				"voided":     true,
+				"voidReason": "transferred to student #" + transfer.ToStudentNumber,
+				"voidedBy":   ownerChange.PreviousOwner,
+				"voidTime":   ownerChange.Timestamp,
+			},
+			"$unset": bson.M{"seat": ""},
+			"$push":  bson.M{"ownerHistory": ownerChange},
+		},
+	).Decode(&ticket)
+	if err == mongo.ErrNoDocuments {
+		err = ErrTransferNotAllowed
+	}
+	if err != nil {
+		// Don't leave the copy around if the original couldn't be voided, the original kept its spot
+		deleteQueuedTicket(ctx, queuedTicketID, false)
+		return primitive.NilObjectID, err
+	}
+
+	// Voided tickets don't take up a seat
+	if err := freeSeat(ctx, ticket.Event, ticket.Seat); err != nil {
+		return queuedTicketID, err
+	}
+
+	// Queued tickets can't sponsor guests, so they lose their tickets
+	if err := voidGuestTickets(ctx, transfer.TicketID, "sponsor's ticket was transferred", ownerChange.PreviousOwner); err != nil {
+		return queuedTicketID, err
+	}
+
+	// Voided tickets can't be seated, so they shouldn't hold onto a spot in a group either
+	if err := removeFromSeatingGroup(ctx, transfer.EventID, transfer.TicketID); err != nil && err != ErrNotFound {
+		return queuedTicketID, err
+	}
+
+	return queuedTicketID, nil
+}
+
+func DeleteAllTicketTransfersForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all ticket transfers for event
+	_, err := lib.Datastore.Db.Collection(transfersColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
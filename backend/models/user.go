@@ -17,6 +17,7 @@ type User struct {
 	ID            string `json:"id"             bson:"_id,omitempty"` // This is also the UUID in Firebase Auth
 	Admin         bool   `json:"admin"          bson:"admin"`
 	SuperAdmin    bool   `json:"superadmin"     bson:"superadmin"`
+	Role          string `json:"role"           bson:"role,omitempty"` // Mirrors the role claim, see util.Role
 	StudentNumber string `json:"student_number" bson:"student_number"`
 	FullName      string `json:"full_name"      bson:"full_name"`
 	ProfilePicURL string `json:"pfp_url"        bson:"pfp_url"`
@@ -136,6 +137,7 @@ func UpdateExistingUserByKeys(
 	UPDATABLE_KEYS := map[string]bool{
 		"admin":          true,
 		"superadmin":     true,
+		"role":           true,
 		"student_number": true,
 		"full_name":      true,
 		"pfp_url":        true,
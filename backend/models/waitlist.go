@@ -0,0 +1,355 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aritrosaha10/frasertickets/lib"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WaitlistEntry is a student waiting for a spot in a full tier or event.
+type WaitlistEntry struct {
+	ID                primitive.ObjectID     `json:"id"                bson:"_id,omitempty"`
+	EventID           primitive.ObjectID     `json:"eventID"           bson:"event"`
+	TierID            primitive.ObjectID     `json:"tierID"            bson:"tier,omitempty"` // Tier they're waiting for, empty for events without tiers
+	UserID            string                 `json:"userID"            bson:"user"`
+	Timestamp         time.Time              `json:"timestamp"         bson:"timestamp"` // When they joined, used for ordering
+	Status            string                 `json:"status"            bson:"status"`
+	CustomFields      map[string]interface{} `json:"customFields"      bson:"customFields"`             // Collected when joining, since they're used for the ticket once promoted
+	TicketID          primitive.ObjectID     `json:"ticketID"          bson:"ticket,omitempty"`         // Set once promoted into a free tier
+	OrderID           primitive.ObjectID     `json:"orderID"           bson:"order,omitempty"`          // Set once promoted into a priced tier, which they still have to pay for
+	FailureReason     string                 `json:"failureReason"     bson:"failure_reason,omitempty"` // Set if they couldn't be given a ticket
+	PromotedTimestamp time.Time              `json:"promotedTime"      bson:"promoted_time"`
+	Position          int64                  `json:"position"          bson:"-"` // 1-indexed position in line, only filled in when waiting
+}
+
+// Statuses a waitlist entry can have
+const (
+	WaitlistStatusWaiting   = "waiting"
+	WaitlistStatusPromoting = "promoting" // At the front of the line and being given a ticket
+	WaitlistStatusPromoted  = "promoted"  // Got a ticket, or an order to pay for one
+	WaitlistStatusFailed    = "failed"    // Couldn't be given a ticket when their turn came
+	WaitlistStatusLeft      = "left"
+)
+
+func (entry *WaitlistEntry) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func CreateWaitlistIndices(ctx context.Context) error {
+	// Create appropriate indices
+	eventStatusTimestampIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "event", Value: 1},
+			{Key: "tier", Value: 1},
+			{Key: "status", Value: 1},
+			{Key: "timestamp", Value: 1},
+		},
+	}
+	userIdxModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "user", Value: 1},
+		},
+	}
+
+	// Try creating the indices
+	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
+	_, err := lib.Datastore.Db.Collection(waitlistColName).
+		Indexes().
+		CreateMany(
+			ctx,
+			[]mongo.IndexModel{
+				eventStatusTimestampIdxModel,
+				userIdxModel,
+			},
+			opts,
+		)
+
+	return err
+}
+
+// GetWaitlist fetches the entries for an event in the order they joined.
+func GetWaitlist(ctx context.Context, filter bson.M) ([]WaitlistEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+
+	// Try to get data from MongoDB
+	cursor, err := lib.Datastore.Db.Collection(waitlistColName).Find(ctx, filter, opts)
+	if err != nil {
+		return []WaitlistEntry{}, err
+	}
+	defer cursor.Close(ctx)
+
+	// Attempt to convert BSON data into WaitlistEntry structs
+	var entries []WaitlistEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return []WaitlistEntry{}, err
+	}
+
+	return entries, nil
+}
+
+// GetWaitingWaitlistEntry fetches a user's spot in line for an event, with their position filled in.
+func GetWaitingWaitlistEntry(ctx context.Context, eventID primitive.ObjectID, uid string) (WaitlistEntry, error) {
+	// Try to fetch data from DB
+	var entry WaitlistEntry
+	err := lib.Datastore.Db.Collection(waitlistColName).
+		FindOne(ctx, bson.M{"event": eventID, "user": uid, "status": WaitlistStatusWaiting}).
+		Decode(&entry)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+
+	entry.Position, err = GetWaitlistPosition(ctx, entry)
+	return entry, err
+}
+
+// waitlistTierFilter matches the entries waiting for a tier. Entries for events without tiers
+// don't have one saved.
+func waitlistTierFilter(tierID primitive.ObjectID) interface{} {
+	if tierID.IsZero() {
+		return bson.M{"$exists": false}
+	}
+	return tierID
+}
+
+// GetWaitlistPosition finds how far along a waiting entry is in its tier's line, starting at 1.
+func GetWaitlistPosition(ctx context.Context, entry WaitlistEntry) (int64, error) {
+	ahead, err := lib.Datastore.Db.Collection(waitlistColName).CountDocuments(ctx, bson.M{
+		"event":     entry.EventID,
+		"tier":      waitlistTierFilter(entry.TierID),
+		"status":    WaitlistStatusWaiting,
+		"timestamp": bson.M{"$lt": entry.Timestamp},
+	})
+	if err != nil {
+		return -1, err
+	}
+	return ahead + 1, nil
+}
+
+// JoinWaitlist adds a user to the end of the line for a full tier, or a full event if it doesn't
+// have tiers. Custom fields are checked now since they're used for their ticket once they get a spot.
+func JoinWaitlist(
+	ctx context.Context,
+	eventID primitive.ObjectID,
+	tierID primitive.ObjectID,
+	uid string,
+	customFields map[string]interface{},
+) (WaitlistEntry, error) {
+	// Check if event exists
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err == mongo.ErrNoDocuments {
+		return WaitlistEntry{}, ErrNotFound
+	} else if err != nil {
+		return WaitlistEntry{}, err
+	}
+
+	// They can only be given a spot in the tier they asked for, so events with tiers need one
+	if !tierID.IsZero() || len(event.TicketTiers) > 0 {
+		if _, ok := event.GetTicketTier(tierID); !ok {
+			return WaitlistEntry{}, ErrTierNotFound
+		}
+	}
+
+	// No point in waiting if they could just get a ticket
+	hasSpace, err := CheckIfTierHasSpace(ctx, eventID, tierID)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	if hasSpace {
+		return WaitlistEntry{}, ErrEventNotFull
+	}
+
+	// Can't join if they already have a ticket or are already waiting
+	if _, err := SearchForTicket(ctx, eventID, uid); err == nil {
+		return WaitlistEntry{}, ErrAlreadyExists
+	} else if err != mongo.ErrNoDocuments {
+		return WaitlistEntry{}, err
+	}
+	alreadyWaiting, err := lib.Datastore.Db.Collection(waitlistColName).
+		CountDocuments(ctx, bson.M{"event": eventID, "user": uid, "status": WaitlistStatusWaiting})
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	if alreadyWaiting > 0 {
+		return WaitlistEntry{}, ErrAlreadyExists
+	}
+
+	if customFields == nil {
+		customFields = map[string]interface{}{}
+	}
+	valid, _, err := ValidateCustomEventFields(ctx, event, customFields)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	if !valid {
+		return WaitlistEntry{}, ErrInvalidCustomFields
+	}
+
+	// Try to add document
+	entry := WaitlistEntry{
+		EventID:      eventID,
+		TierID:       tierID,
+		UserID:       uid,
+		Timestamp:    time.Now(),
+		Status:       WaitlistStatusWaiting,
+		CustomFields: customFields,
+	}
+	res, err := lib.Datastore.Db.Collection(waitlistColName).InsertOne(ctx, entry)
+	if err != nil {
+		return WaitlistEntry{}, err
+	}
+	entry.ID = res.InsertedID.(primitive.ObjectID)
+
+	entry.Position, err = GetWaitlistPosition(ctx, entry)
+	return entry, err
+}
+
+// LeaveWaitlist takes a user out of the line for an event.
+func LeaveWaitlist(ctx context.Context, eventID primitive.ObjectID, uid string) error {
+	res, err := lib.Datastore.Db.Collection(waitlistColName).UpdateOne(
+		ctx,
+		bson.M{"event": eventID, "user": uid, "status": WaitlistStatusWaiting},
+		bson.M{"$set": bson.M{"status": WaitlistStatusLeft}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// setWaitlistEntryStatus moves a waitlist entry that's being promoted to a new status.
+func setWaitlistEntryStatus(ctx context.Context, id primitive.ObjectID, updates bson.M) error {
+	_, err := lib.Datastore.Db.Collection(waitlistColName).UpdateOne(
+		ctx,
+		bson.M{"_id": id, "status": WaitlistStatusPromoting},
+		bson.M{"$set": updates},
+	)
+	return err
+}
+
+// PromoteFromWaitlist gives spots to the people at the front of a tier's waitlist until the tier
+// or event is full again, returning the tickets and orders that were created. The tier should
+// match the ticket that freed up the spot, and only people waiting for that tier are promoted. In
+// a free tier, promoted tickets are issued right away with the tier's max scan count, or the given
+// one for events without tiers. In a priced tier, a pending order holds the spot until they pay
+// for it or the checkout deadline passes, after which it goes to the next person in line. People
+// who can't be given a spot are marked as failed with the reason and skipped over.
+func PromoteFromWaitlist(ctx context.Context, eventID primitive.ObjectID, tierID primitive.ObjectID, maxScanCount int) ([]Ticket, []Order, error) {
+	promotedTickets := []Ticket{}
+	promotedOrders := []Order{}
+
+	event, err := GetEvent(ctx, bson.M{"_id": eventID})
+	if err != nil {
+		return promotedTickets, promotedOrders, err
+	}
+	var tier TicketTier
+	if !tierID.IsZero() {
+		var ok bool
+		tier, ok = event.GetTicketTier(tierID)
+		if !ok {
+			return promotedTickets, promotedOrders, ErrTierNotFound
+		}
+		maxScanCount = tier.MaxScanCount
+	}
+
+	for {
+		hasSpace, err := CheckIfTierHasSpace(ctx, eventID, tierID)
+		if err != nil {
+			return promotedTickets, promotedOrders, err
+		}
+		if !hasSpace {
+			return promotedTickets, promotedOrders, nil
+		}
+
+		// Claim the first person in line so that nobody else can promote them at the same time
+		var entry WaitlistEntry
+		err = lib.Datastore.Db.Collection(waitlistColName).FindOneAndUpdate(
+			ctx,
+			bson.M{"event": eventID, "tier": waitlistTierFilter(tierID), "status": WaitlistStatusWaiting},
+			bson.M{"$set": bson.M{"status": WaitlistStatusPromoting}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "timestamp", Value: 1}}).SetReturnDocument(options.After),
+		).Decode(&entry)
+		if err == mongo.ErrNoDocuments {
+			// Nobody left waiting
+			return promotedTickets, promotedOrders, nil
+		} else if err != nil {
+			return promotedTickets, promotedOrders, err
+		}
+
+		// Entries from before custom fields were collected might not have the ones the event needs
+		if entry.CustomFields == nil {
+			entry.CustomFields = map[string]interface{}{}
+		}
+		valid, _, err := ValidateCustomEventFields(ctx, event, entry.CustomFields)
+		if err == nil && !valid {
+			setWaitlistEntryStatus(ctx, entry.ID, bson.M{
+				"status":         WaitlistStatusFailed,
+				"failure_reason": "missing custom fields needed for a ticket",
+			})
+			continue
+		}
+
+		var ticket Ticket
+		var order Order
+		if err == nil {
+			if tier.Price > 0 {
+				order, err = createWaitlistOrder(ctx, tier, entry)
+			} else {
+				ticket = Ticket{
+					Owner:        entry.UserID,
+					Event:        eventID,
+					Tier:         tierID,
+					MaxScanCount: maxScanCount,
+					CustomFields: entry.CustomFields,
+				}
+				ticket.ID, err = CreateNewTicket(ctx, ticket)
+			}
+		}
+		if err == ErrTierFull || err == ErrEventFull {
+			// Spot was taken by someone else, so leave the rest of the line alone
+			setWaitlistEntryStatus(ctx, entry.ID, bson.M{"status": WaitlistStatusWaiting})
+			return promotedTickets, promotedOrders, nil
+		} else if err == ErrAlreadyExists || err == ErrNotFound {
+			// They got a ticket some other way or deleted their account, so skip them
+			reason := "already had a ticket or an unpaid order for this event"
+			if err == ErrNotFound {
+				reason = "account no longer exists"
+			}
+			setWaitlistEntryStatus(ctx, entry.ID, bson.M{"status": WaitlistStatusFailed, "failure_reason": reason})
+			continue
+		} else if err != nil {
+			// Put them back in line so they aren't skipped over
+			setWaitlistEntryStatus(ctx, entry.ID, bson.M{"status": WaitlistStatusWaiting})
+			return promotedTickets, promotedOrders, err
+		}
+
+		updates := bson.M{"status": WaitlistStatusPromoted, "promoted_time": time.Now()}
+		if !order.ID.IsZero() {
+			updates["order"] = order.ID
+		} else {
+			updates["ticket"] = ticket.ID
+		}
+		if err := setWaitlistEntryStatus(ctx, entry.ID, updates); err != nil {
+			return promotedTickets, promotedOrders, err
+		}
+		if !order.ID.IsZero() {
+			promotedOrders = append(promotedOrders, order)
+		} else {
+			promotedTickets = append(promotedTickets, ticket)
+		}
+	}
+}
+
+func DeleteWaitlistForEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	// Delete all waitlist entries for event
+	_, err := lib.Datastore.Db.Collection(waitlistColName).DeleteMany(ctx, bson.M{"event": eventID})
+	return err
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// GetPaginationFromQuery reads the 1-based "page" and "pageSize" query params,
+// falling back to the first page and the default page size if they aren't given.
+func GetPaginationFromQuery(r *http.Request) (int64, int64, error) {
+	page := int64(1)
+	pageSize := int64(DefaultPageSize)
+
+	if pageRaw := r.URL.Query().Get("page"); pageRaw != "" {
+		parsed, err := strconv.ParseInt(pageRaw, 10, 64)
+		if err != nil || parsed < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+		page = parsed
+	}
+
+	if pageSizeRaw := r.URL.Query().Get("pageSize"); pageSizeRaw != "" {
+		parsed, err := strconv.ParseInt(pageSizeRaw, 10, 64)
+		if err != nil || parsed < 1 || parsed > MaxPageSize {
+			return 0, 0, fmt.Errorf("pageSize must be an integer between 1 and %d", MaxPageSize)
+		}
+		pageSize = parsed
+	}
+
+	return page, pageSize, nil
+}
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"context"
+	"sort"
+)
+
+// Permission is something a requester is allowed to do, in the form "resource:action".
+type Permission string
+
+const (
+	PermissionEventsWrite       Permission = "events:write"        // Create & edit events, tiers, and seating
+	PermissionEventsDelete      Permission = "events:delete"       // Delete events
+	PermissionEventsAnalytics   Permission = "events:analytics"    // See counts, scan history, analytics, and waitlists
+	PermissionTicketsRead       Permission = "tickets:read"        // See anyone's tickets, transfers, and queued tickets
+	PermissionTicketsWrite      Permission = "tickets:write"       // Create & edit tickets, and approve transfers
+	PermissionTicketsDelete     Permission = "tickets:delete"      // Void tickets
+	PermissionTicketsRestore    Permission = "tickets:restore"     // Undo voiding a ticket
+	PermissionTicketsScan       Permission = "tickets:scan"        // Scan tickets at the door
+	PermissionOrdersRead        Permission = "orders:read"         // See anyone's orders and event financials
+	PermissionOrdersRefund      Permission = "orders:refund"       // Refund orders
+	PermissionPromoCodesManage  Permission = "promocodes:manage"   // Create, edit, and delete promo codes
+	PermissionScanStationManage Permission = "scanstations:manage" // Create, edit, and delete scan stations
+	PermissionUsersRead         Permission = "users:read"          // See anyone's user data
+	PermissionUsersManage       Permission = "users:manage"        // Edit anyone's user data
+	PermissionAdminsManage      Permission = "admins:manage"       // Give and take away roles
+	PermissionEventStaffManage  Permission = "events:staff"        // Add & remove event staff
+)
+
+// Role is a named set of permissions, given to a user through their auth claims.
+type Role string
+
+const (
+	RoleNone       Role = ""
+	RoleScanner    Role = "scanner"
+	RoleAdmin      Role = "admin"
+	RoleSuperAdmin Role = "superadmin"
+)
+
+var allPermissions = []Permission{
+	PermissionEventsWrite,
+	PermissionEventsDelete,
+	PermissionEventsAnalytics,
+	PermissionTicketsRead,
+	PermissionTicketsWrite,
+	PermissionTicketsDelete,
+	PermissionTicketsRestore,
+	PermissionTicketsScan,
+	PermissionOrdersRead,
+	PermissionOrdersRefund,
+	PermissionPromoCodesManage,
+	PermissionScanStationManage,
+	PermissionUsersRead,
+	PermissionUsersManage,
+	PermissionAdminsManage,
+	PermissionEventStaffManage,
+}
+
+// Permissions that can't be undone easily are kept for superadmins
+var superAdminOnlyPermissions = map[Permission]bool{
+	PermissionEventsDelete:   true,
+	PermissionTicketsRestore: true,
+	PermissionAdminsManage:   true,
+}
+
+var rolePermissions = map[Role]map[Permission]bool{
+	RoleNone: {},
+	RoleScanner: {
+		PermissionTicketsScan: true,
+		PermissionTicketsRead: true,
+	},
+	RoleAdmin:      {},
+	RoleSuperAdmin: {},
+}
+
+func init() {
+	for _, permission := range allPermissions {
+		rolePermissions[RoleSuperAdmin][permission] = true
+		if !superAdminOnlyPermissions[permission] {
+			rolePermissions[RoleAdmin][permission] = true
+		}
+	}
+}
+
+// IsAdmin checks whether the role is admin or superadmin, which is what the admin claim means.
+func (role Role) IsAdmin() bool {
+	return role == RoleAdmin || role == RoleSuperAdmin
+}
+
+// IsValid checks whether the role is one that exists. RoleNone counts as valid.
+func (role Role) IsValid() bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission checks whether the role gives the permission.
+func (role Role) HasPermission(permission Permission) bool {
+	return rolePermissions[role][permission]
+}
+
+// Permissions lists everything the role allows, sorted by name.
+func (role Role) Permissions() []Permission {
+	permissions := []Permission{}
+	for permission := range rolePermissions[role] {
+		permissions = append(permissions, permission)
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return permissions
+}
+
+// EventStaffRole is a role someone has for just one event, ex. a teacher scanning at their club's event.
+type EventStaffRole string
+
+const (
+	EventStaffScanner EventStaffRole = "scanner" // Scans tickets at the door
+	EventStaffViewer  EventStaffRole = "viewer"  // Sees the attendee list and attendance numbers
+	EventStaffManager EventStaffRole = "manager" // Everything above, and can add & remove staff
+)
+
+var eventStaffRolePermissions = map[EventStaffRole]map[Permission]bool{
+	EventStaffScanner: {
+		PermissionTicketsScan: true,
+	},
+	EventStaffViewer: {
+		PermissionTicketsRead:     true,
+		PermissionEventsAnalytics: true,
+	},
+	EventStaffManager: {
+		PermissionTicketsScan:      true,
+		PermissionTicketsRead:      true,
+		PermissionEventsAnalytics:  true,
+		PermissionEventStaffManage: true,
+	},
+}
+
+// IsValid checks whether the event staff role is one that exists.
+func (role EventStaffRole) IsValid() bool {
+	_, ok := eventStaffRolePermissions[role]
+	return ok
+}
+
+// HasPermission checks whether the event staff role gives the permission for its event.
+func (role EventStaffRole) HasPermission(permission Permission) bool {
+	return eventStaffRolePermissions[role][permission]
+}
+
+// EventStaffRolesWithPermission lists every event staff role that gives the permission.
+func EventStaffRolesWithPermission(permission Permission) []EventStaffRole {
+	roles := []EventStaffRole{}
+	for role, permissions := range eventStaffRolePermissions {
+		if permissions[permission] {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// GetRoleFromClaims works out a user's role from their auth claims. Users from before roles existed
+// only have the admin & superadmin claims, so those are used if there's no role claim.
+func GetRoleFromClaims(claims map[string]interface{}) Role {
+	if isSuperAdmin, _ := claims["superadmin"].(bool); isSuperAdmin {
+		return RoleSuperAdmin
+	}
+
+	if rawRole, _ := claims["role"].(string); rawRole != "" {
+		// Unknown roles don't get anything rather than guessing
+		if role := Role(rawRole); role.IsValid() {
+			return role
+		}
+		return RoleNone
+	}
+
+	if isAdmin, _ := claims["admin"].(bool); isAdmin {
+		return RoleAdmin
+	}
+	return RoleNone
+}
+
+// ClaimsForRole builds the auth claims that give a user a role. The admin claim is only set for
+// admins & superadmins, so anything else that needs to know the role (ex. the admin panel letting
+// in scanners) should use the role claim.
+func ClaimsForRole(role Role) map[string]interface{} {
+	return map[string]interface{}{
+		"admin":      role.IsAdmin(),
+		"superadmin": role == RoleSuperAdmin,
+		"role":       string(role),
+	}
+}
+
+// GetRoleFromContext gets the requester's role from the user token in context.
+func GetRoleFromContext(ctx context.Context) (Role, error) {
+	idToken, err := GetUserTokenFromContext(ctx)
+	if err != nil {
+		return RoleNone, err
+	}
+	return GetRoleFromClaims(idToken.Claims), nil
+}
+
+// CheckPermission checks whether the requester's role gives them a permission.
+func CheckPermission(ctx context.Context, permission Permission) (bool, error) {
+	role, err := GetRoleFromContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	return role.HasPermission(permission), nil
+}
@@ -0,0 +1,67 @@
+package util
+
+import "testing"
+
+func TestGetRoleFromClaims(t *testing.T) {
+	testCases := []struct {
+		name   string
+		claims map[string]interface{}
+		want   Role
+	}{
+		{"no claims", map[string]interface{}{}, RoleNone},
+		{"nil claims", nil, RoleNone},
+		{"scanner", map[string]interface{}{"role": "scanner", "admin": false, "superadmin": false}, RoleScanner},
+		{"admin", map[string]interface{}{"role": "admin", "admin": true, "superadmin": false}, RoleAdmin},
+		{"superadmin", map[string]interface{}{"role": "superadmin", "admin": true, "superadmin": true}, RoleSuperAdmin},
+		{"empty role", map[string]interface{}{"role": "", "admin": false, "superadmin": false}, RoleNone},
+		{"unknown role", map[string]interface{}{"role": "owner"}, RoleNone},
+		{"role that isn't a string", map[string]interface{}{"role": 1}, RoleNone},
+
+		// Users from before roles existed only have the admin & superadmin claims
+		{"legacy admin", map[string]interface{}{"admin": true}, RoleAdmin},
+		{"legacy superadmin", map[string]interface{}{"admin": true, "superadmin": true}, RoleSuperAdmin},
+		{"legacy non-admin", map[string]interface{}{"admin": false}, RoleNone},
+		{"admin claim that isn't a bool", map[string]interface{}{"admin": "true"}, RoleNone},
+
+		// The role claim wins over a leftover admin claim
+		{"scanner with admin claim", map[string]interface{}{"role": "scanner", "admin": true}, RoleScanner},
+		{"unknown role with admin claim", map[string]interface{}{"role": "owner", "admin": true}, RoleNone},
+	}
+
+	for _, testCase := range testCases {
+		if got := GetRoleFromClaims(testCase.claims); got != testCase.want {
+			t.Errorf("%s: got role %q, wanted %q", testCase.name, got, testCase.want)
+		}
+	}
+}
+
+func TestClaimsForRole(t *testing.T) {
+	testCases := []struct {
+		role           Role
+		wantAdmin      bool
+		wantSuperAdmin bool
+	}{
+		{RoleNone, false, false},
+		{RoleScanner, false, false},
+		{RoleAdmin, true, false},
+		{RoleSuperAdmin, true, true},
+	}
+
+	for _, testCase := range testCases {
+		claims := ClaimsForRole(testCase.role)
+		if claims["admin"] != testCase.wantAdmin {
+			t.Errorf("role %q: got admin claim %v, wanted %t", testCase.role, claims["admin"], testCase.wantAdmin)
+		}
+		if claims["superadmin"] != testCase.wantSuperAdmin {
+			t.Errorf("role %q: got superadmin claim %v, wanted %t", testCase.role, claims["superadmin"], testCase.wantSuperAdmin)
+		}
+		if claims["role"] != string(testCase.role) {
+			t.Errorf("role %q: got role claim %v", testCase.role, claims["role"])
+		}
+
+		// Claims have to give back the same role when read
+		if got := GetRoleFromClaims(claims); got != testCase.role {
+			t.Errorf("role %q: claims were read back as %q", testCase.role, got)
+		}
+	}
+}
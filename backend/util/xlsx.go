@@ -0,0 +1,124 @@
+package util
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Static parts of a workbook with a single sheet
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// XLSXWriter writes a spreadsheet with a single sheet in the XLSX format. Rows are written
+// out as they're added, so large sheets don't have to be kept in memory.
+type XLSXWriter struct {
+	zipWriter *zip.Writer
+	sheet     io.Writer
+	rowCount  int
+}
+
+// NewXLSXWriter starts a new spreadsheet, writing it to w.
+func NewXLSXWriter(w io.Writer, sheetName string) (*XLSXWriter, error) {
+	zipWriter := zip.NewWriter(w)
+
+	var sheetNameBuilder strings.Builder
+	xml.EscapeText(&sheetNameBuilder, []byte(cleanXLSXSheetName(sheetName)))
+
+	// Everything but the sheet is known up front, so write it first
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, sheetNameBuilder.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		partWriter, err := zipWriter.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(partWriter, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sheet has to be the last part since rows are streamed into it
+	sheet, err := zipWriter.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, xlsxSheetStart); err != nil {
+		return nil, err
+	}
+
+	return &XLSXWriter{zipWriter: zipWriter, sheet: sheet}, nil
+}
+
+// cleanXLSXSheetName removes characters that aren't allowed in sheet names and shortens it
+// to the 31 character limit.
+func cleanXLSXSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	nameRunes := []rune(strings.TrimSpace(name))
+	if len(nameRunes) > 31 {
+		nameRunes = nameRunes[:31]
+	}
+	if len(nameRunes) == 0 {
+		return "Sheet1"
+	}
+	return string(nameRunes)
+}
+
+// WriteRow adds a row to the sheet. Numbers are written as numeric cells and everything else
+// is written as text, with anything that looks like a formula escaped.
+func (x *XLSXWriter) WriteRow(cells []interface{}) error {
+	x.rowCount++
+
+	var row strings.Builder
+	fmt.Fprintf(&row, `<row r="%d">`, x.rowCount)
+	for _, cell := range cells {
+		switch value := cell.(type) {
+		case int, int32, int64, float32, float64:
+			fmt.Fprintf(&row, `<c t="n"><v>%v</v></c>`, value)
+		case nil:
+			row.WriteString(`<c/>`)
+		default:
+			row.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&row, []byte(fmt.Sprint(value)))
+			row.WriteString(`</t></is></c>`)
+		}
+	}
+	row.WriteString(`</row>`)
+
+	_, err := io.WriteString(x.sheet, row.String())
+	return err
+}
+
+// Close finishes the spreadsheet. It doesn't close the underlying writer.
+func (x *XLSXWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, xlsxSheetEnd); err != nil {
+		return err
+	}
+	return x.zipWriter.Close()
+}
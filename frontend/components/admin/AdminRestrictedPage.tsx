@@ -3,6 +3,7 @@ import { PropsWithChildren, useEffect, useState } from "react";
 import { Typography } from "@material-tailwind/react";
 
 import getDecodedTokenSafely from "@/lib/auth/getDecodedTokenSafely";
+import hasStaffRole from "@/lib/auth/hasStaffRole";
 
 import { useFirebaseAuth } from "@/components/FirebaseAuthContext";
 import LoadingSpinner from "@/components/LoadingSpinner";
@@ -17,7 +18,7 @@ export default function AdminRestrictedPage(props: PropsWithChildren) {
         if (loaded && user) {
             getDecodedTokenSafely(true)
                 .then((res) => {
-                    setAuthorized(!!res.admin);
+                    setAuthorized(hasStaffRole(res));
                 })
                 .catch((err) => {
                     console.warn(err);
@@ -0,0 +1,106 @@
+import { useState } from "react";
+
+import { Option, Select, Typography } from "@material-tailwind/react";
+import { useQuery } from "react-query";
+
+import { getAllEvents } from "@/lib/backend/event";
+import { getScanStations } from "@/lib/backend/scanstation";
+import { SavedScanStation } from "@/util/scanStationStorage";
+
+const stationRoleNames = {
+    entry: "Entry",
+    exit: "Exit",
+    any: "Entry & Exit",
+};
+
+type ScanStationPickerProps = {
+    station: SavedScanStation | null;
+    onChange: (station: SavedScanStation) => void;
+};
+
+// Lets scanners choose the event & door they're scanning at, since every scan has to come from a station
+export default function ScanStationPicker({ station, onChange }: ScanStationPickerProps) {
+    const [eventID, setEventID] = useState<string>();
+
+    const { data: events } = useQuery("frasertix-scan-station-events", getAllEvents);
+    const { data: stations, isError } = useQuery(
+        ["frasertix-scan-stations", eventID],
+        () => getScanStations(eventID as string),
+        {
+            enabled: eventID !== undefined,
+            retry: false,
+        },
+    );
+
+    return (
+        <div className="flex flex-col items-center gap-2 mb-4">
+            <Typography
+                variant="lead"
+                className="text-center text-gray-700"
+            >
+                {station ? `Scanning at ${station.name}` : "Choose where you're scanning before scanning tickets."}
+            </Typography>
+
+            <div className="flex flex-wrap gap-2 justify-center">
+                {events && (
+                    <div className="w-72">
+                        <Select
+                            label="Event"
+                            onChange={(value) => setEventID(value)}
+                        >
+                            {events.map((event) => (
+                                <Option
+                                    value={event.id}
+                                    key={event.id}
+                                >
+                                    {event.name}
+                                </Option>
+                            ))}
+                        </Select>
+                    </div>
+                )}
+
+                {stations && (
+                    <div className="w-72">
+                        <Select
+                            key={eventID} // Remount so the old event's stations aren't left selected
+                            label="Scan station"
+                            onChange={(value) => {
+                                const chosenStation = stations.find((s) => s.id === value);
+                                if (chosenStation) {
+                                    onChange({ id: chosenStation.id, name: chosenStation.name });
+                                }
+                            }}
+                        >
+                            {stations.map((s) => (
+                                <Option
+                                    value={s.id}
+                                    key={s.id}
+                                >
+                                    {`${s.name} (${stationRoleNames[s.role]})`}
+                                </Option>
+                            ))}
+                        </Select>
+                    </div>
+                )}
+            </div>
+
+            {stations?.length === 0 && (
+                <Typography
+                    variant="small"
+                    color="red"
+                >
+                    This event doesn&apos;t have any scan stations yet.
+                </Typography>
+            )}
+            {isError && (
+                <Typography
+                    variant="small"
+                    color="red"
+                >
+                    Could not load this event&apos;s scan stations.
+                </Typography>
+            )}
+        </div>
+    );
+}
@@ -24,6 +24,7 @@ import {
     Typography,
 } from "@material-tailwind/react";
 
+import hasStaffRole from "@/lib/auth/hasStaffRole";
 import logOut from "@/util/logOut";
 
 import { useFirebaseAuth } from "@/components/FirebaseAuthContext";
@@ -56,7 +57,7 @@ function ProfileMenu() {
     useEffect(() => {
         (async () => {
             user?.getIdTokenResult().then((res) => {
-                setIsAdmin(!!res.claims["admin"]);
+                setIsAdmin(hasStaffRole(res.claims));
             });
         })();
     });
@@ -2,6 +2,8 @@ import getTokenSafely from "@/lib/auth/getTokenSafely";
 
 interface DecodedToken {
     admin?: boolean;
+    superadmin?: boolean;
+    role?: string;
     aud: string;
     auth_time: number;
     email: string;
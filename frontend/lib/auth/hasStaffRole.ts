@@ -0,0 +1,19 @@
+const staffRoles = ["scanner", "admin", "superadmin"];
+
+/**
+ * @description Checks whether a user's auth claims give them a staff role (scanner, admin, or superadmin),
+ * which is what gets them into the admin panel. The role claim is what decides this, since the
+ * admin claim is only set for admins & superadmins. Users from before roles existed don't have a
+ * role claim, so the admin & superadmin claims are used for them instead.
+ *
+ * @param claims the user's decoded auth claims
+ */
+export default function hasStaffRole(claims: { [key: string]: any }) {
+    if (claims.superadmin) {
+        return true;
+    }
+    if (typeof claims.role === "string" && claims.role !== "") {
+        return staffRoles.includes(claims.role);
+    }
+    return !!claims.admin;
+}
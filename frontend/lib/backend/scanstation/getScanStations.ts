@@ -0,0 +1,12 @@
+import ScanStation, { convertToScanStation } from "@/lib/backend/scanstation";
+import sendBackendRequest from "@/lib/backend/sendBackendRequest";
+
+// Admin-only route!
+export default async function getScanStations(eventID: string) {
+    const res = await sendBackendRequest(`/scanstations?eventID=${eventID}`, "get", true, true);
+
+    const rawStations = res.data as { [key: string]: any }[];
+    const stations = rawStations.map((data) => convertToScanStation(data));
+
+    return stations as ScanStation[];
+}
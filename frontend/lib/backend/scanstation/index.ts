@@ -0,0 +1,20 @@
+import getScanStations from "@/lib/backend/scanstation/getScanStations";
+
+type ScanStation = {
+    id: string;
+    name: string;
+    eventId: string;
+    role: "entry" | "exit" | "any";
+};
+
+export function convertToScanStation(rawData: { [key: string]: any }): ScanStation {
+    return {
+        id: rawData.id,
+        name: rawData.name,
+        eventId: rawData.eventID,
+        role: rawData.role,
+    };
+}
+
+export default ScanStation;
+export { getScanStations };
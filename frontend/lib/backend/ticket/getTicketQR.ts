@@ -0,0 +1,9 @@
+import sendBackendRequest from "@/lib/backend/sendBackendRequest";
+
+// Gets the signed payload that goes in a ticket's QR code
+export default async function getTicketQR(id: string) {
+    const res = await sendBackendRequest(`/tickets/${id}/qr`, "get", true, false, undefined, undefined, {
+        responseType: "text",
+    });
+    return res.data as string;
+}
@@ -4,6 +4,7 @@ import deleteTicket from "@/lib/backend/ticket/deleteTicket";
 import getAllTickets from "@/lib/backend/ticket/getAllTickets";
 import getSelfTickets from "@/lib/backend/ticket/getSelfTickets";
 import getTicket from "@/lib/backend/ticket/getTicket";
+import getTicketQR from "@/lib/backend/ticket/getTicketQR";
 import searchForTicket from "@/lib/backend/ticket/searchForTicket";
 import updateTicket from "@/lib/backend/ticket/updateTicket";
 import User, { convertToUser } from "@/lib/backend/user";
@@ -37,4 +38,13 @@ export function convertToTicket(rawData: { [key: string]: any }): Ticket {
 }
 
 export default Ticket;
-export { createNewTicket, deleteTicket, getAllTickets, getSelfTickets, getTicket, searchForTicket, updateTicket };
+export {
+    createNewTicket,
+    deleteTicket,
+    getAllTickets,
+    getSelfTickets,
+    getTicket,
+    getTicketQR,
+    searchForTicket,
+    updateTicket,
+};
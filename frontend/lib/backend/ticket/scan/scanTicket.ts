@@ -2,9 +2,10 @@ import sendBackendRequest from "@/lib/backend/sendBackendRequest";
 import TicketScan, { convertToTicketScan } from "@/lib/backend/ticket/scan";
 
 // Admin-only route!
-export default async function scanTicket(ticketID: string) {
+export default async function scanTicket(payload: string, stationID: string) {
     const res = await sendBackendRequest("/tickets/scan", "post", true, true, {
-        ticketID: ticketID,
+        payload: payload,
+        stationID: stationID,
     });
 
     const rawTicketScan = res.data as { [key: string]: any }[];
@@ -8,6 +8,7 @@ import { useQuery } from "react-query";
 
 import { scanTicket } from "@/lib/backend/ticket/scan";
 import getCustomFieldsFromTicket from "@/util/getCustomFieldsFromTicket";
+import { getSavedScanStation } from "@/util/scanStationStorage";
 
 import Layout from "@/components/Layout";
 import TicketScanInfoTable from "@/components/admin/TicketScanInfoTable";
@@ -20,44 +21,61 @@ enum ScanStatus {
     INVALID_FORMAT,
     LOADING,
     FORBIDDEN,
+    NO_STATION,
 }
 
+const noStationError = new Error("no scan station chosen");
+
 export default function TicketScanningPage() {
     const router = useRouter();
     const [scanStatus, setScanStatus] = useState<ScanStatus>(ScanStatus.LOADING);
 
-    const { data: scanData } = useQuery("frasertix-scan-ticket", () => scanTicket(router.query.id as string), {
-        enabled: router.isReady,
-        retry: (failureCount, error: any | undefined) => {
-            if (error?.response?.status === 400) {
-                setScanStatus(ScanStatus.INVALID_FORMAT);
-                return false;
-            } else if (error?.response?.status === 404) {
-                setScanStatus(ScanStatus.DOES_NOT_EXIST);
-                return false;
-            } else if (error?.response?.status === 403 || error?.response?.status === 401) {
-                setScanStatus(ScanStatus.FORBIDDEN);
-                return false;
+    const { data: scanData } = useQuery(
+        "frasertix-scan-ticket",
+        () => {
+            // Every scan has to say which door it's from, so they need to pick one on the scanner page first
+            const station = getSavedScanStation();
+            if (station === null) {
+                setScanStatus(ScanStatus.NO_STATION);
+                return Promise.reject(noStationError);
             }
-
-            return failureCount < 3;
+            return scanTicket(router.query.payload as string, station.id);
         },
-        onSuccess: (data) => {
-            console.log(data);
-            if (!data.processed && data.noProcessReason === "max scan count exceeded") {
-                setScanStatus(ScanStatus.MAX_SCAN_COUNT_REACHED);
-            } else if (data.processed) {
-                setScanStatus(ScanStatus.SUCCESS);
-            } else {
-                alert("Something seems to have gone wrong. Try refreshing your page.");
-            }
+        {
+            enabled: router.isReady,
+            retry: (failureCount, error: any | undefined) => {
+                if (error === noStationError) {
+                    return false;
+                } else if (error?.response?.status === 400) {
+                    setScanStatus(ScanStatus.INVALID_FORMAT);
+                    return false;
+                } else if (error?.response?.status === 404) {
+                    setScanStatus(ScanStatus.DOES_NOT_EXIST);
+                    return false;
+                } else if (error?.response?.status === 403 || error?.response?.status === 401) {
+                    setScanStatus(ScanStatus.FORBIDDEN);
+                    return false;
+                }
+
+                return failureCount < 3;
+            },
+            onSuccess: (data) => {
+                console.log(data);
+                if (!data.processed && data.noProcessReason === "max scan count exceeded") {
+                    setScanStatus(ScanStatus.MAX_SCAN_COUNT_REACHED);
+                } else if (data.processed) {
+                    setScanStatus(ScanStatus.SUCCESS);
+                } else {
+                    alert("Something seems to have gone wrong. Try refreshing your page.");
+                }
+            },
+            // Scanning the ticket changes stuff in the database that we don't want happening multiple times
+            // because the window got refreshed.
+            refetchOnMount: false,
+            refetchOnReconnect: false,
+            refetchOnWindowFocus: false,
         },
-        // Scanning the ticket changes stuff in the database that we don't want happening multiple times
-        // because the window got refreshed.
-        refetchOnMount: false,
-        refetchOnReconnect: false,
-        refetchOnWindowFocus: false,
-    });
+    );
 
     const innerComponent = (() => {
         switch (scanStatus) {
@@ -210,6 +228,34 @@ export default function TicketScanningPage() {
                     </div>
                 );
             }
+            case ScanStatus.NO_STATION: {
+                return (
+                    <div className="flex flex-col items-center">
+                        <Typography
+                            variant="h2"
+                            className="text-center text-red-500"
+                        >
+                            No Scan Station Chosen
+                        </Typography>
+                        <Typography
+                            variant="lead"
+                            className="text-center lg:w-1/2"
+                        >
+                            Choose the event and scan station you&apos;re scanning at on the scanner page, then scan
+                            the ticket again.
+                        </Typography>
+
+                        <div className="flex flex-wrap gap-2 mt-2 items-center justify-center">
+                            <Link
+                                className="py-2 px-4 bg-teal-500 text-md font-semibold rounded-lg hover:bg-teal-800 duration-75 text-white"
+                                href="/admin/scan"
+                            >
+                                Choose Scan Station
+                            </Link>
+                        </div>
+                    </div>
+                );
+            }
             case ScanStatus.FORBIDDEN: {
                 return <ForbiddenComponent />;
             }
@@ -6,8 +6,12 @@ import { useRouter } from "next/router";
 import { Button, Typography } from "@material-tailwind/react";
 import { BrowserCodeReader, BrowserQRCodeReader, IScannerControls } from "@zxing/browser";
 
+import hasStaffRole from "@/lib/auth/hasStaffRole";
+import { SavedScanStation, getSavedScanStation, saveScanStation } from "@/util/scanStationStorage";
+
 import { useFirebaseAuth } from "@/components/FirebaseAuthContext";
 import Layout from "@/components/Layout";
+import ScanStationPicker from "@/components/admin/ScanStationPicker";
 
 enum ScanStatus {
     SUCCESS,
@@ -27,6 +31,11 @@ export default function TicketScanningPage() {
     const [videoControls, setVideoControls] = useState<IScannerControls>();
     const [qrCodeResult, setQRCodeResult] = useState<string>();
     const [scanStatus, setScanStatus] = useState<ScanStatus>(ScanStatus.SCANNER_LOADING);
+    const [station, setStation] = useState<SavedScanStation | null>(null);
+
+    useEffect(() => {
+        setStation(getSavedScanStation());
+    }, []);
 
     useEffect(() => {
         if (
@@ -37,7 +46,7 @@ export default function TicketScanningPage() {
             (async () => {
                 // Need to check this here so we don't start scanning for QR codes if they're unauthorized
                 const token = await user.getIdTokenResult();
-                if (!token.claims.admin) {
+                if (!hasStaffRole(token.claims)) {
                     router.push("/403");
                 }
 
@@ -93,8 +102,8 @@ export default function TicketScanningPage() {
     useEffect(() => {
         (async () => {
             if (qrCodeResult !== undefined) {
-                const ticketId = qrCodeResult.replace("https://tickets.johnfrasersac.com/admin/scan/", "");
-                router.push(`/admin/scan/${ticketId}`);
+                // QR codes hold the signed payload, which gets sent to the backend as-is
+                router.push(`/admin/scan/${encodeURIComponent(qrCodeResult)}`);
 
                 videoControls?.stop();
             }
@@ -187,6 +196,14 @@ export default function TicketScanningPage() {
                 Ticket Scanner
             </Typography>
 
+            <ScanStationPicker
+                station={station}
+                onChange={(newStation) => {
+                    saveScanStation(newStation);
+                    setStation(newStation);
+                }}
+            />
+
             {innerComponent}
 
             <div className="flex flex-col items-center self-center">
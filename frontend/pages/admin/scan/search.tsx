@@ -8,7 +8,7 @@ import { Button, Typography } from "@material-tailwind/react";
 import { useMutation, useQuery } from "react-query";
 
 import { getAllEvents } from "@/lib/backend/event";
-import { searchForTicket } from "@/lib/backend/ticket";
+import { getTicketQR, searchForTicket } from "@/lib/backend/ticket";
 
 import Layout from "@/components/Layout";
 import TicketInfoTable from "@/components/user/TicketInfoTable";
@@ -95,8 +95,10 @@ export default function TicketSearchAndScanPage() {
                     color="green"
                     size="md"
                     className="mt-4 mb-6"
-                    onClick={() => {
-                        router.push(`/admin/scan/${ticketSearchMutation.data?.id}`);
+                    onClick={async () => {
+                        // Scans need the signed QR payload, not just the ticket ID
+                        const payload = await getTicketQR(ticketSearchMutation.data!.id);
+                        router.push(`/admin/scan/${encodeURIComponent(payload)}`);
                     }}
                 >
                     Scan
@@ -6,7 +6,7 @@ import { Typography } from "@material-tailwind/react";
 import QRCode from "react-qr-code";
 import { useQuery } from "react-query";
 
-import { getTicket } from "@/lib/backend/ticket";
+import { getTicket, getTicketQR } from "@/lib/backend/ticket";
 
 import Layout from "@/components/Layout";
 import TicketInfoTable from "@/components/user/TicketInfoTable";
@@ -46,6 +46,13 @@ export default function TicketSpecificPage() {
         refetchInterval: (data, query) => (query.state.error ? 0 : 60 * 1000),
     });
 
+    // QR codes are signed by the backend so they can't be made up, and get refreshed along with the ticket
+    const { data: qrPayload } = useQuery("frasertix-ticket-qr", () => getTicketQR(id as string), {
+        enabled: router.isReady && data !== undefined,
+        retry: false,
+        refetchInterval: (data, query) => (query.state.error ? 0 : 60 * 1000),
+    });
+
     const isLoading = !router.isReady || rqLoading;
     const pageName = !isLoading ? (data?.eventData.name as string) : "Ticket";
 
@@ -114,9 +121,11 @@ export default function TicketSpecificPage() {
                         for later use or keep this page open to present when necessary.
                     </Typography>
 
-                    <div style={{ background: "white", padding: "16px" }}>
-                        <QRCode value={`https://tickets.johnfrasersac.com/admin/scan/${data?.id}` || ""} />
-                    </div>
+                    {qrPayload && (
+                        <div style={{ background: "white", padding: "16px" }}>
+                            <QRCode value={qrPayload} />
+                        </div>
+                    )}
                 </div>
             )}
         </Layout>
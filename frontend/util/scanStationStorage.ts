@@ -0,0 +1,31 @@
+// The station a device scans from is kept between scans (and page loads) so scanners only pick it once
+const scanStationStorageKey = "frasertix-scan-station";
+
+type SavedScanStation = {
+    id: string;
+    name: string;
+};
+
+function getSavedScanStation() {
+    if (typeof window === "undefined") {
+        return null;
+    }
+
+    const rawStation = window.localStorage.getItem(scanStationStorageKey);
+    if (rawStation === null) {
+        return null;
+    }
+
+    try {
+        return JSON.parse(rawStation) as SavedScanStation;
+    } catch (e) {
+        return null;
+    }
+}
+
+function saveScanStation(station: SavedScanStation) {
+    window.localStorage.setItem(scanStationStorageKey, JSON.stringify(station));
+}
+
+export type { SavedScanStation };
+export { getSavedScanStation, saveScanStation };